@@ -38,6 +38,14 @@ type HorizontalRunnerAutoscalerSpec struct {
 	// +optional
 	ScaleDownDelaySecondsAfterScaleUp *int `json:"scaleDownDelaySecondsAfterScaleOut,omitempty"`
 
+	// MinIdleSecondsBeforeScaleToZero is the minimum duration in seconds all the runners need to be seen idle on GitHub
+	// before the scale target is scaled down to zero replicas.
+	// Regardless of this, the scale target is never scaled down to zero while any of its runners is busy running a job,
+	// so that e.g. a job the webhook-based autoscaler has just woken the scale target up for isn't disrupted.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinIdleSecondsBeforeScaleToZero *int `json:"minIdleSecondsBeforeScaleToZero,omitempty"`
+
 	// Metrics is the collection of various metric targets to calculate desired number of runners
 	// +optional
 	Metrics []MetricSpec `json:"metrics,omitempty"`
@@ -212,6 +220,12 @@ type HorizontalRunnerAutoscalerStatus struct {
 	// +nullable
 	LastSuccessfulScaleOutTime *metav1.Time `json:"lastSuccessfulScaleOutTime,omitempty"`
 
+	// IdleSince is the time since when all the runners have been seen idle while scaling the target down to zero is postponed
+	// for MinIdleSecondsBeforeScaleToZero.
+	// +optional
+	// +nullable
+	IdleSince *metav1.Time `json:"idleSince,omitempty"`
+
 	// +optional
 	CacheEntries []CacheEntry `json:"cacheEntries,omitempty"`
 
@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 
@@ -25,6 +27,47 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ReusePolicyRecreate replaces the runner pod of a stopped runner with a new one.
+	ReusePolicyRecreate = "Recreate"
+
+	// ReusePolicyReuse restarts the stopped runner in the same runner pod.
+	ReusePolicyReuse = "Reuse"
+)
+
+const (
+	// RunnerTerminationReasonUnregisteredAndDeleted means that the runner was unregistered from GitHub, or had already been gone,
+	// and its runner pod was deleted.
+	RunnerTerminationReasonUnregisteredAndDeleted = "UnregisteredAndDeleted"
+
+	// RunnerTerminationReasonTimedOutAndForceDeleted means that the runner couldn't be unregistered in time
+	// and its runner pod was deleted anyway.
+	RunnerTerminationReasonTimedOutAndForceDeleted = "TimedOutAndForceDeleted"
+
+	// RunnerTerminationReasonCrashedAndDeleted means that the runner container had stopped or kept crashing
+	// before the runner could be unregistered, and its runner pod was deleted.
+	RunnerTerminationReasonCrashedAndDeleted = "CrashedAndDeleted"
+)
+
+// RunnerUnregistrationPhase is the phase of the unregistration of a runner from GitHub.
+type RunnerUnregistrationPhase string
+
+const (
+	// RunnerUnregistrationPhaseNotStarted means that the controller hasn't started unregistering the runner,
+	// or has cancelled the unregistration, like because the runner turned out to be busy running a job.
+	RunnerUnregistrationPhaseNotStarted RunnerUnregistrationPhase = "NotStarted"
+
+	// RunnerUnregistrationPhaseInProgress means that the controller is unregistering the runner.
+	RunnerUnregistrationPhaseInProgress RunnerUnregistrationPhase = "InProgress"
+
+	// RunnerUnregistrationPhaseCompleted means that the runner has been unregistered, or the runner pod is otherwise safe to delete.
+	RunnerUnregistrationPhaseCompleted RunnerUnregistrationPhase = "Completed"
+
+	// RunnerUnregistrationPhaseTimedOut means that the runner couldn't be unregistered within the unregistration timeout,
+	// so the runner pod is deleted anyway.
+	RunnerUnregistrationPhaseTimedOut RunnerUnregistrationPhase = "TimedOut"
+)
+
 // RunnerSpec defines the desired state of Runner
 type RunnerSpec struct {
 	RunnerConfig  `json:",inline"`
@@ -53,6 +96,34 @@ type RunnerConfig struct {
 	// +optional
 	Ephemeral *bool `json:"ephemeral,omitempty"`
 
+	// ReusePolicy is what happens to the runner pod of a non-ephemeral runner once its runner container stops, like after a job.
+	// "Recreate", the default, replaces the runner pod with a new one.
+	// "Reuse" restarts the runner container in the same runner pod, with the existing registration,
+	// so that e.g. the Docker layer cache of the runner pod is kept warm.
+	// Either way, the runner is gracefully stopped and the runner pod is deleted on scale down.
+	// Ephemeral runners ignore this.
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=Recreate;Reuse
+	ReusePolicy string `json:"reusePolicy,omitempty"`
+
+	// SkipUnregistrationForEphemeral makes the controller delete the runner pod of an ephemeral runner as soon as it has stopped,
+	// without calling GitHub API to unregister the runner, trusting that GitHub removes an ephemeral runner after its job by itself.
+	// This saves GitHub API calls for pure ephemeral runner pools.
+	// A runner that stopped before running a job can be left registered, which --collect-orphaned-runners cleans up eventually.
+	// Non-ephemeral runners ignore this.
+	//
+	// +optional
+	SkipUnregistrationForEphemeral bool `json:"skipUnregistrationForEphemeral,omitempty"`
+
+	// NameRemap is the list of rules to rename the runner pod name into the runner name to look for on GitHub,
+	// for when the runners got renamed on GitHub, like on an organization migration, while the runner pods still carry the old names.
+	// The controller looks for the runner by the remapped name only when no runner has the runner pod name,
+	// so that it can still find and unregister the renamed runner. The first rule that matches the name wins.
+	//
+	// +optional
+	NameRemap []RunnerNameRemapRule `json:"nameRemap,omitempty"`
+
 	// +optional
 	Image string `json:"image"`
 
@@ -156,6 +227,40 @@ type RunnerPodSpec struct {
 	DnsConfig []corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
 }
 
+// RunnerNameRemapRule is a rule to rename the runner pod name into the runner name to look for on GitHub.
+// Either Prefix or Regex must be specified.
+type RunnerNameRemapRule struct {
+	// Prefix is the prefix of the runner pod name to be replaced with Replacement.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Regex is the regular expression the runner pod name is matched against.
+	// The matches are replaced with Replacement, which can refer to the submatches like $1.
+	// +optional
+	Regex string `json:"regex,omitempty"`
+
+	// Replacement is the string that replaces Prefix or the matches of Regex.
+	// +optional
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// ValidateNameRemap validates nameRemap field.
+func (rs *RunnerSpec) ValidateNameRemap() error {
+	for i, rule := range rs.NameRemap {
+		if (rule.Prefix == "") == (rule.Regex == "") {
+			return fmt.Errorf("nameRemap[%d] needs either prefix or regex", i)
+		}
+
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return fmt.Errorf("nameRemap[%d] has an invalid regex: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // ValidateRepository validates repository field.
 func (rs *RunnerSpec) ValidateRepository() error {
 	// Enterprise, Organization and repository are both exclusive.
@@ -192,6 +297,61 @@ type RunnerStatus struct {
 	// +optional
 	// +nullable
 	LastRegistrationCheckTime *metav1.Time `json:"lastRegistrationCheckTime,omitempty"`
+	// RegisteredLabels is the labels the runner has actually registered with, as seen on GitHub.
+	// It can differ from the labels in the spec, and is what GitHub uses to route workflow jobs to the runner.
+	// +optional
+	RegisteredLabels []string `json:"registeredLabels,omitempty"`
+	// GitHubStatus is the status of the runner as seen on GitHub, either "online" or "offline",
+	// as of the last time the controller fetched the runner from GitHub.
+	// +optional
+	GitHubStatus string `json:"githubStatus,omitempty"`
+	// Busy is true when GitHub considered the runner to be running a job,
+	// as of the last time the controller fetched the runner from GitHub.
+	// +optional
+	Busy bool `json:"busy,omitempty"`
+	// RunnerID is the ID of the runner on GitHub, as of the last time the controller fetched the runner from GitHub.
+	// +optional
+	RunnerID int64 `json:"runnerID,omitempty"`
+	// TerminationReason tells why the controller deleted the runner pod after the graceful stop,
+	// either UnregisteredAndDeleted, TimedOutAndForceDeleted, or CrashedAndDeleted.
+	// It's written before the runner pod is deleted, so that it's visible even after the runner pod is gone.
+	// +optional
+	TerminationReason string `json:"terminationReason,omitempty"`
+	// UnregistrationStartTime is the time the controller started unregistering the runner from GitHub.
+	// Along with RunnerID, this lets the controller resume an unregistration still in progress when the runner pod lost its annotations.
+	// It's reset whenever the controller creates a new runner pod for the runner.
+	// +optional
+	// +nullable
+	UnregistrationStartTime *metav1.Time `json:"unregistrationStartTime,omitempty"`
+	// UnregistrationCompleteTime is the time the controller completed unregistering the runner from GitHub.
+	// +optional
+	// +nullable
+	UnregistrationCompleteTime *metav1.Time `json:"unregistrationCompleteTime,omitempty"`
+	// UnregistrationStatus is the structured state of the unregistration of the runner from GitHub,
+	// derived from what the controller records onto the runner pod while unregistering the runner.
+	// +optional
+	UnregistrationStatus *RunnerUnregistrationStatus `json:"unregistrationStatus,omitempty"`
+}
+
+// RunnerUnregistrationStatus is the state of the unregistration of a runner from GitHub.
+type RunnerUnregistrationStatus struct {
+	// Phase is either NotStarted, InProgress, Completed, or TimedOut.
+	// +optional
+	Phase RunnerUnregistrationPhase `json:"phase,omitempty"`
+	// StartedAt is the time the controller started unregistering the runner.
+	// +optional
+	// +nullable
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+	// CompletedAt is the time the unregistration completed or timed out.
+	// +optional
+	// +nullable
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+	// LastError is the time and the message of the last error the controller encountered while unregistering the runner.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// Attempts is the number of failed unregistration attempts.
+	// +optional
+	Attempts int `json:"attempts,omitempty"`
 }
 
 // RunnerStatusRegistration contains runner registration status
@@ -211,6 +371,8 @@ type RunnerStatusRegistration struct {
 // +kubebuilder:printcolumn:JSONPath=".spec.repository",name=Repository,type=string
 // +kubebuilder:printcolumn:JSONPath=".spec.labels",name=Labels,type=string
 // +kubebuilder:printcolumn:JSONPath=".status.phase",name=Status,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.githubStatus",name=GitHub,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.busy",name=Busy,type=boolean
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Runner is the Schema for the runners API
@@ -76,6 +76,11 @@ func (r *Runner) Validate() error {
 		errList = append(errList, field.Invalid(field.NewPath("spec", "repository"), r.Spec.Repository, err.Error()))
 	}
 
+	err = r.Spec.ValidateNameRemap()
+	if err != nil {
+		errList = append(errList, field.Invalid(field.NewPath("spec", "nameRemap"), r.Spec.NameRemap, err.Error()))
+	}
+
 	if len(errList) > 0 {
 		return apierrors.NewInvalid(r.GroupVersionKind().GroupKind(), r.Name, errList)
 	}
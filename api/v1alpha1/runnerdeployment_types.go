@@ -39,6 +39,15 @@ type RunnerDeploymentSpec struct {
 	// +nullable
 	EffectiveTime *metav1.Time `json:"effectiveTime"`
 
+	// MinRunnerLifetimeSeconds is the minimum duration in seconds a runner needs to live before it's gracefully stopped on scale down.
+	// This prevents expensive runners from being repeatedly created and deleted when the autoscaler oscillates.
+	// Ephemeral runners that have completed their jobs are deleted regardless of this.
+	// The value is inherited to RunnerReplicaSet(s).
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinRunnerLifetimeSeconds *int `json:"minRunnerLifetimeSeconds,omitempty"`
+
 	// +optional
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector"`
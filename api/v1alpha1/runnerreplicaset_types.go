@@ -35,6 +35,13 @@ type RunnerReplicaSetSpec struct {
 	// +nullable
 	EffectiveTime *metav1.Time `json:"effectiveTime"`
 
+	// MinRunnerLifetimeSeconds is the minimum duration in seconds a runner needs to live before it's gracefully stopped on scale down.
+	// It is usually populated by the RunnerDeployment.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinRunnerLifetimeSeconds *int `json:"minRunnerLifetimeSeconds,omitempty"`
+
 	// +optional
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector"`
@@ -198,6 +198,11 @@ func (in *HorizontalRunnerAutoscalerSpec) DeepCopyInto(out *HorizontalRunnerAuto
 		*out = new(int)
 		**out = **in
 	}
+	if in.MinIdleSecondsBeforeScaleToZero != nil {
+		in, out := &in.MinIdleSecondsBeforeScaleToZero, &out.MinIdleSecondsBeforeScaleToZero
+		*out = new(int)
+		**out = **in
+	}
 	if in.Metrics != nil {
 		in, out := &in.Metrics, &out.Metrics
 		*out = make([]MetricSpec, len(*in))
@@ -250,6 +255,10 @@ func (in *HorizontalRunnerAutoscalerStatus) DeepCopyInto(out *HorizontalRunnerAu
 		in, out := &in.LastSuccessfulScaleOutTime, &out.LastSuccessfulScaleOutTime
 		*out = (*in).DeepCopy()
 	}
+	if in.IdleSince != nil {
+		in, out := &in.IdleSince, &out.IdleSince
+		*out = (*in).DeepCopy()
+	}
 	if in.CacheEntries != nil {
 		in, out := &in.CacheEntries, &out.CacheEntries
 		*out = make([]CacheEntry, len(*in))
@@ -390,6 +399,11 @@ func (in *RunnerConfig) DeepCopyInto(out *RunnerConfig) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.NameRemap != nil {
+		in, out := &in.NameRemap, &out.NameRemap
+		*out = make([]RunnerNameRemapRule, len(*in))
+		copy(*out, *in)
+	}
 	if in.DockerdWithinRunnerContainer != nil {
 		in, out := &in.DockerdWithinRunnerContainer, &out.DockerdWithinRunnerContainer
 		*out = new(bool)
@@ -503,6 +517,11 @@ func (in *RunnerDeploymentSpec) DeepCopyInto(out *RunnerDeploymentSpec) {
 		in, out := &in.EffectiveTime, &out.EffectiveTime
 		*out = (*in).DeepCopy()
 	}
+	if in.MinRunnerLifetimeSeconds != nil {
+		in, out := &in.MinRunnerLifetimeSeconds, &out.MinRunnerLifetimeSeconds
+		*out = new(int)
+		**out = **in
+	}
 	if in.Selector != nil {
 		in, out := &in.Selector, &out.Selector
 		*out = new(metav1.LabelSelector)
@@ -593,6 +612,21 @@ func (in *RunnerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerNameRemapRule) DeepCopyInto(out *RunnerNameRemapRule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerNameRemapRule.
+func (in *RunnerNameRemapRule) DeepCopy() *RunnerNameRemapRule {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerNameRemapRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RunnerPodSpec) DeepCopyInto(out *RunnerPodSpec) {
 	*out = *in
@@ -821,6 +855,11 @@ func (in *RunnerReplicaSetSpec) DeepCopyInto(out *RunnerReplicaSetSpec) {
 		in, out := &in.EffectiveTime, &out.EffectiveTime
 		*out = (*in).DeepCopy()
 	}
+	if in.MinRunnerLifetimeSeconds != nil {
+		in, out := &in.MinRunnerLifetimeSeconds, &out.MinRunnerLifetimeSeconds
+		*out = new(int)
+		**out = **in
+	}
 	if in.Selector != nil {
 		in, out := &in.Selector, &out.Selector
 		*out = new(metav1.LabelSelector)
@@ -1014,6 +1053,24 @@ func (in *RunnerStatus) DeepCopyInto(out *RunnerStatus) {
 		in, out := &in.LastRegistrationCheckTime, &out.LastRegistrationCheckTime
 		*out = (*in).DeepCopy()
 	}
+	if in.RegisteredLabels != nil {
+		in, out := &in.RegisteredLabels, &out.RegisteredLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnregistrationStartTime != nil {
+		in, out := &in.UnregistrationStartTime, &out.UnregistrationStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UnregistrationCompleteTime != nil {
+		in, out := &in.UnregistrationCompleteTime, &out.UnregistrationCompleteTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UnregistrationStatus != nil {
+		in, out := &in.UnregistrationStatus, &out.UnregistrationStatus
+		*out = new(RunnerUnregistrationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerStatus.
@@ -1064,6 +1121,29 @@ func (in *RunnerTemplate) DeepCopy() *RunnerTemplate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerUnregistrationStatus) DeepCopyInto(out *RunnerUnregistrationStatus) {
+	*out = *in
+	if in.StartedAt != nil {
+		in, out := &in.StartedAt, &out.StartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletedAt != nil {
+		in, out := &in.CompletedAt, &out.CompletedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerUnregistrationStatus.
+func (in *RunnerUnregistrationStatus) DeepCopy() *RunnerUnregistrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerUnregistrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScaleTargetRef) DeepCopyInto(out *ScaleTargetRef) {
 	*out = *in
@@ -73,6 +73,10 @@ func main() {
 		syncPeriod           time.Duration
 		logLevel             string
 
+		gracefulStopRunnerOnJobCompletion bool
+		annotationKeyPrefix               string
+		recordJobTimeout                  bool
+
 		ghClient *github.Client
 	)
 
@@ -92,6 +96,9 @@ func main() {
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Minute, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled. When you use autoscaling, set to a lower value like 10 minute, because this corresponds to the minimum time to react on demand change")
 	flag.StringVar(&logLevel, "log-level", logging.LogLevelDebug, `The verbosity of the logging. Valid values are "debug", "info", "warn", "error". Defaults to "debug".`)
+	flag.BoolVar(&gracefulStopRunnerOnJobCompletion, "graceful-stop-runner-on-job-completion", false, "Trigger the graceful stop of the runner that ran the job on each workflow_job completed event. Only ephemeral runners are stopped, as persistent runners would otherwise be unregistered after every job.")
+	flag.BoolVar(&recordJobTimeout, "record-job-timeout", false, "Record the timeout of each in-progress workflow job onto its runner pod, so that the controller neither unregisters the runner nor times out its unregistration before the job would time out on its own. GitHub doesn't send the job timeout in workflow_job events, so this requires a proxy in front of the webhook server that adds timeout_minutes to the workflow_job in the payload. Without such a proxy this has no effect")
+	flag.StringVar(&annotationKeyPrefix, "annotation-key-prefix", controllers.DefaultAnnotationKeyPrefix, "The prefix of the annotation keys used to record the state of runner pods. Must end with a slash. Set the same value as the --annotation-key-prefix of the controller that manages the runner pods, so that the graceful stops triggered on job completions are picked up by that controller")
 	flag.StringVar(&webhookSecretToken, "github-webhook-secret-token", "", "The personal access token of GitHub.")
 	flag.StringVar(&c.Token, "github-token", c.Token, "The personal access token of GitHub.")
 	flag.Int64Var(&c.AppID, "github-app-id", c.AppID, "The application ID of GitHub App.")
@@ -105,6 +112,12 @@ func main() {
 
 	flag.Parse()
 
+	if err := controllers.ValidateAnnotationKeyPrefix(annotationKeyPrefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --annotation-key-prefix: %v\n", err)
+		os.Exit(1)
+	}
+	controllers.SetAnnotationKeyPrefix(annotationKeyPrefix)
+
 	if webhookSecretToken == "" && webhookSecretTokenEnv != "" {
 		setupLog.Info(fmt.Sprintf("Using the value from %s for -github-webhook-secret-token", webhookSecretTokenEnvName))
 		webhookSecretToken = webhookSecretTokenEnv
@@ -164,6 +177,9 @@ func main() {
 		SecretKeyBytes: []byte(webhookSecretToken),
 		Namespace:      watchNamespace,
 		GitHubClient:   ghClient,
+
+		GracefulStopRunnerOnJobCompletion: gracefulStopRunnerOnJobCompletion,
+		RecordJobTimeout:                  recordJobTimeout,
 	}
 
 	if err = hraGitHubWebhook.SetupWithManager(mgr); err != nil {
@@ -3,9 +3,11 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
@@ -518,3 +520,109 @@ func TestDetermineDesiredReplicas_OrganizationalRunner(t *testing.T) {
 		})
 	}
 }
+
+func TestHoldScaleToZero(t *testing.T) {
+	intPtr := func(v int) *int {
+		return &v
+	}
+
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tenMinutesAgo := metav1.NewTime(now.Add(-10 * time.Minute))
+
+	testcases := []struct {
+		name          string
+		busy          bool
+		desired       int
+		minIdle       *int
+		idleSince     *metav1.Time
+		want          int
+		wantIdleSince *metav1.Time
+	}{
+		{
+			name:    "not scaling to zero",
+			desired: 1,
+			want:    1,
+		},
+		{
+			name: "idle",
+			want: 0,
+		},
+		{
+			name: "busy",
+			busy: true,
+			want: 2,
+		},
+		{
+			name:          "idle but not long enough",
+			minIdle:       intPtr(300),
+			want:          2,
+			wantIdleSince: &metav1.Time{Time: now},
+		},
+		{
+			name:      "idle long enough",
+			minIdle:   intPtr(300),
+			idleSince: &tenMinutesAgo,
+			want:      0,
+		},
+		{
+			name:      "busy again after being idle",
+			busy:      true,
+			minIdle:   intPtr(300),
+			idleSince: &tenMinutesAgo,
+			want:      2,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{"total_count": 1, "runners": [{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": %t}]}`, tc.busy)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			h := &HorizontalRunnerAutoscalerReconciler{
+				Log:          log,
+				GitHubClient: newGithubClient(server),
+			}
+
+			st := scaleTarget{
+				st:       "testrd",
+				kind:     "runnerdeployment",
+				repo:     "test/valid",
+				replicas: intPtr(2),
+				getRunnerMap: func() (map[string]struct{}, error) {
+					return map[string]struct{}{"test1": {}}, nil
+				},
+			}
+
+			hra := v1alpha1.HorizontalRunnerAutoscaler{
+				Spec: v1alpha1.HorizontalRunnerAutoscalerSpec{
+					MinIdleSecondsBeforeScaleToZero: tc.minIdle,
+				},
+				Status: v1alpha1.HorizontalRunnerAutoscalerStatus{
+					IdleSince: tc.idleSince,
+				},
+			}
+
+			got, idleSince, err := h.holdScaleToZero(context.Background(), log, now, st, hra, tc.desired)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("incorrect desired replicas: want %d, got %d", tc.want, got)
+			}
+
+			if !idleSince.Equal(tc.wantIdleSince) {
+				t.Errorf("incorrect idle since: want %v, got %v", tc.wantIdleSince, idleSince)
+			}
+		})
+	}
+}
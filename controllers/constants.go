@@ -1,6 +1,12 @@
 package controllers
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
 
 const (
 	LabelKeyRunnerSetName = "runnerset-name"
@@ -11,24 +17,84 @@ const (
 	// See https://github.com/google/knative-gcp/issues/378
 	runnerPodFinalizerName = "actions.summerwind.dev/runner-pod"
 
-	annotationKeyPrefix = "actions-runner/"
+	// DefaultAnnotationKeyPrefix is the default prefix of the annotation keys ARC uses to record the state of runner pods.
+	// See SetAnnotationKeyPrefix for how to change it.
+	DefaultAnnotationKeyPrefix = "actions-runner/"
 
-	AnnotationKeyLastRegistrationCheckTime = "actions-runner-controller/last-registration-check-time"
+	// AnnotationKeyUnregistrationTimeout is the annotation that can be added onto a runner pod, usually via the pod template of
+	// a RunnerDeployment or a RunnerSet, to override the controller-wide unregistration timeout for the pod.
+	// The value is parsed with time.ParseDuration so that you can write e.g. `30m` or `2h`.
+	AnnotationKeyUnregistrationTimeout = "actions-runner-controller/unregistration-timeout"
 
-	// AnnotationKeyUnregistrationCompleteTimestamp is the annotation that is added onto the pod once the previously started unregistration process has been completed.
-	AnnotationKeyUnregistrationCompleteTimestamp = annotationKeyPrefix + "unregistration-complete-timestamp"
+	// AnnotationKeyPreStopGracePeriod is the annotation that can be added onto a runner pod, usually via the pod template of
+	// a RunnerDeployment or a RunnerSet, to override the controller-wide grace period given to the preStop hook of the runner container.
+	// The value is parsed with time.ParseDuration. It has no effect on a runner container without a preStop hook.
+	AnnotationKeyPreStopGracePeriod = "actions-runner-controller/pre-stop-grace-period"
 
-	// unregistarionStartTimestamp is the annotation that contains the time that the requested unregistration process has been started
-	AnnotationKeyUnregistrationStartTimestamp = annotationKeyPrefix + "unregistration-start-timestamp"
+	// AnnotationKeyRunnerGroupID is the annotation that can be added onto a runner pod to specify the ID of the runner group
+	// the runner belongs to.
+	// When specified, ARC looks up the runner within the runner group, instead of all the runners in the enterprise or the organization.
+	// It has no effect on repository runners, as runner groups are available only to enterprises and organizations.
+	AnnotationKeyRunnerGroupID = "actions-runner-controller/runner-group-id"
 
-	// AnnotationKeyUnregistrationRequestTimestamp is the annotation that contains the time that the unregistration has been requested.
-	// This doesn't immediately start the unregistration. Instead, ARC will first check if the runner has already been registered.
-	// If not, ARC will hold on until the registration to complete first, and only after that it starts the unregistration process.
-	// This is crucial to avoid a race between ARC marking the runner pod for deletion while the actions-runner registers itself to GitHub, leaving the assigned job
-	// hang like forever.
-	AnnotationKeyUnregistrationRequestTimestamp = annotationKeyPrefix + "unregistration-request-timestamp"
+	// AnnotationKeyPauseUnregistration is the annotation that can be added onto a runner pod to pause its unregistration,
+	// so that you can e.g. `kubectl exec` into a stuck runner and investigate without ARC tearing it down.
+	// ARC resumes the unregistration once the annotation is removed. The value is ignored.
+	AnnotationKeyPauseUnregistration = "actions-runner-controller/pause-unregistration"
 
-	AnnotationKeyRunnerID = annotationKeyPrefix + "id"
+	// AnnotationKeySkipUnregistration is the annotation that makes ARC delete the runner pod of an ephemeral runner as soon as it has stopped,
+	// without unregistering the runner from GitHub. The value must be "true".
+	// It's added onto the runner pod on creation for v1alpha1.RunnerConfig.SkipUnregistrationForEphemeral,
+	// but can also be added via the pod template. It has no effect on non-ephemeral runners.
+	AnnotationKeySkipUnregistration = "actions-runner-controller/skip-unregistration"
+
+	// AnnotationKeyProtectedJob is the annotation that the runner sets to "true" onto its own pod while running a protected job,
+	// like a deployment, and removes once the job ends. While it's set, ARC never deletes the runner pod on the unregistration timeout,
+	// and keeps retrying the unregistration instead.
+	AnnotationKeyProtectedJob = "actions-runner-controller/protected-job"
+
+	// AnnotationKeyRunnerNameRemap is the annotation that contains the JSON-encoded v1alpha1.RunnerConfig.NameRemap rules.
+	// It's added onto the runner pod on creation, so that ARC can find the runner renamed on GitHub while unregistering it.
+	AnnotationKeyRunnerNameRemap = "actions-runner-controller/runner-name-remap"
+
+	// AnnotationKeyRunnerContainerName is the annotation that can be added onto a runner pod, usually via the pod template
+	// of a RunnerDeployment or a RunnerSet, to tell ARC which container runs the runner agent when it isn't named "runner".
+	// ARC relies on the container to detect the runner has stopped, read its exit code, and inject the registration token.
+	AnnotationKeyRunnerContainerName = "actions-runner-controller/runner-container-name"
+
+	// AnnotationKeyForceReregister is the annotation that can be added onto a runner pod to make ARC remove the runner from GitHub
+	// and forget everything it recorded about the registration, so that the runner is registered and tracked afresh
+	// without recreating the runner pod. This is useful for e.g. a runner that is seen offline on GitHub while its pod is healthy.
+	// ARC removes the annotation once done. The value is ignored.
+	AnnotationKeyForceReregister = "actions-runner-controller/force-reregister"
+
+	// AnnotationKeyJIT is the annotation that can be added onto a runner pod, usually via the pod template of a RunnerSet,
+	// to make ARC register the runner with a just-in-time configuration instead of a registration token,
+	// so that the runner never holds a long-lived registration token.
+	// The value must be "true".
+	//
+	// A JIT runner is strictly ephemeral. GitHub removes the runner after it ran a job, and the runner can't be configured again,
+	// so the runner pod is never restarted.
+	AnnotationKeyJIT = "actions-runner-controller/jit"
+
+	// AnnotationKeyGitHubEnterpriseURL is the annotation that can be added onto a runner, usually via the runner template of
+	// a RunnerDeployment, to make ARC talk to the GitHub Enterprise Server at the URL instead of the controller-wide GitHub API endpoint
+	// for the runner.
+	// It's useful when you have RunnerDeployments targeting different GHES instances, like during a migration.
+	// The runner is registered and unregistered with the same credential as the controller-wide one.
+	AnnotationKeyGitHubEnterpriseURL = "actions-runner-controller/github-enterprise-url"
+
+	// AnnotationKeyDrainRunnerLabels is the annotation that can be added onto a RunnerDeployment to gracefully stop
+	// all its runners that have every runner label in the comma-separated value, like `gpu,linux`.
+	// The runner labels are the ones the runners have registered with on GitHub, or the ones in the spec when unknown yet.
+	// It's a one-shot request. ARC removes the annotation once it has started the graceful stop of the matching runners.
+	AnnotationKeyDrainRunnerLabels = "actions-runner-controller/drain-runner-labels"
+
+	// AnnotationKeyDrainPodSelector is the annotation that can be added onto a RunnerDeployment to gracefully stop
+	// all its runners whose pods match the label selector in the value, like `node-pool=old`.
+	// When it's used along with AnnotationKeyDrainRunnerLabels, only runners matching both are stopped.
+	// It's a one-shot request as well as AnnotationKeyDrainRunnerLabels.
+	AnnotationKeyDrainPodSelector = "actions-runner-controller/drain-pod-selector"
 
 	// DefaultUnregistrationTimeout is the duration until ARC gives up retrying the combo of ListRunners API (to detect the runner ID by name)
 	// and RemoveRunner API (to actually unregister the runner) calls.
@@ -40,10 +106,66 @@ const (
 	// This can be any value but a larger value can make an unregistration timeout longer than configured in practice.
 	DefaultUnregistrationRetryDelay = 30 * time.Second
 
+	// DefaultUnregistrationProgressLogInterval is the default minimum interval between two logs of the in-progress unregistration
+	// of a runner pod, so that a long drain of many runner pods doesn't flood the controller logs.
+	DefaultUnregistrationProgressLogInterval = 5 * time.Minute
+
+	// DefaultGracefulStopSyncPeriod is the default delay until ARC reconciles a runner pod in graceful stop again
+	// when nothing else requeues it, so that a graceful stop whose progress doesn't fire any Kubernetes event
+	// still reaches its timeouts.
+	DefaultGracefulStopSyncPeriod = 1 * time.Minute
+
+	// DefaultMaxUnregistrationAttempts is the number of failed unregistration attempts after which ARC gives up unregistering the runner
+	// and deletes the runner pod anyway, so that a runner pod that can never be unregistered doesn't pin cluster capacity forever.
+	DefaultMaxUnregistrationAttempts = 20
+
+	// DefaultUnregistrationTimeoutWarningThreshold is the fraction of the unregistration timeout after which ARC warns once
+	// that the unregistration of the runner is approaching the timeout, so that operators can intervene before ARC deletes
+	// the runner pod of a possibly busy runner.
+	DefaultUnregistrationTimeoutWarningThreshold = 0.8
+
+	// maxUnregistrationRetryDelay is the upper bound of the exponentially growing delay between unregistration retries.
+	maxUnregistrationRetryDelay = 5 * time.Minute
+
+	// DefaultRegistrationGracePeriod is the duration since the runner pod creation until ARC considers an unregistered runner
+	// as it will never be registered.
+	// Within the grace period, ARC postpones the unregistration of a runner that isn't seen on GitHub yet,
+	// so that the runner pod isn't deleted while GitHub is about to schedule a workflow job onto the runner.
+	// A longer grace period makes the race less likely, but can delay the deletion of runner pods that will never be registered.
+	DefaultRegistrationGracePeriod = 3 * time.Minute
+
+	// DefaultRegistrationRecheckInterval is the delay until ARC rechecks the registration of a runner that isn't seen on GitHub yet.
+	DefaultRegistrationRecheckInterval = 10 * time.Second
+
+	// DefaultMaxRegistrationWait is the duration since the first registration check of a runner pod after which ARC considers
+	// the runner is genuinely absent on GitHub, rather than GitHub's runner list being eventually consistent, and stops polling for it.
+	DefaultMaxRegistrationWait = 10 * time.Minute
+
+	// DefaultMaxBlockStopDuration is the default hard cap of how long the block-stop pod condition can keep a runner pod
+	// whose unregistration has timed out from being deleted. See RunnerPodReconciler.BlockStopConditionType.
+	DefaultMaxBlockStopDuration = time.Hour
+
+	// DefaultBulkUnregistrationConcurrency is the default maximum number of RemoveRunner calls in flight at once
+	// while unregistering all the runners of a RunnerDeployment being deleted.
+	DefaultBulkUnregistrationConcurrency = 10
+
+	// DefaultGitHubAPITimeout is the timeout of each GitHub API call made during the runner pod registration check and unregistration.
+	// This prevents a slow or unresponsive GitHub API from blocking the reconcilation loop, and the controller shutdown, for too long.
+	DefaultGitHubAPITimeout = 30 * time.Second
+
+	// DefaultWebhookRunnerPodUpdateTimeout is the timeout of finding and annotating the runner pod of a workflow job
+	// while the GitHub webhook server handles a webhook event, so that a slow Kubernetes API doesn't keep the request open for too long.
+	DefaultWebhookRunnerPodUpdateTimeout = 10 * time.Second
+
 	// registrationTimeout is the duration until a pod times out after it becomes Ready and Running.
 	// A pod that is timed out can be terminated if needed.
 	registrationTimeout = 10 * time.Minute
 
+	// crashLoopingRegistrationGracePeriod is the duration since the runner pod creation after which ARC considers
+	// the registration of a runner has failed, when the runner container is crash-looping without the runner ever seen on GitHub.
+	// It's much shorter than the registration grace period, as such a runner will never be registered.
+	crashLoopingRegistrationGracePeriod = 30 * time.Second
+
 	defaultRegistrationCheckInterval = time.Minute
 
 	// DefaultRunnerPodRecreationDelayAfterWebhookScale is the delay until syncing the runners with the desired replicas
@@ -58,3 +180,194 @@ const (
 	// See https://github.com/actions-runner-controller/actions-runner-controller/pull/1180
 	DefaultRunnerPodRecreationDelayAfterWebhookScale = 10 * time.Minute
 )
+
+// DefaultRetryableGitHubStatusCodes is the HTTP status codes of failed RemoveRunner API calls that ARC retries with backoff,
+// as they are usually transient, like a 429 from a proxy in front of GitHub Enterprise Server or a 502 from a load balancer.
+var DefaultRetryableGitHubStatusCodes = []int{429, 500, 502, 503, 504}
+
+// The keys of the annotations that ARC uses to record the state of runner pods.
+// They are derived from the annotation key prefix at runtime. See SetAnnotationKeyPrefix.
+var (
+	annotationKeyPrefix = DefaultAnnotationKeyPrefix
+
+	AnnotationKeyLastRegistrationCheckTime = annotationKeyPrefix + "last-registration-check-time"
+
+	// AnnotationKeyLastUnregistrationError is the annotation that contains the time and the message of the last error
+	// ARC encountered while unregistering the runner. It's updated on every failed unregistration attempt, so that
+	// you can diagnose a stuck runner pod by just looking into the pod.
+	AnnotationKeyLastUnregistrationError = annotationKeyPrefix + "last-unregistration-error"
+
+	// AnnotationKeyUnregistrationCompleteTimestamp is the annotation that is added onto the pod once the previously started unregistration process has been completed.
+	AnnotationKeyUnregistrationCompleteTimestamp = annotationKeyPrefix + "unregistration-complete-timestamp"
+
+	// unregistarionStartTimestamp is the annotation that contains the time that the requested unregistration process has been started
+	AnnotationKeyUnregistrationStartTimestamp = annotationKeyPrefix + "unregistration-start-timestamp"
+
+	// AnnotationKeyUnregistrationRequestTimestamp is the annotation that contains the time that the unregistration has been requested.
+	// This doesn't immediately start the unregistration. Instead, ARC will first check if the runner has already been registered.
+	// If not, ARC will hold on until the registration to complete first, and only after that it starts the unregistration process.
+	// This is crucial to avoid a race between ARC marking the runner pod for deletion while the actions-runner registers itself to GitHub, leaving the assigned job
+	// hang like forever.
+	AnnotationKeyUnregistrationRequestTimestamp = annotationKeyPrefix + "unregistration-request-timestamp"
+
+	AnnotationKeyRunnerID = annotationKeyPrefix + "id"
+
+	// AnnotationKeyRunnerIDPodUID is the annotation that contains the UID of the pod for which ARC recorded the runner ID annotation.
+	// ARC uses the runner ID annotation only when this matches the pod UID, so that a runner ID captured for another pod,
+	// e.g. a previous incarnation of the ephemeral runner pod with the same name, never results in unregistering a wrong runner.
+	AnnotationKeyRunnerIDPodUID = annotationKeyPrefix + "id-pod-uid"
+
+	// AnnotationKeyUnregistrationRetryCount is the annotation that contains the number of times ARC has retried the unregistration
+	// while the runner was still busy or not yet unregistered.
+	// It's used to exponentially back off the unregistration retries so that a runner draining a long job doesn't hammer GitHub API.
+	AnnotationKeyUnregistrationRetryCount = annotationKeyPrefix + "unregistration-retry-count"
+
+	// AnnotationKeyUnregistrationRetryReason is the annotation that contains the reason the unregistration retry count was accumulated for.
+	// The count restarts from zero when ARC retries for another reason, so that e.g. a runner that was busy for a long time
+	// doesn't wait for the maximum retry delay on its first transient GitHub API error.
+	AnnotationKeyUnregistrationRetryReason = annotationKeyPrefix + "unregistration-retry-reason"
+
+	// AnnotationKeyUnregistrationAttempts is the annotation that contains the number of failed unregistration attempts,
+	// excluding ones failed due to GitHub API rate limits or the runner being busy.
+	AnnotationKeyUnregistrationAttempts = annotationKeyPrefix + "unregistration-attempts"
+
+	// AnnotationKeyRegistrationCheckStartTimestamp is the annotation that contains the time ARC first checked the registration of the runner.
+	// It's used to bound the total wait for the runner to show up on GitHub.
+	AnnotationKeyRegistrationCheckStartTimestamp = annotationKeyPrefix + "registration-check-start-timestamp"
+
+	// AnnotationKeyRegistrationCheckAbandonedTimestamp is the annotation that contains the time ARC gave up waiting for the runner to show up on GitHub.
+	// ARC stops polling GitHub for the registration of the runner pod once it's set.
+	AnnotationKeyRegistrationCheckAbandonedTimestamp = annotationKeyPrefix + "registration-check-abandoned-timestamp"
+
+	// AnnotationKeyEphemeral is the annotation that is added onto the runner pod on creation to record whether the runner is ephemeral or not.
+	// ARC uses it to tell an ephemeral runner that has unregistered itself after a job run from a persistent runner that is just missing on GitHub.
+	AnnotationKeyEphemeral = annotationKeyPrefix + "ephemeral"
+
+	// AnnotationKeyJITRunnerID is the annotation that is added onto the runner pod on creation when ARC has generated a JIT configuration
+	// for the runner pod. It contains the ID of the runner GitHub registered for the configuration.
+	AnnotationKeyJITRunnerID = annotationKeyPrefix + "jit-runner-id"
+
+	// AnnotationKeyReuse is the annotation that is added onto the runner pod of a non-ephemeral runner on creation
+	// when the runner pod is reused across runner container restarts. See v1alpha1.ReusePolicyReuse.
+	AnnotationKeyReuse = annotationKeyPrefix + "reuse"
+
+	// AnnotationKeyStoppedTimestamp is the annotation that contains the time ARC first saw the runner pod or container stopped,
+	// which usually means the runner has completed its job.
+	// It's used to measure how long the runner pod lingers until its deletion.
+	AnnotationKeyStoppedTimestamp = annotationKeyPrefix + "stopped-timestamp"
+
+	// AnnotationKeyUnregistrationBranch is the annotation that contains the short code of the decision the last evaluation
+	// of the runner unregistration ended up with, like "in-progress" or "timed-out", so that you can tell where
+	// a runner pod is in the unregistration process with `kubectl get pod -o yaml`.
+	AnnotationKeyUnregistrationBranch = annotationKeyPrefix + "unregistration-branch"
+
+	// AnnotationKeyJobTimeout is the annotation that contains the timeout of the workflow job the runner is running, in Go duration format.
+	// The unregistration timeout of the runner pod is extended to this, and the runner isn't unregistered until it elapses,
+	// so that ARC never removes a runner before its job would time out on its own, even if the busy status GitHub reports is stale.
+	// It's recorded by the GitHub webhook server only when the workflow_job events are enriched with the job timeout by a proxy,
+	// as GitHub doesn't send it. See HorizontalRunnerAutoscalerGitHubWebhook.RecordJobTimeout.
+	AnnotationKeyJobTimeout = annotationKeyPrefix + "job-timeout"
+
+	// AnnotationKeyUnregistrationWarningTimestamp is the annotation that contains the time ARC warned that the unregistration
+	// of the runner is approaching the unregistration timeout. It's used to warn only once per runner pod.
+	AnnotationKeyUnregistrationWarningTimestamp = annotationKeyPrefix + "unregistration-warning-timestamp"
+
+	// AnnotationKeyOfflineTimestamp is the annotation that contains the time ARC first saw the runner offline on GitHub during the graceful stop.
+	// GitHub API doesn't tell when a runner went offline, so this is what the offline grace period counts from.
+	AnnotationKeyOfflineTimestamp = annotationKeyPrefix + "offline-timestamp"
+
+	// AnnotationKeyUnregistrationCancelTimestamp is the annotation that contains the time ARC cancelled the graceful stop
+	// as it found the runner busy running a job. The start timestamp is kept, so that the unregistration timeout keeps counting,
+	// and this is removed once the runner is seen idle again. It's used to emit the cancellation event only once per cancellation.
+	AnnotationKeyUnregistrationCancelTimestamp = annotationKeyPrefix + "unregistration-cancel-timestamp"
+
+	// AnnotationKeyLegacyAnnotationsMigrated is set on a runner pod once the annotations with the default prefix are copied to the changed prefix.
+	// See EnableLegacyAnnotationKeyMigration.
+	AnnotationKeyLegacyAnnotationsMigrated = annotationKeyPrefix + "legacy-annotations-migrated"
+)
+
+// prefixedAnnotationKeySuffixes maps each prefixed annotation key variable to its suffix.
+var prefixedAnnotationKeySuffixes = map[*string]string{
+	&AnnotationKeyLastRegistrationCheckTime:           "last-registration-check-time",
+	&AnnotationKeyLastUnregistrationError:             "last-unregistration-error",
+	&AnnotationKeyUnregistrationCompleteTimestamp:     "unregistration-complete-timestamp",
+	&AnnotationKeyUnregistrationStartTimestamp:        "unregistration-start-timestamp",
+	&AnnotationKeyUnregistrationRequestTimestamp:      "unregistration-request-timestamp",
+	&AnnotationKeyRunnerID:                            "id",
+	&AnnotationKeyRunnerIDPodUID:                      "id-pod-uid",
+	&AnnotationKeyUnregistrationRetryCount:            "unregistration-retry-count",
+	&AnnotationKeyUnregistrationRetryReason:           "unregistration-retry-reason",
+	&AnnotationKeyUnregistrationAttempts:              "unregistration-attempts",
+	&AnnotationKeyRegistrationCheckStartTimestamp:     "registration-check-start-timestamp",
+	&AnnotationKeyRegistrationCheckAbandonedTimestamp: "registration-check-abandoned-timestamp",
+	&AnnotationKeyEphemeral:                           "ephemeral",
+	&AnnotationKeyJITRunnerID:                         "jit-runner-id",
+	&AnnotationKeyReuse:                               "reuse",
+	&AnnotationKeyStoppedTimestamp:                    "stopped-timestamp",
+	&AnnotationKeyUnregistrationBranch:                "unregistration-branch",
+	&AnnotationKeyJobTimeout:                          "job-timeout",
+	&AnnotationKeyUnregistrationWarningTimestamp:      "unregistration-warning-timestamp",
+	&AnnotationKeyOfflineTimestamp:                    "offline-timestamp",
+	&AnnotationKeyUnregistrationCancelTimestamp:       "unregistration-cancel-timestamp",
+	&AnnotationKeyLegacyAnnotationsMigrated:           "legacy-annotations-migrated",
+}
+
+// migrateLegacyAnnotationKeys is true when the annotations with the default prefix are migrated to the changed prefix.
+// See EnableLegacyAnnotationKeyMigration.
+var migrateLegacyAnnotationKeys bool
+
+// formerlyFixedAnnotationKeyPrefix is the prefix the keys in formerlyFixedAnnotationKeys had regardless of the annotation key prefix.
+const formerlyFixedAnnotationKeyPrefix = "actions-runner-controller/"
+
+// formerlyFixedAnnotationKeys is the prefixed annotation keys that used to have formerlyFixedAnnotationKeyPrefix instead of the default prefix.
+var formerlyFixedAnnotationKeys = map[*string]bool{
+	&AnnotationKeyLastRegistrationCheckTime: true,
+	&AnnotationKeyLastUnregistrationError:   true,
+}
+
+// ValidateAnnotationKeyPrefix returns an error when the prefix can't be used as the prefix of annotation keys,
+// which is a DNS subdomain followed by a slash.
+func ValidateAnnotationKeyPrefix(prefix string) error {
+	if !strings.HasSuffix(prefix, "/") || strings.Count(prefix, "/") != 1 {
+		return fmt.Errorf("annotation key prefix must contain exactly one slash at the end: %q", prefix)
+	}
+
+	if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(prefix, "/")); len(errs) > 0 {
+		return fmt.Errorf("annotation key prefix must be a DNS subdomain followed by a slash: %q: %s", prefix, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// SetAnnotationKeyPrefix changes the prefix of the annotation keys ARC uses to record the state of runner pods.
+// This is useful to run multiple controllers, like a canary one alongside the stable one, without their annotations colliding on shared pods.
+// It must be called once on startup, before any controller starts.
+//
+// Annotations with any other prefix are neither read nor removed, so that each controller owns only its own annotations.
+// See EnableLegacyAnnotationKeyMigration to take over the annotations recorded before the prefix change.
+func SetAnnotationKeyPrefix(prefix string) {
+	annotationKeyPrefix = prefix
+
+	for k, suffix := range prefixedAnnotationKeySuffixes {
+		*k = prefix + suffix
+	}
+}
+
+// EnableLegacyAnnotationKeyMigration makes ARC copy the annotations with the default prefix to the changed prefix, once per runner pod,
+// so that runner pods annotated before the prefix change keep working. The annotations with the default prefix are left as-is.
+// Enable it only when no controller with the default prefix manages the same runner pods, as it would otherwise take over the state of that controller.
+// It must be called once on startup, before any controller starts.
+func EnableLegacyAnnotationKeyMigration() {
+	migrateLegacyAnnotationKeys = true
+}
+
+// legacyAnnotationKey returns the key the prefixed annotation key had before the prefix change.
+// That's the key with the default prefix, or formerlyFixedAnnotationKeyPrefix for the keys in formerlyFixedAnnotationKeys.
+func legacyAnnotationKey(key *string) string {
+	prefix := DefaultAnnotationKeyPrefix
+	if formerlyFixedAnnotationKeys[key] {
+		prefix = formerlyFixedAnnotationKeyPrefix
+	}
+
+	return prefix + prefixedAnnotationKeySuffixes[key]
+}
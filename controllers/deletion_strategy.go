@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DeletionStrategyDelete leaves the runner pod to be deleted along with its owner, like a Runner or a StatefulSet.
+	// This is the default.
+	DeletionStrategyDelete = "delete"
+
+	// DeletionStrategyEvict evicts the runner pod, so that its deletion respects PodDisruptionBudgets.
+	DeletionStrategyEvict = "evict"
+
+	// DeletionStrategyCordon cordons the node the runner pod runs on, and then leaves the runner pod to be deleted as DeletionStrategyDelete does.
+	// This is useful to drain nodes of runners one by one, like before replacing the nodes.
+	DeletionStrategyCordon = "cordon"
+
+	// retryDelayOnBlockedEviction is the delay until retrying an eviction blocked by a PodDisruptionBudget.
+	retryDelayOnBlockedEviction = 10 * time.Second
+)
+
+// DeletionStrategy is the teardown step of a runner pod, run once the graceful stop of the runner pod has completed,
+// that is, the runner has been unregistered and the runner pod is safe to delete.
+type DeletionStrategy interface {
+	// TearDown is called on every reconcilation of the runner pod after its graceful stop has completed, until the runner pod is gone,
+	// so it must be idempotent.
+	// It returns a non-nil result to requeue the runner pod, like when the teardown is blocked by a PodDisruptionBudget.
+	TearDown(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*ctrl.Result, error)
+}
+
+// NewDeletionStrategy returns the deletion strategy of the name, one of DeletionStrategyDelete, DeletionStrategyEvict, and DeletionStrategyCordon.
+// clientset is used only by DeletionStrategyEvict, as the controller-runtime client can't create the eviction subresource.
+func NewDeletionStrategy(name string, clientset kubernetes.Interface) (DeletionStrategy, error) {
+	switch name {
+	case "", DeletionStrategyDelete:
+		return deleteStrategy{}, nil
+	case DeletionStrategyEvict:
+		return evictStrategy{clientset: clientset}, nil
+	case DeletionStrategyCordon:
+		return cordonStrategy{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown deletion strategy %q: must be one of %q, %q, and %q", name, DeletionStrategyDelete, DeletionStrategyEvict, DeletionStrategyCordon)
+}
+
+// deleteStrategy doesn't delete the runner pod by itself.
+// The upstream controller, like runnerreplicaset-controller or runnerset-controller, deletes the owner of the runner pod
+// and the runner pod is deleted as a part of the cascade deletion.
+// This prevents the owner from recreating the deleted runner pod, which would start a registration that races with the owner deletion.
+type deleteStrategy struct{}
+
+func (deleteStrategy) TearDown(_ context.Context, _ client.Client, log logr.Logger, _ *corev1.Pod) (*ctrl.Result, error) {
+	log.V(2).Info("Leaving the runner pod to be deleted along with its owner")
+
+	return nil, nil
+}
+
+// evictStrategy evicts the runner pod via the Eviction API, which refuses the eviction when it violates a PodDisruptionBudget.
+type evictStrategy struct {
+	clientset kubernetes.Interface
+}
+
+func (s evictStrategy) TearDown(ctx context.Context, _ client.Client, log logr.Logger, pod *corev1.Pod) (*ctrl.Result, error) {
+	if !pod.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+
+	if err := s.clientset.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		// The Eviction API responds with 429 when the eviction would violate a PodDisruptionBudget.
+		if kerrors.IsTooManyRequests(err) {
+			log.Info("Eviction of the runner pod is blocked by a PodDisruptionBudget. Retrying later.", "retryDelay", retryDelayOnBlockedEviction, "error", err.Error())
+
+			return &ctrl.Result{RequeueAfter: retryDelayOnBlockedEviction}, nil
+		}
+
+		log.Error(err, "Failed to evict the runner pod")
+
+		return &ctrl.Result{}, err
+	}
+
+	log.Info("Evicted the runner pod")
+
+	return nil, nil
+}
+
+// cordonStrategy cordons the node the runner pod runs on, so that no new pod is scheduled onto the node.
+type cordonStrategy struct{}
+
+func (cordonStrategy) TearDown(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*ctrl.Result, error) {
+	if pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+
+	var node corev1.Node
+
+	if err := c.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, &node); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return &ctrl.Result{}, err
+	}
+
+	if node.Spec.Unschedulable {
+		return nil, nil
+	}
+
+	updated := node.DeepCopy()
+	updated.Spec.Unschedulable = true
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(&node)); err != nil {
+		log.Error(err, "Failed to cordon the node of the runner pod", "node", node.Name)
+
+		return &ctrl.Result{}, err
+	}
+
+	log.Info("Cordoned the node of the runner pod", "node", node.Name)
+
+	return nil, nil
+}
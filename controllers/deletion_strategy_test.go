@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestNewDeletionStrategy(t *testing.T) {
+	for _, name := range []string{"", DeletionStrategyDelete, DeletionStrategyEvict, DeletionStrategyCordon} {
+		if _, err := NewDeletionStrategy(name, kubefake.NewSimpleClientset()); err != nil {
+			t.Errorf("unexpected error for %q: %v", name, err)
+		}
+	}
+
+	if _, err := NewDeletionStrategy("drain", kubefake.NewSimpleClientset()); err == nil {
+		t.Error("expected error for unknown deletion strategy")
+	}
+}
+
+func TestDeletionStrategy_TearDown(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "runner-1",
+				Namespace: "default",
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node-1",
+			},
+		}
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-1",
+		},
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(newPod(), node.DeepCopy()).Build()
+
+		res, err := deleteStrategy{}.TearDown(context.Background(), c, log, newPod())
+		if err != nil || res != nil {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+
+		var pod corev1.Pod
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "runner-1"}, &pod); err != nil {
+			t.Fatalf("expected the runner pod to be left as is: %v", err)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		clientset := kubefake.NewSimpleClientset(newPod())
+
+		res, err := evictStrategy{clientset: clientset}.TearDown(context.Background(), nil, log, newPod())
+		if err != nil || res != nil {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+
+		var evicted bool
+		for _, a := range clientset.Actions() {
+			if a.GetVerb() == "create" && a.GetSubresource() == "eviction" {
+				evicted = true
+			}
+		}
+		if !evicted {
+			t.Errorf("expected the runner pod to be evicted: %v", clientset.Actions())
+		}
+	})
+
+	t.Run("evict blocked by a PodDisruptionBudget", func(t *testing.T) {
+		clientset := kubefake.NewSimpleClientset(newPod())
+		clientset.PrependReactor("create", "pods", func(a clienttesting.Action) (bool, runtime.Object, error) {
+			if a.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+
+			return true, nil, kerrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+		})
+
+		res, err := evictStrategy{clientset: clientset}.TearDown(context.Background(), nil, log, newPod())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if res == nil || res.RequeueAfter != retryDelayOnBlockedEviction {
+			t.Errorf("expected the runner pod to be requeued after %s, got %v", retryDelayOnBlockedEviction, res)
+		}
+	})
+
+	t.Run("cordon", func(t *testing.T) {
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(node.DeepCopy()).Build()
+
+		res, err := cordonStrategy{}.TearDown(context.Background(), c, log, newPod())
+		if err != nil || res != nil {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+
+		var got corev1.Node
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "node-1"}, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Spec.Unschedulable {
+			t.Error("expected the node to be cordoned")
+		}
+	})
+
+	t.Run("cordon without node", func(t *testing.T) {
+		c := clientfake.NewClientBuilder().WithScheme(sc).Build()
+
+		res, err := cordonStrategy{}.TearDown(context.Background(), c, log, newPod())
+		if err != nil || res != nil {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+	})
+}
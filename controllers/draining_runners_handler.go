@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DrainingRunnersPath is the path the DrainingRunnersHandler is served at on the metrics server.
+const DrainingRunnersPath = "/draining-runners"
+
+// DrainingRunnersHandler serves the runner pods whose graceful stop has started but not completed yet as JSON,
+// so that you can tell which runners ARC is waiting for and for how long during an incident, without grepping the logs.
+//
+// It's read-only and reads the runner pods from the cache, so it costs neither Kubernetes nor GitHub API calls.
+type DrainingRunnersHandler struct {
+	Client client.Reader
+	Log    logr.Logger
+
+	clock clock.Clock
+}
+
+// drainingRunner is the JSON representation of a runner pod in graceful stop.
+type drainingRunner struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	Enterprise   string `json:"enterprise,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Repository   string `json:"repository,omitempty"`
+
+	// StartTimestamp is the time the graceful stop started, as recorded in the unregistration start timestamp annotation.
+	StartTimestamp string `json:"startTimestamp"`
+
+	// Elapsed is the time since the graceful stop started, in Go duration format.
+	Elapsed string `json:"elapsed,omitempty"`
+
+	// Branch is the decision the last evaluation of the unregistration ended up with, like "in-progress".
+	Branch string `json:"branch,omitempty"`
+
+	elapsed time.Duration
+}
+
+func (h *DrainingRunnersHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var pods corev1.PodList
+
+	if err := h.Client.List(req.Context(), &pods); err != nil {
+		h.Log.Error(err, "Failed to list pods for the draining runners endpoint")
+		http.Error(w, "failed to list pods", http.StatusInternalServerError)
+		return
+	}
+
+	runners := drainingRunners(pods.Items, h.now())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(runners); err != nil {
+		h.Log.Error(err, "Failed to write the draining runners response")
+	}
+}
+
+func (h *DrainingRunnersHandler) now() time.Time {
+	if h.clock == nil {
+		return time.Now()
+	}
+
+	return h.clock.Now()
+}
+
+// drainingRunners returns the pods in graceful stop, the longest draining one first.
+func drainingRunners(pods []corev1.Pod, now time.Time) []drainingRunner {
+	runners := []drainingRunner{}
+
+	for i := range pods {
+		pod := &pods[i]
+
+		if !podIsDraining(pod) {
+			continue
+		}
+
+		scope := runnerPodScope(pod)
+		start, _ := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp)
+		branch, _ := getAnnotation(pod, AnnotationKeyUnregistrationBranch)
+
+		r := drainingRunner{
+			Namespace:      pod.Namespace,
+			Name:           pod.Name,
+			Enterprise:     scope.enterprise,
+			Organization:   scope.organization,
+			Repository:     scope.repository,
+			StartTimestamp: start,
+			Branch:         branch,
+		}
+
+		if t, err := time.Parse(time.RFC3339, start); err == nil {
+			r.elapsed = now.Sub(t)
+			r.Elapsed = r.elapsed.String()
+		}
+
+		runners = append(runners, r)
+	}
+
+	sort.SliceStable(runners, func(i, j int) bool {
+		return runners[i].elapsed > runners[j].elapsed
+	})
+
+	return runners
+}
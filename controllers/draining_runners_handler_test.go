@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestDrainingRunnersHandler(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	newPod := func(name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name: containerName,
+					Env:  []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}},
+				}},
+			},
+		}
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(
+		newPod("recent", map[string]string{
+			AnnotationKeyUnregistrationStartTimestamp: now.Add(-time.Minute).Format(time.RFC3339),
+		}),
+		newPod("long", map[string]string{
+			AnnotationKeyUnregistrationStartTimestamp: now.Add(-time.Hour).Format(time.RFC3339),
+			AnnotationKeyUnregistrationBranch:         string(unregistrationBranchInProgress),
+		}),
+		newPod("completed", map[string]string{
+			AnnotationKeyUnregistrationStartTimestamp:    now.Add(-time.Hour).Format(time.RFC3339),
+			AnnotationKeyUnregistrationCompleteTimestamp: now.Format(time.RFC3339),
+		}),
+		newPod("running", nil),
+	).Build()
+
+	h := &DrainingRunnersHandler{
+		Client: c,
+		Log: zap.New(func(o *zap.Options) {
+			o.Development = true
+		}),
+		clock: clocktesting.NewFakeClock(now),
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DrainingRunnersPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got []map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected response body %q: %v", rec.Body.String(), err)
+	}
+
+	want := []map[string]string{
+		{
+			"namespace":      "default",
+			"name":           "long",
+			"repository":     "test/valid",
+			"startTimestamp": now.Add(-time.Hour).Format(time.RFC3339),
+			"elapsed":        "1h0m0s",
+			"branch":         string(unregistrationBranchInProgress),
+		},
+		{
+			"namespace":      "default",
+			"name":           "recent",
+			"repository":     "test/valid",
+			"startTimestamp": now.Add(-time.Minute).Format(time.RFC3339),
+			"elapsed":        "1m0s",
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected draining runners (-want +got):\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, DrainingRunnersPath, nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for POST: %d", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// gitHubRateLimitLowRatio is the ratio of the remaining GitHub API rate limit to the limit
+	// below which gitHubRateLimiter starts slowing requeues down.
+	gitHubRateLimitLowRatio = 0.2
+
+	// maxGitHubRateLimitedRequeueDelay caps the requeue delay gitHubRateLimiter stretches to,
+	// in case the time the rate limit window resets is unknown.
+	maxGitHubRateLimitedRequeueDelay = 10 * time.Minute
+)
+
+// gitHubRateLimiter is a workqueue.RateLimiter that slows requeues down when the remaining GitHub API rate limit is low,
+// so that failing reconciliations retried by the workqueue don't burn the rest of the budget shared by every controller.
+//
+// Above gitHubRateLimitLowRatio of the limit, it's a passthrough to the base rate limiter.
+// Below that, the delay of the base rate limiter is stretched in inverse proportion to the remaining budget,
+// up to the time the rate limit window resets. It's a passthrough as well until any GitHub API response has been seen.
+type gitHubRateLimiter struct {
+	workqueue.RateLimiter
+
+	// rateLimit returns the last observed GitHub API rate limit. It can be nil, in which case metrics.LastRateLimit is used.
+	rateLimit func() (metrics.RateLimit, bool)
+
+	// clock can be nil, in which case the real clock is used.
+	clock clock.Clock
+}
+
+func newGitHubRateLimiter(base workqueue.RateLimiter) *gitHubRateLimiter {
+	return &gitHubRateLimiter{RateLimiter: base}
+}
+
+func (l *gitHubRateLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+
+	getRateLimit := l.rateLimit
+	if getRateLimit == nil {
+		getRateLimit = metrics.LastRateLimit
+	}
+
+	rl, ok := getRateLimit()
+	if !ok || rl.Limit <= 0 {
+		return delay
+	}
+
+	ratio := float64(rl.Remaining) / float64(rl.Limit)
+	if ratio >= gitHubRateLimitLowRatio {
+		return delay
+	}
+
+	maxDelay := maxGitHubRateLimitedRequeueDelay
+	if !rl.Reset.IsZero() {
+		if untilReset := rl.Reset.Sub(l.now()); untilReset > 0 {
+			maxDelay = untilReset
+		}
+	}
+
+	// Nothing can be done until the rate limit window resets.
+	if rl.Remaining <= 0 {
+		if delay > maxDelay {
+			return delay
+		}
+		return maxDelay
+	}
+
+	stretched := time.Duration(float64(delay) * gitHubRateLimitLowRatio / ratio)
+	if stretched > maxDelay {
+		stretched = maxDelay
+	}
+
+	if stretched < delay {
+		return delay
+	}
+
+	return stretched
+}
+
+func (l *gitHubRateLimiter) now() time.Time {
+	if l.clock == nil {
+		return time.Now()
+	}
+
+	return l.clock.Now()
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"k8s.io/client-go/util/workqueue"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestGitHubRateLimiter(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		rateLimit *metrics.RateLimit
+		want      time.Duration
+	}{
+		{
+			name: "no rate limit observed yet",
+			want: time.Second,
+		},
+		{
+			name:      "plenty of budget",
+			rateLimit: &metrics.RateLimit{Limit: 5000, Remaining: 4000, Reset: now.Add(time.Hour)},
+			want:      time.Second,
+		},
+		{
+			name:      "low budget",
+			rateLimit: &metrics.RateLimit{Limit: 5000, Remaining: 100, Reset: now.Add(time.Hour)},
+			want:      10 * time.Second,
+		},
+		{
+			name:      "low budget capped at the reset",
+			rateLimit: &metrics.RateLimit{Limit: 5000, Remaining: 1, Reset: now.Add(time.Minute)},
+			want:      time.Minute,
+		},
+		{
+			name:      "low budget without the reset time",
+			rateLimit: &metrics.RateLimit{Limit: 5000, Remaining: 1},
+			want:      maxGitHubRateLimitedRequeueDelay,
+		},
+		{
+			name:      "exhausted",
+			rateLimit: &metrics.RateLimit{Limit: 5000, Remaining: 0, Reset: now.Add(30 * time.Minute)},
+			want:      30 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newGitHubRateLimiter(workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Hour))
+			l.clock = clocktesting.NewFakeClock(now)
+			l.rateLimit = func() (metrics.RateLimit, bool) {
+				if tt.rateLimit == nil {
+					return metrics.RateLimit{}, false
+				}
+				return *tt.rateLimit, true
+			}
+
+			if got := l.When("item"); got != tt.want {
+				t.Errorf("unexpected delay: want %s, got %s", tt.want, got)
+			}
+
+			// The base rate limiter keeps tracking the failures.
+			if got := l.NumRequeues("item"); got != 1 {
+				t.Errorf("unexpected number of requeues: want 1, got %d", got)
+			}
+
+			l.Forget("item")
+
+			if got := l.NumRequeues("item"); got != 0 {
+				t.Errorf("unexpected number of requeues after forget: want 0, got %d", got)
+			}
+		})
+	}
+}
@@ -33,6 +33,7 @@ import (
 	gogithub "github.com/google/go-github/v39/github"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -68,6 +69,37 @@ type HorizontalRunnerAutoscalerGitHubWebhook struct {
 	// Set to empty for letting it watch for all namespaces.
 	Namespace string
 	Name      string
+
+	// GracefulStopRunnerOnJobCompletion makes the webhook server trigger the graceful stop of the runner
+	// that ran the job on each workflow_job completed event, instead of waiting for the scale down to stop it.
+	// Only ephemeral runners are stopped, as a persistent runner would otherwise be unregistered after every job.
+	GracefulStopRunnerOnJobCompletion bool
+
+	// RecordJobTimeout makes the webhook server record the timeout of the job onto the runner pod on each workflow_job in_progress event,
+	// and clear it on the completed event. See AnnotationKeyJobTimeout.
+	// GitHub doesn't send the job timeout in workflow_job events, so this has no effect unless a proxy in front of the webhook server
+	// adds the timeout_minutes field to the workflow_job in the payload, like by looking up the timeout-minutes of the job from the workflow definition.
+	RecordJobTimeout bool
+
+	// RunnerPodUpdateTimeout is the timeout of finding and annotating the runner pod of a workflow job while handling a webhook event.
+	// Defaults to DefaultWebhookRunnerPodUpdateTimeout.
+	RunnerPodUpdateTimeout time.Duration
+
+	// Clock is used to tell the time the runner pods are annotated with, so that tests can control it.
+	// It can be nil, in which case the real clock is used.
+	Clock clock.Clock
+}
+
+// workflowJobPayload contains the fields of the workflow_job event payload that go-github's WorkflowJob doesn't have.
+type workflowJobPayload struct {
+	WorkflowJob struct {
+		RunnerName string `json:"runner_name,omitempty"`
+
+		// TimeoutMinutes is the timeout of the job.
+		// GitHub doesn't include it in workflow_job events, so this is set only when the payload is enriched with it
+		// by a proxy in front of the webhook server. See RecordJobTimeout.
+		TimeoutMinutes int `json:"timeout_minutes,omitempty"`
+	} `json:"workflow_job,omitempty"`
 }
 
 func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Reconcile(_ context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -254,6 +286,51 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.Respons
 					target.Amount = -1
 				}
 			}
+
+			if action == "completed" && (autoscaler.GracefulStopRunnerOnJobCompletion || autoscaler.RecordJobTimeout) {
+				var workflowJobEvent workflowJobPayload
+				if err := json.Unmarshal(payload, &workflowJobEvent); err != nil {
+					log.Error(err, "could not parse webhook payload for extracting runner name")
+				} else {
+					ctx, cancel := autoscaler.withRunnerPodUpdateTimeout(r.Context())
+					defer cancel()
+
+					runnerName := workflowJobEvent.WorkflowJob.RunnerName
+
+					// The job timeout no longer keeps the runner from being unregistered once the job has completed.
+					if autoscaler.RecordJobTimeout {
+						if err := autoscaler.ClearRunnerJobTimeout(ctx, log, runnerName); err != nil {
+							log.Error(err, "could not clear the job timeout of the runner", "runner", runnerName)
+						}
+					}
+
+					if autoscaler.GracefulStopRunnerOnJobCompletion {
+						if err := autoscaler.TriggerRunnerGracefulStop(ctx, log, runnerName); err != nil {
+							log.Error(err, "could not trigger the graceful stop of the runner", "runner", runnerName)
+						}
+					}
+				}
+			}
+		case "in_progress":
+			ok = true
+
+			var workflowJobEvent workflowJobPayload
+			if err := json.Unmarshal(payload, &workflowJobEvent); err != nil {
+				log.Error(err, "could not parse webhook payload for extracting job timeout")
+			} else if job := workflowJobEvent.WorkflowJob; autoscaler.RecordJobTimeout && job.TimeoutMinutes > 0 {
+				ctx, cancel := autoscaler.withRunnerPodUpdateTimeout(r.Context())
+				defer cancel()
+
+				if err := autoscaler.RecordRunnerJobTimeout(ctx, log, job.RunnerName, time.Duration(job.TimeoutMinutes)*time.Minute); err != nil {
+					log.Error(err, "could not record the job timeout of the runner", "runner", job.RunnerName)
+				}
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+			log.V(2).Info("Received a workflow_job event that triggers neither scale-up nor scale-down", "action", action)
+
+			return
 		default:
 			ok = true
 
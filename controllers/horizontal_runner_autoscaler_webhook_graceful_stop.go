@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TriggerRunnerGracefulStop annotates the runner pod for the runner with the given name so that
+// the runner pod controller starts the graceful stop of the runner on its next reconcilation.
+//
+// This is used to shorten the time a runner that has already completed its job stays idle,
+// because otherwise ARC has to wait until the upstream controller, like runnerset-controller, notices the runner is no longer needed.
+// It does nothing if there's no runner pod with the given name, or the runner is persistent.
+// A persistent runner would otherwise be unregistered after every job and left around unregistered,
+// as nothing scales it down nor recreates it.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) TriggerRunnerGracefulStop(ctx context.Context, log logr.Logger, runnerName string) error {
+	if runnerName == "" {
+		return nil
+	}
+
+	pod, err := autoscaler.findRunnerPod(ctx, runnerName)
+	if err != nil {
+		return err
+	}
+
+	if pod == nil {
+		log.V(1).Info("Runner pod not found for the completed workflow job. Skipped triggering the graceful stop", "runner", runnerName)
+
+		return nil
+	}
+
+	log = log.WithValues("runner", runnerName, "pod", client.ObjectKeyFromObject(pod))
+
+	if !podIsEphemeral(pod) {
+		log.V(1).Info("Runner is not ephemeral. Skipped triggering the graceful stop on workflow job completion")
+
+		return nil
+	}
+
+	now := autoscaler.now().Format(time.RFC3339)
+
+	// The request timestamp is what makes the runner pod controller tick the graceful stop.
+	// We also set the start timestamp proactively so that the unregistration timeout counts from the job completion.
+	updated, err := annotatePodOnce(ctx, autoscaler.Client, log, pod, AnnotationKeyUnregistrationRequestTimestamp, now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := annotatePodOnce(ctx, autoscaler.Client, log, updated, AnnotationKeyUnregistrationStartTimestamp, now); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Triggered the graceful stop of the runner on workflow job completion")
+
+	return nil
+}
+
+// RecordRunnerJobTimeout annotates the runner pod for the runner with the given name with the timeout of the workflow job
+// the runner has just started running, so that the runner pod controller doesn't time out the unregistration of the runner
+// before the job would time out on its own. See AnnotationKeyJobTimeout.
+//
+// The timeout of the previous job, if any, is overwritten as a persistent runner runs one job after another.
+// It does nothing if there's no runner pod with the given name.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) RecordRunnerJobTimeout(ctx context.Context, log logr.Logger, runnerName string, timeout time.Duration) error {
+	if runnerName == "" || timeout <= 0 {
+		return nil
+	}
+
+	pod, err := autoscaler.findRunnerPod(ctx, runnerName)
+	if err != nil {
+		return err
+	}
+
+	if pod == nil {
+		log.V(1).Info("Runner pod not found for the in-progress workflow job. Skipped recording the job timeout", "runner", runnerName)
+
+		return nil
+	}
+
+	log = log.WithValues("runner", runnerName, "pod", client.ObjectKeyFromObject(pod))
+
+	if _, err := annotatePodUpdate(ctx, autoscaler.Client, log, pod, AnnotationKeyJobTimeout, timeout.String()); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Recorded the timeout of the workflow job the runner is running", "jobTimeout", timeout)
+
+	return nil
+}
+
+// ClearRunnerJobTimeout removes the timeout of the workflow job recorded by RecordRunnerJobTimeout from the runner pod for the runner
+// with the given name, as the job has completed. It does nothing if there's no runner pod with the given name.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) ClearRunnerJobTimeout(ctx context.Context, log logr.Logger, runnerName string) error {
+	if runnerName == "" {
+		return nil
+	}
+
+	pod, err := autoscaler.findRunnerPod(ctx, runnerName)
+	if err != nil {
+		return err
+	}
+
+	if pod == nil {
+		log.V(1).Info("Runner pod not found for the completed workflow job. Skipped clearing the job timeout", "runner", runnerName)
+
+		return nil
+	}
+
+	log = log.WithValues("runner", runnerName, "pod", client.ObjectKeyFromObject(pod))
+
+	if _, err := unannotatePod(ctx, autoscaler.Client, log, pod, AnnotationKeyJobTimeout); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// findRunnerPod returns the runner pod for the runner with the given name, or nil if there's none or it's being deleted.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) findRunnerPod(ctx context.Context, runnerName string) (*corev1.Pod, error) {
+	opts := []client.ListOption{client.HasLabels{LabelKeyRunnerSetName}}
+
+	if autoscaler.Namespace != "" {
+		opts = append(opts, client.InNamespace(autoscaler.Namespace))
+	}
+
+	var pods corev1.PodList
+
+	if err := autoscaler.List(ctx, &pods, opts...); err != nil {
+		return nil, err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		if pod.Name == runnerName && pod.DeletionTimestamp.IsZero() {
+			return pod, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) now() time.Time {
+	if autoscaler.Clock == nil {
+		return time.Now()
+	}
+
+	return autoscaler.Clock.Now()
+}
+
+// withRunnerPodUpdateTimeout returns a context for finding and annotating the runner pod of a workflow job, derived from ctx.
+// The context is canceled either after the RunnerPodUpdateTimeout or when ctx is done, like when the webhook request is canceled, whichever comes first.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) withRunnerPodUpdateTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := autoscaler.RunnerPodUpdateTimeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookRunnerPodUpdateTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
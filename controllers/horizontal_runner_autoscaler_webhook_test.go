@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,9 +17,12 @@ import (
 	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
 	"github.com/go-logr/logr"
 	"github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -596,3 +600,145 @@ func (l *testLogSink) WithValues(kvs ...interface{}) logr.LogSink {
 		writer:    l.writer,
 	}
 }
+
+func TestTriggerRunnerGracefulStop(t *testing.T) {
+	newPod := func(name string, labels map[string]string, ephemeral bool) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+				Annotations: map[string]string{
+					AnnotationKeyEphemeral: fmt.Sprintf("%v", ephemeral),
+				},
+			},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(sc).WithObjects(
+		newPod("runner-1", map[string]string{LabelKeyRunnerSetName: "runnerset"}, true),
+		newPod("runner-2", map[string]string{LabelKeyRunnerSetName: "runnerset"}, true),
+		newPod("persistent-runner", map[string]string{LabelKeyRunnerSetName: "runnerset"}, false),
+		newPod("not-a-runner", nil, true),
+	).Build()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	hraWebhook := &HorizontalRunnerAutoscalerGitHubWebhook{Client: c, Clock: clocktesting.NewFakeClock(now)}
+	logs := installTestLogger(hraWebhook)
+
+	defer func() {
+		if t.Failed() {
+			t.Logf("diagnostics: %s", logs.String())
+		}
+	}()
+
+	for _, name := range []string{"runner-1", "persistent-runner", "not-a-runner", "missing"} {
+		if err := hraWebhook.TriggerRunnerGracefulStop(context.Background(), hraWebhook.Log, name); err != nil {
+			t.Fatalf("unexpected error for %s: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		triggered bool
+	}{
+		{name: "runner-1", triggered: true},
+		{name: "runner-2", triggered: false},
+		{name: "persistent-runner", triggered: false},
+		{name: "not-a-runner", triggered: false},
+	} {
+		var pod corev1.Pod
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: tc.name}, &pod); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, k := range []string{AnnotationKeyUnregistrationRequestTimestamp, AnnotationKeyUnregistrationStartTimestamp} {
+			v, ok := getAnnotation(&pod, k)
+			if ok != tc.triggered {
+				t.Errorf("%s: unexpected presence of annotation %s: want %v, got %v", tc.name, k, tc.triggered, ok)
+			}
+
+			if ok && v != now.Format(time.RFC3339) {
+				t.Errorf("%s: unexpected value of annotation %s: want %s, got %s", tc.name, k, now.Format(time.RFC3339), v)
+			}
+		}
+	}
+}
+
+func TestWithRunnerPodUpdateTimeout(t *testing.T) {
+	hraWebhook := &HorizontalRunnerAutoscalerGitHubWebhook{RunnerPodUpdateTimeout: time.Minute}
+
+	ctx, cancel := hraWebhook.withRunnerPodUpdateTimeout(context.Background())
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("unexpected deadline: want within %s, got %v (%v)", time.Minute, deadline, ok)
+	}
+
+	// The context is canceled along with the webhook request.
+	reqCtx, cancelReq := context.WithCancel(context.Background())
+
+	ctx, cancel = hraWebhook.withRunnerPodUpdateTimeout(reqCtx)
+	defer cancel()
+
+	cancelReq()
+
+	if err := ctx.Err(); err != context.Canceled {
+		t.Errorf("unexpected error after the request was canceled: want %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestRecordRunnerJobTimeout(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(sc).WithObjects(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "runner-1",
+				Namespace:   "default",
+				Labels:      map[string]string{LabelKeyRunnerSetName: "runnerset"},
+				Annotations: map[string]string{AnnotationKeyJobTimeout: "6h0m0s"},
+			},
+		},
+	).Build()
+
+	hraWebhook := &HorizontalRunnerAutoscalerGitHubWebhook{Client: c}
+	logs := installTestLogger(hraWebhook)
+
+	defer func() {
+		if t.Failed() {
+			t.Logf("diagnostics: %s", logs.String())
+		}
+	}()
+
+	// The timeout of the previous job is overwritten by the next job's.
+	if err := hraWebhook.RecordRunnerJobTimeout(context.Background(), hraWebhook.Log, "runner-1", 90*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := hraWebhook.RecordRunnerJobTimeout(context.Background(), hraWebhook.Log, "missing", 90*time.Minute); err != nil {
+		t.Fatalf("unexpected error for a missing runner: %v", err)
+	}
+
+	var pod corev1.Pod
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "runner-1"}, &pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := getAnnotation(&pod, AnnotationKeyJobTimeout); v != "1h30m0s" {
+		t.Errorf("unexpected job timeout annotation: want 1h30m0s, got %q", v)
+	}
+
+	// The job timeout is cleared once the job completes.
+	if err := hraWebhook.ClearRunnerJobTimeout(context.Background(), hraWebhook.Log, "runner-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "runner-1"}, &pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := getAnnotation(&pod, AnnotationKeyJobTimeout); ok {
+		t.Errorf("unexpected job timeout annotation after the job completion: %q", v)
+	}
+}
@@ -316,12 +316,21 @@ func (r *HorizontalRunnerAutoscalerReconciler) reconcile(ctx context.Context, re
 		return ctrl.Result{}, err
 	}
 
+	newDesiredReplicas, idleSince, err := r.holdScaleToZero(ctx, log, now, st, hra, newDesiredReplicas)
+	if err != nil {
+		log.Error(err, "Could not check if the runners are idle before scaling to zero")
+
+		return ctrl.Result{}, err
+	}
+
 	if err := updatedDesiredReplicas(newDesiredReplicas); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	updated := hra.DeepCopy()
 
+	updated.Status.IdleSince = idleSince
+
 	if hra.Status.DesiredReplicas == nil || *hra.Status.DesiredReplicas != newDesiredReplicas {
 		if (hra.Status.DesiredReplicas == nil && newDesiredReplicas > 1) ||
 			(hra.Status.DesiredReplicas != nil && newDesiredReplicas > *hra.Status.DesiredReplicas) {
@@ -363,9 +372,66 @@ func (r *HorizontalRunnerAutoscalerReconciler) reconcile(ctx context.Context, re
 		}
 	}
 
+	// Scale to zero as soon as the runners have been idle long enough, rather than waiting for the next sync period.
+	if idleSince != nil {
+		return ctrl.Result{RequeueAfter: idleSince.Add(minIdleBeforeScaleToZero(hra)).Sub(now)}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// holdScaleToZero postpones scaling the target down to zero replicas while any of its runners is busy running a job on GitHub,
+// and until all the runners have been seen idle for MinIdleSecondsBeforeScaleToZero.
+// A job can be assigned to a runner before GitHub tells us, e.g. the one the webhook-based autoscaler has just woken the scale target up for,
+// so we make the same busy check as the graceful stop before letting the runners go.
+//
+// It returns the number of replicas to actually set, along with the time since when all the runners have been seen idle.
+// The latter is nil unless scaling to zero is postponed for MinIdleSecondsBeforeScaleToZero.
+func (r *HorizontalRunnerAutoscalerReconciler) holdScaleToZero(ctx context.Context, log logr.Logger, now time.Time, st scaleTarget, hra v1alpha1.HorizontalRunnerAutoscaler, newDesiredReplicas int) (int, *metav1.Time, error) {
+	currentDesiredReplicas := getIntOrDefault(st.replicas, defaultReplicas)
+
+	if newDesiredReplicas > 0 || currentDesiredReplicas == 0 {
+		return newDesiredReplicas, nil, nil
+	}
+
+	runnerMap, err := st.getRunnerMap()
+	if err != nil {
+		return currentDesiredReplicas, nil, err
+	}
+
+	scope := runnerScope{enterprise: st.enterprise, organization: st.org, repository: st.repo}
+
+	for name := range runnerMap {
+		safe, reason, err := isRunnerSafeToDelete(ctx, log, r.GitHubClient, scope, name, nil)
+		if err != nil {
+			return currentDesiredReplicas, nil, err
+		}
+
+		if !safe {
+			log.Info("Postponed scaling down to zero replicas", "runner", name, "reason", reason, "replicas", currentDesiredReplicas)
+
+			return currentDesiredReplicas, nil, nil
+		}
+	}
+
+	idleSince := metav1.NewTime(now)
+	if hra.Status.IdleSince != nil {
+		idleSince = *hra.Status.IdleSince
+	}
+
+	if until := idleSince.Add(minIdleBeforeScaleToZero(hra)); until.After(now) {
+		log.V(1).Info("Postponed scaling down to zero replicas until the runners have been idle long enough", "idleSince", idleSince, "until", until, "replicas", currentDesiredReplicas)
+
+		return currentDesiredReplicas, &idleSince, nil
+	}
+
+	return 0, nil, nil
+}
+
+func minIdleBeforeScaleToZero(hra v1alpha1.HorizontalRunnerAutoscaler) time.Duration {
+	return time.Duration(getIntOrDefault(hra.Spec.MinIdleSecondsBeforeScaleToZero, 0)) * time.Second
+}
+
 func (r *HorizontalRunnerAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	name := "horizontalrunnerautoscaler-controller"
 	if r.Name != "" {
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	runnerEnterprise   = "enterprise"
+	runnerOrganization = "organization"
+	runnerRepository   = "repository"
+	runnerReason       = "reason"
+	runnerOutcome      = "outcome"
+)
+
+var (
+	runnerMetrics = []prometheus.Collector{
+		runnerGracefulStopDuration,
+		runnerGracefulStopTicks,
+		runnerUnregistrations,
+		runnerBusyUnregistrations,
+		runnerRegistrationDuration,
+		runnerPodLingeringDuration,
+		runnerPodStuckDeletions,
+		runnerStateDrifts,
+	}
+)
+
+var (
+	runnerGracefulStopDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "runner_graceful_stop_duration_seconds",
+			Help:    "Duration between the start and the completion of the graceful stop of runners",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository},
+	)
+	runnerGracefulStopTicks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "runner_graceful_stop_ticks_total",
+			Help: "Number of ticks of the graceful stop of runners, by the reason the tick completed or requeued the graceful stop",
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository, runnerReason},
+	)
+	runnerUnregistrations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_runner_unregistrations_total",
+			Help: "Number of runner unregistration attempts, by the outcome of the attempt",
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository, runnerOutcome},
+	)
+	runnerBusyUnregistrations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_busy_runner_unregistered_total",
+			Help: "Number of runners unregistered successfully while GitHub reported them busy around the unregistration, which can disrupt workflow jobs",
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository},
+	)
+	runnerRegistrationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "runner_registration_duration_seconds",
+			Help:    "Duration between the creation of runner pods and their runners being seen on GitHub",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository},
+	)
+	runnerPodLingeringDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "runner_pod_lingering_duration_seconds",
+			Help:    "Duration between runner pods being seen stopped, usually after completing their jobs, and their deletion",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository},
+	)
+	runnerPodStuckDeletions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_runner_pod_stuck_deletions_total",
+			Help: "Number of runner pods that were not deleted within the deletion verification timeout after their runners had been unregistered",
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository},
+	)
+	runnerStateDrifts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_runner_state_drift_total",
+			Help: "Number of runner pods whose runner ID recorded in the annotation was found inconsistent with the runner on GitHub, by the kind of the drift",
+		},
+		[]string{runnerEnterprise, runnerOrganization, runnerRepository, runnerReason},
+	)
+)
+
+func ObserveRunnerGracefulStopDuration(enterprise, organization, repository string, d time.Duration) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+	}
+	runnerGracefulStopDuration.With(labels).Observe(d.Seconds())
+}
+
+func IncRunnerGracefulStopTicks(enterprise, organization, repository, reason string) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+		runnerReason:       reason,
+	}
+	runnerGracefulStopTicks.With(labels).Inc()
+}
+
+func IncRunnerUnregistrations(enterprise, organization, repository, outcome string) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+		runnerOutcome:      outcome,
+	}
+	runnerUnregistrations.With(labels).Inc()
+}
+
+func IncBusyRunnerUnregistered(enterprise, organization, repository string) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+	}
+	runnerBusyUnregistrations.With(labels).Inc()
+}
+
+func ObserveRunnerRegistrationDuration(enterprise, organization, repository string, d time.Duration) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+	}
+	runnerRegistrationDuration.With(labels).Observe(d.Seconds())
+}
+
+func ObserveRunnerPodLingeringDuration(enterprise, organization, repository string, d time.Duration) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+	}
+	runnerPodLingeringDuration.With(labels).Observe(d.Seconds())
+}
+
+func IncRunnerPodStuckDeletions(enterprise, organization, repository string) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+	}
+	runnerPodStuckDeletions.With(labels).Inc()
+}
+
+func IncRunnerStateDrift(enterprise, organization, repository, reason string) {
+	labels := prometheus.Labels{
+		runnerEnterprise:   enterprise,
+		runnerOrganization: organization,
+		runnerRepository:   repository,
+		runnerReason:       reason,
+	}
+	runnerStateDrifts.With(labels).Inc()
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultOrphanedRunnerCollectionInterval is the default interval between two runs of the orphaned runner collection.
+	DefaultOrphanedRunnerCollectionInterval = 10 * time.Minute
+
+	// DefaultOrphanedRunnerAge is the default duration a runner needs to be seen offline without a runner pod
+	// before it's considered orphaned.
+	DefaultOrphanedRunnerAge = time.Hour
+)
+
+// OrphanedRunnerReconciler periodically removes runners that are registered to GitHub but no runner pod maps to.
+// Such runners are left behind when e.g. a runner pod crashed, or ARC gave up unregistering the runner before deleting the runner pod.
+//
+// GitHub API doesn't tell when a runner went offline, so the reconciler remembers the first time it saw each runner orphaned,
+// and removes the runner only after it kept being orphaned for OrphanedRunnerAge.
+// Only enterprises, organizations, and repositories that have one or more runner pods are scanned.
+//
+// Note that this removes any offline runner without a runner pod in the scanned scopes, including ones not managed by ARC.
+type OrphanedRunnerReconciler struct {
+	client.Client
+	Log          logr.Logger
+	GitHubClient *github.Client
+
+	// Interval is the interval between two runs of the orphaned runner collection.
+	Interval time.Duration
+
+	// OrphanedRunnerAge is the duration a runner needs to be seen offline without a runner pod before it's removed.
+	OrphanedRunnerAge time.Duration
+
+	// DryRun makes the reconciler log orphaned runners it would remove without actually removing them from GitHub.
+	DryRun bool
+
+	clock clock.Clock
+
+	// orphanedSince is the first time each runner was seen orphaned, keyed by the scope and the runner ID.
+	orphanedSince map[string]time.Time
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// runnerScope is an enterprise, an organization, or a repository that runners are registered to.
+type runnerScope struct {
+	enterprise, organization, repository string
+}
+
+func (s runnerScope) key(runnerID int64) string {
+	return fmt.Sprintf("enterprise=%s,org=%s,repo=%s,id=%d", s.enterprise, s.organization, s.repository, runnerID)
+}
+
+// Start runs the orphaned runner collection until the context is done.
+func (r *OrphanedRunnerReconciler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		if err := r.collect(ctx); err != nil {
+			r.Log.Error(err, "Failed to collect orphaned runners")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns true so that only the leader removes orphaned runners.
+func (r *OrphanedRunnerReconciler) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *OrphanedRunnerReconciler) collect(ctx context.Context) error {
+	var pods corev1.PodList
+
+	if err := r.List(ctx, &pods, client.HasLabels{LabelKeyRunnerSetName}); err != nil {
+		return err
+	}
+
+	podNames := map[runnerScope]map[string]struct{}{}
+
+	for _, pod := range pods.Items {
+		if len(pod.Spec.Containers) == 0 {
+			continue
+		}
+
+		scope := runnerPodScope(&pod)
+
+		if podNames[scope] == nil {
+			podNames[scope] = map[string]struct{}{}
+		}
+
+		podNames[scope][pod.Name] = struct{}{}
+	}
+
+	now := r.now()
+	orphanedSince := map[string]time.Time{}
+
+	for scope, names := range podNames {
+		log := withRunnerScope(r.Log, scope.enterprise, scope.organization, scope.repository, "", nil)
+
+		runners, err := r.GitHubClient.ListRunners(ctx, scope.enterprise, scope.organization, scope.repository)
+		if err != nil {
+			log.Error(err, "Failed to list runners for orphaned runner collection")
+			continue
+		}
+
+		for _, runner := range runners {
+			if _, ok := names[runner.GetName()]; ok || runner.GetStatus() != "offline" || runner.GetBusy() {
+				continue
+			}
+
+			key := scope.key(runner.GetID())
+
+			since, ok := r.orphanedSince[key]
+			if !ok {
+				since = now
+			}
+
+			if age := now.Sub(since); age < r.orphanedRunnerAge() {
+				log.V(1).Info("Found an orphaned runner", "runner", runner.GetName(), "runnerID", runner.GetID(), "age", age)
+				orphanedSince[key] = since
+				continue
+			}
+
+			if r.DryRun {
+				log.Info("Would remove the orphaned runner but skipped as dry-run is enabled", "runner", runner.GetName(), "runnerID", runner.GetID())
+				orphanedSince[key] = since
+				continue
+			}
+
+			if err := r.GitHubClient.RemoveRunner(ctx, scope.enterprise, scope.organization, scope.repository, runner.GetID()); err != nil {
+				log.Error(err, "Failed to remove the orphaned runner", "runner", runner.GetName(), "runnerID", runner.GetID())
+				orphanedSince[key] = since
+				continue
+			}
+
+			log.Info("Removed the orphaned runner", "runner", runner.GetName(), "runnerID", runner.GetID())
+		}
+	}
+
+	r.orphanedSince = orphanedSince
+
+	return nil
+}
+
+func (r *OrphanedRunnerReconciler) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+
+	return r.clock.Now()
+}
+
+func (r *OrphanedRunnerReconciler) interval() time.Duration {
+	interval := DefaultOrphanedRunnerCollectionInterval
+
+	if r.Interval > 0 {
+		interval = r.Interval
+	}
+	return interval
+}
+
+func (r *OrphanedRunnerReconciler) orphanedRunnerAge() time.Duration {
+	age := DefaultOrphanedRunnerAge
+
+	if r.OrphanedRunnerAge > 0 {
+		age = r.OrphanedRunnerAge
+	}
+	return age
+}
+
+func (r *OrphanedRunnerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(r)
+}
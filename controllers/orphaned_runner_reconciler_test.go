@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOrphanedRunnerReconciler_collect(t *testing.T) {
+	var removed []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 4, "runners": [`+
+			`{"id": 1, "name": "with-pod", "os": "linux", "status": "offline", "busy": false},`+
+			`{"id": 2, "name": "orphaned", "os": "linux", "status": "offline", "busy": false},`+
+			`{"id": 3, "name": "online", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 4, "name": "busy", "os": "linux", "status": "offline", "busy": true}]}`)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/", func(w http.ResponseWriter, req *http.Request) {
+		removed = append(removed, req.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "with-pod",
+			Namespace: "default",
+			Labels:    map[string]string{LabelKeyRunnerSetName: "runnerset"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: containerName,
+					Env: []corev1.EnvVar{
+						{Name: EnvVarRepo, Value: "test/valid"},
+					},
+				},
+			},
+		},
+	}
+
+	clk := clocktesting.NewFakeClock(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	r := &OrphanedRunnerReconciler{
+		Client:            clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build(),
+		Log:               logr.Discard(),
+		GitHubClient:      newGithubClient(server),
+		OrphanedRunnerAge: time.Hour,
+		clock:             clk,
+	}
+
+	if err := r.collect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("expected no runner to be removed before the orphaned runner age, got %v", removed)
+	}
+
+	clk.Step(time.Hour)
+
+	if err := r.collect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"/repos/test/valid/actions/runners/2"}; fmt.Sprint(removed) != fmt.Sprint(want) {
+		t.Errorf("unexpected removed runners: want %v, got %v", want, removed)
+	}
+}
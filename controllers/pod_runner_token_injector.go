@@ -50,7 +50,7 @@ func (t *PodRunnerTokenInjector) Handle(ctx context.Context, req admission.Reque
 	for i := range pod.Spec.Containers {
 		c := pod.Spec.Containers[i]
 
-		if c.Name == "runner" {
+		if c.Name == runnerContainerName(&pod) {
 			runnerContainer = &c
 		}
 	}
@@ -66,6 +66,10 @@ func (t *PodRunnerTokenInjector) Handle(ctx context.Context, req admission.Reque
 		return newEmptyResponse()
 	}
 
+	if jitRequested(&pod) {
+		return t.injectJITConfig(req, enterprise, org, repo, &pod, runnerContainer)
+	}
+
 	rt, err := t.GitHubClient.GetRegistrationToken(context.Background(), enterprise, org, repo, pod.Name)
 	if err != nil {
 		t.Log.Error(err, "Failed to get new registration token")
@@ -78,7 +82,8 @@ func (t *PodRunnerTokenInjector) Handle(ctx context.Context, req admission.Reque
 
 	updated.Annotations[AnnotationKeyTokenExpirationDate] = ts
 
-	if pod.Spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+	// A reused runner pod relies on the kubelet to restart the runner container after it stopped.
+	if pod.Spec.RestartPolicy != corev1.RestartPolicyOnFailure && !podIsReused(&pod) {
 		updated.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
 	}
 
@@ -92,6 +97,30 @@ func (t *PodRunnerTokenInjector) Handle(ctx context.Context, req admission.Reque
 	return res
 }
 
+// injectJITConfig registers the runner with a JIT configuration and injects the configuration into the runner pod,
+// instead of a registration token.
+func (t *PodRunnerTokenInjector) injectJITConfig(req admission.Request, enterprise, org, repo string, pod *corev1.Pod, runnerContainer *corev1.Container) admission.Response {
+	log := t.Log.WithValues("pod", pod.Name, "namespace", req.Namespace)
+
+	config, err := generateJITConfig(context.Background(), log, t.GitHubClient, enterprise, org, repo, pod, runnerContainer)
+	if err != nil {
+		log.Error(err, "Failed to generate JIT config")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	log.Info("Registered the runner with a JIT config", "runnerID", config.Runner.GetID())
+
+	updated := mutatePodForJIT(pod, config)
+
+	buf, err := json.Marshal(updated)
+	if err != nil {
+		t.Log.Error(err, "Failed to encode new object")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, buf)
+}
+
 func getEnv(container *corev1.Container, key string) (string, bool) {
 	for _, env := range container.Env {
 		if env.Name == key {
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuietHours is the set of recurring time windows during which the unregistration of non-ephemeral runners is deferred,
+// so that scale-downs don't disrupt work that's expected to happen in the windows, like nightly batch jobs.
+//
+// Ephemeral runners are unaffected, as they stop by themselves after running a job anyway.
+type QuietHours struct {
+	windows  []quietHoursWindow
+	location *time.Location
+}
+
+// quietHoursWindow is a window that starts at the start time on each of the weekdays,
+// and ends at the end time on the same day, or on the next day when the end time isn't later than the start time.
+type quietHoursWindow struct {
+	// weekdays is the days of the week the window starts on.
+	weekdays [7]bool
+
+	startHour, startMinute int
+	endHour, endMinute     int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseQuietHours parses the semicolon-separated list of windows in the "[DAYS ]HH:MM-HH:MM" format,
+// where DAYS is a comma-separated list of weekdays or weekday ranges, like "Mon-Fri" or "Sat,Sun".
+// For example, "Mon-Fri 22:00-06:00;Sat,Sun 00:00-00:00" defers unregistrations from 10 PM to 6 AM on weekdays
+// and all day long on weekends.
+//
+// The times are interpreted in the location, which defaults to UTC when nil.
+// An empty spec results in nil, which never defers unregistrations.
+func ParseQuietHours(spec string, location *time.Location) (*QuietHours, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	q := &QuietHours{location: location}
+
+	for _, w := range strings.Split(spec, ";") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+
+		window, err := parseQuietHoursWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours window %q: %w", w, err)
+		}
+
+		q.windows = append(q.windows, window)
+	}
+
+	if len(q.windows) == 0 {
+		return nil, nil
+	}
+
+	return q, nil
+}
+
+func parseQuietHoursWindow(w string) (quietHoursWindow, error) {
+	var window quietHoursWindow
+
+	times := w
+	if fields := strings.Fields(w); len(fields) == 2 {
+		if err := window.parseWeekdays(fields[0]); err != nil {
+			return window, err
+		}
+
+		times = fields[1]
+	} else if len(fields) != 1 {
+		return window, fmt.Errorf(`it must be in the "[DAYS ]HH:MM-HH:MM" format`)
+	} else {
+		// A window without weekdays starts every day
+		for day := range window.weekdays {
+			window.weekdays[day] = true
+		}
+	}
+
+	startEnd := strings.Split(times, "-")
+	if len(startEnd) != 2 {
+		return window, fmt.Errorf(`times must be in the "HH:MM-HH:MM" format`)
+	}
+
+	var err error
+
+	if window.startHour, window.startMinute, err = parseClock(startEnd[0]); err != nil {
+		return window, err
+	}
+
+	if window.endHour, window.endMinute, err = parseClock(startEnd[1]); err != nil {
+		return window, err
+	}
+
+	return window, nil
+}
+
+func (w *quietHoursWindow) parseWeekdays(days string) error {
+	for _, d := range strings.Split(days, ",") {
+		fromTo := strings.Split(d, "-")
+		if len(fromTo) > 2 {
+			return fmt.Errorf("invalid weekday range %q", d)
+		}
+
+		from, ok := weekdayNames[strings.ToLower(fromTo[0])]
+		if !ok {
+			return fmt.Errorf("invalid weekday %q", fromTo[0])
+		}
+
+		to := from
+		if len(fromTo) == 2 {
+			if to, ok = weekdayNames[strings.ToLower(fromTo[1])]; !ok {
+				return fmt.Errorf("invalid weekday %q", fromTo[1])
+			}
+		}
+
+		// A range like "Fri-Mon" wraps around the weekend
+		for day := from; ; day = (day + 1) % 7 {
+			w.weekdays[day] = true
+
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseClock(s string) (int, int, error) {
+	hm := strings.Split(s, ":")
+	if len(hm) != 2 {
+		return 0, 0, fmt.Errorf("invalid time %q: it must be in the HH:MM format", s)
+	}
+
+	h, err := strconv.Atoi(hm[0])
+	if err != nil || h < 0 || h > 23 {
+		return 0, 0, fmt.Errorf("invalid hour in %q", s)
+	}
+
+	m, err := strconv.Atoi(hm[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, 0, fmt.Errorf("invalid minute in %q", s)
+	}
+
+	return h, m, nil
+}
+
+// Active returns true when the time is within any of the windows, along with the time the windows end.
+// When overlapping or adjacent windows are active, it returns the latest end among the windows active at the time,
+// so that the caller can recheck on the end.
+func (q *QuietHours) Active(now time.Time) (bool, time.Time) {
+	if q == nil {
+		return false, time.Time{}
+	}
+
+	now = now.In(q.location)
+
+	var (
+		active bool
+		until  time.Time
+	)
+
+	// A window that started yesterday can still be active when it ends after midnight
+	for _, daysAgo := range []int{0, 1} {
+		day := now.AddDate(0, 0, -daysAgo)
+
+		for _, w := range q.windows {
+			if !w.weekdays[day.Weekday()] {
+				continue
+			}
+
+			start := time.Date(day.Year(), day.Month(), day.Day(), w.startHour, w.startMinute, 0, 0, q.location)
+			end := time.Date(day.Year(), day.Month(), day.Day(), w.endHour, w.endMinute, 0, 0, q.location)
+			if !end.After(start) {
+				end = end.AddDate(0, 0, 1)
+			}
+
+			if now.Before(start) || !now.Before(end) {
+				continue
+			}
+
+			active = true
+
+			if end.After(until) {
+				until = end
+			}
+		}
+	}
+
+	return active, until
+}
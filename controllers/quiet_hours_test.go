@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	for _, spec := range []string{
+		"22:00",
+		"22:00-24:00",
+		"22:00-06:60",
+		"Mon 22:00",
+		"Funday 22:00-06:00",
+		"Mon-Fri-Sat 22:00-06:00",
+		"Mon Tue 22:00-06:00",
+	} {
+		if _, err := ParseQuietHours(spec, time.UTC); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+
+	q, err := ParseQuietHours(" ; ", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != nil {
+		t.Errorf("expected no quiet hours for an empty spec, got %+v", q)
+	}
+}
+
+func TestQuietHours_Active(t *testing.T) {
+	tokyo := time.FixedZone("Asia/Tokyo", 9*60*60)
+
+	// 2022-03-04 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2022, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec      string
+		location  *time.Location
+		now       time.Time
+		wantUntil time.Time
+	}{
+		{
+			spec:      "22:00-06:00",
+			now:       at(4, 23, 0),
+			wantUntil: at(5, 6, 0),
+		},
+		{
+			spec:      "22:00-06:00",
+			now:       at(5, 5, 59),
+			wantUntil: at(5, 6, 0),
+		},
+		{
+			spec: "22:00-06:00",
+			now:  at(5, 6, 0),
+		},
+		{
+			spec: "22:00-06:00",
+			now:  at(4, 21, 59),
+		},
+		{
+			// The window that started on Friday lasts until Saturday morning
+			spec:      "Mon-Fri 22:00-06:00",
+			now:       at(5, 1, 0),
+			wantUntil: at(5, 6, 0),
+		},
+		{
+			spec: "Mon-Fri 22:00-06:00",
+			now:  at(5, 23, 0),
+		},
+		{
+			spec:      "Fri-Mon 00:00-00:00",
+			now:       at(6, 12, 0),
+			wantUntil: at(7, 0, 0),
+		},
+		{
+			spec: "sat,sun 09:00-17:00",
+			now:  at(4, 12, 0),
+		},
+		{
+			// Overlapping windows end at the latest end
+			spec:      "09:00-12:00;Fri 11:00-18:00",
+			now:       at(4, 11, 30),
+			wantUntil: at(4, 18, 0),
+		},
+		{
+			// 22:00-06:00 in Tokyo is 13:00-21:00 in UTC
+			spec:      "22:00-06:00",
+			location:  tokyo,
+			now:       at(4, 14, 0),
+			wantUntil: at(4, 21, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" at "+tt.now.Format(time.RFC3339), func(t *testing.T) {
+			q, err := ParseQuietHours(tt.spec, tt.location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			active, until := q.Active(tt.now)
+
+			if want := !tt.wantUntil.IsZero(); active != want {
+				t.Fatalf("unexpected active: want %v, got %v", want, active)
+			}
+
+			if !until.Equal(tt.wantUntil) {
+				t.Errorf("unexpected until: want %s, got %s", tt.wantUntil, until)
+			}
+		})
+	}
+
+	var nilQuietHours *QuietHours
+	if active, _ := nilQuietHours.Active(at(4, 23, 0)); active {
+		t.Error("expected nil quiet hours to be never active")
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// registrationLatencyWindowSize is the number of the most recent runner registrations the registration grace period is derived from.
+	registrationLatencyWindowSize = 100
+
+	// minRegistrationLatencySamples is the number of observed registrations needed before the derived registration grace period is used.
+	// Until then, DefaultRegistrationGracePeriod is used.
+	minRegistrationLatencySamples = 10
+
+	// registrationLatencyPercentile is the percentile of the observed registration latencies the registration grace period is derived from.
+	registrationLatencyPercentile = 0.95
+
+	// registrationGracePeriodMargin is added to the percentile of the observed registration latencies,
+	// so that a registration that is a bit slower than usual doesn't end up with its runner pod deleted.
+	registrationGracePeriodMargin = time.Minute
+)
+
+// registrationLatencyEstimator keeps track of how long recent runners took to register themselves,
+// i.e. the duration from the runner pod creation until the runner is seen on GitHub,
+// and derives the registration grace period from them.
+//
+// A nil *registrationLatencyEstimator observes nothing and never derives a grace period.
+type registrationLatencyEstimator struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	size    int
+}
+
+func newRegistrationLatencyEstimator(size int) *registrationLatencyEstimator {
+	return &registrationLatencyEstimator{size: size}
+}
+
+// observe records the registration latency of a runner, evicting the oldest one once the window is full.
+func (e *registrationLatencyEstimator) observe(d time.Duration) {
+	if e == nil || d < 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.samples) < e.size {
+		e.samples = append(e.samples, d)
+		return
+	}
+
+	e.samples[e.next] = d
+	e.next = (e.next + 1) % e.size
+}
+
+// gracePeriod returns the registration grace period derived from the observed registration latencies,
+// which is the registrationLatencyPercentile of them plus registrationGracePeriodMargin.
+// The second return value is false when there aren't enough observations yet.
+func (e *registrationLatencyEstimator) gracePeriod() (time.Duration, bool) {
+	if e == nil {
+		return 0, false
+	}
+
+	e.mu.Lock()
+	sorted := make([]time.Duration, len(e.samples))
+	copy(sorted, e.samples)
+	e.mu.Unlock()
+
+	if len(sorted) < minRegistrationLatencySamples {
+		return 0, false
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Nearest-rank percentile
+	i := int(math.Ceil(float64(len(sorted))*registrationLatencyPercentile)) - 1
+
+	return sorted[i] + registrationGracePeriodMargin, true
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistrationLatencyEstimator(t *testing.T) {
+	e := newRegistrationLatencyEstimator(20)
+
+	for i := 1; i < minRegistrationLatencySamples; i++ {
+		e.observe(time.Duration(i) * time.Second)
+	}
+
+	if d, ok := e.gracePeriod(); ok {
+		t.Fatalf("unexpected grace period derived from too few samples: %v", d)
+	}
+
+	// 1s, 2s, ..., 20s
+	for i := minRegistrationLatencySamples; i <= 20; i++ {
+		e.observe(time.Duration(i) * time.Second)
+	}
+
+	if d, ok := e.gracePeriod(); !ok || d != 19*time.Second+registrationGracePeriodMargin {
+		t.Errorf("unexpected grace period: want %v, got %v (%v)", 19*time.Second+registrationGracePeriodMargin, d, ok)
+	}
+
+	// The oldest samples are evicted, resulting in 21s, 22s, ..., 40s
+	for i := 21; i <= 40; i++ {
+		e.observe(time.Duration(i) * time.Second)
+	}
+
+	if d, ok := e.gracePeriod(); !ok || d != 39*time.Second+registrationGracePeriodMargin {
+		t.Errorf("unexpected grace period: want %v, got %v (%v)", 39*time.Second+registrationGracePeriodMargin, d, ok)
+	}
+}
+
+func TestRunnerPodReconciler_registrationGracePeriod(t *testing.T) {
+	r := &RunnerPodReconciler{}
+
+	if d := r.registrationGracePeriod(); d != DefaultRegistrationGracePeriod {
+		t.Errorf("unexpected grace period without the estimator: %v", d)
+	}
+
+	r.registrationLatency = newRegistrationLatencyEstimator(registrationLatencyWindowSize)
+
+	if d := r.registrationGracePeriod(); d != DefaultRegistrationGracePeriod {
+		t.Errorf("unexpected grace period without observations: %v", d)
+	}
+
+	for i := 0; i < minRegistrationLatencySamples; i++ {
+		r.registrationLatency.observe(30 * time.Second)
+	}
+
+	if d := r.registrationGracePeriod(); d != 30*time.Second+registrationGracePeriodMargin {
+		t.Errorf("unexpected derived grace period: %v", d)
+	}
+
+	r.RegistrationGracePeriod = 5 * time.Minute
+
+	if d := r.registrationGracePeriod(); d != 5*time.Minute {
+		t.Errorf("unexpected grace period with the manual override: %v", d)
+	}
+}
@@ -18,18 +18,24 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/actions-runner-controller/actions-runner-controller/hash"
 	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	corev1 "k8s.io/api/core/v1"
@@ -47,17 +53,43 @@ const (
 
 	retryDelayOnGitHubAPIRateLimitError = 30 * time.Second
 
+	// retryDelayOnGitHubAPIServerError is the base delay until retrying a GitHub API call failed due to a transient 5xx error.
+	// The delay exponentially grows up to maxRetryDelayOnGitHubAPIServerError on consecutive failures.
+	retryDelayOnGitHubAPIServerError    = 5 * time.Second
+	maxRetryDelayOnGitHubAPIServerError = time.Minute
+
+	// retryDelayOnUnregistrationLimit is the delay until retrying an unregistration that couldn't start
+	// because too many unregistrations were already in flight.
+	retryDelayOnUnregistrationLimit = 3 * time.Second
+
+	// retryDelayOnPausedUnregistration is the delay until rechecking a runner pod whose unregistration is paused.
+	// It can be long because removing the pause annotation triggers a reconcilation anyway.
+	retryDelayOnPausedUnregistration = 5 * time.Minute
+
+	// retryDelayOnGitHubAPICircuitOpen is the minimum delay until retrying a GitHub API call short-circuited by the GitHub client's
+	// circuit breaker. It's long so that runner pods don't keep being reconciled while GitHub is down.
+	retryDelayOnGitHubAPICircuitOpen = time.Minute
+
 	// This is an annotation internal to actions-runner-controller and can change in backward-incompatible ways
 	annotationKeyRegistrationOnly = "actions-runner-controller/registration-only"
 
 	EnvVarOrg        = "RUNNER_ORG"
 	EnvVarRepo       = "RUNNER_REPO"
 	EnvVarEnterprise = "RUNNER_ENTERPRISE"
+
+	// EnvVarRunnerGroup is the environment variable of the runner container that contains the name of the runner group
+	// the runner registers itself to.
+	EnvVarRunnerGroup = "RUNNER_GROUP"
 )
 
 // RunnerReconciler reconciles a Runner object
 type RunnerReconciler struct {
 	client.Client
+
+	// APIReader reads directly from the API server, bypassing the cache the client reads from.
+	// It's used to fetch the merge bases of runner pod patches. Nil means the merge bases are read from the cache, too.
+	APIReader client.Reader
+
 	Log                         logr.Logger
 	Recorder                    record.EventRecorder
 	Scheme                      *runtime.Scheme
@@ -72,6 +104,13 @@ type RunnerReconciler struct {
 
 	UnregistrationTimeout    time.Duration
 	UnregistrationRetryDelay time.Duration
+
+	// UnregistrationDryRun makes the reconciler log runners it would unregister without actually unregistering them from GitHub.
+	UnregistrationDryRun bool
+
+	// BulkUnregistrationConcurrency is the maximum number of RemoveRunner calls in flight at once
+	// while unregistering all the runners of a RunnerDeployment being deleted.
+	BulkUnregistrationConcurrency int
 }
 
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch;create;update;patch;delete
@@ -122,6 +161,15 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			// An error ocurred
 			return ctrl.Result{}, err
 		}
+
+		// The runner pod of a runner being scaled down can be gone before the runner, like when it was evicted after the unregistration.
+		// Recreating it would register a new runner that races with the runner deletion.
+		if _, ok := getAnnotation(&runner, AnnotationKeyUnregistrationRequestTimestamp); ok {
+			log.V(1).Info("Skipped recreating the runner pod as the runner is being scaled down")
+
+			return ctrl.Result{}, nil
+		}
+
 		return r.processRunnerCreation(ctx, runner, log)
 	}
 
@@ -153,9 +201,21 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	return ctrl.Result{}, nil
 }
 
+// runnerContainerName returns the name of the container that runs the runner agent within the runner pod.
+// It defaults to "runner", and can be overridden via the AnnotationKeyRunnerContainerName annotation for custom pod templates.
+func runnerContainerName(pod *corev1.Pod) string {
+	if name := pod.Annotations[AnnotationKeyRunnerContainerName]; name != "" {
+		return name
+	}
+
+	return containerName
+}
+
 func runnerContainerExitCode(pod *corev1.Pod) *int32 {
+	name := runnerContainerName(pod)
+
 	for _, status := range pod.Status.ContainerStatuses {
-		if status.Name != containerName {
+		if status.Name != name {
 			continue
 		}
 
@@ -167,15 +227,38 @@ func runnerContainerExitCode(pod *corev1.Pod) *int32 {
 	return nil
 }
 
+// podContainerExitCodes returns the exit codes of all the stopped containers in the pod, keyed by container name.
+// Unlike runnerContainerExitCode, this includes sidecar containers like dind,
+// which is useful to diagnose e.g. the runner container exited with 0 but the dind sidecar was OOM-killed.
+func podContainerExitCodes(pod *corev1.Pod) map[string]int32 {
+	codes := map[string]int32{}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil {
+			codes[status.Name] = status.State.Terminated.ExitCode
+		}
+	}
+
+	return codes
+}
+
 func runnerPodOrContainerIsStopped(pod *corev1.Pod) bool {
+	// The runner container of a reused runner pod is restarted in place by the kubelet rather than the runner pod being recreated,
+	// so the runner pod is never considered stopped. It's unregistered and deleted only on scale down.
+	if podIsReused(pod) {
+		return false
+	}
+
 	// If pod has ended up succeeded we need to restart it
 	// Happens e.g. when dind is in runner and run completes
 	stopped := pod.Status.Phase == corev1.PodSucceeded
 
 	if !stopped {
 		if pod.Status.Phase == corev1.PodRunning {
+			name := runnerContainerName(pod)
+
 			for _, status := range pod.Status.ContainerStatuses {
-				if status.Name != containerName {
+				if status.Name != name {
 					continue
 				}
 
@@ -193,6 +276,11 @@ func (r *RunnerReconciler) processRunnerDeletion(runner v1alpha1.Runner, ctx con
 	finalizers, removed := removeFinalizer(runner.ObjectMeta.Finalizers, finalizerName)
 
 	if removed {
+		// This is best-effort. Runners that failed to be unregistered here are unregistered one by one by the runner pod controller.
+		if err := r.unregisterRunnersOfDeletedRunnerDeployment(ctx, log, runner); err != nil {
+			log.Error(err, "Failed to unregister some runners of the deleted runnerdeployment in bulk. They will be unregistered one by one")
+		}
+
 		newRunner := runner.DeepCopy()
 		newRunner.ObjectMeta.Finalizers = finalizers
 
@@ -207,6 +295,100 @@ func (r *RunnerReconciler) processRunnerDeletion(runner v1alpha1.Runner, ctx con
 	return ctrl.Result{}, nil
 }
 
+// unregisterRunnersOfDeletedRunnerDeployment unregisters all the runners of the RunnerDeployment the runner belongs to at once,
+// when the runner is being deleted as a part of the deletion of the whole RunnerDeployment.
+//
+// Otherwise the runner pod controller unregisters the runners one by one on the cascade deletion of the runner pods,
+// which takes long for a large RunnerDeployment.
+// Each unregistered runner pod is annotated as such, so that the runner pod controller doesn't unregister it again.
+func (r *RunnerReconciler) unregisterRunnersOfDeletedRunnerDeployment(ctx context.Context, log logr.Logger, runner v1alpha1.Runner) error {
+	rdName, ok := runner.Labels[LabelKeyRunnerDeploymentName]
+	if !ok {
+		return nil
+	}
+
+	var rd v1alpha1.RunnerDeployment
+	if err := r.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: rdName}, &rd); err == nil && rd.DeletionTimestamp.IsZero() {
+		// The runner is being deleted on scale down, rather than the deletion of the RunnerDeployment.
+		return nil
+	} else if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	var runnerList v1alpha1.RunnerList
+	if err := r.List(ctx, &runnerList, client.InNamespace(runner.Namespace), client.MatchingLabels{LabelKeyRunnerDeploymentName: rdName}); err != nil {
+		return err
+	}
+
+	var (
+		runners []*gogithub.Runner
+		pods    = map[int64]*corev1.Pod{}
+	)
+
+	for _, rn := range runnerList.Items {
+		if rn.DeletionTimestamp.IsZero() || rn.Spec.Enterprise != runner.Spec.Enterprise || rn.Spec.Organization != runner.Spec.Organization || rn.Spec.Repository != runner.Spec.Repository {
+			continue
+		}
+
+		var pod corev1.Pod
+		if err := r.Get(ctx, types.NamespacedName{Namespace: rn.Namespace, Name: rn.Name}, &pod); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if _, done := getAnnotation(&pod, AnnotationKeyUnregistrationCompleteTimestamp); done || metav1.HasAnnotation(pod.ObjectMeta, AnnotationKeyPauseUnregistration) {
+			continue
+		}
+
+		if uid, ok := getAnnotation(&pod, AnnotationKeyRunnerIDPodUID); ok && uid != string(pod.UID) {
+			continue
+		}
+
+		id, err := strconv.ParseInt(podRunnerID(&pod), 10, 64)
+		if err != nil {
+			// The runner isn't registered yet. The runner pod controller handles it with the registration grace period.
+			continue
+		}
+
+		runners = append(runners, &gogithub.Runner{ID: &id, Name: &pod.Name})
+		pods[id] = pod.DeepCopy()
+	}
+
+	if len(runners) == 0 {
+		return nil
+	}
+
+	ghClient, err := githubClientFor(r.GitHubClient, &runner)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Unregistering runners of the deleted runnerdeployment in bulk", "runnerdeployment", rdName, "runners", len(runners))
+
+	removed, unregisterErr := unregisterRunners(ctx, log, r.UnregistrationDryRun, ghClient, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runners, r.bulkUnregistrationConcurrency())
+
+	now := time.Now().Format(time.RFC3339)
+
+	for _, id := range removed {
+		if _, err := annotatePodOnce(ctx, newPodClient(r.Client, r.APIReader), log, pods[id], AnnotationKeyUnregistrationCompleteTimestamp, now); err != nil {
+			return err
+		}
+	}
+
+	return unregisterErr
+}
+
+func (r *RunnerReconciler) bulkUnregistrationConcurrency() int {
+	concurrency := DefaultBulkUnregistrationConcurrency
+
+	if r.BulkUnregistrationConcurrency > 0 {
+		concurrency = r.BulkUnregistrationConcurrency
+	}
+	return concurrency
+}
+
 func (r *RunnerReconciler) processRunnerCreation(ctx context.Context, runner v1alpha1.Runner, log logr.Logger) (reconcile.Result, error) {
 	if updated, err := r.updateRegistrationToken(ctx, runner); err != nil {
 		return ctrl.Result{}, err
@@ -220,6 +402,11 @@ func (r *RunnerReconciler) processRunnerCreation(ctx context.Context, runner v1a
 		return ctrl.Result{}, err
 	}
 
+	// The new runner pod registers a new runner, so the state of the previous runner pod must not be restored onto it.
+	if err := resetRunnerUnregistrationStatus(ctx, r.Client, log, &runner); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.Create(ctx, &newPod); err != nil {
 		if kerrors.IsAlreadyExists(err) {
 			// Gracefully handle pod-already-exists errors due to informer cache delay.
@@ -249,7 +436,13 @@ func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v
 
 	log := r.Log.WithValues("runner", runner.Name)
 
-	rt, err := r.GitHubClient.GetRegistrationToken(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+	ghClient, err := githubClientFor(r.GitHubClient, &runner)
+	if err != nil {
+		log.Error(err, "Failed to create the GitHub client for the runner")
+		return false, err
+	}
+
+	rt, err := ghClient.GetRegistrationToken(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
 	if err != nil {
 		r.Recorder.Event(&runner, corev1.EventTypeWarning, "FailedUpdateRegistrationToken", "Updating registration token failed")
 		log.Error(err, "Failed to get new registration token")
@@ -279,6 +472,11 @@ func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v
 func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 	var template corev1.Pod
 
+	ghClient, err := githubClientFor(r.GitHubClient, &runner)
+	if err != nil {
+		return template, err
+	}
+
 	labels := map[string]string{}
 
 	for k, v := range runner.ObjectMeta.Labels {
@@ -291,7 +489,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 	// - metadata.labels (excluding "runner-template-hash" added by the parent RunnerReplicaSet
 	// - metadata.annotations
 	// - metadata.spec (including image, env, organization, repository, group, and so on)
-	// - GithubBaseURL setting of the controller (can be configured via GITHUB_ENTERPRISE_URL)
+	// - GithubBaseURL setting of the controller (can be configured via GITHUB_ENTERPRISE_URL, or per runner via the github-enterprise-url annotation)
 	//
 	// (2) We don't recreate the runner pod when there are changes in:
 	// - runner.status.registration.token
@@ -308,7 +506,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 		filterLabels(runner.ObjectMeta.Labels, LabelKeyRunnerTemplateHash),
 		runner.ObjectMeta.Annotations,
 		runner.Spec,
-		r.GitHubClient.GithubBaseURL,
+		ghClient.GithubBaseURL,
 		// Token change should trigger replacement.
 		// We need to include this explicitly here because
 		// runner.Spec does not contain the possibly updated token stored in the
@@ -327,7 +525,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 
 	if len(runner.Spec.Containers) == 0 {
 		template.Spec.Containers = append(template.Spec.Containers, corev1.Container{
-			Name:            "runner",
+			Name:            runnerContainerName(&template),
 			ImagePullPolicy: runner.Spec.ImagePullPolicy,
 			EnvFrom:         runner.Spec.EnvFrom,
 			Env:             runner.Spec.Env,
@@ -351,7 +549,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 
 	registrationOnly := metav1.HasAnnotation(runner.ObjectMeta, annotationKeyRegistrationOnly)
 
-	pod, err := newRunnerPod(runner.Name, template, runner.Spec.RunnerConfig, r.RunnerImage, r.RunnerImagePullSecrets, r.DockerImage, r.DockerRegistryMirror, r.GitHubClient.GithubBaseURL, registrationOnly)
+	pod, err := newRunnerPod(runner.Name, template, runner.Spec.RunnerConfig, r.RunnerImage, r.RunnerImagePullSecrets, r.DockerImage, r.DockerRegistryMirror, ghClient.GithubBaseURL, registrationOnly)
 	if err != nil {
 		return pod, err
 	}
@@ -450,8 +648,10 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 func mutatePod(pod *corev1.Pod, token string) *corev1.Pod {
 	updated := pod.DeepCopy()
 
+	name := runnerContainerName(pod)
+
 	for i := range pod.Spec.Containers {
-		if pod.Spec.Containers[i].Name == "runner" {
+		if pod.Spec.Containers[i].Name == name {
 			updated.Spec.Containers[i].Env = append(updated.Spec.Containers[i].Env,
 				corev1.EnvVar{
 					Name:  "RUNNER_NAME",
@@ -474,6 +674,7 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 		dockerdInRunner           bool = runnerSpec.DockerdWithinRunnerContainer != nil && *runnerSpec.DockerdWithinRunnerContainer
 		dockerEnabled             bool = runnerSpec.DockerEnabled == nil || *runnerSpec.DockerEnabled
 		ephemeral                 bool = runnerSpec.Ephemeral == nil || *runnerSpec.Ephemeral
+		reuse                     bool = !ephemeral && runnerSpec.ReusePolicy == v1alpha1.ReusePolicyReuse
 		dockerdInRunnerPrivileged bool = dockerdInRunner
 	)
 
@@ -483,6 +684,25 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 	template.ObjectMeta.Labels = CloneAndAddLabel(template.ObjectMeta.Labels, LabelKeyRunnerSetName, runnerName)
 	template.ObjectMeta.Labels = CloneAndAddLabel(template.ObjectMeta.Labels, LabelKeyPodMutation, LabelValuePodMutation)
 
+	setAnnotation(&template.ObjectMeta, AnnotationKeyEphemeral, fmt.Sprintf("%v", ephemeral))
+
+	if reuse {
+		setAnnotation(&template.ObjectMeta, AnnotationKeyReuse, "true")
+	}
+
+	if ephemeral && runnerSpec.SkipUnregistrationForEphemeral {
+		setAnnotation(&template.ObjectMeta, AnnotationKeySkipUnregistration, "true")
+	}
+
+	if len(runnerSpec.NameRemap) > 0 {
+		nameRemap, err := json.Marshal(runnerSpec.NameRemap)
+		if err != nil {
+			return corev1.Pod{}, err
+		}
+
+		setAnnotation(&template.ObjectMeta, AnnotationKeyRunnerNameRemap, string(nameRemap))
+	}
+
 	workDir := runnerSpec.WorkDir
 	if workDir == "" {
 		workDir = "/runner/_work"
@@ -515,7 +735,7 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 			Value: strings.Join(runnerSpec.Labels, ","),
 		},
 		{
-			Name:  "RUNNER_GROUP",
+			Name:  EnvVarRunnerGroup,
 			Value: runnerSpec.Group,
 		},
 		{
@@ -560,9 +780,11 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 	var runnerContainerIndex, dockerdContainerIndex int
 	var runnerContainer, dockerdContainer *corev1.Container
 
+	name := runnerContainerName(&template)
+
 	for i := range template.Spec.Containers {
 		c := template.Spec.Containers[i]
-		if c.Name == containerName {
+		if c.Name == name {
 			runnerContainerIndex = i
 			runnerContainer = &c
 		} else if c.Name == "docker" {
@@ -574,7 +796,7 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 	if runnerContainer == nil {
 		runnerContainerIndex = -1
 		runnerContainer = &corev1.Container{
-			Name: containerName,
+			Name: name,
 			SecurityContext: &corev1.SecurityContext{
 				// Runner need to run privileged if it contains DinD
 				Privileged: &dockerdInRunnerPrivileged,
@@ -611,7 +833,12 @@ func newRunnerPod(runnerName string, template corev1.Pod, runnerSpec v1alpha1.Ru
 	pod := template.DeepCopy()
 
 	if pod.Spec.RestartPolicy == "" {
-		pod.Spec.RestartPolicy = "OnFailure"
+		if reuse {
+			// The kubelet restarts the runner container in place after it stopped, so that the runner pod is reused.
+			pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+		} else {
+			pod.Spec.RestartPolicy = "OnFailure"
+		}
 	}
 
 	if mtu := runnerSpec.DockerMTU; mtu != nil && dockerdInRunner {
@@ -826,6 +1053,8 @@ func (r *RunnerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&v1alpha1.Runner{}).
 		Owns(&corev1.Pod{}).
 		Named(name).
+		// Failed reconciliations often call GitHub API again on retry, so retries are slowed down when the rate limit is running out.
+		WithOptions(controller.Options{RateLimiter: newGitHubRateLimiter(workqueue.DefaultControllerRateLimiter())}).
 		Complete(r)
 }
 
@@ -876,3 +1105,15 @@ func workVolumeMountPresent(items []corev1.VolumeMount) (bool, int) {
 	}
 	return false, 0
 }
+
+// githubClientFor returns the GitHub client for the runner or the runner pod.
+// It's the client for the GitHub Enterprise Server specified via the github-enterprise-url annotation if any,
+// or the controller-wide client otherwise.
+func githubClientFor(ghClient *github.Client, obj metav1.Object) (*github.Client, error) {
+	enterpriseURL, ok := obj.GetAnnotations()[AnnotationKeyGitHubEnterpriseURL]
+	if !ok {
+		return ghClient, nil
+	}
+
+	return ghClient.WithEnterpriseURL(enterpriseURL)
+}
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestRunnerReconciler_BulkUnregistrationOnRunnerDeploymentDeletion(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var (
+		mu      sync.Mutex
+		removed []string
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners/", func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		removed = append(removed, req.URL.Path)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := metav1.Now()
+
+	newRunner := func(name string) *v1alpha1.Runner {
+		return &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{LabelKeyRunnerDeploymentName: "example"},
+				Finalizers:        []string{finalizerName},
+				DeletionTimestamp: &now,
+			},
+			Spec: v1alpha1.RunnerSpec{
+				RunnerConfig: v1alpha1.RunnerConfig{Repository: "test/valid"},
+			},
+		}
+	}
+
+	newPod := func(name, runnerID string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AnnotationKeyRunnerID: runnerID},
+			},
+		}
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(
+		newRunner("runner1"), newPod("runner1", "1"),
+		newRunner("runner2"), newPod("runner2", "2"),
+		// Not registered yet, so it's left to the runner pod controller.
+		newRunner("runner3"), newPod("runner3", ""),
+	).Build()
+
+	r := &RunnerReconciler{
+		Client:       c,
+		Log:          log,
+		GitHubClient: newGithubClient(server),
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "runner1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(removed)
+	if want := []string{"/repos/test/valid/actions/runners/1", "/repos/test/valid/actions/runners/2"}; len(removed) != len(want) || removed[0] != want[0] || removed[1] != want[1] {
+		t.Fatalf("unexpected RemoveRunner calls: want %v, got %v", want, removed)
+	}
+
+	for name, wantUnregistered := range map[string]bool{"runner1": true, "runner2": true, "runner3": false} {
+		var pod corev1.Pod
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &pod); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, unregistered := getAnnotation(&pod, AnnotationKeyUnregistrationCompleteTimestamp); unregistered != wantUnregistered {
+			t.Errorf("unexpected unregistration of pod %s: want %v, got %v", name, wantUnregistered, unregistered)
+		}
+	}
+
+	// The runner is gone once its finalizer is removed.
+	var runner v1alpha1.Runner
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "runner1"}, &runner); !kerrors.IsNotFound(err) {
+		t.Errorf("expected the runner to be deleted, got %v", err)
+	}
+}
+
+func TestNewRunnerPod_ReusePolicy(t *testing.T) {
+	nonEphemeral := false
+
+	tests := []struct {
+		name              string
+		config            v1alpha1.RunnerConfig
+		wantReuse         bool
+		wantRestartPolicy corev1.RestartPolicy
+	}{
+		{
+			name:              "default",
+			config:            v1alpha1.RunnerConfig{Repository: "test/valid", Ephemeral: &nonEphemeral},
+			wantRestartPolicy: corev1.RestartPolicyOnFailure,
+		},
+		{
+			name:              "reuse",
+			config:            v1alpha1.RunnerConfig{Repository: "test/valid", Ephemeral: &nonEphemeral, ReusePolicy: v1alpha1.ReusePolicyReuse},
+			wantReuse:         true,
+			wantRestartPolicy: corev1.RestartPolicyAlways,
+		},
+		{
+			name:              "ephemeral runners ignore reuse",
+			config:            v1alpha1.RunnerConfig{Repository: "test/valid", ReusePolicy: v1alpha1.ReusePolicyReuse},
+			wantRestartPolicy: corev1.RestartPolicyOnFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, err := newRunnerPod("test1", corev1.Pod{}, tt.config, "runner", nil, "docker", "", "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := podIsReused(&pod); got != tt.wantReuse {
+				t.Errorf("unexpected reuse: want %v, got %v", tt.wantReuse, got)
+			}
+
+			if pod.Spec.RestartPolicy != tt.wantRestartPolicy {
+				t.Errorf("unexpected restart policy: want %s, got %s", tt.wantRestartPolicy, pod.Spec.RestartPolicy)
+			}
+
+			// The runner container exited after a job
+			pod.Status.Phase = corev1.PodRunning
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+			}
+
+			if got, want := runnerPodOrContainerIsStopped(&pod), !tt.wantReuse; got != want {
+				t.Errorf("unexpected stopped: want %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestNewRunnerPod_RunnerContainerName(t *testing.T) {
+	ephemeral := true
+
+	template := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				AnnotationKeyRunnerContainerName: "agent",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "agent"},
+				{Name: "sidecar", Image: "busybox"},
+			},
+		},
+	}
+
+	pod, err := newRunnerPod("test1", template, v1alpha1.RunnerConfig{Repository: "test/valid", Ephemeral: &ephemeral}, "runner", nil, "docker", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name == containerName {
+			t.Fatalf("unexpected default runner container added next to the custom one: %v", pod.Spec.Containers)
+		}
+	}
+
+	if got := runnerContainerName(&pod); got != "agent" {
+		t.Fatalf("unexpected runner container name: want agent, got %s", got)
+	}
+
+	if got := pod.Spec.Containers[0].Image; got != "runner" {
+		t.Errorf("unexpected image of the custom runner container: want runner, got %s", got)
+	}
+
+	// The sidecar exiting must not be mistaken for the runner container exiting
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "agent", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		{Name: "sidecar", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+	}
+
+	if runnerPodOrContainerIsStopped(&pod) {
+		t.Errorf("unexpected stopped while the custom runner container is running")
+	}
+
+	if code := runnerContainerExitCode(&pod); code != nil {
+		t.Errorf("unexpected exit code while the custom runner container is running: %d", *code)
+	}
+
+	// The custom runner container exited after a job
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+
+	if !runnerPodOrContainerIsStopped(&pod) {
+		t.Errorf("unexpected not stopped after the custom runner container exited")
+	}
+
+	if code := runnerContainerExitCode(&pod); code == nil || *code != 0 {
+		t.Errorf("unexpected exit code after the custom runner container exited: %v", code)
+	}
+}
+
+func TestPodContainerExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []corev1.ContainerStatus
+		want     map[string]int32
+	}{
+		{
+			name: "runner exited 0 with the dind sidecar OOM-killed",
+			statuses: []corev1.ContainerStatus{
+				{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+				{Name: "docker", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+			},
+			want: map[string]int32{containerName: 0, "docker": 137},
+		},
+		{
+			name: "non-terminated container",
+			statuses: []corev1.ContainerStatus{
+				{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}},
+				{Name: "docker", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+			want: map[string]int32{containerName: 1},
+		},
+		{
+			name: "no container statuses",
+			want: map[string]int32{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: tt.statuses}}
+
+			if got := podContainerExitCodes(pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected exit codes: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// verifyRunnerPodDeleted verifies that the runner pod whose graceful stop and teardown have completed is deleted
+// within cfg.deletionVerificationTimeout since the completion of the unregistration.
+//
+// The runner has already been unregistered at this point, so a runner pod whose deletion never happens,
+// like when it's blocked by a finalizer or the owner controller lacks the RBAC permission to delete it,
+// would otherwise leave a healthy runner pod without a runner on GitHub forever.
+// Once the timeout passes, it logs and counts the stuck deletion, and clears the registration and the unregistration state
+// recorded in the pod annotations, including the unregistration request, so that the runner pod is tracked afresh.
+// It doesn't re-register the runner by itself. The runner is tracked again once it registers itself again,
+// like when the runner container restarts, and a stuck deletion still needs to be resolved by the operator.
+//
+// It returns a non-nil *ctrl.Result to check on the runner pod again once the timeout passes.
+func verifyRunnerPodDeleted(ctx context.Context, cfg gracefulStopConfig, log logr.Logger, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*ctrl.Result, error) {
+	if cfg.deletionVerificationTimeout <= 0 || !pod.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	completed := annotationTime(pod, AnnotationKeyUnregistrationCompleteTimestamp)
+	if completed == nil {
+		return nil, nil
+	}
+
+	if waited := cfg.now().Sub(completed.Time); waited < cfg.deletionVerificationTimeout {
+		return &ctrl.Result{RequeueAfter: cfg.deletionVerificationTimeout - waited}, nil
+	}
+
+	log = withRunnerScope(log, enterprise, organization, repository, runner, pod)
+
+	log.Info(
+		"Runner pod has not been deleted within the deletion verification timeout after its runner was unregistered. "+
+			"Its deletion is probably blocked by a finalizer or missing RBAC permissions. Resetting the registration state of the runner pod to track it afresh. "+
+			"The runner is not re-registered until it registers itself again, like on the restart of the runner container",
+		"unregistrationCompleteTimestamp", completed.Time,
+		"deletionVerificationTimeout", cfg.deletionVerificationTimeout,
+	)
+
+	metrics.IncRunnerPodStuckDeletions(enterprise, organization, repository)
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		clearRegistrationState(p, AnnotationKeyUnregistrationRequestTimestamp)
+
+		return true
+	})
+	if err != nil {
+		log.Error(err, "Failed to patch pod to clear the registration state")
+		return &ctrl.Result{}, err
+	}
+
+	// Otherwise a stale unregistration state would be restored onto the pod from the Runner status.
+	if err := updateRunnerUnregistrationStatus(ctx, c, log, updated); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	cfg.event(updated, corev1.EventTypeWarning, "RunnerPodDeletionStuck", fmt.Sprintf("Runner pod was not deleted within %s after runner %q was unregistered. Reset the registration state of the runner pod to track it afresh", cfg.deletionVerificationTimeout, runner))
+
+	return nil, nil
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestVerifyRunnerPodDeleted(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name             string
+		timeout          time.Duration
+		completed        time.Duration
+		deleting         bool
+		wantRequeueAfter time.Duration
+		wantReregistered bool
+	}{
+		{
+			name:      "disabled",
+			completed: time.Hour,
+		},
+		{
+			name:             "within the timeout",
+			timeout:          10 * time.Minute,
+			completed:        4 * time.Minute,
+			wantRequeueAfter: 6 * time.Minute,
+		},
+		{
+			name:             "stuck",
+			timeout:          10 * time.Minute,
+			completed:        11 * time.Minute,
+			wantReregistered: true,
+		},
+		{
+			name:      "deletion in progress",
+			timeout:   10 * time.Minute,
+			completed: 11 * time.Minute,
+			deleting:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					Annotations: map[string]string{
+						AnnotationKeyRunnerID:                        "1",
+						AnnotationKeyUnregistrationRequestTimestamp:  now.Add(-time.Hour).Format(time.RFC3339),
+						AnnotationKeyUnregistrationStartTimestamp:    now.Add(-time.Hour).Format(time.RFC3339),
+						AnnotationKeyUnregistrationCompleteTimestamp: now.Add(-tc.completed).Format(time.RFC3339),
+					},
+				},
+			}
+
+			if tc.deleting {
+				deletionTimestamp := metav1.NewTime(now)
+				pod.DeletionTimestamp = &deletionTimestamp
+				pod.Finalizers = []string{"example.com/blocking"}
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				deletionVerificationTimeout: tc.timeout,
+				clock:                       clocktesting.NewFakeClock(now),
+			}
+
+			res, err := verifyRunnerPodDeleted(context.Background(), cfg, log, c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var requeueAfter time.Duration
+			if res != nil {
+				requeueAfter = res.RequeueAfter
+			}
+			if requeueAfter != tc.wantRequeueAfter {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tc.wantRequeueAfter, requeueAfter)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, k := range []string{
+				AnnotationKeyRunnerID,
+				AnnotationKeyUnregistrationRequestTimestamp,
+				AnnotationKeyUnregistrationStartTimestamp,
+				AnnotationKeyUnregistrationCompleteTimestamp,
+			} {
+				if _, ok := updated.Annotations[k]; ok == tc.wantReregistered {
+					t.Errorf("unexpected %s annotation: want present %v, got %v", k, !tc.wantReregistered, ok)
+				}
+			}
+		})
+	}
+}
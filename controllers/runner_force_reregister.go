@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forceRunnerReregistration handles the force-reregister request made via AnnotationKeyForceReregister.
+// It removes the runner from GitHub, and clears the runner ID and the unregistration state recorded in the pod annotations and the Runner status,
+// so that ensureRunnerPodRegistered starts tracking the registration of the runner afresh.
+//
+// It returns the updated pod, or a non-nil *ctrl.Result when the caller should retry later,
+// like when the runner is busy running a job that removing the runner would disrupt.
+func forceRunnerReregistration(ctx context.Context, cfg gracefulStopConfig, log logr.Logger, ghClient GitHubRunnerClient, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	if !metav1.HasAnnotation(pod.ObjectMeta, AnnotationKeyForceReregister) {
+		return pod, nil, nil
+	}
+
+	log = withRunnerScope(log, enterprise, organization, repository, runner, pod)
+
+	if id, ok := getAnnotation(pod, AnnotationKeyRunnerID); ok {
+		runnerID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, &ctrl.Result{}, err
+		}
+
+		getCtx, cancelGet := cfg.withAPITimeout(ctx)
+		r, err := ghClient.GetRunnerByID(getCtx, enterprise, organization, repository, runnerID)
+		cancelGet()
+
+		if err != nil {
+			return nil, &ctrl.Result{RequeueAfter: cfg.retryDelay}, err
+		}
+
+		if safe, reason := runnerDeletionSafety(r); !safe {
+			log.Info("Postponed the forced re-registration of the runner", "runnerID", runnerID, "reason", reason, "retryDelay", cfg.retryDelay)
+
+			return nil, &ctrl.Result{RequeueAfter: cfg.retryDelay}, nil
+		}
+
+		if r == nil {
+			log.Info("Runner is already gone from GitHub. Skipped removing it for the forced re-registration", "runnerID", runnerID)
+		} else {
+			removeCtx, cancelRemove := cfg.withAPITimeout(ctx)
+			err := ghClient.RemoveRunner(removeCtx, enterprise, organization, repository, runnerID)
+			cancelRemove()
+
+			if errRes := (&gogithub.ErrorResponse{}); errors.As(err, &errRes) && errRes.Response.StatusCode == http.StatusNotFound {
+				err = nil
+			}
+
+			if err != nil {
+				log.Error(err, "Failed to remove the runner for the forced re-registration", "runnerID", runnerID)
+
+				return nil, &ctrl.Result{RequeueAfter: cfg.retryDelay}, err
+			}
+
+			log.Info("Removed the runner from GitHub for the forced re-registration", "runnerID", runnerID)
+		}
+	}
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		clearRegistrationState(p, AnnotationKeyForceReregister)
+
+		return true
+	})
+	if err != nil {
+		log.Error(err, "Failed to patch pod to clear the registration state for the forced re-registration")
+		return nil, &ctrl.Result{}, err
+	}
+
+	// Otherwise a stale unregistration state would be restored onto the pod from the Runner status.
+	if err := updateRunnerUnregistrationStatus(ctx, c, log, updated); err != nil {
+		return nil, &ctrl.Result{}, err
+	}
+
+	cfg.event(updated, corev1.EventTypeNormal, "RunnerReregistrationForced", fmt.Sprintf("Forced re-registration of runner %q", runner))
+
+	return updated, nil, nil
+}
+
+// clearRegistrationState removes the annotations recording the registration and the unregistration of the runner from the pod,
+// along with the extra annotation keys, so that ensureRunnerPodRegistered starts tracking the registration of the runner afresh.
+func clearRegistrationState(pod *corev1.Pod, extraKeys ...string) {
+	keys := append([]string{
+		AnnotationKeyRunnerID,
+		AnnotationKeyRunnerIDPodUID,
+		AnnotationKeyRegistrationCheckStartTimestamp,
+		AnnotationKeyRegistrationCheckAbandonedTimestamp,
+		AnnotationKeyUnregistrationStartTimestamp,
+		AnnotationKeyUnregistrationCompleteTimestamp,
+		AnnotationKeyUnregistrationRetryCount,
+		AnnotationKeyUnregistrationRetryReason,
+		AnnotationKeyUnregistrationAttempts,
+		AnnotationKeyLastUnregistrationError,
+		AnnotationKeyUnregistrationBranch,
+		AnnotationKeyOfflineTimestamp,
+		AnnotationKeyUnregistrationCancelTimestamp,
+	}, extraKeys...)
+
+	for _, k := range keys {
+		delete(pod.Annotations, k)
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestForceRunnerReregistration(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	tcs := []struct {
+		name        string
+		busy        bool
+		getStatus   int
+		wantRemoved bool
+		wantRequeue bool
+	}{
+		{
+			name:        "idle runner",
+			getStatus:   http.StatusOK,
+			wantRemoved: true,
+		},
+		{
+			name:        "busy runner",
+			busy:        true,
+			getStatus:   http.StatusOK,
+			wantRequeue: true,
+		},
+		{
+			name:      "runner already gone",
+			getStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var removed bool
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+				switch req.Method {
+				case http.MethodGet:
+					w.WriteHeader(tc.getStatus)
+					if tc.getStatus == http.StatusOK {
+						fmt.Fprintf(w, `{"id": 1, "name": "test1", "os": "linux", "status": "offline", "busy": %t}`, tc.busy)
+					} else {
+						fmt.Fprint(w, `{"message": "Not Found"}`)
+					}
+				case http.MethodDelete:
+					removed = true
+					w.WriteHeader(http.StatusNoContent)
+				}
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					Annotations: map[string]string{
+						AnnotationKeyForceReregister:                 "",
+						AnnotationKeyRunnerID:                        "1",
+						AnnotationKeyRegistrationCheckStartTimestamp: time.Now().Format(time.RFC3339),
+						AnnotationKeyUnregistrationStartTimestamp:    time.Now().Format(time.RFC3339),
+					},
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{retryDelay: DefaultUnregistrationRetryDelay}
+
+			_, res, err := forceRunnerReregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (res != nil) != tc.wantRequeue {
+				t.Fatalf("unexpected result: want requeue %v, got %+v", tc.wantRequeue, res)
+			}
+			if removed != tc.wantRemoved {
+				t.Errorf("unexpected removal: want %v, got %v", tc.wantRemoved, removed)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, k := range []string{
+				AnnotationKeyForceReregister,
+				AnnotationKeyRunnerID,
+				AnnotationKeyRegistrationCheckStartTimestamp,
+				AnnotationKeyUnregistrationStartTimestamp,
+			} {
+				if _, ok := updated.Annotations[k]; ok == !tc.wantRequeue {
+					t.Errorf("unexpected %s annotation: want present %v, got %v", k, tc.wantRequeue, ok)
+				}
+			}
+		})
+	}
+}
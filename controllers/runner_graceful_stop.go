@@ -4,18 +4,372 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
 	"github.com/go-logr/logr"
 	gogithub "github.com/google/go-github/v39/github"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// GitHubRunnerClient is the subset of *github.Client the runner graceful stop process uses to look up and unregister runners.
+// It's satisfied by *github.Client in production, and by *fake.RunnerClient in tests, which returns programmed responses
+// without a real GitHub.
+type GitHubRunnerClient interface {
+	ListRunnersInGroup(ctx context.Context, enterprise, org, repo string, groupID int64) ([]*gogithub.Runner, error)
+	GetRunnerByID(ctx context.Context, enterprise, org, repo string, runnerID int64) (*gogithub.Runner, error)
+	RemoveRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) error
+	GetRunnerGroupIDByName(ctx context.Context, enterprise, org, name string) (int64, error)
+	RetryDelayOnRateLimit(err error, now time.Time, defaultDelay time.Duration) time.Duration
+}
+
+var _ GitHubRunnerClient = &github.Client{}
+
+// gracefulStopConfig is the set of controller-wide settings for tickRunnerGracefulStop.
+type gracefulStopConfig struct {
+	unregistrationTimeout   time.Duration
+	retryDelay              time.Duration
+	registrationGracePeriod time.Duration
+
+	// apiTimeout is the timeout of each GitHub API call.
+	apiTimeout time.Duration
+
+	// retryableStatusCodes is the HTTP status codes of failed RemoveRunner API calls that are retried with backoff.
+	// Empty means DefaultRetryableGitHubStatusCodes.
+	retryableStatusCodes []int
+
+	// maxUnregistrationAttempts is the number of failed unregistration attempts after which the runner pod is allowed to be deleted
+	// without the runner being unregistered. Zero means ARC never gives up.
+	maxUnregistrationAttempts int
+
+	// timeoutWarningThreshold is the fraction of the unregistration timeout after which a one-time warning event is emitted
+	// for a runner that is still being unregistered. Zero disables the warning.
+	timeoutWarningThreshold float64
+
+	// drainReadinessGate is the condition type of the readiness gate that is set to False on the start of the graceful stop
+	// of a runner pod that declares it. Empty disables it.
+	drainReadinessGate corev1.PodConditionType
+
+	// blockStopCondition is the type of the pod condition that, while True, keeps a runner pod whose unregistration has timed out
+	// from being deleted, up to maxBlockStopDuration past the unregistration timeout. Empty disables it.
+	// See RunnerPodReconciler.BlockStopConditionType for the contract.
+	blockStopCondition corev1.PodConditionType
+
+	// maxBlockStopDuration is the hard cap of how long blockStopCondition can delay the deletion past the unregistration timeout.
+	maxBlockStopDuration time.Duration
+
+	// dryRun makes the graceful stop process log the runner it would unregister, instead of actually calling the RemoveRunner API.
+	// This is useful to validate scale-down behaviors without unregistering real runners from GitHub.
+	dryRun bool
+
+	// verifyRunnerID makes the graceful stop process get the runner by the ID recorded in the pod annotation and confirm that
+	// it still has the expected name before removing it, so that a runner ID reassigned to another runner, like after a GHES restore,
+	// doesn't result in removing the wrong runner. It costs an extra GitHub API call per unregistration.
+	verifyRunnerID bool
+
+	// onlyUnregisterOffline makes the graceful stop process unregister a non-ephemeral runner only when GitHub reports it offline,
+	// or its runner container has stopped. An online and idle runner is kept, as it might pick up a job,
+	// which reduces churn for persistent runner pools.
+	onlyUnregisterOffline bool
+
+	// offlineGracePeriod is the duration a runner needs to be seen offline on GitHub during the graceful stop,
+	// after which the runner pod is safe for deletion even if GitHub still reports the runner busy.
+	// A runner whose pod was killed along with its node in the middle of a job can linger on GitHub as offline but busy,
+	// which would otherwise keep cancelling or retrying the graceful stop. Zero disables it.
+	offlineGracePeriod time.Duration
+
+	// requeueJitter is the fraction of the randomized jitter added to requeue delays,
+	// so that many runners reconciled at once, like after a controller restart, don't requeue at the same instant.
+	// For example, 0.2 results in a requeue delay of ±20% from the original delay. Zero disables the jitter.
+	requeueJitter float64
+
+	// recorder is used to emit events onto the runner pod on key transitions of the graceful stop process.
+	// It can be nil, in which case no event is emitted.
+	recorder record.EventRecorder
+
+	// unregistrationLimiter limits the number of concurrent unregistrations controller-wide.
+	// It can be nil, in which case the concurrency is unlimited.
+	unregistrationLimiter *unregistrationLimiter
+
+	// progressLogThrottle limits how often the in-progress unregistration of each runner pod is logged,
+	// so that a long drain doesn't log on every retry.
+	// It can be nil, in which case the progress is logged on every retry.
+	progressLogThrottle *logThrottle
+
+	// quietHours is the recurring time windows during which the unregistration of non-ephemeral runners is deferred.
+	// It can be nil, in which case unregistrations are never deferred.
+	quietHours *QuietHours
+
+	// deletionVerificationTimeout is the time a runner pod is given to be deleted once its graceful stop has completed,
+	// after which verifyRunnerPodDeleted resets the registration state of the runner pod. Zero disables it.
+	deletionVerificationTimeout time.Duration
+
+	// clock is used to tell the current time, so that tests can deterministically advance the time
+	// to hit the registration grace period and the unregistration timeout.
+	// It can be nil, in which case the real clock is used.
+	clock clock.Clock
+}
+
+// unregistrationLimiter is a semaphore that limits the number of RemoveRunner API calls in flight,
+// so that a big scale-down doesn't result in dozens of runner pods calling GitHub API at once.
+// A nil *unregistrationLimiter never limits.
+type unregistrationLimiter struct {
+	tokens chan struct{}
+}
+
+func newUnregistrationLimiter(max int) *unregistrationLimiter {
+	return &unregistrationLimiter{tokens: make(chan struct{}, max)}
+}
+
+// tryAcquire returns true if it acquired a token. It never blocks, so that the caller can requeue instead of
+// occupying a reconciler worker.
+func (l *unregistrationLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *unregistrationLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l.tokens
+}
+
+// logThrottle allows a log line at most once per interval per runner pod.
+// It's in-memory, so a controller restart makes every runner pod log once more, which is fine for logs.
+// A nil *logThrottle never throttles.
+type logThrottle struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[types.UID]time.Time
+}
+
+func newLogThrottle(interval time.Duration) *logThrottle {
+	return &logThrottle{interval: interval, last: map[types.UID]time.Time{}}
+}
+
+// allow returns true when the pod hasn't been allowed to log in the last interval, and records the time if so.
+func (t *logThrottle) allow(pod *corev1.Pod, now time.Time) bool {
+	if t == nil || pod == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[pod.UID]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+
+	// Forget runner pods that stopped logging, like ones that have been deleted, so that the map doesn't grow forever.
+	for uid, last := range t.last {
+		if now.Sub(last) >= t.interval {
+			delete(t.last, uid)
+		}
+	}
+
+	t.last[pod.UID] = now
+
+	return true
+}
+
+func (c gracefulStopConfig) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+
+	return c.clock.Now()
+}
+
+func (c gracefulStopConfig) event(pod *corev1.Pod, eventtype, reason, message string) {
+	if c.recorder == nil || pod == nil {
+		return
+	}
+
+	// The node name helps to correlate slow graceful stops with a problematic node.
+	if pod.Spec.NodeName != "" {
+		message = fmt.Sprintf("%s (node %q)", message, pod.Spec.NodeName)
+	}
+
+	c.recorder.Event(pod, eventtype, reason, message)
+}
+
+func (c gracefulStopConfig) isRetryableStatusCode(status int) bool {
+	codes := c.retryableStatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryableGitHubStatusCodes
+	}
+
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withAPITimeout returns a context for a single GitHub API call, derived from ctx.
+// The context is canceled either after the apiTimeout or when ctx is done, whichever comes first.
+func (c gracefulStopConfig) withAPITimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.apiTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.apiTimeout)
+}
+
+// gracefulStopReason tells why a tick of the graceful stop process ended the way it did.
+// It's used by the caller of tickRunnerGracefulStopWithReason to label its metrics.
+type gracefulStopReason string
+
+const (
+	// gracefulStopReasonCompleted means that the runner is considered to have gracefully stopped.
+	gracefulStopReasonCompleted gracefulStopReason = "completed"
+	// gracefulStopReasonTimedOut means that the unregistration has been timed out so the runner pod is safe for deletion anyway.
+	gracefulStopReasonTimedOut gracefulStopReason = "timed_out"
+	// gracefulStopReasonGaveUp means that ARC gave up unregistering the runner after too many failed attempts.
+	gracefulStopReasonGaveUp gracefulStopReason = "gave_up"
+	// gracefulStopReasonRunnerStopped means that the runner container has already stopped but the unregistration failed.
+	gracefulStopReasonRunnerStopped gracefulStopReason = "runner_stopped"
+	// gracefulStopReasonRunnerOffline means that the runner has been offline for the offline grace period while GitHub reports it busy,
+	// so the runner pod is safe for deletion although the runner couldn't be unregistered.
+	gracefulStopReasonRunnerOffline gracefulStopReason = "runner_offline"
+	// gracefulStopReasonRegistrationFailed means that the runner has never been registered and its container is crash-looping,
+	// so the runner pod is safe for deletion without waiting for the registration grace period.
+	gracefulStopReasonRegistrationFailed gracefulStopReason = "registration_failed"
+
+	// gracefulStopReasonRunnerBusy means that the runner is still running a job, so the unregistration is retried later.
+	gracefulStopReasonRunnerBusy gracefulStopReason = "runner_busy"
+	// gracefulStopReasonRunnerOnline means that the non-ephemeral runner is still online and kept registered
+	// as only offline runners are unregistered, so the unregistration is retried later.
+	gracefulStopReasonRunnerOnline gracefulStopReason = "runner_online"
+	// gracefulStopReasonRateLimited means that the unregistration is delayed due to GitHub API rate limits.
+	gracefulStopReasonRateLimited gracefulStopReason = "rate_limited"
+	// gracefulStopReasonRegistrationGracePeriod means that the runner isn't registered yet and ARC is waiting for the registration grace period to pass.
+	gracefulStopReasonRegistrationGracePeriod gracefulStopReason = "registration_grace_period"
+	// gracefulStopReasonInProgress means that the runner wasn't seen on GitHub and ARC is waiting for the unregistration timeout.
+	gracefulStopReasonInProgress gracefulStopReason = "in_progress"
+	// gracefulStopReasonThrottled means that the unregistration is delayed as too many unregistrations are in flight.
+	gracefulStopReasonThrottled gracefulStopReason = "throttled"
+	// gracefulStopReasonBlockStop means that the unregistration has timed out, but the deletion of the runner pod is delayed
+	// as the block-stop pod condition is True.
+	gracefulStopReasonBlockStop gracefulStopReason = "block_stop"
+	// gracefulStopReasonProtectedJob means that the unregistration has timed out, but the deletion of the runner pod is delayed
+	// as the runner is running a protected job.
+	gracefulStopReasonProtectedJob gracefulStopReason = "protected_job"
+	// gracefulStopReasonJobRunning means that the unregistration is deferred as the runner is running a job whose timeout has been recorded
+	// onto the runner pod, and neither the job timeout nor the unregistration timeout has elapsed yet.
+	gracefulStopReasonJobRunning gracefulStopReason = "job_running"
+	// gracefulStopReasonPaused means that the unregistration is paused via the pause-unregistration annotation.
+	gracefulStopReasonPaused gracefulStopReason = "paused"
+	// gracefulStopReasonQuietHours means that the unregistration of the non-ephemeral runner is deferred until the quiet hours end.
+	gracefulStopReasonQuietHours gracefulStopReason = "quiet_hours"
+	// gracefulStopReasonServerError means that the unregistration failed due to a GitHub API server error,
+	// or any other error with a retryable status code.
+	gracefulStopReasonServerError gracefulStopReason = "server_error"
+	// gracefulStopReasonRunnerIDMismatch means that the recorded runner ID turned out to belong to a runner with another name,
+	// so ARC forgot the ID and will look up the runner by name on the next try.
+	gracefulStopReasonRunnerIDMismatch gracefulStopReason = "runner_id_mismatch"
+	// gracefulStopReasonCircuitOpen means that the unregistration is delayed as the GitHub client's circuit breaker is open.
+	gracefulStopReasonCircuitOpen gracefulStopReason = "circuit_open"
+	// gracefulStopReasonError means that the tick failed due to any other error, including Kubernetes API errors.
+	gracefulStopReasonError gracefulStopReason = "error"
+)
+
+// runnerTerminationReason returns the termination reason recorded onto the Runner status for the graceful stop
+// that has completed with the reason, so that the runner pod is about to be deleted.
+func runnerTerminationReason(reason gracefulStopReason) string {
+	switch reason {
+	case gracefulStopReasonTimedOut, gracefulStopReasonGaveUp:
+		return v1alpha1.RunnerTerminationReasonTimedOutAndForceDeleted
+	case gracefulStopReasonRunnerStopped, gracefulStopReasonRunnerOffline, gracefulStopReasonRegistrationFailed:
+		return v1alpha1.RunnerTerminationReasonCrashedAndDeleted
+	default:
+		return v1alpha1.RunnerTerminationReasonUnregisteredAndDeleted
+	}
+}
+
+// unregistrationBranch is the short code of the decision an evaluation of the runner unregistration ended up with.
+// It's recorded in the AnnotationKeyUnregistrationBranch annotation for debugging.
+type unregistrationBranch string
+
+const (
+	// unregistrationBranchUnregistered means that the runner has just been unregistered, or had already been removed from GitHub.
+	unregistrationBranchUnregistered unregistrationBranch = "unregistered"
+	// unregistrationBranchAlreadyMarked means that the runner pod had been marked as unregistered in a previous reconcilation.
+	unregistrationBranchAlreadyMarked unregistrationBranch = "already-marked"
+	// unregistrationBranchPodStopped means that the runner was not found on GitHub and the runner pod or container has stopped.
+	unregistrationBranchPodStopped unregistrationBranch = "pod-stopped"
+	// unregistrationBranchRegistrationFailed means that the runner has never been registered and its container is crash-looping.
+	unregistrationBranchRegistrationFailed unregistrationBranch = "registration-failed"
+	// unregistrationBranchRegistrationGracePeriod means that the runner is not registered yet and ARC waits for the registration grace period.
+	unregistrationBranchRegistrationGracePeriod unregistrationBranch = "registration-grace-period"
+	// unregistrationBranchInProgress means that the unregistration has started but hasn't completed nor timed out yet.
+	unregistrationBranchInProgress unregistrationBranch = "in-progress"
+	// unregistrationBranchTimedOut means that the unregistration has timed out.
+	unregistrationBranchTimedOut unregistrationBranch = "timed-out"
+	// unregistrationBranchBlockStop means that the unregistration has timed out but the block-stop pod condition keeps the runner pod.
+	unregistrationBranchBlockStop unregistrationBranch = "block-stop"
+	// unregistrationBranchProtectedJob means that the unregistration has timed out but the runner pod is kept as it's running a protected job.
+	unregistrationBranchProtectedJob unregistrationBranch = "protected-job"
+	// unregistrationBranchJobRunning means that the runner isn't unregistered yet as it's running a job whose timeout hasn't elapsed.
+	unregistrationBranchJobRunning unregistrationBranch = "job-running"
+	// unregistrationBranchSkipped means that the ephemeral runner has stopped and its unregistration is skipped as configured.
+	unregistrationBranchSkipped unregistrationBranch = "skipped"
+	// unregistrationBranchFallthrough means that none of the above applied, which is kept for backward-compatibility.
+	unregistrationBranchFallthrough unregistrationBranch = "fallthrough"
+)
+
+// unregistrationOutcome tells how an attempt to unregister a runner ended up.
+// Unlike gracefulStopReason, it's recorded only when ARC reached a conclusion about the runner on GitHub,
+// and is used to label the arc_runner_unregistrations_total metric.
+type unregistrationOutcome string
+
+const (
+	unregistrationOutcomeSuccess      unregistrationOutcome = "success"
+	unregistrationOutcomeAlreadyGone  unregistrationOutcome = "already_gone"
+	unregistrationOutcomeBusyRequeued unregistrationOutcome = "busy_requeued"
+	unregistrationOutcomeRateLimited  unregistrationOutcome = "rate_limited"
+	unregistrationOutcomeTimedOut     unregistrationOutcome = "timed_out"
+	unregistrationOutcomeError        unregistrationOutcome = "error"
+
+	// unregistrationOutcomeRegistrationFailed means that there was nothing to unregister as the runner never registered itself.
+	unregistrationOutcomeRegistrationFailed unregistrationOutcome = "registration_failed"
+
+	// unregistrationOutcomeSkipped means that ARC didn't unregister the stopped ephemeral runner, trusting GitHub to have removed it.
+	unregistrationOutcomeSkipped unregistrationOutcome = "skipped"
+)
+
 // tickRunnerGracefulStop reconciles the runner and the runner pod in a way so that
 // we can delete the runner pod without disrupting a workflow job.
 //
@@ -26,177 +380,1807 @@ import (
 // This function is designed to complete a lengthy graceful stop process in a unblocking way.
 // When it wants to be retried later, the function returns a non-nil *ctrl.Result as the second return value, may or may not populating the error in the second return value.
 // The caller is expected to return the returned ctrl.Result and error to postpone the current reconcilation loop and trigger a scheduled retry.
-func tickRunnerGracefulStop(ctx context.Context, unregistrationTimeout time.Duration, retryDelay time.Duration, log logr.Logger, ghClient *github.Client, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
-	pod, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationStartTimestamp, time.Now().Format(time.RFC3339))
+func tickRunnerGracefulStop(ctx context.Context, cfg gracefulStopConfig, log logr.Logger, ghClient GitHubRunnerClient, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	pod, res, _, err := tickRunnerGracefulStopWithReason(ctx, cfg, log, ghClient, c, enterprise, organization, repository, runner, pod)
+	return pod, res, err
+}
+
+// tickRunnerGracefulStopWithReason is the same as tickRunnerGracefulStop, except that it also returns the reason
+// why the graceful stop has completed or needs to be retried later.
+func tickRunnerGracefulStopWithReason(ctx context.Context, cfg gracefulStopConfig, log logr.Logger, ghClient GitHubRunnerClient, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, gracefulStopReason, error) {
+	log = withRunnerScope(log, enterprise, organization, repository, runner, pod)
+
+	pod, err := restoreUnregistrationState(ctx, c, log, pod)
+	if err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	// The runner might have been unregistered in a previous reconcilation loop, or in bulk by the runner controller
+	// on the deletion of the whole RunnerDeployment. There's no point in calling GitHub API again in that case.
+	if _, completed := getAnnotation(pod, AnnotationKeyUnregistrationCompleteTimestamp); completed {
+		return pod, nil, gracefulStopReasonCompleted, nil
+	}
+
+	_, started := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp)
+
+	pod, err = annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationStartTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	if err := updateRunnerUnregistrationStatus(ctx, c, log, pod); err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	if !started {
+		cfg.event(pod, corev1.EventTypeNormal, "RunnerUnregistrationStarted", fmt.Sprintf("Started unregistering runner %q", runner))
+	}
+
+	// The runner pod is made unready before the runner is unregistered, so that external systems can react to the graceful stop first.
+	pod, err = setDrainReadinessGate(ctx, cfg, c, log, pod)
+	if err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	res, reason, err := ensureRunnerUnregistration(ctx, cfg, log, ghClient, c, enterprise, organization, repository, runner, pod)
+	if res != nil {
+		return nil, withRequeueJitter(res, cfg.requeueJitter), reason, err
+	}
+
+	_, completed := getAnnotation(pod, AnnotationKeyUnregistrationCompleteTimestamp)
+
+	pod, err = annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationCompleteTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	if err := updateRunnerUnregistrationStatus(ctx, c, log, pod); err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	// The caller deletes the runner pod once we return it, so this is the last chance to record why.
+	if err := updateRunnerTerminationReason(ctx, c, log, pod, runnerTerminationReason(reason)); err != nil {
+		return nil, &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	if !completed {
+		if d, ok := gracefulStopDuration(pod); ok {
+			metrics.ObserveRunnerGracefulStopDuration(enterprise, organization, repository, d)
+		}
+
+		cfg.event(pod, corev1.EventTypeNormal, "RunnerUnregistrationCompleted", fmt.Sprintf("Completed unregistering runner %q", runner))
+	}
+
+	return pod, nil, reason, nil
+}
+
+// withRunnerScope returns the logger that carries the scope of the runner, so that every log line of the graceful stop
+// tells which enterprise, organization, or repository it refers to, even in a multi-org installation.
+// Empty scope fields are omitted.
+func withRunnerScope(log logr.Logger, enterprise, organization, repository, runner string, pod *corev1.Pod) logr.Logger {
+	var kvs []interface{}
+
+	for _, kv := range []struct {
+		k, v string
+	}{
+		{"enterprise", enterprise},
+		{"organization", organization},
+		{"repository", repository},
+		{"runner", runner},
+	} {
+		if kv.v != "" {
+			kvs = append(kvs, kv.k, kv.v)
+		}
+	}
+
+	if pod != nil && pod.Name != "" {
+		kvs = append(kvs, "pod", pod.Name)
+	}
+
+	if pod != nil && pod.Spec.NodeName != "" {
+		kvs = append(kvs, "node", pod.Spec.NodeName)
+	}
+
+	if len(kvs) == 0 {
+		return log
+	}
+
+	return log.WithValues(kvs...)
+}
+
+// gracefulStopDuration returns the duration between the unregistration start and complete timestamps recorded in the pod annotations.
+// The second return value is false when either of the timestamps is missing or unparsable.
+func gracefulStopDuration(pod *corev1.Pod) (time.Duration, bool) {
+	start, ok := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp)
+	if !ok {
+		return 0, false
+	}
+
+	complete, ok := getAnnotation(pod, AnnotationKeyUnregistrationCompleteTimestamp)
+	if !ok {
+		return 0, false
+	}
+
+	s, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return 0, false
+	}
+
+	c, err := time.Parse(time.RFC3339, complete)
 	if err != nil {
-		return nil, &ctrl.Result{}, err
+		return 0, false
 	}
 
-	if res, err := ensureRunnerUnregistration(ctx, unregistrationTimeout, retryDelay, log, ghClient, enterprise, organization, repository, runner, pod); res != nil {
-		return nil, res, err
+	return c.Sub(s), true
+}
+
+// podLingeringDuration returns the duration between the runner pod being seen stopped, as recorded in the stopped timestamp annotation,
+// and its deletion timestamp.
+// The second return value is false when the pod isn't marked for deletion, or the stopped timestamp is missing or unparsable.
+func podLingeringDuration(pod *corev1.Pod) (time.Duration, bool) {
+	if pod.DeletionTimestamp.IsZero() {
+		return 0, false
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyStoppedTimestamp)
+	if !ok {
+		return 0, false
 	}
 
-	pod, err = annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationCompleteTimestamp, time.Now().Format(time.RFC3339))
+	t, err := time.Parse(time.RFC3339, v)
 	if err != nil {
-		return nil, &ctrl.Result{}, err
+		return 0, false
 	}
 
-	return pod, nil, nil
+	return pod.DeletionTimestamp.Sub(t), true
 }
 
 // annotatePodOnce annotates the pod if it wasn't.
 // Returns the provided pod as-is if it was already annotated.
+// The provided pod can be read from the cache. As an annotation is never missing from the cache once it's seen there,
+// the pod is checked first, and then the pod patchPod fetches is checked again before it's patched.
 // Returns the updated pod if the pod was missing the annotation and the update to add the annotation succeeded.
 func annotatePodOnce(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, k, v string) (*corev1.Pod, error) {
 	if pod == nil {
 		return nil, nil
 	}
 
-	if _, ok := getAnnotation(pod, k); ok {
+	if _, ok := getAnnotation(pod, k); ok {
+		return pod, nil
+	}
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		if _, ok := getAnnotation(p, k); ok {
+			return false
+		}
+
+		setAnnotation(&p.ObjectMeta, k, v)
+		return true
+	})
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", k))
+		return nil, err
+	}
+
+	log.V(2).Info("Annotated pod", "key", k, "value", v)
+
+	return updated, nil
+}
+
+// annotatePodUpdate annotates the pod, overwriting the existing value if any.
+// Unlike annotatePodOnce, this is intended for annotations whose values change over time.
+// Returns the provided pod as-is if it already has the same value.
+// Like annotatePodOnce, the value is compared against the provided pod and then against the pod patchPod fetches.
+func annotatePodUpdate(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, k, v string) (*corev1.Pod, error) {
+	if pod == nil {
+		return nil, nil
+	}
+
+	if current, ok := getAnnotation(pod, k); ok && current == v {
+		return pod, nil
+	}
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		if current, ok := getAnnotation(p, k); ok && current == v {
+			return false
+		}
+
+		setAnnotation(&p.ObjectMeta, k, v)
+		return true
+	})
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to update %s annotation", k))
+		return nil, err
+	}
+
+	log.V(2).Info("Updated pod annotation", "key", k, "value", v)
+
+	return updated, nil
+}
+
+// unannotatePod removes the annotation from the pod if it exists.
+// Returns the provided pod as-is if it didn't have the annotation.
+func unannotatePod(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, k string) (*corev1.Pod, error) {
+	if pod == nil {
+		return nil, nil
+	}
+
+	if _, ok := getAnnotation(pod, k); !ok {
+		return pod, nil
+	}
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		if _, ok := getAnnotation(p, k); !ok {
+			return false
+		}
+
+		delete(p.Annotations, k)
+		return true
+	})
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to remove %s annotation", k))
+		return nil, err
+	}
+
+	log.V(2).Info("Removed pod annotation", "key", k)
+
+	return updated, nil
+}
+
+// podClient is the client the graceful stop process reads and writes runner pods with.
+// Reads go through the embedded client, which is the manager's client backed by the shared informer cache,
+// so that every read in a reconcilation loop sees the same, possibly slightly stale, view of the pod.
+// apiReader reads directly from the API server, and is used only to fetch the merge base of a pod patch.
+type podClient struct {
+	client.Client
+
+	apiReader client.Reader
+}
+
+// newPodClient returns the client that fetches merge bases of pod patches with apiReader,
+// or c itself when apiReader is nil.
+func newPodClient(c client.Client, apiReader client.Reader) client.Client {
+	if apiReader == nil {
+		return c
+	}
+
+	return podClient{Client: c, apiReader: apiReader}
+}
+
+// patchPod patches the pod with the change made by mutate, retrying on conflicts.
+// mutate is called with a copy of the pod and returns false when there's nothing to change, in which case no patch is sent.
+//
+// When c is a podClient, the merge base is re-fetched from the API server before every attempt, and the patch is sent
+// with the resource version of the base, so that a stale pod read from the cache, like the one the reconcilation loop
+// started with, never results in a patch that reverts or duplicates changes made in the meantime.
+// mutate sees the fresh pod, so e.g. annotatePodOnce doesn't overwrite an annotation missing only in the cache.
+// Otherwise, the provided pod is the merge base of the first attempt, and the pod is re-fetched via c only on retries.
+//
+// It returns the provided pod as-is when the pod has been deleted in the meantime, as there's nothing left to annotate.
+func patchPod(ctx context.Context, c client.Client, pod *corev1.Pod, mutate func(*corev1.Pod) bool) (*corev1.Pod, error) {
+	var (
+		reader client.Reader = c
+		opts   []client.MergeFromOption
+	)
+
+	pc, fresh := c.(podClient)
+	if fresh {
+		reader = pc.apiReader
+		opts = append(opts, client.MergeFromWithOptimisticLock{})
+	}
+
+	base := pod
+
+	var (
+		updated *corev1.Pod
+		retried bool
+	)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if fresh || retried {
+			var latest corev1.Pod
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(pod), &latest); err != nil {
+				return err
+			}
+			base = &latest
+		}
+		retried = true
+
+		updated = base.DeepCopy()
+		if !mutate(updated) {
+			return nil
+		}
+
+		return c.Patch(ctx, updated, client.MergeFromWithOptions(base, opts...))
+	})
+	if err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return pod, nil
+		}
+
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// forgetMismatchedRunnerID removes the runner ID recorded for the runner pod, as it turned out to belong to another runner,
+// so that the next try looks up the runner by name and records the right ID.
+// The unregistration attempt isn't counted as failed, as nothing was removed from GitHub.
+func forgetMismatchedRunnerID(ctx context.Context, cfg gracefulStopConfig, c client.Client, log logr.Logger, pod *corev1.Pod, runner string, mismatch *runnerIDMismatchError) (*ctrl.Result, gracefulStopReason, error) {
+	log.Info("Refused to unregister the runner as the recorded runner ID belongs to another runner. Forgetting the runner ID to look up the runner by name", "runnerID", mismatch.id, "runnerNameOfID", mismatch.actualName)
+
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		for _, k := range []string{AnnotationKeyRunnerID, AnnotationKeyRunnerIDPodUID} {
+			delete(p.Annotations, k)
+		}
+
+		return true
+	})
+	if err != nil {
+		log.Error(err, "Failed to patch pod to remove the mismatched runner ID")
+		return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+	}
+
+	cfg.event(updated, corev1.EventTypeWarning, "RunnerIDMismatch", fmt.Sprintf("Refused to unregister runner %q as its recorded runner ID %d belongs to runner %q", runner, mismatch.id, mismatch.actualName))
+
+	return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonRunnerIDMismatch, nil
+}
+
+// requeueOnCircuitOpen returns the result that delays the unregistration until the GitHub client's circuit breaker
+// lets requests through again, but no sooner than retryDelayOnGitHubAPICircuitOpen.
+// The unregistration attempt isn't counted as failed, as no API call was made.
+func requeueOnCircuitOpen(cfg gracefulStopConfig, log logr.Logger, err error) *ctrl.Result {
+	delay := retryDelayOnGitHubAPICircuitOpen
+
+	if d, ok := github.RetryAfter(err, cfg.now()); ok && d > delay {
+		delay = d
+	}
+
+	log.Info("Skipped runner unregistration as GitHub API seems to be down. Retrying later.", "error", err.Error(), "retryDelay", delay)
+
+	return &ctrl.Result{RequeueAfter: delay}
+}
+
+// If the first return value is nil, it's safe to delete the runner pod.
+// The second return value tells why, so that the caller can label its metrics.
+func ensureRunnerUnregistration(ctx context.Context, cfg gracefulStopConfig, log logr.Logger, ghClient GitHubRunnerClient, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*ctrl.Result, gracefulStopReason, error) {
+	// The context is done when e.g. the controller is shutting down.
+	// We don't want to leave any GitHub API call in flight in that case.
+	if err := ctx.Err(); err != nil {
+		log.V(1).Info("Skipped runner unregistration as the context is done", "error", err.Error())
+		return &ctrl.Result{}, gracefulStopReasonError, err
+	}
+
+	if pod != nil && metav1.HasAnnotation(pod.ObjectMeta, AnnotationKeyPauseUnregistration) {
+		log.Info("Runner unregistration is paused. Remove the annotation to resume it.", "annotation", AnnotationKeyPauseUnregistration, "retryDelay", retryDelayOnPausedUnregistration)
+
+		return &ctrl.Result{RequeueAfter: retryDelayOnPausedUnregistration}, gracefulStopReasonPaused, nil
+	}
+
+	// Ephemeral runners are unaffected, as they stop by themselves after a job regardless of the unregistration.
+	if active, until := cfg.quietHours.Active(cfg.now()); active && !podIsEphemeral(pod) {
+		retryDelay := until.Sub(cfg.now())
+
+		log.Info("Deferred runner unregistration until the quiet hours end", "until", until.Format(time.RFC3339), "retryDelay", retryDelay)
+
+		return &ctrl.Result{RequeueAfter: retryDelay}, gracefulStopReasonQuietHours, nil
+	}
+
+	// GitHub removes an ephemeral runner after its job by itself, so there's no need to call GitHub API for a stopped one
+	// when the user opted out of the unregistration.
+	if podSkipsUnregistration(pod) && runnerPodOrContainerIsStopped(pod) {
+		recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchSkipped)
+
+		log.Info("Ephemeral runner has stopped. Skipped unregistering it as GitHub removes it by itself.", "annotation", AnnotationKeySkipUnregistration)
+
+		metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeSkipped))
+
+		return nil, gracefulStopReasonCompleted, nil
+	}
+
+	var runnerID *int64
+
+	groupID := runnerGroupID(ctx, log, ghClient, enterprise, organization, repository, pod)
+	labels := podRunnerLabels(pod)
+	nameRemap := podRunnerNameRemap(log, pod)
+
+	id, hasRunnerID := getAnnotation(pod, AnnotationKeyRunnerID)
+	if !hasRunnerID {
+		// A JIT runner pod that stopped before its registration check has the runner ID only in the JIT annotation,
+		// which was recorded on the creation of this very pod.
+		id, hasRunnerID = getAnnotation(pod, AnnotationKeyJITRunnerID)
+	}
+
+	if hasRunnerID {
+		if uid, ok := getAnnotation(pod, AnnotationKeyRunnerIDPodUID); ok && uid != string(pod.UID) {
+			// The pod might have been created by an older version of ARC that didn't record the pod UID along with the runner ID,
+			// in which case we trust the runner ID annotation as before.
+			log.Info("Ignoring the runner ID annotation as it was recorded for another pod", "runnerID", id, "recordedPodUID", uid)
+		} else {
+			v, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return &ctrl.Result{}, gracefulStopReasonError, err
+			}
+
+			runnerID = &v
+		}
+	}
+
+	// With the runner ID known, RemoveRunner is attempted without looking up the runner first, so that the happy path
+	// makes only one GitHub API call. GitHub refuses to remove a busy runner with 422, in which case the runner is looked up lazily below.
+	// The runner needs to be looked up first only to find its ID by name, or to see if it's offline.
+	lookedUp := runnerID == nil || cfg.onlyUnregisterOffline
+
+	var (
+		runnersByName []*gogithub.Runner
+		r             *gogithub.Runner
+		err           error
+	)
+
+	if lookedUp {
+		getRunnerCtx, cancelGetRunner := cfg.withAPITimeout(ctx)
+		runnersByName, err = getRunnersByName(getRunnerCtx, log, ghClient, enterprise, organization, repository, runner, groupID, labels, nameRemap)
+		cancelGetRunner()
+
+		if errors.Is(err, github.ErrCircuitOpen) {
+			return requeueOnCircuitOpen(cfg, log, err), gracefulStopReasonCircuitOpen, nil
+		}
+
+		if err == nil {
+			updated, patchErr := resetUnregistrationRetryOnServerError(ctx, c, log, pod)
+			if patchErr != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+			}
+			pod = updated
+		}
+
+		if len(runnersByName) > 0 {
+			r = runnersByName[0]
+
+			// This is best-effort, as the status is only for observability, e.g. of a scale-down stuck on a busy runner.
+			if err := updateRunnerStatusFromGitHub(ctx, c, log, pod, r); err != nil {
+				log.V(1).Info("Failed to update runner status from GitHub. Continuing the graceful stop", "error", err.Error())
+			}
+		}
+
+		if safe, _ := runnerDeletionSafety(r); err == nil && !safe {
+			updated, offline, patchErr := runnerOfflineForGracePeriod(ctx, cfg, c, log, pod, r)
+			if patchErr != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+			}
+			pod = updated
+
+			// An offline runner can't pick up a job anymore, so we try to remove it anyway. See the runnerBusy case below for when it fails.
+			if !offline {
+				return cancelBusyRunnerGracefulStop(ctx, cfg, c, log, pod, enterprise, organization, repository, runner, r)
+			}
+		} else if err == nil && r != nil {
+			updated, patchErr := resumeCancelledGracefulStop(ctx, c, log, pod, r)
+			if patchErr != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+			}
+			pod = updated
+		}
+	}
+
+	// GitHub can keep reporting a stopped runner as online for a while, so the stopped runner container is trusted over the status.
+	if cfg.onlyUnregisterOffline && r != nil && r.GetStatus() != "offline" && !podIsEphemeral(pod) && runnerContainerExitCode(pod) == nil {
+		log.Info("Runner is online and might pick up a job. Retrying unregistration once it goes offline.", "runnerID", r.GetID(), "status", r.GetStatus(), "retryDelay", cfg.retryDelay)
+
+		return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonRunnerOnline, nil
+	}
+
+	// GitHub can report a runner idle for a while after it picked up a job, in which case RemoveRunner succeeds in the middle of the job.
+	// The job timeout recorded on the in-progress job is trusted over that status until the job would time out on its own.
+	if remaining, ok := runningJobTimeoutRemaining(log, pod, cfg.unregistrationTimeout, cfg.now()); ok && remaining > 0 && runnerContainerExitCode(pod) == nil {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchJobRunning)
+
+		delay, patchErr := backoffUnregistrationRetry(ctx, c, log, pod, gracefulStopReasonJobRunning, cfg.retryDelay, maxUnregistrationRetryDelay)
+		if patchErr != nil {
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+		}
+
+		if delay > remaining {
+			delay = remaining
+		}
+
+		if cfg.progressLogThrottle.allow(pod, cfg.now()) {
+			log.Info("Runner is running a job that hasn't timed out yet. Retrying unregistration later.", "annotation", AnnotationKeyJobTimeout, "remaining", remaining, "retryDelay", delay)
+		}
+
+		return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonJobRunning, nil
+	}
+
+	var ok, alreadyGone bool
+
+	reason := gracefulStopReasonCompleted
+
+	// Without the runner ID, we have no choice other than unregistering the runner by name.
+	// But names of ephemeral runners can collide across recreations, so we refuse to unregister by name alone when it's ambiguous.
+	// In that case this falls through to the same path as the runner wasn't found, and the registration grace period and the
+	// unregistration timeout eventually allow the pod deletion.
+	if runnerID == nil && podIsEphemeral(pod) && len(runnersByName) > 1 {
+		log.Info("Refused to unregister the ephemeral runner by name alone as multiple runners have the same name", "matches", len(runnersByName))
+
+		cfg.event(pod, corev1.EventTypeWarning, "RunnerUnregistrationAmbiguous", fmt.Sprintf("Refused to unregister runner %q by name as %d runners have the same name", runner, len(runnersByName)))
+	} else if !cfg.unregistrationLimiter.tryAcquire() {
+		log.V(1).Info("Too many unregistrations are in flight. Retrying unregistration later.", "retryDelay", retryDelayOnUnregistrationLimit)
+
+		return &ctrl.Result{RequeueAfter: retryDelayOnUnregistrationLimit}, gracefulStopReasonThrottled, nil
+	} else {
+		unregisterCtx, cancelUnregister := cfg.withAPITimeout(ctx)
+		ok, alreadyGone, err = unregisterRunner(unregisterCtx, log, cfg.dryRun, cfg.verifyRunnerID, ghClient, enterprise, organization, repository, runner, groupID, labels, nameRemap, runnerID)
+		cancelUnregister()
+		cfg.unregistrationLimiter.release()
+	}
+
+	// A persistent runner can be missing on GitHub for various reasons, like GitHub hasn't reflected the registration yet,
+	// so a 404 is ambiguous. We fall through to the same path as the runner wasn't found by name, which is guarded by
+	// the registration grace period and the unregistration timeout.
+	unregErr := &unregisterError{}
+	isUnregErr := errors.As(err, &unregErr)
+
+	if isUnregErr && unregErr.StatusCode == http.StatusNotFound && !podIsEphemeral(pod) {
+		log.Info("Runner was not found on GitHub while unregistering. It might not have been registered yet.", "error", err.Error())
+
+		ok, err = false, nil
+	}
+
+	if err != nil {
+		updated, patchErr := annotatePodUpdate(ctx, c, log, pod, AnnotationKeyLastUnregistrationError, lastUnregistrationError(cfg.now(), err))
+		if patchErr != nil {
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+		}
+		pod = updated
+
+		if err := updateRunnerUnregistrationStatus(ctx, c, log, pod); err != nil {
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+		}
+
+		if errors.Is(err, github.ErrCircuitOpen) {
+			return requeueOnCircuitOpen(cfg, log, err), gracefulStopReasonCircuitOpen, nil
+		}
+
+		if mismatch := (&runnerIDMismatchError{}); errors.As(err, &mismatch) {
+			return forgetMismatchedRunnerID(ctx, cfg, c, log, pod, runner, mismatch)
+		}
+
+		if github.IsRateLimitError(err) {
+			retryDelay := ghClient.RetryDelayOnRateLimit(err, cfg.now(), retryDelayOnGitHubAPIRateLimitError)
+
+			// We log the underlying error when we failed calling GitHub API to list or unregisters,
+			// or the runner is still busy.
+			log.Error(
+				err,
+				fmt.Sprintf(
+					"Failed to unregister runner due to GitHub API rate limits. Delaying retry for %s to avoid excessive GitHub API calls",
+					retryDelay,
+				),
+			)
+
+			cfg.event(pod, corev1.EventTypeWarning, "RunnerUnregistrationRateLimited", fmt.Sprintf("Delaying unregistration of runner %q for %s due to GitHub API rate limits", runner, retryDelay))
+
+			metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeRateLimited))
+
+			return &ctrl.Result{RequeueAfter: retryDelay}, gracefulStopReasonRateLimited, err
+		}
+
+		alreadyUnregistered := isUnregErr && unregErr.StatusCode == http.StatusNotFound
+		runnerBusy := isUnregErr && unregErr.Busy && runnerContainerExitCode(pod) == nil
+
+		// The busy runner and the ephemeral runner that has already unregistered itself have their own outcomes recorded below.
+		if !alreadyUnregistered && !runnerBusy {
+			metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeError))
+		}
+
+		// 422 usually means that the runner is busy running a job, which isn't a failure we want to give up on.
+		if !isUnregErr || unregErr.StatusCode != http.StatusUnprocessableEntity {
+			updated, attempts, patchErr := incrementUnregistrationAttempts(ctx, c, log, pod)
+			if patchErr != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+			}
+			pod = updated
+
+			if err := updateRunnerUnregistrationStatus(ctx, c, log, pod); err != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+			}
+
+			if cfg.maxUnregistrationAttempts > 0 && attempts >= cfg.maxUnregistrationAttempts {
+				log.Info(
+					"Gave up unregistering the runner after too many failed attempts. The runner pod will be deleted without unregistration. "+
+						"You'd probably need to manually delete the runner later by calling the GitHub API",
+					"attempts", attempts,
+					"maxAttempts", cfg.maxUnregistrationAttempts,
+					"error", err.Error(),
+				)
+
+				cfg.event(pod, corev1.EventTypeWarning, "RunnerUnregistrationGaveUp", fmt.Sprintf("Gave up unregistering runner %q after %d failed attempts. The runner pod will be deleted without unregistration", runner, attempts))
+
+				return nil, gracefulStopReasonGaveUp, nil
+			}
+		}
+
+		if isUnregErr {
+			switch status := unregErr.StatusCode; {
+			case alreadyUnregistered:
+				// This is "Case 2-1." explained in the comment of `unregisterRunner`.
+				// An ephemeral runner unregisters itself after a job run, so there's no point in retrying.
+				log.Info("Ephemeral runner was not found on GitHub while unregistering. It has already unregistered itself.", "error", err.Error())
+
+				metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeAlreadyGone))
+
+				return nil, gracefulStopReasonCompleted, nil
+			case runnerBusy:
+				if !lookedUp {
+					// The runner turned out to be busy only on RemoveRunner, as it wasn't looked up beforehand.
+					// It's looked up now only for the status, the log, and the offline grace period, so a failed lookup doesn't prevent the cancellation.
+					getCtx, cancelGet := cfg.withAPITimeout(ctx)
+					r, _ = ghClient.GetRunnerByID(getCtx, enterprise, organization, repository, *runnerID)
+					cancelGet()
+
+					if r != nil {
+						if err := updateRunnerStatusFromGitHub(ctx, c, log, pod, r); err != nil {
+							log.V(1).Info("Failed to update runner status from GitHub. Continuing the graceful stop", "error", err.Error())
+						}
+					}
+				}
+
+				updated, offline, patchErr := runnerOfflineForGracePeriod(ctx, cfg, c, log, pod, r)
+				if patchErr != nil {
+					return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+				}
+				pod = updated
+
+				if offline {
+					log.Info(
+						"Runner has been offline for the offline grace period but GitHub still reports it busy. "+
+							"The runner pod will be deleted without unregistration. You'd probably need to manually delete the runner later by calling the GitHub API",
+						"runnerID", r.GetID(),
+						"offlineGracePeriod", cfg.offlineGracePeriod,
+					)
+
+					cfg.event(pod, corev1.EventTypeWarning, "RunnerOffline", fmt.Sprintf("Runner %q has been offline for %s but is reported busy. The runner pod will be deleted without unregistration", runner, cfg.offlineGracePeriod))
+
+					return nil, gracefulStopReasonRunnerOffline, nil
+				}
+
+				if !lookedUp {
+					return cancelBusyRunnerGracefulStop(ctx, cfg, c, log, pod, enterprise, organization, repository, runner, r)
+				}
+
+				// See the comment in unregisterRunner for the error message returned by GitHub for a busy runner.
+				// The runner container is still running so we wait for the job to complete, backing off so that a long job doesn't cost many API calls.
+				delay, patchErr := backoffUnregistrationRetry(ctx, c, log, pod, gracefulStopReasonRunnerBusy, cfg.retryDelay, maxUnregistrationRetryDelay)
+				if patchErr != nil {
+					return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+				}
+
+				log.Info("Runner is still running a job. Retrying unregistration later.", "runnerID", runnerIDForLog(runnerID), "message", unregErr.Message, "retryDelay", delay)
+
+				metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeBusyRequeued))
+
+				return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonRunnerBusy, nil
+			case cfg.isRetryableStatusCode(status):
+				// Errors with retryable status codes, like 5xx, are usually transient so we retry sooner than the default unregistration retry delay.
+				delay, patchErr := backoffUnregistrationRetry(ctx, c, log, pod, gracefulStopReasonServerError, retryDelayOnGitHubAPIServerError, maxRetryDelayOnGitHubAPIServerError)
+				if patchErr != nil {
+					return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, patchErr
+				}
+
+				// A 429 or 503 often comes with Retry-After, which is more precise than our backoff.
+				if retryAfter, ok := github.RetryAfter(err, cfg.now()); ok {
+					delay = retryAfter
+				}
+
+				log.Error(err, "Failed to unregister runner due to a transient GitHub API error. Retrying later.", "statusCode", status, "retryDelay", delay)
+
+				return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonServerError, nil
+			}
+		}
+
+		log.Error(err, "Failed to unregister runner before deleting the pod.")
+
+		if isUnregErr {
+			code := runnerContainerExitCode(pod)
+
+			if unregErr.StatusCode == http.StatusUnprocessableEntity && code != nil {
+				// The runner is looked up only for the log, and only if it wasn't looked up beforehand.
+				if !lookedUp {
+					getCtx, cancelGet := cfg.withAPITimeout(ctx)
+					r, _ = ghClient.GetRunnerByID(getCtx, enterprise, organization, repository, *runnerID)
+					cancelGet()
+				}
+
+				var id int64
+
+				if r != nil && r.ID != nil {
+					id = *r.ID
+				} else if runnerID != nil {
+					id = *runnerID
+				}
+
+				log.V(2).Info("Runner container has already stopped but the unregistration attempt failed. "+
+					"This can happen when the runner container crashed due to an unhandled error, OOM, etc. "+
+					"ARC terminates the pod anyway. You'd probably need to manually delete the runner later by calling the GitHub API",
+					"runnerExitCode", *code,
+					"containerExitCodes", podContainerExitCodes(pod),
+					"runnerID", id,
+					"runnerStatus", r.GetStatus(),
+					"runnerBusy", r.GetBusy(),
+				)
+
+				return nil, gracefulStopReasonRunnerStopped, nil
+			}
+		}
+
+		return &ctrl.Result{}, gracefulStopReasonError, err
+	} else if ok {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchUnregistered)
+
+		if alreadyGone {
+			metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeAlreadyGone))
+		} else {
+			metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeSuccess))
+		}
+
+		log.Info("Runner has just been unregistered.")
+	} else if pod == nil {
+		// `r.unregisterRunner()` will returns `false, nil` if the runner is not found on GitHub.
+		// However, that doesn't always mean the pod can be safely removed.
+		//
+		// If the pod does not exist for the runner,
+		// it may be due to that the runner pod has never been created.
+		// In that case we can safely assume that the runner will never be registered.
+
+		log.Info("Runner was not found on GitHub and the runner pod was not found on Kuberntes.")
+
+		metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeAlreadyGone))
+	} else if v, _ := getAnnotation(pod, AnnotationKeyUnregistrationCompleteTimestamp); v != "" {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchAlreadyMarked)
+
+		// If it's already unregistered in the previous reconcilation loop,
+		// you can safely assume that it won't get registered again so it's safe to delete the runner pod.
+		log.Info("Runner pod is marked as already unregistered.")
+	} else if runnerPodOrContainerIsStopped(pod) {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchPodStopped)
+
+		// If it's an ephemeral runner with the actions/runner container exited with 0,
+		// we can safely assume that it has unregistered itself from GitHub Actions
+		// so it's natural that RemoveRunner fails due to 404.
+
+		// If pod has ended up succeeded we need to restart it
+		// Happens e.g. when dind is in runner and run completes
+		log.Info("Runner pod has been stopped with a successful status.")
+
+		metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeAlreadyGone))
+	} else if exitCode, crashLooping := runnerContainerCrashLooping(pod); crashLooping && runnerID == nil && cfg.now().Sub(pod.CreationTimestamp.Time) >= crashLoopingRegistrationGracePeriod {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchRegistrationFailed)
+
+		// This is "Case 2-2." explained in the comment of `unregisterRunner`.
+		// The runner container keeps failing before the runner is ever seen on GitHub, which usually means that config.sh failed,
+		// like due to an invalid registration token. Waiting for the registration grace period would only waste reconcilation loops.
+		log.Info(
+			"Runner container is crash-looping and the runner has never been registered. The registration likely failed. "+
+				"The runner pod will be deleted without waiting for the registration grace period.",
+			"runnerExitCode", exitCode,
+		)
+
+		reason = gracefulStopReasonRegistrationFailed
+
+		metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeRegistrationFailed))
+
+		cfg.event(pod, corev1.EventTypeWarning, "RunnerRegistrationFailed", fmt.Sprintf("Runner %q has never been registered and its container is crash-looping with exit code %d. The registration likely failed. The runner pod will be deleted soon", runner, exitCode))
+	} else if remaining := registrationGracePeriodRemaining(pod, cfg.registrationGracePeriod, cfg.now()); remaining > 0 {
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchRegistrationGracePeriod)
+
+		// This is "Case 2-3." explained in the comment of `unregisterRunner`.
+		// The runner pod has not been registered yet but it may still be registering itself to GitHub,
+		// so we wait until the grace period passes, so that we don't race with GitHub scheduling a job onto the runner.
+		log.Info("Runner is not registered yet. Waiting for the registration grace period to pass before unregistration.", "registrationGracePeriod", cfg.registrationGracePeriod, "remaining", remaining)
+
+		delay := cfg.retryDelay
+		if delay > remaining {
+			delay = remaining
+		}
+
+		return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonRegistrationGracePeriod, nil
+	} else if ts, _ := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp); ts != "" {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+		}
+
+		unregistrationTimeout := podUnregistrationTimeoutWithJobTimeout(log, pod, cfg.unregistrationTimeout)
+
+		if r := t.Add(unregistrationTimeout).Sub(cfg.now()); r > 0 {
+			pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchInProgress)
+
+			delay, err := backoffUnregistrationRetry(ctx, c, log, pod, gracefulStopReasonInProgress, cfg.retryDelay, maxUnregistrationRetryDelay)
+			if err != nil {
+				return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+			}
+
+			// We don't want the backoff to delay the unregistration timeout too much.
+			if delay > r {
+				delay = r
+			}
+
+			pod = warnUnregistrationTimeoutApproaching(ctx, cfg, c, log, pod, runner, cfg.now().Sub(t), unregistrationTimeout)
+
+			if cfg.progressLogThrottle.allow(pod, cfg.now()) {
+				log.Info("Runner unregistration is in-progress.", "timeout", unregistrationTimeout, "remaining", r, "retryDelay", delay)
+			}
+			return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonInProgress, nil
+		}
+
+		if podIsRunningProtectedJob(pod) {
+			// Unlike the block-stop condition, there's no hard cap, as force-deleting the runner pod in the middle of e.g. a deployment
+			// can be worse than keeping it forever. The runner removes the annotation once the job ends.
+			pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchProtectedJob)
+
+			if cfg.progressLogThrottle.allow(pod, cfg.now()) {
+				log.Info("Runner unregistration has been timed out, but the runner pod is kept as it's running a protected job. Remove the annotation to let the runner pod be deleted.", "annotation", AnnotationKeyProtectedJob, "timeout", unregistrationTimeout, "retryDelay", cfg.retryDelay)
+
+				cfg.event(pod, corev1.EventTypeWarning, "RunnerProtectedJobBlockingStop", fmt.Sprintf("Unregistration of runner %q has been timed out after %s, but the runner pod is kept as it's running a protected job", runner, unregistrationTimeout))
+			}
+
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonProtectedJob, nil
+		}
+
+		if cfg.blockStopCondition != "" && podConditionTransitionTime(pod, cfg.blockStopCondition, corev1.ConditionTrue) != nil {
+			// A supervisor in the runner pod tells that it's still unsafe to stop the runner pod, like while it's uploading artifacts.
+			// We keep the runner pod until the condition turns False, but no longer than the hard cap, so that a stuck supervisor can't keep it forever.
+			if r := t.Add(unregistrationTimeout).Add(cfg.maxBlockStopDuration).Sub(cfg.now()); r > 0 {
+				pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchBlockStop)
+
+				delay := cfg.retryDelay
+				if delay > r {
+					delay = r
+				}
+
+				if cfg.progressLogThrottle.allow(pod, cfg.now()) {
+					log.Info("Runner unregistration has been timed out, but the runner pod is kept as its block-stop condition is True.", "condition", cfg.blockStopCondition, "remaining", r, "retryDelay", delay)
+				}
+
+				return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonBlockStop, nil
+			}
+
+			log.Info("Runner pod has been blocked from stopping for too long. Ignoring its block-stop condition.", "condition", cfg.blockStopCondition, "maxBlockStopDuration", cfg.maxBlockStopDuration)
+
+			cfg.event(pod, corev1.EventTypeWarning, "RunnerBlockStopExpired", fmt.Sprintf("Runner pod kept its %s condition True for %s past the unregistration timeout. Ignoring the condition", cfg.blockStopCondition, cfg.maxBlockStopDuration))
+		}
+
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchTimedOut)
+
+		log.Info("Runner unregistration has been timed out. The runner pod will be deleted soon.", "timeout", unregistrationTimeout)
+
+		reason = gracefulStopReasonTimedOut
+
+		metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeTimedOut))
+
+		cfg.event(pod, corev1.EventTypeWarning, "RunnerUnregistrationTimedOut", fmt.Sprintf("Unregistration of runner %q has been timed out after %s. The runner pod will be deleted soon", runner, unregistrationTimeout))
+	} else {
+		// A runner and a runner pod that is created by this version of ARC should match
+		// any of the above branches.
+		//
+		// But we leave this match all branch for potential backward-compatibility.
+		// The caller is expected to take appropriate actions, like annotating the pod as started the unregistration process,
+		// and retry later.
+		pod = recordUnregistrationBranch(ctx, c, log, pod, unregistrationBranchFallthrough)
+
+		delay, err := backoffUnregistrationRetry(ctx, c, log, pod, gracefulStopReasonInProgress, cfg.retryDelay, maxUnregistrationRetryDelay)
+		if err != nil {
+			return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+		}
+
+		log.V(1).Info("Runner unregistration is being retried later.", "retryDelay", delay)
+
+		return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonInProgress, nil
+	}
+
+	return nil, reason, nil
+}
+
+// recordUnregistrationBranch annotates the pod with the decision the unregistration evaluation ended up with.
+// This is best-effort, as the annotation is only for debugging. It returns the provided pod as-is on failure.
+func recordUnregistrationBranch(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, branch unregistrationBranch) *corev1.Pod {
+	updated, err := annotatePodUpdate(ctx, c, log, pod, AnnotationKeyUnregistrationBranch, string(branch))
+	if err != nil || updated == nil {
+		return pod
+	}
+
+	return updated
+}
+
+// warnUnregistrationTimeoutApproaching emits a warning event once the unregistration of the runner has been in progress
+// for the warning threshold of the unregistration timeout, so that operators can intervene before ARC deletes the runner pod
+// of a possibly busy runner. The warning is recorded in the pod annotation so that it isn't repeated on every tick.
+func warnUnregistrationTimeoutApproaching(ctx context.Context, cfg gracefulStopConfig, c client.Client, log logr.Logger, pod *corev1.Pod, runner string, elapsed, timeout time.Duration) *corev1.Pod {
+	if cfg.timeoutWarningThreshold <= 0 || float64(elapsed) < cfg.timeoutWarningThreshold*float64(timeout) {
+		return pod
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyUnregistrationWarningTimestamp); ok {
+		return pod
+	}
+
+	updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationWarningTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil || updated == nil {
+		return pod
+	}
+
+	log.Info("Runner unregistration is approaching its timeout. The runner pod will be deleted once the timeout passes, even if the runner is still busy.", "timeout", timeout, "elapsed", elapsed)
+
+	cfg.event(updated, corev1.EventTypeWarning, "RunnerUnregistrationTimeoutApproaching", fmt.Sprintf("Unregistration of runner %q has been in progress for %s of its %s timeout. The runner pod will be deleted once the timeout passes, even if the runner is still busy", runner, elapsed.Round(time.Second), timeout))
+
+	return updated
+}
+
+// runnerContainerCrashLooping returns true and the last exit code of the runner container
+// when the runner container is in CrashLoopBackOff after exiting with a non-zero code.
+func runnerContainerCrashLooping(pod *corev1.Pod) (int32, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != runnerContainerName(pod) {
+			continue
+		}
+
+		if status.State.Waiting == nil || status.State.Waiting.Reason != "CrashLoopBackOff" {
+			return 0, false
+		}
+
+		if t := status.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			return t.ExitCode, true
+		}
+	}
+
+	return 0, false
+}
+
+// runnerOfflineForGracePeriod returns true once the runner has been seen offline on GitHub for the offline grace period.
+// GitHub API doesn't tell when a runner went offline, so the first time ARC saw it offline is recorded in the pod annotation,
+// which is removed once the runner is seen online again so that the grace period restarts on the next outage.
+func runnerOfflineForGracePeriod(ctx context.Context, cfg gracefulStopConfig, c client.Client, log logr.Logger, pod *corev1.Pod, r *gogithub.Runner) (*corev1.Pod, bool, error) {
+	if cfg.offlineGracePeriod <= 0 || r == nil {
+		return pod, false, nil
+	}
+
+	if r.GetStatus() != "offline" {
+		updated, err := unannotatePod(ctx, c, log, pod, AnnotationKeyOfflineTimestamp)
+		return updated, false, err
+	}
+
+	updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyOfflineTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil {
+		return nil, false, err
+	}
+
+	since := annotationTime(updated, AnnotationKeyOfflineTimestamp)
+	if since == nil {
+		return updated, false, nil
+	}
+
+	return updated, cfg.now().Sub(since.Time) >= cfg.offlineGracePeriod, nil
+}
+
+// cancelBusyRunnerGracefulStop cancels the graceful stop of the busy runner without calling RemoveRunner, and retries it with backoff
+// until the runner is seen idle again.
+//
+// The cancellation is recorded in the cancel timestamp annotation, so that it's logged and evented only on the transition to cancelled,
+// rather than on every retry of a runner draining a long job. The start timestamp is kept as-is, so that the graceful stop isn't restarted
+// on every retry and the unregistration timeout keeps counting from the original start.
+//
+// This is needed as the scale-down decision that triggered the graceful stop and GitHub assigning a new job to the runner can race.
+func cancelBusyRunnerGracefulStop(ctx context.Context, cfg gracefulStopConfig, c client.Client, log logr.Logger, pod *corev1.Pod, enterprise, organization, repository, runner string, r *gogithub.Runner) (*ctrl.Result, gracefulStopReason, error) {
+	_, cancelled := getAnnotation(pod, AnnotationKeyUnregistrationCancelTimestamp)
+
+	updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyUnregistrationCancelTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil {
+		return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+	}
+
+	delay, err := backoffUnregistrationRetry(ctx, c, log, updated, gracefulStopReasonRunnerBusy, cfg.retryDelay, maxUnregistrationRetryDelay)
+	if err != nil {
+		return &ctrl.Result{RequeueAfter: cfg.retryDelay}, gracefulStopReasonError, err
+	}
+
+	metrics.IncRunnerUnregistrations(enterprise, organization, repository, string(unregistrationOutcomeBusyRequeued))
+
+	if cancelled {
+		if cfg.progressLogThrottle.allow(updated, cfg.now()) {
+			log.Info("Runner is still busy running a job. Retrying the graceful stop later.", "runnerID", r.GetID(), "retryDelay", delay)
+		}
+
+		return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonRunnerBusy, nil
+	}
+
+	log.Info("Runner is busy running a job. Cancelled the graceful stop and will retry later.", "runnerID", r.GetID(), "retryDelay", delay)
+
+	cfg.event(updated, corev1.EventTypeNormal, "RunnerUnregistrationCancelled", fmt.Sprintf("Cancelled unregistering runner %q because it is busy running a job", runner))
+
+	return &ctrl.Result{RequeueAfter: delay}, gracefulStopReasonRunnerBusy, nil
+}
+
+// resumeCancelledGracefulStop removes the cancel timestamp annotation once the runner whose graceful stop was cancelled is seen idle,
+// so that the runner getting busy again is reported as a new cancellation.
+func resumeCancelledGracefulStop(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, r *gogithub.Runner) (*corev1.Pod, error) {
+	if _, cancelled := getAnnotation(pod, AnnotationKeyUnregistrationCancelTimestamp); !cancelled {
+		return pod, nil
+	}
+
+	updated, err := unannotatePod(ctx, c, log, pod, AnnotationKeyUnregistrationCancelTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Runner is no longer busy. Resuming the cancelled graceful stop.", "runnerID", r.GetID())
+
+	return updated, nil
+}
+
+func runnerIDForLog(runnerID *int64) interface{} {
+	if runnerID == nil {
+		return "unknown"
+	}
+
+	return *runnerID
+}
+
+// maxLastUnregistrationErrorLength is the maximum length of the error message recorded in the pod annotation,
+// so that an unexpectedly long error doesn't bloat the pod object.
+const maxLastUnregistrationErrorLength = 1024
+
+// lastUnregistrationError returns the value of the last-unregistration-error annotation, in the form of "<RFC3339 timestamp> <error message>".
+func lastUnregistrationError(now time.Time, err error) string {
+	msg := err.Error()
+	if len(msg) > maxLastUnregistrationErrorLength {
+		msg = msg[:maxLastUnregistrationErrorLength] + "..."
+	}
+
+	return now.Format(time.RFC3339) + " " + msg
+}
+
+// incrementUnregistrationAttempts increments the number of failed unregistration attempts recorded in the pod annotation.
+// It returns the updated pod and the number of attempts so far, including the current one.
+func incrementUnregistrationAttempts(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*corev1.Pod, int, error) {
+	var attempts int
+
+	if v, ok := getAnnotation(pod, AnnotationKeyUnregistrationAttempts); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.V(1).Info("Ignoring the unparsable unregistration attempts", "annotation", AnnotationKeyUnregistrationAttempts, "value", v)
+		} else {
+			attempts = n
+		}
+	}
+
+	attempts++
+
+	updated, err := annotatePodUpdate(ctx, c, log, pod, AnnotationKeyUnregistrationAttempts, strconv.Itoa(attempts))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return updated, attempts, nil
+}
+
+// backoffUnregistrationRetry increments the unregistration retry count recorded in the pod annotation and
+// returns the delay until the next retry.
+// The delay is retryDelay * 2^count, capped at maxRetryDelay, where count is the number of retries so far for the same reason.
+// The count restarts from zero when the reason differs from the one recorded along with the count, so that the backoff of
+// one condition, like a busy runner, never carries over to another, like a transient GitHub API error.
+func backoffUnregistrationRetry(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, reason gracefulStopReason, retryDelay, maxRetryDelay time.Duration) (time.Duration, error) {
+	var count int
+
+	if v, ok := getAnnotation(pod, AnnotationKeyUnregistrationRetryCount); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.V(1).Info("Ignoring the unparsable unregistration retry count", "annotation", AnnotationKeyUnregistrationRetryCount, "value", v)
+		} else {
+			count = n
+		}
+	}
+
+	// A count recorded by an older version of ARC has no reason, and is kept as-is.
+	if r, ok := getAnnotation(pod, AnnotationKeyUnregistrationRetryReason); ok && r != string(reason) {
+		log.V(1).Info("Resetting the unregistration retry count as the reason changed", "previousReason", r, "reason", reason, "count", count)
+
+		count = 0
+	}
+
+	_, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		setAnnotation(&p.ObjectMeta, AnnotationKeyUnregistrationRetryCount, strconv.Itoa(count+1))
+		setAnnotation(&p.ObjectMeta, AnnotationKeyUnregistrationRetryReason, string(reason))
+		return true
+	})
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to update %s annotation", AnnotationKeyUnregistrationRetryCount))
+		return 0, err
+	}
+
+	return exponentialRetryDelay(retryDelay, maxRetryDelay, count), nil
+}
+
+// resetUnregistrationRetryOnServerError resets the unregistration retry count accumulated for transient GitHub API errors,
+// as a successful GitHub API call tells that GitHub has recovered.
+// The count accumulated for other reasons, like a busy runner, is kept, as a successful lookup is what tells the runner is still busy.
+func resetUnregistrationRetryOnServerError(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*corev1.Pod, error) {
+	if r, _ := getAnnotation(pod, AnnotationKeyUnregistrationRetryReason); r != string(gracefulStopReasonServerError) {
+		return pod, nil
+	}
+
+	updated, err := unannotatePod(ctx, c, log, pod, AnnotationKeyUnregistrationRetryCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return unannotatePod(ctx, c, log, updated, AnnotationKeyUnregistrationRetryReason)
+}
+
+func exponentialRetryDelay(base, max time.Duration, count int) time.Duration {
+	d := base
+	for i := 0; i < count && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+// registrationGracePeriodRemaining returns the remaining duration of the registration grace period of the pod.
+// It returns zero when the pod has already been registered, as known by the runner ID annotation, or the grace period has passed.
+func registrationGracePeriodRemaining(pod *corev1.Pod, registrationGracePeriod time.Duration, now time.Time) time.Duration {
+	if _, ok := getAnnotation(pod, AnnotationKeyRunnerID); ok {
+		return 0
+	}
+
+	r := pod.CreationTimestamp.Add(registrationGracePeriod).Sub(now)
+	if r < 0 {
+		return 0
+	}
+
+	return r
+}
+
+// podUnregistrationTimeout returns the unregistration timeout specified via the pod annotation, if any.
+// It falls back to the controller-wide default when the annotation is missing or unparsable.
+func podUnregistrationTimeout(log logr.Logger, pod *corev1.Pod, defaultTimeout time.Duration) time.Duration {
+	v, ok := getAnnotation(pod, AnnotationKeyUnregistrationTimeout)
+	if !ok {
+		log.V(1).Info("Using the default unregistration timeout as the pod has no override", "annotation", AnnotationKeyUnregistrationTimeout, "default", defaultTimeout)
+		return defaultTimeout
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.V(1).Info("Using the default unregistration timeout as the pod has an unparsable override", "annotation", AnnotationKeyUnregistrationTimeout, "value", v, "default", defaultTimeout, "error", err.Error())
+		return defaultTimeout
+	}
+
+	return d
+}
+
+// podJobTimeout returns the timeout of the workflow job the runner is running, if it has been recorded onto the pod.
+func podJobTimeout(log logr.Logger, pod *corev1.Pod) (time.Duration, bool) {
+	v, ok := getAnnotation(pod, AnnotationKeyJobTimeout)
+	if !ok {
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.V(1).Info("Ignoring the unparsable job timeout of the pod", "annotation", AnnotationKeyJobTimeout, "value", v, "error", err.Error())
+		return 0, false
+	}
+
+	return d, true
+}
+
+// podUnregistrationTimeoutWithJobTimeout returns the larger of the unregistration timeout of the pod and the timeout of the workflow job
+// the runner is running, so that ARC never gives up on the runner before the job would time out on its own.
+func podUnregistrationTimeoutWithJobTimeout(log logr.Logger, pod *corev1.Pod, defaultTimeout time.Duration) time.Duration {
+	unregistrationTimeout := podUnregistrationTimeout(log, pod, defaultTimeout)
+
+	if jobTimeout, ok := podJobTimeout(log, pod); ok && jobTimeout > unregistrationTimeout {
+		log.V(1).Info("Extending the unregistration timeout to the timeout of the job the runner is running", "unregistrationTimeout", unregistrationTimeout, "jobTimeout", jobTimeout)
+		return jobTimeout
+	}
+
+	return unregistrationTimeout
+}
+
+// runningJobTimeoutRemaining returns the time left until the unregistration timeout extended by podUnregistrationTimeoutWithJobTimeout elapses.
+// The second return value is false when no job timeout has been recorded onto the pod or the unregistration hasn't started.
+func runningJobTimeoutRemaining(log logr.Logger, pod *corev1.Pod, defaultTimeout time.Duration, now time.Time) (time.Duration, bool) {
+	if _, ok := podJobTimeout(log, pod); !ok {
+		return 0, false
+	}
+
+	start := annotationTime(pod, AnnotationKeyUnregistrationStartTimestamp)
+	if start == nil {
+		return 0, false
+	}
+
+	return start.Add(podUnregistrationTimeoutWithJobTimeout(log, pod, defaultTimeout)).Sub(now), true
+}
+
+// podPreStopGracePeriod returns the additional time given to the preStop hook of the runner container before the runner pod
+// is forcefully deleted. That's the override via the pod annotation if any, or defaultPeriod otherwise.
+// It returns zero when the runner container has no preStop hook, as there's nothing to wait for.
+func podPreStopGracePeriod(log logr.Logger, pod *corev1.Pod, defaultPeriod time.Duration) time.Duration {
+	var hasPreStop bool
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name == runnerContainerName(pod) && c.Lifecycle != nil && c.Lifecycle.PreStop != nil {
+			hasPreStop = true
+		}
+	}
+
+	if !hasPreStop {
+		return 0
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyPreStopGracePeriod)
+	if !ok {
+		return defaultPeriod
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.V(1).Info("Using the default preStop grace period as the pod has an unparsable override", "annotation", AnnotationKeyPreStopGracePeriod, "value", v, "default", defaultPeriod, "error", err.Error())
+		return defaultPeriod
+	}
+
+	return d
+}
+
+// runnerGroupID returns the ID of the runner group the runner of the pod is looked up within.
+// That's the one specified via the pod annotation if any, or the one named by the group field of the runner spec,
+// like `spec.template.spec.group` of a RunnerDeployment, which is passed to the runner container as RUNNER_GROUP.
+// It returns zero, meaning that the runner is looked up regardless of runner groups, for repository runners,
+// runners without a group, or when the runner group couldn't be resolved.
+func runnerGroupID(ctx context.Context, log logr.Logger, ghClient GitHubRunnerClient, enterprise, org, repo string, pod *corev1.Pod) int64 {
+	if id := podRunnerGroupID(log, pod); id != 0 {
+		return id
+	}
+
+	group := podRunnerGroupName(pod)
+	if group == "" || repo != "" {
+		return 0
+	}
+
+	id, err := ghClient.GetRunnerGroupIDByName(ctx, enterprise, org, group)
+	if err != nil {
+		log.V(1).Info("Looking up the runner regardless of runner groups as the runner group couldn't be resolved", "runnerGroup", group, "error", err.Error())
+		return 0
+	}
+
+	return id
+}
+
+// podRunnerGroupName returns the name of the runner group the runner container registers the runner to.
+func podRunnerGroupName(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name != runnerContainerName(pod) {
+			continue
+		}
+
+		for _, env := range c.Env {
+			if env.Name == EnvVarRunnerGroup {
+				return env.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+// podRunnerLabels returns the custom labels the runner container registers the runner with, which derive from the runner spec.
+func podRunnerLabels(pod *corev1.Pod) []string {
+	if pod == nil {
+		return nil
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name != runnerContainerName(pod) {
+			continue
+		}
+
+		for _, env := range c.Env {
+			if env.Name == "RUNNER_LABELS" {
+				return parseRunnerLabels(env.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseRunnerLabels parses the comma-separated list of runner labels, as passed to config.sh via RUNNER_LABELS.
+func parseRunnerLabels(s string) []string {
+	var labels []string
+
+	for _, l := range strings.Split(s, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			labels = append(labels, l)
+		}
+	}
+
+	return labels
+}
+
+// podRunnerGroupID returns the runner group ID specified via the pod annotation.
+// It returns zero, meaning that the runner is looked up regardless of runner groups, when the annotation is missing or unparsable.
+func podRunnerGroupID(log logr.Logger, pod *corev1.Pod) int64 {
+	v, ok := getAnnotation(pod, AnnotationKeyRunnerGroupID)
+	if !ok {
+		return 0
+	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.V(1).Info("Ignoring the unparsable runner group ID", "annotation", AnnotationKeyRunnerGroupID, "value", v, "error", err.Error())
+		return 0
+	}
+
+	return id
+}
+
+// registrationCheckConfig is the set of controller-wide settings for ensureRunnerPodRegistered.
+type registrationCheckConfig struct {
+	// interval is the delay until rechecking the registration of a runner that isn't seen on GitHub yet.
+	interval time.Duration
+
+	// maxWait is the duration since the first registration check after which ARC considers the runner is genuinely absent
+	// and stops polling GitHub for it. Zero means ARC never stops polling.
+	maxWait time.Duration
+
+	requeueJitter float64
+
+	// registrationLatency observes how long runners took to be seen on GitHub since their pod creation.
+	// It can be nil, in which case nothing is observed.
+	registrationLatency *registrationLatencyEstimator
+
+	// clock is used to tell the current time, so that tests can deterministically advance the time.
+	// It can be nil, in which case the real clock is used.
+	clock clock.Clock
+}
+
+func (c registrationCheckConfig) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+
+	return c.clock.Now()
+}
+
+func ensureRunnerPodRegistered(ctx context.Context, cfg registrationCheckConfig, log logr.Logger, ghClient GitHubRunnerClient, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	_, hasRunnerID := getAnnotation(pod, AnnotationKeyRunnerID)
+	if runnerPodOrContainerIsStopped(pod) || hasRunnerID {
+		return pod, nil, nil
+	}
+
+	requeue := withRequeueJitter(&ctrl.Result{RequeueAfter: cfg.interval}, cfg.requeueJitter)
+
+	// A JIT runner has been registered by ARC itself before the runner pod was created, so there's nothing to poll GitHub for.
+	if id, ok := getAnnotation(pod, AnnotationKeyJITRunnerID); ok {
+		updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyRunnerIDPodUID, string(pod.UID))
+		if err != nil {
+			return nil, requeue, err
+		}
+
+		updated, err = annotatePodOnce(ctx, c, log, updated, AnnotationKeyRunnerID, id)
+		if err != nil {
+			return nil, requeue, err
+		}
+
+		return updated, nil, nil
+	}
+
+	// A runner pod recreated in the middle of the unregistration resumes unregistering the runner known by the runner status,
+	// rather than waiting for a registration.
+	pod, err := restoreUnregistrationState(ctx, c, log, pod)
+	if err != nil {
+		return nil, requeue, err
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyRunnerID); ok {
+		return pod, nil, nil
+	}
+
+	// There's no point in polling GitHub again for a runner we already gave up waiting for.
+	if _, ok := getAnnotation(pod, AnnotationKeyRegistrationCheckAbandonedTimestamp); ok {
+		return pod, nil, nil
+	}
+
+	// GitHub's runner list is eventually consistent so a just-registered runner can be missing for a while.
+	// We record when we started polling, so that we can tell that from a runner that is genuinely absent.
+	pod, err = annotatePodOnce(ctx, c, log, pod, AnnotationKeyRegistrationCheckStartTimestamp, cfg.now().Format(time.RFC3339))
+	if err != nil {
+		return nil, requeue, err
+	}
+
+	r, err := getRunner(ctx, log, ghClient, enterprise, organization, repository, runner, runnerGroupID(ctx, log, ghClient, enterprise, organization, repository, pod), podRunnerLabels(pod), podRunnerNameRemap(log, pod))
+	if err != nil {
+		return nil, requeue, err
+	}
+
+	if r == nil || r.ID == nil {
+		if waited, ok := registrationCheckElapsed(pod, cfg.now()); ok && cfg.maxWait > 0 && waited >= cfg.maxWait {
+			log.Info(
+				"Runner is still not seen on GitHub long after the first registration check. Stopped waiting for the registration. "+
+					"The runner might have failed to register itself",
+				"waited", waited,
+				"maxWait", cfg.maxWait,
+			)
+
+			updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyRegistrationCheckAbandonedTimestamp, cfg.now().Format(time.RFC3339))
+			if err != nil {
+				return nil, requeue, err
+			}
+
+			return updated, nil, nil
+		}
+
+		log.V(2).Info("Runner is not seen on GitHub yet. Rechecking the registration later", "retryDelay", requeue.RequeueAfter)
+
+		return nil, requeue, nil
+	}
+
+	id := *r.ID
+
+	// This needs to be done before annotating the pod with the runner ID, because we don't reach here once the pod is annotated.
+	if err := updateRunnerStatusFromGitHub(ctx, c, log, pod, r); err != nil {
+		return nil, requeue, err
+	}
+
+	updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyRunnerIDPodUID, string(pod.UID))
+	if err != nil {
+		return nil, requeue, err
+	}
+
+	updated, err = annotatePodOnce(ctx, c, log, updated, AnnotationKeyRunnerID, fmt.Sprintf("%d", id))
+	if err != nil {
+		return nil, requeue, err
+	}
+
+	if !pod.CreationTimestamp.IsZero() {
+		latency := cfg.now().Sub(pod.CreationTimestamp.Time)
+
+		metrics.ObserveRunnerRegistrationDuration(enterprise, organization, repository, latency)
+		cfg.registrationLatency.observe(latency)
+	}
+
+	return updated, nil, nil
+}
+
+// registrationCheckElapsed returns the duration since the first registration check of the pod.
+// The second return value is false when the registration check start timestamp is missing or unparsable.
+func registrationCheckElapsed(pod *corev1.Pod, now time.Time) (time.Duration, bool) {
+	v, ok := getAnnotation(pod, AnnotationKeyRegistrationCheckStartTimestamp)
+	if !ok {
+		return 0, false
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, false
+	}
+
+	return now.Sub(t), true
+}
+
+// getOwnerRunner returns the Runner that owns the runner pod.
+// It returns nil for a runner pod that isn't owned by a Runner, like one managed by a RunnerSet, or whose Runner is already gone.
+func getOwnerRunner(ctx context.Context, c client.Client, pod *corev1.Pod) (*v1alpha1.Runner, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "Runner" {
+		return nil, nil
+	}
+
+	var runner v1alpha1.Runner
+	if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, &runner); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	return &runner, nil
+}
+
+// updateRunnerStatusFromGitHub records the ID of the runner, the labels the runner has registered with, its status, and whether it's busy,
+// as seen on GitHub, onto the status of the Runner that owns the runner pod.
+// It does nothing for a runner pod that isn't owned by a Runner, like one managed by a RunnerSet.
+func updateRunnerStatusFromGitHub(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, r *gogithub.Runner) error {
+	runner, err := getOwnerRunner(ctx, c, pod)
+	if err != nil || runner == nil {
+		return err
+	}
+
+	var labels []string
+	for _, l := range r.Labels {
+		labels = append(labels, l.GetName())
+	}
+
+	if reflect.DeepEqual(runner.Status.RegisteredLabels, labels) && runner.Status.GitHubStatus == r.GetStatus() && runner.Status.Busy == r.GetBusy() && runner.Status.RunnerID == r.GetID() {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Status.RegisteredLabels = labels
+	updated.Status.GitHubStatus = r.GetStatus()
+	updated.Status.Busy = r.GetBusy()
+	updated.Status.RunnerID = r.GetID()
+
+	if err := c.Status().Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		log.Error(err, "Failed to update runner status from GitHub")
+		return err
+	}
+
+	log.V(1).Info("Updated runner status from GitHub", "runnerID", r.GetID(), "labels", labels, "githubStatus", r.GetStatus(), "busy", r.GetBusy())
+
+	return nil
+}
+
+// updateRunnerUnregistrationStatus mirrors the unregistration start and complete timestamps recorded in the pod annotations,
+// along with the structured unregistration status, onto the status of the Runner that owns the runner pod, so that they survive the runner pod being recreated in the middle of the unregistration.
+// It does nothing for a runner pod that isn't owned by a Runner, like one managed by a RunnerSet.
+func updateRunnerUnregistrationStatus(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) error {
+	runner, err := getOwnerRunner(ctx, c, pod)
+	if err != nil || runner == nil {
+		return err
+	}
+
+	start := annotationTime(pod, AnnotationKeyUnregistrationStartTimestamp)
+	complete := annotationTime(pod, AnnotationKeyUnregistrationCompleteTimestamp)
+	status := runnerUnregistrationStatus(log, pod)
+
+	if runner.Status.UnregistrationStartTime.Equal(start) && runner.Status.UnregistrationCompleteTime.Equal(complete) &&
+		equality.Semantic.DeepEqual(runner.Status.UnregistrationStatus, status) {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Status.UnregistrationStartTime = start
+	updated.Status.UnregistrationCompleteTime = complete
+	updated.Status.UnregistrationStatus = status
+
+	if err := c.Status().Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		log.Error(err, "Failed to update runner status for the unregistration")
+		return err
+	}
+
+	log.V(2).Info("Updated runner status for the unregistration", "unregistrationStartTime", start, "unregistrationCompleteTime", complete, "phase", status.Phase)
+
+	return nil
+}
+
+// resetRunnerUnregistrationStatus clears the runner ID and the unregistration state recorded in the Runner status,
+// so that they aren't restored onto a fresh runner pod that registers a new runner. See restoreUnregistrationState.
+func resetRunnerUnregistrationStatus(ctx context.Context, c client.Client, log logr.Logger, runner *v1alpha1.Runner) error {
+	if runner.Status.RunnerID == 0 && runner.Status.UnregistrationStartTime == nil && runner.Status.UnregistrationCompleteTime == nil && runner.Status.UnregistrationStatus == nil {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Status.RunnerID = 0
+	updated.Status.UnregistrationStartTime = nil
+	updated.Status.UnregistrationCompleteTime = nil
+	updated.Status.UnregistrationStatus = nil
+
+	if err := c.Status().Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		log.Error(err, "Failed to reset the unregistration state in the runner status")
+		return err
+	}
+
+	log.V(1).Info("Reset the unregistration state in the runner status for the new runner pod", "previousRunnerID", runner.Status.RunnerID)
+
+	return nil
+}
+
+// runnerUnregistrationStatus builds the structured unregistration status from the annotations ensureRunnerUnregistration records onto the runner pod.
+func runnerUnregistrationStatus(log logr.Logger, pod *corev1.Pod) *v1alpha1.RunnerUnregistrationStatus {
+	status := &v1alpha1.RunnerUnregistrationStatus{
+		Phase:       v1alpha1.RunnerUnregistrationPhaseNotStarted,
+		StartedAt:   annotationTime(pod, AnnotationKeyUnregistrationStartTimestamp),
+		CompletedAt: annotationTime(pod, AnnotationKeyUnregistrationCompleteTimestamp),
+	}
+
+	status.LastError, _ = getAnnotation(pod, AnnotationKeyLastUnregistrationError)
+
+	if v, ok := getAnnotation(pod, AnnotationKeyUnregistrationAttempts); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.V(1).Info("Ignoring the unparsable unregistration attempts", "annotation", AnnotationKeyUnregistrationAttempts, "value", v)
+		} else {
+			status.Attempts = n
+		}
+	}
+
+	switch branch, _ := getAnnotation(pod, AnnotationKeyUnregistrationBranch); {
+	case status.CompletedAt != nil && branch == string(unregistrationBranchTimedOut):
+		status.Phase = v1alpha1.RunnerUnregistrationPhaseTimedOut
+	case status.CompletedAt != nil:
+		status.Phase = v1alpha1.RunnerUnregistrationPhaseCompleted
+	case status.StartedAt != nil:
+		status.Phase = v1alpha1.RunnerUnregistrationPhaseInProgress
+	}
+
+	return status
+}
+
+// updateRunnerTerminationReason records the reason the runner pod is about to be deleted onto the status of the Runner that owns the runner pod,
+// so that tools watching the Runner can tell the outcome of the graceful stop even after the runner pod is gone.
+// It does nothing for a runner pod that isn't owned by a Runner, like one managed by a RunnerSet.
+func updateRunnerTerminationReason(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, reason string) error {
+	runner, err := getOwnerRunner(ctx, c, pod)
+	if err != nil || runner == nil {
+		return err
+	}
+
+	if runner.Status.TerminationReason == reason {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Status.TerminationReason = reason
+
+	if err := c.Status().Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		log.Error(err, "Failed to update runner status for the termination reason")
+		return err
+	}
+
+	log.V(1).Info("Updated runner status for the termination reason", "terminationReason", reason)
+
+	return nil
+}
+
+// restoreUnregistrationState annotates the runner pod with the runner ID and the unregistration start recorded in the status of the Runner that owns the runner pod,
+// so that a runner pod that lost its annotations in the middle of the unregistration resumes the unregistration where it left off.
+// Only an unregistration still in progress is restored. A completed one is never restored, as the pod would otherwise be deleted
+// without unregistering its runner. The Runner controller resets the status whenever it creates a fresh runner pod, so that
+// the state of the previous runner is never restored onto the new one. See resetRunnerUnregistrationStatus.
+// The pod annotations are used as-is when the runner pod isn't owned by a Runner, like one managed by a RunnerSet, or the Runner has no unregistration in progress.
+func restoreUnregistrationState(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*corev1.Pod, error) {
+	pod, err := migrateLegacyAnnotations(ctx, c, log, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := getOwnerRunner(ctx, c, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	if runner == nil || runner.Status.UnregistrationStartTime == nil || runner.Status.UnregistrationCompleteTime != nil {
 		return pod, nil
 	}
 
-	updated := pod.DeepCopy()
-	setAnnotation(&updated.ObjectMeta, k, v)
-	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
-		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", k))
-		return nil, err
+	start := runner.Status.UnregistrationStartTime.Format(time.RFC3339)
+
+	annotations := map[string]string{
+		// The unregistration request is restored as well, so that RunnerPodReconciler resumes the graceful stop of the recreated pod.
+		AnnotationKeyUnregistrationRequestTimestamp: start,
+		AnnotationKeyUnregistrationStartTimestamp:   start,
 	}
 
-	log.V(2).Info("Annotated pod", "key", k, "value", v)
+	if id := runner.Status.RunnerID; id != 0 {
+		annotations[AnnotationKeyRunnerID] = fmt.Sprintf("%d", id)
+	}
 
-	return updated, nil
-}
+	mutate := func(p *corev1.Pod) bool {
+		var changed bool
 
-// If the first return value is nil, it's safe to delete the runner pod.
-func ensureRunnerUnregistration(ctx context.Context, unregistrationTimeout time.Duration, retryDelay time.Duration, log logr.Logger, ghClient *github.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*ctrl.Result, error) {
-	var runnerID *int64
+		for k, v := range annotations {
+			if _, ok := getAnnotation(p, k); ok {
+				continue
+			}
 
-	if id, ok := getAnnotation(pod, AnnotationKeyRunnerID); ok {
-		v, err := strconv.ParseInt(id, 10, 64)
-		if err != nil {
-			return &ctrl.Result{}, err
+			setAnnotation(&p.ObjectMeta, k, v)
+			changed = true
 		}
 
-		runnerID = &v
+		return changed
+	}
+
+	if !mutate(pod.DeepCopy()) {
+		return pod, nil
 	}
 
-	ok, err := unregisterRunner(ctx, ghClient, enterprise, organization, repository, runner, runnerID)
+	updated, err := patchPod(ctx, c, pod, mutate)
 	if err != nil {
-		if errors.Is(err, &gogithub.RateLimitError{}) {
-			// We log the underlying error when we failed calling GitHub API to list or unregisters,
-			// or the runner is still busy.
-			log.Error(
-				err,
-				fmt.Sprintf(
-					"Failed to unregister runner due to GitHub API rate limits. Delaying retry for %s to avoid excessive GitHub API calls",
-					retryDelayOnGitHubAPIRateLimitError,
-				),
-			)
+		log.Error(err, "Failed to patch pod to restore the unregistration state from the runner status")
+		return nil, err
+	}
 
-			return &ctrl.Result{RequeueAfter: retryDelayOnGitHubAPIRateLimitError}, err
-		}
+	log.Info("Restored the unregistration state from the runner status", "unregistrationStartTime", start, "runnerID", runner.Status.RunnerID)
 
-		log.Error(err, "Failed to unregister runner before deleting the pod.")
+	return updated, nil
+}
 
-		errRes := &gogithub.ErrorResponse{}
-		if errors.As(err, &errRes) {
-			code := runnerContainerExitCode(pod)
+// migrateLegacyAnnotations copies the annotations with the default prefix to the changed prefix, once per runner pod,
+// when enabled by EnableLegacyAnnotationKeyMigration. An annotation already recorded with the changed prefix is never overwritten,
+// and the annotations with the default prefix are left for the controller that owns them, if any.
+func migrateLegacyAnnotations(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) (*corev1.Pod, error) {
+	if !migrateLegacyAnnotationKeys || annotationKeyPrefix == DefaultAnnotationKeyPrefix {
+		return pod, nil
+	}
 
-			runner, _ := getRunner(ctx, ghClient, enterprise, organization, repository, runner)
+	if _, ok := getAnnotation(pod, AnnotationKeyLegacyAnnotationsMigrated); ok {
+		return pod, nil
+	}
 
-			var runnerID int64
+	var migrated []string
 
-			if runner != nil && runner.ID != nil {
-				runnerID = *runner.ID
-			}
+	updated, err := patchPod(ctx, c, pod, func(p *corev1.Pod) bool {
+		migrated = nil
 
-			if errRes.Response.StatusCode == 422 && code != nil {
-				log.V(2).Info("Runner container has already stopped but the unregistration attempt failed. "+
-					"This can happen when the runner container crashed due to an unhandled error, OOM, etc. "+
-					"ARC terminates the pod anyway. You'd probably need to manually delete the runner later by calling the GitHub API",
-					"runnerExitCode", *code,
-					"runnerID", runnerID,
-				)
+		for k := range prefixedAnnotationKeySuffixes {
+			legacy := legacyAnnotationKey(k)
 
-				return nil, nil
+			v, ok := p.Annotations[legacy]
+			if !ok {
+				continue
 			}
-		}
-
-		return &ctrl.Result{}, err
-	} else if ok {
-		log.Info("Runner has just been unregistered.")
-	} else if pod == nil {
-		// `r.unregisterRunner()` will returns `false, nil` if the runner is not found on GitHub.
-		// However, that doesn't always mean the pod can be safely removed.
-		//
-		// If the pod does not exist for the runner,
-		// it may be due to that the runner pod has never been created.
-		// In that case we can safely assume that the runner will never be registered.
 
-		log.Info("Runner was not found on GitHub and the runner pod was not found on Kuberntes.")
-	} else if pod.Annotations[AnnotationKeyUnregistrationCompleteTimestamp] != "" {
-		// If it's already unregistered in the previous reconcilation loop,
-		// you can safely assume that it won't get registered again so it's safe to delete the runner pod.
-		log.Info("Runner pod is marked as already unregistered.")
-	} else if runnerPodOrContainerIsStopped(pod) {
-		// If it's an ephemeral runner with the actions/runner container exited with 0,
-		// we can safely assume that it has unregistered itself from GitHub Actions
-		// so it's natural that RemoveRunner fails due to 404.
+			if _, ok := getAnnotation(p, *k); ok {
+				continue
+			}
 
-		// If pod has ended up succeeded we need to restart it
-		// Happens e.g. when dind is in runner and run completes
-		log.Info("Runner pod has been stopped with a successful status.")
-	} else if ts := pod.Annotations[AnnotationKeyUnregistrationStartTimestamp]; ts != "" {
-		t, err := time.Parse(time.RFC3339, ts)
-		if err != nil {
-			return &ctrl.Result{RequeueAfter: retryDelay}, err
+			setAnnotation(&p.ObjectMeta, *k, v)
+			migrated = append(migrated, *k)
 		}
 
-		if r := time.Until(t.Add(unregistrationTimeout)); r > 0 {
-			log.Info("Runner unregistration is in-progress.", "timeout", unregistrationTimeout, "remaining", r)
-			return &ctrl.Result{RequeueAfter: retryDelay}, err
-		}
+		setAnnotation(&p.ObjectMeta, AnnotationKeyLegacyAnnotationsMigrated, "true")
 
-		log.Info("Runner unregistration has been timed out. The runner pod will be deleted soon.", "timeout", unregistrationTimeout)
-	} else {
-		// A runner and a runner pod that is created by this version of ARC should match
-		// any of the above branches.
-		//
-		// But we leave this match all branch for potential backward-compatibility.
-		// The caller is expected to take appropriate actions, like annotating the pod as started the unregistration process,
-		// and retry later.
-		log.V(1).Info("Runner unregistration is being retried later.")
+		return true
+	})
+	if err != nil {
+		log.Error(err, "Failed to patch pod to migrate the annotations with the default prefix")
+		return nil, err
+	}
 
-		return &ctrl.Result{RequeueAfter: retryDelay}, nil
+	if len(migrated) > 0 {
+		sort.Strings(migrated)
+		log.Info("Migrated the annotations with the default prefix", "keys", migrated)
 	}
 
-	return nil, nil
+	return updated, nil
 }
 
-func ensureRunnerPodRegistered(ctx context.Context, log logr.Logger, ghClient *github.Client, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
-	_, hasRunnerID := getAnnotation(pod, AnnotationKeyRunnerID)
-	if runnerPodOrContainerIsStopped(pod) || hasRunnerID {
-		return pod, nil, nil
+// annotationTime returns the RFC3339 timestamp recorded in the pod annotation.
+// It returns nil when the annotation is missing or unparsable.
+func annotationTime(pod *corev1.Pod, key string) *metav1.Time {
+	v, ok := getAnnotation(pod, key)
+	if !ok {
+		return nil
 	}
 
-	r, err := getRunner(ctx, ghClient, enterprise, organization, repository, runner)
+	t, err := time.Parse(time.RFC3339, v)
 	if err != nil {
-		return nil, &ctrl.Result{RequeueAfter: 10 * time.Second}, err
+		return nil
 	}
 
-	if r == nil || r.ID == nil {
-		return nil, &ctrl.Result{RequeueAfter: 10 * time.Second}, err
-	}
+	mt := metav1.NewTime(t)
 
-	id := *r.ID
+	return &mt
+}
 
-	updated, err := annotatePodOnce(ctx, c, log, pod, AnnotationKeyRunnerID, fmt.Sprintf("%d", id))
-	if err != nil {
-		return nil, &ctrl.Result{RequeueAfter: 10 * time.Second}, err
+// withRequeueJitter adds a randomized jitter of ±fraction to the RequeueAfter of the result.
+func withRequeueJitter(res *ctrl.Result, fraction float64) *ctrl.Result {
+	if res == nil || res.RequeueAfter <= 0 || fraction <= 0 {
+		return res
 	}
 
-	return updated, nil, nil
+	jittered := *res
+	jittered.RequeueAfter += time.Duration((rand.Float64()*2 - 1) * fraction * float64(res.RequeueAfter))
+
+	return &jittered
 }
 
 func getAnnotation(obj client.Object, key string) (string, bool) {
@@ -205,7 +2189,6 @@ func getAnnotation(obj client.Object, key string) (string, bool) {
 	}
 
 	v, ok := obj.GetAnnotations()[key]
-
 	return v, ok
 }
 
@@ -227,13 +2210,14 @@ func podConditionTransitionTime(pod *corev1.Pod, tpe corev1.PodConditionType, v
 	return nil
 }
 
-func podConditionTransitionTimeAfter(pod *corev1.Pod, tpe corev1.PodConditionType, d time.Duration) bool {
+// podConditionTransitionTimeAfter returns true when the pod condition has transitioned to true more than d before the current time of the clock.
+func podConditionTransitionTimeAfter(clk clock.PassiveClock, pod *corev1.Pod, tpe corev1.PodConditionType, d time.Duration) bool {
 	c := podConditionTransitionTime(pod, tpe, corev1.ConditionTrue)
 	if c == nil {
 		return false
 	}
 
-	return c.Add(d).Before(time.Now())
+	return c.Add(d).Before(clk.Now())
 }
 
 func podRunnerID(pod *corev1.Pod) string {
@@ -276,18 +2260,53 @@ func podRunnerID(pod *corev1.Pod) string {
 // There isn't a single right grace period that works for everyone.
 // The longer the grace period is, the earlier a cluster resource shortage can occur due to throttoled runner pod deletions,
 // while the shorter the grace period is, the more likely you may encounter the race issue.
-func unregisterRunner(ctx context.Context, client *github.Client, enterprise, org, repo, name string, id *int64) (bool, error) {
-	if id == nil {
-		runner, err := getRunner(ctx, client, enterprise, org, repo, name)
+//
+// ensureRunnerUnregistration implements the grace period for "Case 2-3." as registrationGracePeriod, measured since the runner pod creation.
+//
+// The second return value, omitted in the cases above, is true only in "Case 1." when RemoveRunner responded with 404,
+// which means that the runner had already been removed, e.g. by another controller replica.
+//
+// When dryRun is true, this function only logs the runner it would unregister and returns "Case 1. (true, nil)" without calling RemoveRunner.
+//
+// When verifyID is true and id is non-nil, this function gets the runner by the id and returns a *runnerIDMismatchError
+// without calling RemoveRunner if the runner has another name, as the id might have been reassigned to another runner.
+// The name remapped by nameRemap isn't considered another name.
+//
+// groupID is used only to look up the runner by name when id is nil. See getRunner for details.
+//
+// When the runner looked up right before RemoveRunner was busy but RemoveRunner succeeded anyway,
+// this function increments the arc_busy_runner_unregistered_total metric, as the job the runner was running might have been disrupted.
+func unregisterRunner(ctx context.Context, log logr.Logger, dryRun, verifyID bool, client GitHubRunnerClient, enterprise, org, repo, name string, groupID int64, labels []string, nameRemap runnerNameRemap, id *int64) (bool, bool, error) {
+	// seen is the runner as GitHub reported it right before the removal, if ARC had to look it up anyway.
+	// It's used to detect GitHub accepting the removal of a busy runner, which must never happen.
+	var seen *gogithub.Runner
+
+	if id != nil && verifyID {
+		runner, err := client.GetRunnerByID(ctx, enterprise, org, repo, *id)
+		if err != nil {
+			return false, false, newUnregisterError(err)
+		}
+
+		// A runner that's not found is handled by RemoveRunner responding with 404 below.
+		remapped, _, remap := nameRemap.apply(name)
+
+		if runner != nil && !strings.EqualFold(runner.GetName(), name) && !(remap && strings.EqualFold(runner.GetName(), remapped)) {
+			return false, false, &runnerIDMismatchError{id: *id, name: name, actualName: runner.GetName()}
+		}
+
+		seen = runner
+	} else if id == nil {
+		runner, err := getRunner(ctx, log, client, enterprise, org, repo, name, groupID, labels, nameRemap)
 		if err != nil {
-			return false, err
+			return false, false, newUnregisterError(err)
 		}
 
 		if runner == nil || runner.ID == nil {
-			return false, nil
+			return false, false, nil
 		}
 
 		id = runner.ID
+		seen = runner
 	}
 
 	// For the record, historically ARC did not try to call RemoveRunner on a busy runner, but it's no longer true.
@@ -308,26 +2327,401 @@ func unregisterRunner(ctx context.Context, client *github.Client, enterprise, or
 	//   determine if the runner is busy can be more outdated than before, as those responeses are now cached for 60 seconds.
 	// - Note that 60 seconds is controlled by the Cache-Control response header provided by GitHub so we don't have a strict control on it but we assume it won't
 	//   change from 60 seconds.
+	//   You can make ARC revalidate cached responses on every call with github.Config.ListRunnersRevalidate, and see how often a busy status
+	//   flipped between calls with the github_runner_busy_status_flips_total metric.
 	//
 	// TODO: Probably we can just remove the runner by ID without seeing if the runner is busy, by treating it as busy when a remove-runner call failed with 422?
+	if dryRun {
+		log.Info("Skipped unregistering runner due to dry-run", "runnerName", name, "runnerID", *id)
+		return true, false, nil
+	}
+
 	if err := client.RemoveRunner(ctx, enterprise, org, repo, *id); err != nil {
-		return false, err
+		unregErr := newUnregisterError(err)
+
+		// Another controller replica, like the previous leader during a failover, might have removed the runner concurrently.
+		// The runner is gone either way, which is what we want.
+		if unregErr.StatusCode == http.StatusNotFound {
+			log.Info("Runner was already removed from GitHub", "runnerName", name, "runnerID", *id)
+
+			return true, true, nil
+		}
+
+		return false, false, unregErr
+	}
+
+	if seen.GetBusy() {
+		// RemoveRunner is supposed to respond with 422 for a busy runner, so this is either a race between the runner
+		// picking up a job and the removal, or GitHub not protecting the busy runner. Either way, the job is likely to fail.
+		log.Info("Unregistered the runner that was seen busy right before the unregistration. Its workflow job might have been disrupted.", "runnerName", name, "runnerID", *id)
+
+		metrics.IncBusyRunnerUnregistered(enterprise, org, repo)
+	}
+
+	return true, false, nil
+}
+
+// unregisterError is returned by unregisterRunner when a GitHub API call made for the unregistration failed.
+// It classifies the underlying error so that callers can branch on the status code or the busy runner
+// without digging into go-github's error types.
+// The underlying error is still available via errors.As and errors.Is.
+type unregisterError struct {
+	// StatusCode is the HTTP status code GitHub responded with.
+	// It's zero when the call failed without a response, like on a timeout or an open circuit breaker.
+	StatusCode int
+
+	// Busy is true when GitHub refused to remove the runner because it's running a job.
+	Busy bool
+
+	// Message is the message in the GitHub API error response, if any.
+	Message string
+
+	err error
+}
+
+func newUnregisterError(err error) *unregisterError {
+	e := &unregisterError{err: err}
+
+	var (
+		errRes       *gogithub.ErrorResponse
+		rateLimitErr *gogithub.RateLimitError
+	)
+
+	switch {
+	case errors.As(err, &errRes):
+		if errRes.Response != nil {
+			e.StatusCode = errRes.Response.StatusCode
+		}
+		e.Message = errRes.Message
+	case errors.As(err, &rateLimitErr):
+		if rateLimitErr.Response != nil {
+			e.StatusCode = rateLimitErr.Response.StatusCode
+		}
+		e.Message = rateLimitErr.Message
+	}
+
+	// See the comment in unregisterRunner for the error message returned by GitHub for a busy runner.
+	e.Busy = e.StatusCode == http.StatusUnprocessableEntity && strings.Contains(e.Message, "still running a job")
+
+	return e
+}
+
+func (e *unregisterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unregisterError) Unwrap() error {
+	return e.err
+}
+
+// runnerIDMismatchError is returned by unregisterRunner when the runner ID recorded for the runner pod belongs to a runner with another name.
+type runnerIDMismatchError struct {
+	id         int64
+	name       string
+	actualName string
+}
+
+func (e *runnerIDMismatchError) Error() string {
+	return fmt.Sprintf("runner id %d belongs to runner %q, not %q", e.id, e.actualName, e.name)
+}
+
+// unregisterRunners unregisters the runners in the same enterprise, organization, or repository by their IDs,
+// calling RemoveRunner concurrently with at most concurrency calls in flight.
+// GitHub API has no bulk deletion, so this is the fastest way to unregister many runners at once, like on the deletion of a whole RunnerDeployment.
+//
+// It returns the IDs of the runners that are unregistered, including ones that were already gone, in ascending order,
+// and the aggregated error of the runners that failed to be unregistered, like busy ones.
+func unregisterRunners(ctx context.Context, log logr.Logger, dryRun bool, client GitHubRunnerClient, enterprise, org, repo string, runners []*gogithub.Runner, concurrency int) ([]int64, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		removed []int64
+		errs    []error
+	)
+
+	sem := make(chan struct{}, concurrency)
+
+	for _, r := range runners {
+		r := r
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ok, alreadyGone, err := unregisterRunner(ctx, log, dryRun, false, client, enterprise, org, repo, r.GetName(), 0, nil, nil, r.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unregistering runner %q (id %d): %w", r.GetName(), r.GetID(), err))
+				return
+			}
+
+			if !ok {
+				return
+			}
+
+			if alreadyGone {
+				metrics.IncRunnerUnregistrations(enterprise, org, repo, string(unregistrationOutcomeAlreadyGone))
+			} else {
+				metrics.IncRunnerUnregistrations(enterprise, org, repo, string(unregistrationOutcomeSuccess))
+			}
+
+			removed = append(removed, r.GetID())
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+
+	return removed, utilerrors.NewAggregate(errs)
+}
+
+// isRunnerSafeToDelete tells whether the runner can be deleted without disrupting a workflow job, along with the reason.
+// It makes the same busy evaluation as the graceful stop, but never calls RemoveRunner or changes anything,
+// so that it can be shared with e.g. an admission webhook that blocks manual deletions of busy runners.
+//
+// The runner is looked up by the ID when id is non-nil, and by the name otherwise.
+func isRunnerSafeToDelete(ctx context.Context, log logr.Logger, ghClient GitHubRunnerClient, scope runnerScope, name string, id *int64) (bool, string, error) {
+	var (
+		r   *gogithub.Runner
+		err error
+	)
+
+	if id != nil {
+		r, err = ghClient.GetRunnerByID(ctx, scope.enterprise, scope.organization, scope.repository, *id)
+	} else {
+		r, err = getRunner(ctx, log, ghClient, scope.enterprise, scope.organization, scope.repository, name, 0, nil, nil)
+	}
+
+	if err != nil {
+		return false, "", err
+	}
+
+	safe, reason := runnerDeletionSafety(r)
+
+	return safe, reason, nil
+}
+
+// runnerDeletionSafety is the read-only decision on whether the runner seen on GitHub can be deleted without disrupting a workflow job.
+// A runner that isn't found on GitHub, r being nil, is safe to delete as there's no job to disrupt.
+func runnerDeletionSafety(r *gogithub.Runner) (bool, string) {
+	switch {
+	case r == nil:
+		return true, "runner is not found on GitHub"
+	case r.GetBusy():
+		return false, "runner is busy running a job"
+	case r.GetStatus() == "offline":
+		return true, "runner is offline"
+	default:
+		return true, "runner is idle"
+	}
+}
+
+// getRunner returns the runner with the name, or nil if not found.
+// When groupID is non-zero, the runner is looked up within the enterprise or organization runner group of the ID.
+// groupID is ignored for repository runners.
+// See getRunnersByName for how the name and the labels are matched.
+func getRunner(ctx context.Context, log logr.Logger, client GitHubRunnerClient, enterprise, org, repo, name string, groupID int64, labels []string, nameRemap runnerNameRemap) (*gogithub.Runner, error) {
+	runners, err := getRunnersByName(ctx, log, client, enterprise, org, repo, name, groupID, labels, nameRemap)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runners) == 0 {
+		return nil, nil
 	}
 
-	return true, nil
+	return runners[0], nil
 }
 
-func getRunner(ctx context.Context, client *github.Client, enterprise, org, repo, name string) (*gogithub.Runner, error) {
-	runners, err := client.ListRunners(ctx, enterprise, org, repo)
+// getRunnersByName returns all the runners with the name.
+// There's usually at most one runner per name, but a stale runner can remain with the same name as a recreated ephemeral runner.
+//
+// GitHub Enterprise Server can normalize runner names, so the name is matched case-insensitively when no runner has the exact name,
+// rather than concluding that the runner is gone and deleting the runner pod prematurely.
+// A runner whose name differs only in trailing non-alphanumeric characters isn't matched, but is logged as a near-miss,
+// so that operators can spot the naming drift.
+//
+// When labels is non-empty, a runner is matched only when it has all the labels, too,
+// so that a runner of the same name in another RunnerDeployment with overlapping templates is never mistaken for the runner.
+// The runner can have more labels than expected, like the default ones config.sh adds.
+//
+// When no runner has the name, the name remapped by nameRemap is looked for instead, so that a runner renamed on GitHub,
+// like on an organization migration, can still be found. See v1alpha1.RunnerConfig.NameRemap.
+func getRunnersByName(ctx context.Context, log logr.Logger, client GitHubRunnerClient, enterprise, org, repo, name string, groupID int64, labels []string, nameRemap runnerNameRemap) ([]*gogithub.Runner, error) {
+	runners, err := client.ListRunnersInGroup(ctx, enterprise, org, repo, groupID)
 	if err != nil {
 		return nil, err
 	}
 
+	var matches, caseInsensitiveMatches []*gogithub.Runner
+
 	for _, runner := range runners {
+		if strings.EqualFold(runner.GetName(), name) && !gitHubRunnerHasLabels(runner, labels) {
+			log.Info("Ignoring the runner with the same name as it lacks some of the expected labels. It probably belongs to another RunnerDeployment", "runner", name, "runnerID", runner.GetID(), "expectedLabels", labels)
+
+			continue
+		}
+
 		if runner.GetName() == name {
-			return runner, nil
+			matches = append(matches, runner)
+		} else if strings.EqualFold(runner.GetName(), name) {
+			caseInsensitiveMatches = append(caseInsensitiveMatches, runner)
+		}
+	}
+
+	if len(matches) > 0 {
+		return matches, nil
+	}
+
+	for _, runner := range caseInsensitiveMatches {
+		log.Info("Runner name on GitHub differs in case from the expected one. Treating them as the same runner", "runner", name, "runnerNameOnGitHub", runner.GetName(), "runnerID", runner.GetID())
+	}
+
+	if len(caseInsensitiveMatches) > 0 {
+		return caseInsensitiveMatches, nil
+	}
+
+	if remapped, rule, ok := nameRemap.apply(name); ok && remapped != name {
+		var remappedMatches, caseInsensitiveRemappedMatches []*gogithub.Runner
+
+		for _, runner := range runners {
+			if !strings.EqualFold(runner.GetName(), remapped) || !gitHubRunnerHasLabels(runner, labels) {
+				continue
+			}
+
+			if runner.GetName() == remapped {
+				remappedMatches = append(remappedMatches, runner)
+			} else {
+				caseInsensitiveRemappedMatches = append(caseInsensitiveRemappedMatches, runner)
+			}
+		}
+
+		if len(remappedMatches) == 0 {
+			remappedMatches = caseInsensitiveRemappedMatches
+		}
+
+		for _, runner := range remappedMatches {
+			log.Info("Runner was not found on GitHub by its name, but by the remapped name. Treating them as the same runner", "runner", name, "remappedName", remapped, "rule", rule, "runnerNameOnGitHub", runner.GetName(), "runnerID", runner.GetID())
+		}
+
+		if len(remappedMatches) > 0 {
+			return remappedMatches, nil
+		}
+
+		log.V(1).Info("Remapped the runner name, but no runner has the remapped name on GitHub either", "runner", name, "remappedName", remapped, "rule", rule)
+	}
+
+	for _, runner := range runners {
+		if isNearMissRunnerName(runner.GetName(), name) {
+			log.Info("Runner was not found on GitHub, but a runner with a similar name was. GitHub might have normalized the runner name", "runner", name, "runnerNameOnGitHub", runner.GetName(), "runnerID", runner.GetID())
 		}
 	}
 
 	return nil, nil
 }
+
+// gitHubRunnerHasLabels returns true when the runner seen on GitHub has all the labels. Label names are case-insensitive on GitHub.
+func gitHubRunnerHasLabels(runner *gogithub.Runner, labels []string) bool {
+	for _, l := range labels {
+		var found bool
+
+		for _, rl := range runner.Labels {
+			if strings.EqualFold(rl.GetName(), l) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isNearMissRunnerName returns true when the two runner names are the same except the case and trailing non-alphanumeric characters,
+// like trailing whitespace or dots.
+func isNearMissRunnerName(a, b string) bool {
+	trim := func(s string) string {
+		return strings.TrimRightFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	}
+
+	return strings.EqualFold(trim(a), trim(b))
+}
+
+// podIsReused returns true if the pod runs a non-ephemeral runner whose runner container is restarted in the same pod after it stopped.
+func podIsReused(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+
+	v, _ := getAnnotation(pod, AnnotationKeyReuse)
+
+	return v == "true"
+}
+
+// podSkipsUnregistration returns true if the pod runs an ephemeral runner whose unregistration is skipped once it has stopped.
+// See AnnotationKeySkipUnregistration.
+func podSkipsUnregistration(pod *corev1.Pod) bool {
+	if !podIsEphemeral(pod) {
+		return false
+	}
+
+	v, _ := getAnnotation(pod, AnnotationKeySkipUnregistration)
+
+	return v == "true"
+}
+
+// podIsRunningProtectedJob returns true if the runner has marked its pod as running a protected job.
+// See AnnotationKeyProtectedJob.
+func podIsRunningProtectedJob(pod *corev1.Pod) bool {
+	v, _ := getAnnotation(pod, AnnotationKeyProtectedJob)
+
+	return v == "true"
+}
+
+// podIsEphemeral returns true if the pod runs an ephemeral runner.
+// It relies on the annotation recorded on pod creation, and falls back to the environment variable of the runner container
+// for pods created by an older version of ARC.
+func podIsEphemeral(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+
+	// A JIT runner can run only one job, whatever the runner container is told.
+	if podIsJIT(pod) {
+		return true
+	}
+
+	if v, ok := getAnnotation(pod, AnnotationKeyEphemeral); ok {
+		return v == "true"
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name != runnerContainerName(pod) {
+			continue
+		}
+
+		for _, env := range c.Env {
+			if env.Name == "RUNNER_EPHEMERAL" {
+				return env.Value == "true"
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,3727 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func Test_gracefulStopDuration(t *testing.T) {
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	podWithAnnotations := func(annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: annotations,
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want time.Duration
+		ok   bool
+	}{
+		{
+			name: "completed",
+			pod: podWithAnnotations(map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp:    start.Format(time.RFC3339),
+				AnnotationKeyUnregistrationCompleteTimestamp: start.Add(90 * time.Second).Format(time.RFC3339),
+			}),
+			want: 90 * time.Second,
+			ok:   true,
+		},
+		{
+			name: "not completed",
+			pod: podWithAnnotations(map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: start.Format(time.RFC3339),
+			}),
+			ok: false,
+		},
+		{
+			name: "unparsable",
+			pod: podWithAnnotations(map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp:    "foo",
+				AnnotationKeyUnregistrationCompleteTimestamp: start.Format(time.RFC3339),
+			}),
+			ok: false,
+		},
+		{
+			name: "no annotations",
+			pod:  podWithAnnotations(nil),
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := gracefulStopDuration(tt.pod)
+			if ok != tt.ok {
+				t.Fatalf("gracefulStopDuration() ok = %v, want %v", ok, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("gracefulStopDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_podLingeringDuration(t *testing.T) {
+	stopped := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	deleted := metav1.NewTime(stopped.Add(45 * time.Second))
+
+	tests := []struct {
+		name              string
+		annotations       map[string]string
+		deletionTimestamp *metav1.Time
+		want              time.Duration
+		ok                bool
+	}{
+		{
+			name:              "deleted after stopped",
+			annotations:       map[string]string{AnnotationKeyStoppedTimestamp: stopped.Format(time.RFC3339)},
+			deletionTimestamp: &deleted,
+			want:              45 * time.Second,
+			ok:                true,
+		},
+		{
+			name:        "not deleted",
+			annotations: map[string]string{AnnotationKeyStoppedTimestamp: stopped.Format(time.RFC3339)},
+			ok:          false,
+		},
+		{
+			name:              "never seen stopped",
+			deletionTimestamp: &deleted,
+			ok:                false,
+		},
+		{
+			name:              "unparsable",
+			annotations:       map[string]string{AnnotationKeyStoppedTimestamp: "foo"},
+			deletionTimestamp: &deleted,
+			ok:                false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations:       tt.annotations,
+					DeletionTimestamp: tt.deletionTimestamp,
+				},
+			}
+
+			got, ok := podLingeringDuration(pod)
+			if ok != tt.ok {
+				t.Fatalf("podLingeringDuration() ok = %v, want %v", ok, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("podLingeringDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RemoveRunnerStatus(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	newPod := func(exitCode *int32, annotations map[string]string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test1",
+				Namespace:         "default",
+				CreationTimestamp: metav1.Now(),
+				Annotations: map[string]string{
+					AnnotationKeyRunnerID:                     "1",
+					AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+				},
+			},
+		}
+
+		for k, v := range annotations {
+			pod.Annotations[k] = v
+		}
+
+		if exitCode != nil {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{
+					Name: containerName,
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: *exitCode},
+					},
+				},
+			}
+		}
+
+		return pod
+	}
+
+	exitCode := int32(1)
+
+	tests := []struct {
+		name        string
+		status      int
+		message     string
+		exitCode    *int32
+		annotations map[string]string
+		retryable   []int
+		wantResult  bool
+		wantRequeue time.Duration
+		wantReason  gracefulStopReason
+		wantBranch  unregistrationBranch
+		wantErr     bool
+	}{
+		{
+			name:       "unregistered",
+			status:     http.StatusNoContent,
+			wantResult: false,
+			wantReason: gracefulStopReasonCompleted,
+			wantBranch: unregistrationBranchUnregistered,
+		},
+		{
+			name:        "server error",
+			status:      http.StatusBadGateway,
+			wantResult:  true,
+			wantRequeue: retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:        "too many requests from a proxy",
+			status:      http.StatusTooManyRequests,
+			wantResult:  true,
+			wantRequeue: retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:   "consecutive server errors",
+			status: http.StatusBadGateway,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationRetryCount:  "2",
+				AnnotationKeyUnregistrationRetryReason: string(gracefulStopReasonServerError),
+			},
+			wantResult:  true,
+			wantRequeue: 4 * retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:   "server error after the runner was busy",
+			status: http.StatusBadGateway,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationRetryCount:  "4",
+				AnnotationKeyUnregistrationRetryReason: string(gracefulStopReasonRunnerBusy),
+			},
+			wantResult:  true,
+			wantRequeue: retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:   "server error after a successful lookup",
+			status: http.StatusBadGateway,
+			annotations: map[string]string{
+				// The runner ID recorded for another pod makes ARC look up the runner by name.
+				AnnotationKeyRunnerIDPodUID:            "another",
+				AnnotationKeyUnregistrationRetryCount:  "2",
+				AnnotationKeyUnregistrationRetryReason: string(gracefulStopReasonServerError),
+			},
+			wantResult:  true,
+			wantRequeue: retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:       "non-retryable server error",
+			status:     http.StatusNotImplemented,
+			wantResult: true,
+			wantErr:    true,
+			wantReason: gracefulStopReasonError,
+		},
+		{
+			name:        "custom retryable status code",
+			status:      http.StatusRequestTimeout,
+			retryable:   []int{http.StatusRequestTimeout},
+			wantResult:  true,
+			wantRequeue: retryDelayOnGitHubAPIServerError,
+			wantReason:  gracefulStopReasonServerError,
+		},
+		{
+			name:   "server error after too many attempts",
+			status: http.StatusBadGateway,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationAttempts: "2",
+			},
+			wantResult: false,
+			wantReason: gracefulStopReasonGaveUp,
+		},
+		{
+			name:   "not found for an ephemeral runner",
+			status: http.StatusNotFound,
+			annotations: map[string]string{
+				AnnotationKeyEphemeral: "true",
+			},
+			wantResult: false,
+			wantReason: gracefulStopReasonCompleted,
+			wantBranch: unregistrationBranchUnregistered,
+		},
+		{
+			name:   "not found for a persistent runner",
+			status: http.StatusNotFound,
+			annotations: map[string]string{
+				AnnotationKeyEphemeral: "false",
+			},
+			wantResult: false,
+			wantReason: gracefulStopReasonCompleted,
+			wantBranch: unregistrationBranchUnregistered,
+		},
+		{
+			name:       "unprocessable with runner exit code",
+			status:     http.StatusUnprocessableEntity,
+			exitCode:   &exitCode,
+			wantResult: false,
+			wantReason: gracefulStopReasonRunnerStopped,
+		},
+		{
+			name:        "unprocessable because the runner is busy",
+			status:      http.StatusUnprocessableEntity,
+			message:     `Runner \"test1\" is still running a job`,
+			wantResult:  true,
+			wantRequeue: DefaultUnregistrationRetryDelay,
+			wantReason:  gracefulStopReasonRunnerBusy,
+		},
+		{
+			name:    "unprocessable because the runner is busy after server errors",
+			status:  http.StatusUnprocessableEntity,
+			message: `Runner \"test1\" is still running a job`,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationRetryCount:  "3",
+				AnnotationKeyUnregistrationRetryReason: string(gracefulStopReasonServerError),
+			},
+			wantResult:  true,
+			wantRequeue: DefaultUnregistrationRetryDelay,
+			wantReason:  gracefulStopReasonRunnerBusy,
+		},
+		{
+			name:       "unprocessable without runner exit code",
+			status:     http.StatusUnprocessableEntity,
+			wantResult: true,
+			wantErr:    true,
+			wantReason: gracefulStopReasonError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, fake.RunnersListBody)
+			})
+			mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusNoContent {
+					message := tt.message
+					if message == "" {
+						message = "error"
+					}
+					fmt.Fprintf(w, `{"message": "%s"}`, message)
+				}
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			pod := newPod(tt.exitCode, tt.annotations)
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:     DefaultUnregistrationTimeout,
+				retryDelay:                DefaultUnregistrationRetryDelay,
+				registrationGracePeriod:   DefaultRegistrationGracePeriod,
+				maxUnregistrationAttempts: 3,
+				retryableStatusCodes:      tt.retryable,
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: want error %v, got %v", tt.wantErr, err)
+			}
+			if (res != nil) != tt.wantResult {
+				t.Fatalf("unexpected result: want non-nil result %v, got %+v", tt.wantResult, res)
+			}
+			if res != nil && res.RequeueAfter != tt.wantRequeue {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tt.wantRequeue, res.RequeueAfter)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+				t.Fatalf("unable to get pod: %v", err)
+			}
+			_, hasLastError := getAnnotation(&updated, AnnotationKeyLastUnregistrationError)
+			if wantLastError := tt.status != http.StatusNoContent && tt.status != http.StatusNotFound; hasLastError != wantLastError {
+				t.Errorf("unexpected %s annotation: want %v, got %v", AnnotationKeyLastUnregistrationError, wantLastError, hasLastError)
+			}
+			// The branch is recorded only when the evaluation reached a decision, unlike failed API calls.
+			if branch, _ := getAnnotation(&updated, AnnotationKeyUnregistrationBranch); branch != string(tt.wantBranch) {
+				t.Errorf("unexpected %s annotation: want %q, got %q", AnnotationKeyUnregistrationBranch, tt.wantBranch, branch)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_Branch(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := time.Now().Truncate(time.Second)
+	longAgo := now.Add(-time.Hour)
+
+	tcs := []struct {
+		name        string
+		created     time.Time
+		annotations map[string]string
+		want        unregistrationBranch
+	}{
+		{
+			name:    "already marked",
+			created: longAgo,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationCompleteTimestamp: now.Format(time.RFC3339),
+			},
+			want: unregistrationBranchAlreadyMarked,
+		},
+		{
+			name:    "registration grace period",
+			created: now,
+			want:    unregistrationBranchRegistrationGracePeriod,
+		},
+		{
+			name:    "in progress",
+			created: longAgo,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+			},
+			want: unregistrationBranchInProgress,
+		},
+		{
+			name:    "timed out",
+			created: longAgo,
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: longAgo.Format(time.RFC3339),
+			},
+			want: unregistrationBranchTimedOut,
+		},
+		{
+			name:    "fallthrough",
+			created: longAgo,
+			want:    unregistrationBranchFallthrough,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			// The runner isn't on GitHub, so the unregistration falls through to the branches that decide by the pod.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test3",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(tc.created),
+					Annotations:       tc.annotations,
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			if _, _, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test3", pod); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+				t.Fatalf("unable to get pod: %v", err)
+			}
+			if branch, _ := getAnnotation(&updated, AnnotationKeyUnregistrationBranch); branch != string(tc.want) {
+				t.Errorf("unexpected %s annotation: want %q, got %q", AnnotationKeyUnregistrationBranch, tc.want, branch)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RunnerGroup(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/test/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected request to list all the runners in the organization")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	mux.HandleFunc("/orgs/test/actions/runner-groups", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 2, "runner_groups": [{"id": 1, "name": "Default"}, {"id": 2, "name": "team-a"}]}`)
+	})
+	mux.HandleFunc("/orgs/test/actions/runner-groups/2/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 1, "runners": [{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": false}]}`)
+	})
+	mux.HandleFunc("/orgs/test/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removed = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: containerName,
+					Env: []corev1.EnvVar{
+						{Name: EnvVarOrg, Value: "test"},
+						{Name: EnvVarRunnerGroup, Value: "team-a"},
+					},
+				},
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+	}
+
+	res, _, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "test", "", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != nil {
+		t.Errorf("expected the runner pod to be safe to delete, got %+v", res)
+	}
+	if !removed {
+		t.Errorf("expected the runner found in the runner group to be removed")
+	}
+}
+
+func TestEnsureRunnerUnregistration_RateLimited(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Now().Truncate(time.Second)
+
+	primaryRateLimit := `{"message": "API rate limit exceeded"}`
+	secondaryRateLimit := `{"message": "You have exceeded a secondary rate limit", "documentation_url": "https://docs.github.com/rest/overview/resources-in-the-rest-api#secondary-rate-limits"}`
+
+	tcs := []struct {
+		name                string
+		status              int
+		headers             map[string]string
+		body                string
+		rateLimitRetryDelay time.Duration
+		wantRequeue         time.Duration
+		wantReason          gracefulStopReason
+	}{
+		{
+			name:   "primary rate limit with reset time",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     fmt.Sprintf("%d", now.Add(90*time.Second).Unix()),
+			},
+			body:        primaryRateLimit,
+			wantRequeue: 90 * time.Second,
+			wantReason:  gracefulStopReasonRateLimited,
+		},
+		{
+			name:   "primary rate limit without reset time",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+			},
+			body:        primaryRateLimit,
+			wantRequeue: retryDelayOnGitHubAPIRateLimitError,
+			wantReason:  gracefulStopReasonRateLimited,
+		},
+		{
+			name:   "primary rate limit with client delay",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+			},
+			body:                primaryRateLimit,
+			rateLimitRetryDelay: 10 * time.Second,
+			wantRequeue:         10 * time.Second,
+			wantReason:          gracefulStopReasonRateLimited,
+		},
+		{
+			name:   "secondary rate limit with retry-after",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"Retry-After": "120",
+			},
+			body:        secondaryRateLimit,
+			wantRequeue: 2 * time.Minute,
+			wantReason:  gracefulStopReasonRateLimited,
+		},
+		{
+			name:        "secondary rate limit without retry-after",
+			status:      http.StatusForbidden,
+			body:        secondaryRateLimit,
+			wantRequeue: retryDelayOnGitHubAPIRateLimitError,
+			wantReason:  gracefulStopReasonRateLimited,
+		},
+		{
+			name:   "too many requests from a proxy with retry-after",
+			status: http.StatusTooManyRequests,
+			headers: map[string]string{
+				"Retry-After": "45",
+			},
+			body:        `{"message": "error"}`,
+			wantRequeue: 45 * time.Second,
+			wantReason:  gracefulStopReasonServerError,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, fake.RunnersListBody)
+			})
+			mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			conf := github.Config{
+				Token:               "token",
+				RateLimitRetryDelay: tc.rateLimitRetryDelay,
+			}
+			ghClient, err := conf.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ghClient.Client.BaseURL = newGithubClient(server).Client.BaseURL
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now),
+					Annotations: map[string]string{
+						AnnotationKeyRunnerID:                     "1",
+						AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+					},
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				retryableStatusCodes:    DefaultRetryableGitHubStatusCodes,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, _ := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+			if reason != tc.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tc.wantReason, reason)
+			}
+			if res == nil || res.RequeueAfter != tc.wantRequeue {
+				t.Errorf("unexpected result: want requeue after %s, got %+v", tc.wantRequeue, res)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_CircuitOpen(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removals int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removals++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conf := github.Config{
+		Token:                          "token",
+		CircuitBreakerFailureThreshold: 1,
+		CircuitBreakerCooldown:         5 * time.Minute,
+	}
+	ghClient, err := conf.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient.Client.BaseURL = newGithubClient(server).Client.BaseURL
+
+	now := time.Now()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now),
+			Annotations: map[string]string{
+				AnnotationKeyRunnerID:                     "1",
+				AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	// The runner ID is known so ARC would call RemoveRunner right away.
+	// Trip the circuit breaker beforehand with a failing call from elsewhere, like the autoscaler.
+	if _, err := ghClient.ListRunners(context.Background(), "", "", "test/valid"); err == nil {
+		t.Fatal("expected ListRunners to fail")
+	}
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		clock:                   clocktesting.NewFakeClock(now),
+	}
+
+	res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason != gracefulStopReasonCircuitOpen {
+		t.Errorf("unexpected reason: want %s, got %s", gracefulStopReasonCircuitOpen, reason)
+	}
+	// The circuit breaker uses the real clock, so the remaining cooldown is slightly off from the fake clock.
+	if res == nil || res.RequeueAfter < 4*time.Minute || res.RequeueAfter > 5*time.Minute+time.Second {
+		t.Errorf("expected requeue after the remaining cooldown, got %+v", res)
+	}
+	if removals != 0 {
+		t.Errorf("expected no RemoveRunner API call while the circuit breaker is open, got %d", removals)
+	}
+}
+
+var _ GitHubRunnerClient = &fake.RunnerClient{}
+
+func TestEnsureRunnerUnregistration_FakeGitHubClient(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		runners     []*gogithub.Runner
+		removeErr   error
+		wantReason  gracefulStopReason
+		wantRequeue time.Duration
+		wantErr     bool
+		wantRemoved []int64
+		// wantCalls is the GitHub API calls made in order.
+		// The happy path should make exactly one call, and a busy runner at most one more to confirm it's busy.
+		wantCalls []string
+	}{
+		{
+			name:        "idle runner",
+			runners:     []*gogithub.Runner{fake.NewRunner(1, "test1", false)},
+			wantReason:  gracefulStopReasonCompleted,
+			wantRemoved: []int64{1},
+			wantCalls:   []string{"RemoveRunner"},
+		},
+		{
+			name:        "busy runner",
+			runners:     []*gogithub.Runner{fake.NewRunner(1, "test1", true)},
+			wantReason:  gracefulStopReasonRunnerBusy,
+			wantRequeue: DefaultUnregistrationRetryDelay,
+			wantRemoved: []int64{1},
+			wantCalls:   []string{"RemoveRunner", "GetRunnerByID"},
+		},
+		{
+			name:        "runner got a job after listed",
+			runners:     []*gogithub.Runner{fake.NewRunner(1, "test1", false)},
+			removeErr:   fake.NewBusyRunnerError("test1"),
+			wantReason:  gracefulStopReasonRunnerBusy,
+			wantRequeue: DefaultUnregistrationRetryDelay,
+			wantRemoved: []int64{1},
+			wantCalls:   []string{"RemoveRunner", "GetRunnerByID"},
+		},
+		{
+			name:        "rate limited",
+			runners:     []*gogithub.Runner{fake.NewRunner(1, "test1", false)},
+			removeErr:   fake.NewRateLimitError(now.Add(10 * time.Minute)),
+			wantReason:  gracefulStopReasonRateLimited,
+			wantRequeue: 10 * time.Minute,
+			wantErr:     true,
+			wantRemoved: []int64{1},
+			wantCalls:   []string{"RemoveRunner"},
+		},
+		{
+			name:        "runner already removed",
+			runners:     []*gogithub.Runner{fake.NewRunner(1, "test1", false)},
+			removeErr:   fake.NewErrorResponse(http.MethodDelete, http.StatusNotFound, "Not Found"),
+			wantReason:  gracefulStopReasonCompleted,
+			wantRemoved: []int64{1},
+			wantCalls:   []string{"RemoveRunner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghClient := fake.NewRunnerClient(tt.runners...)
+			if tt.removeErr != nil {
+				ghClient.QueueRemoveRunner(tt.removeErr)
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					Annotations: map[string]string{
+						AnnotationKeyRunnerID:                     "1",
+						AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+					},
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			var requeue time.Duration
+			if res != nil {
+				requeue = res.RequeueAfter
+			}
+			if requeue != tt.wantRequeue {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tt.wantRequeue, requeue)
+			}
+
+			var removed []int64
+			for _, call := range ghClient.Calls("RemoveRunner") {
+				removed = append(removed, call.RunnerID)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("unexpected RemoveRunner calls: want %v, got %v", tt.wantRemoved, removed)
+			}
+
+			var calls []string
+			for _, call := range ghClient.Calls("") {
+				calls = append(calls, call.Method)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("unexpected GitHub API calls: want %v, got %v", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestTickRunnerGracefulStop_BusyRunnerCancellation(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	busy := fake.NewRunner(1, "test1", true)
+	ghClient := fake.NewRunnerClient(busy)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(start.Add(-time.Hour)),
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	recorder := record.NewFakeRecorder(10)
+	clock := clocktesting.NewFakeClock(start)
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		recorder:                recorder,
+		clock:                   clock,
+	}
+
+	tick := func() (*ctrl.Result, gracefulStopReason) {
+		t.Helper()
+
+		var latest corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &latest); err != nil {
+			t.Fatal(err)
+		}
+
+		_, res, reason, err := tickRunnerGracefulStopWithReason(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", &latest)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return res, reason
+	}
+
+	events := func() []string {
+		var reasons []string
+		for len(recorder.Events) > 0 {
+			reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+		}
+		return reasons
+	}
+
+	// The runner stays busy for several ticks, like while draining a long job.
+	for i, wantDelay := range []time.Duration{DefaultUnregistrationRetryDelay, 2 * DefaultUnregistrationRetryDelay, 4 * DefaultUnregistrationRetryDelay} {
+		res, reason := tick()
+
+		if reason != gracefulStopReasonRunnerBusy {
+			t.Fatalf("[%d] unexpected reason: want %s, got %s", i, gracefulStopReasonRunnerBusy, reason)
+		}
+		if res == nil || res.RequeueAfter != wantDelay {
+			t.Errorf("[%d] unexpected requeue: want %s, got %+v", i, wantDelay, res)
+		}
+
+		clock.Step(wantDelay)
+	}
+
+	if got, want := events(), []string{"RunnerUnregistrationStarted", "RunnerUnregistrationCancelled"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected events: want %v, got %v", want, got)
+	}
+
+	var updated corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unregistration timeout keeps counting from the original start.
+	if got, want := updated.Annotations[AnnotationKeyUnregistrationStartTimestamp], start.Format(time.RFC3339); got != want {
+		t.Errorf("unexpected start timestamp: want %s, got %s", want, got)
+	}
+	if got, want := updated.Annotations[AnnotationKeyUnregistrationCancelTimestamp], start.Format(time.RFC3339); got != want {
+		t.Errorf("unexpected cancel timestamp: want %s, got %s", want, got)
+	}
+
+	if removals := ghClient.Calls("RemoveRunner"); len(removals) != 0 {
+		t.Errorf("unexpected RemoveRunner calls for the busy runner: %v", removals)
+	}
+
+	// The runner completes the job, so the graceful stop resumes without restarting.
+	busy.Busy = gogithub.Bool(false)
+
+	if res, reason := tick(); res != nil || reason != gracefulStopReasonCompleted {
+		t.Fatalf("unexpected result: want completion, got %+v (%s)", res, reason)
+	}
+
+	if got, want := events(), []string{"RunnerUnregistrationCompleted"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected events: want %v, got %v", want, got)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := updated.Annotations[AnnotationKeyUnregistrationCancelTimestamp]; ok {
+		t.Errorf("unexpected cancel timestamp after the runner went idle: %s", v)
+	}
+}
+
+func TestEnsureRunnerUnregistration_OnlyUnregisterOffline(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	offline := fake.NewRunner(1, "test1", false)
+	offline.Status = gogithub.String("offline")
+
+	tests := []struct {
+		name          string
+		runner        *gogithub.Runner
+		ephemeral     bool
+		containerDone bool
+		wantReason    gracefulStopReason
+		wantRemoved   bool
+	}{
+		{
+			name:       "online runner",
+			runner:     fake.NewRunner(1, "test1", false),
+			wantReason: gracefulStopReasonRunnerOnline,
+		},
+		{
+			name:        "offline runner",
+			runner:      offline,
+			wantReason:  gracefulStopReasonCompleted,
+			wantRemoved: true,
+		},
+		{
+			name:          "online runner whose container has stopped",
+			runner:        fake.NewRunner(1, "test1", false),
+			containerDone: true,
+			wantReason:    gracefulStopReasonCompleted,
+			wantRemoved:   true,
+		},
+		{
+			name:        "online ephemeral runner",
+			runner:      fake.NewRunner(1, "test1", false),
+			ephemeral:   true,
+			wantReason:  gracefulStopReasonCompleted,
+			wantRemoved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghClient := fake.NewRunnerClient(tt.runner)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					Annotations: map[string]string{
+						AnnotationKeyRunnerID:                     "1",
+						AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+					},
+				},
+			}
+			if tt.ephemeral {
+				setAnnotation(&pod.ObjectMeta, AnnotationKeyEphemeral, "true")
+			}
+			if tt.containerDone {
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name: containerName,
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+					},
+				}}
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				onlyUnregisterOffline:   true,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			if !tt.wantRemoved && (res == nil || res.RequeueAfter != DefaultUnregistrationRetryDelay) {
+				t.Errorf("expected the unregistration to be retried after %s, got %+v", DefaultUnregistrationRetryDelay, res)
+			}
+
+			if removed := len(ghClient.Calls("RemoveRunner")) > 0; removed != tt.wantRemoved {
+				t.Errorf("unexpected RemoveRunner call: want %v, got %v", tt.wantRemoved, removed)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_OfflineGracePeriod(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	offlineBusy := fake.NewRunner(1, "test1", true)
+	offlineBusy.Status = gogithub.String("offline")
+
+	tests := []struct {
+		name             string
+		runner           *gogithub.Runner
+		gracePeriod      time.Duration
+		offlineSince     time.Time
+		wantReason       gracefulStopReason
+		wantOfflineSince string
+		wantRequeue      bool
+	}{
+		{
+			name:             "first seen offline",
+			runner:           offlineBusy,
+			gracePeriod:      10 * time.Minute,
+			wantReason:       gracefulStopReasonRunnerBusy,
+			wantOfflineSince: now.Format(time.RFC3339),
+			wantRequeue:      true,
+		},
+		{
+			name:             "offline for the grace period",
+			runner:           offlineBusy,
+			gracePeriod:      10 * time.Minute,
+			offlineSince:     now.Add(-10 * time.Minute),
+			wantReason:       gracefulStopReasonRunnerOffline,
+			wantOfflineSince: now.Add(-10 * time.Minute).Format(time.RFC3339),
+		},
+		{
+			name:         "back online",
+			runner:       fake.NewRunner(1, "test1", true),
+			gracePeriod:  10 * time.Minute,
+			offlineSince: now.Add(-time.Hour),
+			wantReason:   gracefulStopReasonRunnerBusy,
+			wantRequeue:  true,
+		},
+		{
+			name:             "disabled",
+			runner:           offlineBusy,
+			offlineSince:     now.Add(-time.Hour),
+			wantReason:       gracefulStopReasonRunnerBusy,
+			wantOfflineSince: now.Add(-time.Hour).Format(time.RFC3339),
+			wantRequeue:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]string{
+				AnnotationKeyRunnerID:                     "1",
+				AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+			}
+			if !tt.offlineSince.IsZero() {
+				annotations[AnnotationKeyOfflineTimestamp] = tt.offlineSince.Format(time.RFC3339)
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					Annotations:       annotations,
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				offlineGracePeriod:      tt.gracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, fake.NewRunnerClient(tt.runner), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			if (res != nil) != tt.wantRequeue {
+				t.Errorf("unexpected result: want requeue %v, got %+v", tt.wantRequeue, res)
+			}
+
+			var got corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if v := got.Annotations[AnnotationKeyOfflineTimestamp]; v != tt.wantOfflineSince {
+				t.Errorf("unexpected %s annotation: want %q, got %q", AnnotationKeyOfflineTimestamp, tt.wantOfflineSince, v)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_SkipUnregistrationForEphemeral(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	nonEphemeral := false
+
+	tests := []struct {
+		name      string
+		config    v1alpha1.RunnerConfig
+		stopped   bool
+		wantCalls []string
+	}{
+		{
+			name:    "stopped ephemeral runner",
+			config:  v1alpha1.RunnerConfig{Repository: "test/valid", SkipUnregistrationForEphemeral: true},
+			stopped: true,
+		},
+		{
+			name:      "running ephemeral runner",
+			config:    v1alpha1.RunnerConfig{Repository: "test/valid", SkipUnregistrationForEphemeral: true},
+			wantCalls: []string{"RemoveRunner"},
+		},
+		{
+			name:      "stopped non-ephemeral runner",
+			config:    v1alpha1.RunnerConfig{Repository: "test/valid", Ephemeral: &nonEphemeral, SkipUnregistrationForEphemeral: true},
+			stopped:   true,
+			wantCalls: []string{"RemoveRunner"},
+		},
+		{
+			name:      "disabled",
+			config:    v1alpha1.RunnerConfig{Repository: "test/valid"},
+			stopped:   true,
+			wantCalls: []string{"RemoveRunner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, err := newRunnerPod("test1", corev1.Pod{}, tt.config, "runner", nil, "docker", "", "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pod.Name = "test1"
+			pod.Namespace = "default"
+			pod.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+			pod.Annotations[AnnotationKeyRunnerID] = "1"
+			pod.Status.Phase = corev1.PodRunning
+
+			if tt.stopped {
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+					{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+				}
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(&pod).Build()
+
+			ghClient := fake.NewRunnerClient(fake.NewRunner(1, "test1", false))
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", &pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res != nil || reason != gracefulStopReasonCompleted {
+				t.Errorf("expected the runner pod to be safe for deletion, got %+v, %s", res, reason)
+			}
+
+			var calls []string
+			for _, call := range ghClient.Calls("") {
+				calls = append(calls, call.Method)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("unexpected GitHub API calls: want %v, got %v", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_VerifyRunnerID(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test1",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+				Annotations: map[string]string{
+					// The runner ID 1 has been reassigned to another runner, like after a GHES restore.
+					AnnotationKeyRunnerID:                     "1",
+					AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+				},
+			},
+		}
+	}
+
+	newRunners := func() []*gogithub.Runner {
+		return []*gogithub.Runner{fake.NewRunner(1, "other", false), fake.NewRunner(2, "test1", false)}
+	}
+
+	removedIDs := func(ghClient *fake.RunnerClient) []int64 {
+		var ids []int64
+		for _, call := range ghClient.Calls("RemoveRunner") {
+			ids = append(ids, call.RunnerID)
+		}
+		return ids
+	}
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		clock:                   clocktesting.NewFakeClock(now),
+	}
+
+	t.Run("without verification", func(t *testing.T) {
+		ghClient := fake.NewRunnerClient(newRunners()...)
+		pod := newPod()
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+		if _, _, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, want := removedIDs(ghClient), []int64{1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected RemoveRunner calls: want %v, got %v", want, got)
+		}
+	})
+
+	t.Run("with verification", func(t *testing.T) {
+		cfg := cfg
+		cfg.verifyRunnerID = true
+
+		ghClient := fake.NewRunnerClient(newRunners()...)
+		pod := newPod()
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+		res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res == nil || reason != gracefulStopReasonRunnerIDMismatch {
+			t.Fatalf("expected the unregistration to be retried due to the runner ID mismatch, got result %+v and reason %s", res, reason)
+		}
+		if got := removedIDs(ghClient); len(got) != 0 {
+			t.Fatalf("expected no runner to be removed, got %v", got)
+		}
+
+		var updated corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &updated); err != nil {
+			t.Fatal(err)
+		}
+		if id, ok := getAnnotation(&updated, AnnotationKeyRunnerID); ok {
+			t.Fatalf("expected the mismatched runner ID to be forgotten, got %s", id)
+		}
+
+		// The next try looks up the runner by name.
+		res, reason, err = ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", &updated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res != nil || reason != gracefulStopReasonCompleted {
+			t.Fatalf("expected the unregistration to complete, got result %+v and reason %s", res, reason)
+		}
+		if got, want := removedIDs(ghClient), []int64{2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected RemoveRunner calls: want %v, got %v", want, got)
+		}
+	})
+}
+
+func TestEnsureRunnerUnregistration_BusyRunnerUnregistered(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// The runner picks up a job between the busy check and the lookup right before the removal,
+	// and GitHub accepts the removal anyway.
+	ghClient := fake.NewRunnerClient(fake.NewRunner(1, "test1", false))
+	ghClient.QueueListRunners([]*gogithub.Runner{fake.NewRunner(1, "test1", false)}, nil)
+	ghClient.QueueListRunners([]*gogithub.Runner{fake.NewRunner(1, "test1", true)}, nil)
+	ghClient.QueueRemoveRunner(nil)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			Annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		clock:                   clocktesting.NewFakeClock(now),
+	}
+
+	repo := "test/busy-runner-unregistered"
+
+	before := busyRunnerUnregisteredCount(t, repo)
+
+	_, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", repo, "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reason != gracefulStopReasonCompleted {
+		t.Errorf("unexpected reason: want %s, got %s", gracefulStopReasonCompleted, reason)
+	}
+
+	if got := busyRunnerUnregisteredCount(t, repo) - before; got != 1 {
+		t.Errorf("unexpected number of busy runners unregistered: want 1, got %v", got)
+	}
+}
+
+func busyRunnerUnregisteredCount(t *testing.T, repo string) float64 {
+	t.Helper()
+
+	families, err := crmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	var count float64
+
+	for _, f := range families {
+		if f.GetName() != "arc_busy_runner_unregistered_total" {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "repository" && l.GetValue() == repo {
+					count += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return count
+}
+
+// TestEnsureRunnerUnregistration_Scope verifies that the runner is looked up and removed in the scope of the runner,
+// as the enterprise and the organization are empty for repository runners, and the repository is empty for the others.
+func TestEnsureRunnerUnregistration_Scope(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		enterprise   string
+		organization string
+		repository   string
+		wantPath     string
+	}{
+		{name: "enterprise", enterprise: "myent", wantPath: "/enterprises/myent/actions/runners"},
+		{name: "organization", organization: "myorg", wantPath: "/orgs/myorg/actions/runners"},
+		{name: "repository", repository: "myorg/myrepo", wantPath: "/repos/myorg/myrepo/actions/runners"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+
+				switch {
+				case req.Method == http.MethodGet && req.URL.Path == tt.wantPath:
+					fmt.Fprint(w, `{"total_count":1,"runners":[{"id":1,"name":"test1","status":"online","busy":false}]}`)
+				case req.Method == http.MethodDelete && req.URL.Path == tt.wantPath+"/1":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, tt.enterprise, tt.organization, tt.repository, "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res != nil || reason != gracefulStopReasonCompleted {
+				t.Errorf("expected the runner to be unregistered, got %+v, %s", res, reason)
+			}
+
+			// Without the runners cache, the runner is listed once to look it up and once more to unregister it by name.
+			for _, r := range requests {
+				if r != "GET "+tt.wantPath && r != "DELETE "+tt.wantPath+"/1" {
+					t.Errorf("unexpected request out of the scope: %s", r)
+				}
+			}
+			if len(requests) == 0 || requests[len(requests)-1] != "DELETE "+tt.wantPath+"/1" {
+				t.Errorf("expected the runner to be removed in the scope, got %v", requests)
+			}
+		})
+	}
+}
+
+func TestUnregisterRunner_AlreadyRemoved(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodDelete {
+			t.Errorf("unexpected method: %s", req.Method)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	id := int64(1)
+
+	ok, alreadyGone, err := unregisterRunner(context.Background(), log, false, false, newGithubClient(server), "", "", "test/valid", "test1", 0, nil, nil, &id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected the runner to be considered unregistered")
+	}
+	if !alreadyGone {
+		t.Errorf("expected the runner to be reported as already gone")
+	}
+}
+
+func TestUnregisterRunner_UnregisterError(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	id := int64(1)
+
+	tests := []struct {
+		name       string
+		removeErr  error
+		wantStatus int
+		wantBusy   bool
+	}{
+		{
+			name:       "busy",
+			removeErr:  fake.NewBusyRunnerError("test1"),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBusy:   true,
+		},
+		{
+			name:       "unprocessable but not busy",
+			removeErr:  fake.NewErrorResponse(http.MethodDelete, http.StatusUnprocessableEntity, "Validation Failed"),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "server error",
+			removeErr:  fake.NewErrorResponse(http.MethodDelete, http.StatusBadGateway, "Bad Gateway"),
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "rate limited",
+			removeErr:  fake.NewRateLimitError(time.Now().Add(time.Minute)),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:      "no response",
+			removeErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewRunnerClient(fake.NewRunner(id, "test1", false))
+			client.QueueRemoveRunner(tc.removeErr)
+
+			ok, _, err := unregisterRunner(context.Background(), log, false, false, client, "", "", "test/valid", "test1", 0, nil, nil, &id)
+			if ok {
+				t.Errorf("expected the runner not to be unregistered")
+			}
+
+			var unregErr *unregisterError
+			if !errors.As(err, &unregErr) {
+				t.Fatalf("expected an unregisterError, got %T: %v", err, err)
+			}
+
+			if unregErr.StatusCode != tc.wantStatus {
+				t.Errorf("unexpected status code: want %d, got %d", tc.wantStatus, unregErr.StatusCode)
+			}
+
+			if unregErr.Busy != tc.wantBusy {
+				t.Errorf("unexpected busy: want %v, got %v", tc.wantBusy, unregErr.Busy)
+			}
+
+			if !errors.Is(err, tc.removeErr) {
+				t.Errorf("expected the error to wrap the RemoveRunner error %v", tc.removeErr)
+			}
+		})
+	}
+}
+
+func Test_lastUnregistrationError(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	got := lastUnregistrationError(now, fmt.Errorf("failed to remove runner"))
+	if want := "2022-03-01T10:00:00Z failed to remove runner"; got != want {
+		t.Errorf("lastUnregistrationError() = %q, want %q", got, want)
+	}
+
+	long := lastUnregistrationError(now, fmt.Errorf("%0*d", maxLastUnregistrationErrorLength*2, 0))
+	if want := len("2022-03-01T10:00:00Z ") + maxLastUnregistrationErrorLength + len("..."); len(long) != want {
+		t.Errorf("unexpected length of a truncated error: want %d, got %d", want, len(long))
+	}
+}
+
+func TestEnsureRunnerUnregistration_AmbiguousEphemeralRunnerName(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 2, "runners": [`+
+			`{"id": 1, "name": "test1", "os": "linux", "status": "offline", "busy": false},`+
+			`{"id": 2, "name": "test1", "os": "linux", "status": "online", "busy": false}]}`)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/", func(w http.ResponseWriter, req *http.Request) {
+		removed = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+			Annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: containerName,
+					Env: []corev1.EnvVar{
+						{Name: "RUNNER_EPHEMERAL", Value: "true"},
+					},
+				},
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+	}
+
+	res, _, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res == nil {
+		t.Fatalf("expected the pod deletion to be postponed, but it was allowed")
+	}
+	if removed {
+		t.Errorf("expected no runner to be removed, but RemoveRunner was called")
+	}
+}
+
+// conflictingClient is a client.Client that fails the first n patches with a conflict error.
+type conflictingClient struct {
+	client.Client
+
+	conflicts int
+}
+
+func (c *conflictingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return kerrors.NewConflict(corev1.Resource("pods"), obj.GetName(), fmt.Errorf("the object has been modified"))
+	}
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestAnnotatePodOnce_RetryOnConflict(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+	}
+
+	c := &conflictingClient{
+		Client:    clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build(),
+		conflicts: 2,
+	}
+
+	updated, err := annotatePodOnce(context.Background(), c, log, pod, AnnotationKeyRunnerID, "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := getAnnotation(updated, AnnotationKeyRunnerID); v != "1" {
+		t.Errorf("unexpected annotation value: want %q, got %q", "1", v)
+	}
+
+	var latest corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &latest); err != nil {
+		t.Fatalf("unable to get pod: %v", err)
+	}
+	if v, _ := getAnnotation(&latest, AnnotationKeyRunnerID); v != "1" {
+		t.Errorf("unexpected annotation value of the stored pod: want %q, got %q", "1", v)
+	}
+}
+
+func TestAnnotatePodOnce_StaleCache(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	stale := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+	}
+
+	latest := stale.DeepCopy()
+	setAnnotation(&latest.ObjectMeta, AnnotationKeyUnregistrationStartTimestamp, "2022-03-01T00:00:00Z")
+
+	apiServer := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(latest).Build()
+
+	// The stale pod is what the reconcilation loop read from the cache before the informer caught up with the annotation.
+	updated, err := annotatePodOnce(context.Background(), newPodClient(apiServer, apiServer), log, stale, AnnotationKeyUnregistrationStartTimestamp, "2022-03-01T00:05:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := getAnnotation(updated, AnnotationKeyUnregistrationStartTimestamp); v != "2022-03-01T00:00:00Z" {
+		t.Errorf("unexpected annotation value of the returned pod: want %q, got %q", "2022-03-01T00:00:00Z", v)
+	}
+
+	var stored corev1.Pod
+	if err := apiServer.Get(context.Background(), client.ObjectKeyFromObject(stale), &stored); err != nil {
+		t.Fatalf("unable to get pod: %v", err)
+	}
+	if v, _ := getAnnotation(&stored, AnnotationKeyUnregistrationStartTimestamp); v != "2022-03-01T00:00:00Z" {
+		t.Errorf("expected the annotation not to be overwritten, got %q", v)
+	}
+}
+
+func Test_getAnnotation_customAnnotationKeyPrefix(t *testing.T) {
+	SetAnnotationKeyPrefix("canary.actions-runner/")
+	defer SetAnnotationKeyPrefix(DefaultAnnotationKeyPrefix)
+
+	for got, want := range map[string]string{
+		AnnotationKeyRunnerID:                  "canary.actions-runner/id",
+		AnnotationKeyLastUnregistrationError:   "canary.actions-runner/last-unregistration-error",
+		AnnotationKeyLastRegistrationCheckTime: "canary.actions-runner/last-registration-check-time",
+	} {
+		if got != want {
+			t.Errorf("unexpected annotation key: want %s, got %s", want, got)
+		}
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				DefaultAnnotationKeyPrefix + "id":                             "1",
+				DefaultAnnotationKeyPrefix + "unregistration-start-timestamp": "2022-03-01T09:00:00Z",
+				"canary.actions-runner/unregistration-start-timestamp":        "2022-03-01T10:00:00Z",
+			},
+		},
+	}
+
+	if v, ok := getAnnotation(pod, AnnotationKeyRunnerID); ok {
+		t.Errorf("unexpected annotation with the default prefix read for the changed prefix: %q", v)
+	}
+
+	if v, ok := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp); !ok || v != "2022-03-01T10:00:00Z" {
+		t.Errorf("unexpected annotation value: got %q, %v", v, ok)
+	}
+
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	updated, err := unannotatePod(context.Background(), c, log, pod, AnnotationKeyUnregistrationStartTimestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := updated.Annotations[AnnotationKeyUnregistrationStartTimestamp]; ok {
+		t.Errorf("expected the annotation with the changed prefix to be removed")
+	}
+
+	if _, ok := updated.Annotations[DefaultAnnotationKeyPrefix+"unregistration-start-timestamp"]; !ok {
+		t.Errorf("expected the annotation with the default prefix to be left for the other controller")
+	}
+}
+
+func Test_migrateLegacyAnnotations(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	SetAnnotationKeyPrefix("canary.actions-runner/")
+	defer SetAnnotationKeyPrefix(DefaultAnnotationKeyPrefix)
+
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test1",
+				Namespace: "default",
+				Annotations: map[string]string{
+					DefaultAnnotationKeyPrefix + "id":                             "1",
+					DefaultAnnotationKeyPrefix + "unregistration-start-timestamp": "2022-03-01T09:00:00Z",
+					"canary.actions-runner/unregistration-start-timestamp":        "2022-03-01T10:00:00Z",
+					"actions-runner-controller/last-unregistration-error":         "2022-03-01T09:30:00Z boom",
+				},
+			},
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		pod := newPod()
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+		updated, err := migrateLegacyAnnotations(context.Background(), c, log, pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, ok := getAnnotation(updated, AnnotationKeyRunnerID); ok {
+			t.Errorf("unexpected migration while disabled: %q", v)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		EnableLegacyAnnotationKeyMigration()
+		defer func() { migrateLegacyAnnotationKeys = false }()
+
+		pod := newPod()
+		c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+		updated, err := migrateLegacyAnnotations(context.Background(), c, log, pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, _ := getAnnotation(updated, AnnotationKeyRunnerID); v != "1" {
+			t.Errorf("expected the runner ID to be migrated, got %q", v)
+		}
+
+		if v, _ := getAnnotation(updated, AnnotationKeyLastUnregistrationError); v != "2022-03-01T09:30:00Z boom" {
+			t.Errorf("expected the formerly fixed annotation to be migrated, got %q", v)
+		}
+
+		if v, _ := getAnnotation(updated, AnnotationKeyUnregistrationStartTimestamp); v != "2022-03-01T10:00:00Z" {
+			t.Errorf("expected the annotation with the changed prefix not to be overwritten, got %q", v)
+		}
+
+		if _, ok := updated.Annotations[DefaultAnnotationKeyPrefix+"id"]; !ok {
+			t.Errorf("expected the annotation with the default prefix to be left as-is")
+		}
+
+		// The migration is done only once, so that annotations removed afterwards aren't brought back.
+		updated, err = unannotatePod(context.Background(), c, log, updated, AnnotationKeyRunnerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err = migrateLegacyAnnotations(context.Background(), c, log, updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, ok := getAnnotation(updated, AnnotationKeyRunnerID); ok {
+			t.Errorf("unexpected runner ID migrated again: %q", v)
+		}
+	})
+}
+
+func TestValidateAnnotationKeyPrefix(t *testing.T) {
+	for prefix, wantErr := range map[string]bool{
+		DefaultAnnotationKeyPrefix: false,
+		"canary.actions-runner/":   false,
+		"canary.actions-runner":    true,
+		"canary/actions-runner/":   true,
+		"":                         true,
+		"/":                        true,
+		"Canary.actions-runner/":   true,
+		"canary_actions-runner/":   true,
+		"-canary.actions-runner/":  true,
+	} {
+		if err := ValidateAnnotationKeyPrefix(prefix); (err != nil) != wantErr {
+			t.Errorf("unexpected result for %q: want error %v, got %v", prefix, wantErr, err)
+		}
+	}
+}
+
+func Test_withRunnerScope(t *testing.T) {
+	log := logr.New(&testLogSink{writer: io.Discard})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test1-abcde",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node1",
+		},
+	}
+
+	sink := withRunnerScope(log, "", "test", "", "test1", pod).GetSink().(*testLogSink)
+
+	want := map[string]interface{}{
+		"organization": "test",
+		"runner":       "test1",
+		"pod":          "test1-abcde",
+		"node":         "node1",
+	}
+	if len(sink.keyValues) != len(want) {
+		t.Fatalf("unexpected values: want %v, got %v", want, sink.keyValues)
+	}
+	for k, v := range want {
+		if sink.keyValues[k] != v {
+			t.Errorf("unexpected value for %s: want %v, got %v", k, v, sink.keyValues[k])
+		}
+	}
+}
+
+func TestEnsureRunnerUnregistration_Timeout(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		elapsed     time.Duration
+		jobTimeout  string
+		wantRequeue bool
+		wantReason  gracefulStopReason
+	}{
+		{
+			name:        "within the registration grace period",
+			elapsed:     DefaultRegistrationGracePeriod - time.Second,
+			wantRequeue: true,
+			wantReason:  gracefulStopReasonRegistrationGracePeriod,
+		},
+		{
+			name:        "within the unregistration timeout",
+			elapsed:     DefaultRegistrationGracePeriod + time.Second,
+			wantRequeue: true,
+			wantReason:  gracefulStopReasonInProgress,
+		},
+		{
+			name:       "timed out",
+			elapsed:    DefaultRegistrationGracePeriod + DefaultUnregistrationTimeout,
+			wantReason: gracefulStopReasonTimedOut,
+		},
+		{
+			name:        "within the job timeout",
+			elapsed:     DefaultRegistrationGracePeriod + DefaultUnregistrationTimeout,
+			jobTimeout:  (2 * DefaultUnregistrationTimeout).String(),
+			wantRequeue: true,
+			wantReason:  gracefulStopReasonJobRunning,
+		},
+		{
+			name:       "job timeout shorter than the unregistration timeout",
+			elapsed:    DefaultRegistrationGracePeriod + DefaultUnregistrationTimeout,
+			jobTimeout: "1s",
+			wantReason: gracefulStopReasonTimedOut,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The unregistration starts on the pod creation, and the runner never shows up on GitHub.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(start),
+					Annotations: map[string]string{
+						AnnotationKeyUnregistrationStartTimestamp: start.Add(DefaultRegistrationGracePeriod).Format(time.RFC3339),
+					},
+				},
+			}
+			if tt.jobTimeout != "" {
+				pod.Annotations[AnnotationKeyJobTimeout] = tt.jobTimeout
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(start.Add(tt.elapsed)),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (res != nil) != tt.wantRequeue {
+				t.Errorf("unexpected result: want requeue %v, got %+v", tt.wantRequeue, res)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_BusyOnRemoveRunnerBacksOff(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// GitHub lists the runner idle, but the runner keeps picking up jobs before RemoveRunner is called.
+	ghClient := fake.NewRunnerClient(fake.NewRunner(1, "test1", false))
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			Annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		clock:                   clocktesting.NewFakeClock(now),
+	}
+
+	for i, wantDelay := range []time.Duration{DefaultUnregistrationRetryDelay, 2 * DefaultUnregistrationRetryDelay, 4 * DefaultUnregistrationRetryDelay} {
+		ghClient.QueueRemoveRunner(fake.NewBusyRunnerError("test1"))
+
+		var latest corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &latest); err != nil {
+			t.Fatal(err)
+		}
+
+		res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", &latest)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+		if reason != gracefulStopReasonRunnerBusy {
+			t.Errorf("[%d] unexpected reason: want %s, got %s", i, gracefulStopReasonRunnerBusy, reason)
+		}
+		if res == nil || res.RequeueAfter != wantDelay {
+			t.Errorf("[%d] unexpected requeue: want %s, got %+v", i, wantDelay, res)
+		}
+	}
+}
+
+func TestEnsureRunnerUnregistration_JobTimeoutBeforeRemoveRunner(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		elapsed         time.Duration
+		jobTimeout      string
+		wantReason      gracefulStopReason
+		wantRemoveCalls int
+	}{
+		{
+			name:            "within the job timeout",
+			elapsed:         time.Hour,
+			jobTimeout:      "2h0m0s",
+			wantReason:      gracefulStopReasonJobRunning,
+			wantRemoveCalls: 0,
+		},
+		{
+			name:            "job timeout elapsed",
+			elapsed:         2 * time.Hour,
+			jobTimeout:      "2h0m0s",
+			wantReason:      gracefulStopReasonCompleted,
+			wantRemoveCalls: 1,
+		},
+		{
+			name:            "no job timeout",
+			elapsed:         time.Minute,
+			wantReason:      gracefulStopReasonCompleted,
+			wantRemoveCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GitHub reports the runner idle, although the runner has just picked up a job.
+			ghClient := fake.NewRunnerClient(fake.NewRunner(1, "test1", false))
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(start.Add(-time.Hour)),
+					Annotations: map[string]string{
+						AnnotationKeyRunnerID:                     "1",
+						AnnotationKeyUnregistrationStartTimestamp: start.Format(time.RFC3339),
+					},
+				},
+			}
+			if tt.jobTimeout != "" {
+				pod.Annotations[AnnotationKeyJobTimeout] = tt.jobTimeout
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(start.Add(tt.elapsed)),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+			if reason == gracefulStopReasonJobRunning && (res == nil || res.RequeueAfter <= 0) {
+				t.Errorf("unexpected result: want requeue, got %+v", res)
+			}
+			if got := len(ghClient.Calls("RemoveRunner")); got != tt.wantRemoveCalls {
+				t.Errorf("unexpected number of RemoveRunner calls: want %d, got %d", tt.wantRemoveCalls, got)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_BlockStop(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	timedOut := start.Add(DefaultRegistrationGracePeriod + DefaultUnregistrationTimeout)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		condition        corev1.PodConditionType
+		status           corev1.ConditionStatus
+		now              time.Time
+		wantRequeueAfter time.Duration
+		wantReason       gracefulStopReason
+	}{
+		{
+			name:             "blocked",
+			condition:        "example.com/BlockStop",
+			status:           corev1.ConditionTrue,
+			now:              timedOut,
+			wantRequeueAfter: DefaultUnregistrationRetryDelay,
+			wantReason:       gracefulStopReasonBlockStop,
+		},
+		{
+			name:             "blocked until the hard cap",
+			condition:        "example.com/BlockStop",
+			status:           corev1.ConditionTrue,
+			now:              timedOut.Add(time.Hour - 10*time.Second),
+			wantRequeueAfter: 10 * time.Second,
+			wantReason:       gracefulStopReasonBlockStop,
+		},
+		{
+			name:       "hard cap exceeded",
+			condition:  "example.com/BlockStop",
+			status:     corev1.ConditionTrue,
+			now:        timedOut.Add(time.Hour),
+			wantReason: gracefulStopReasonTimedOut,
+		},
+		{
+			name:       "safe to stop",
+			condition:  "example.com/BlockStop",
+			status:     corev1.ConditionFalse,
+			now:        timedOut,
+			wantReason: gracefulStopReasonTimedOut,
+		},
+		{
+			name:       "disabled",
+			status:     corev1.ConditionTrue,
+			now:        timedOut,
+			wantReason: gracefulStopReasonTimedOut,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The unregistration starts on the pod creation, and the runner never shows up on GitHub.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(start),
+					Annotations: map[string]string{
+						AnnotationKeyUnregistrationStartTimestamp: start.Add(DefaultRegistrationGracePeriod).Format(time.RFC3339),
+					},
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{Type: "example.com/BlockStop", Status: tt.status},
+					},
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				blockStopCondition:      tt.condition,
+				maxBlockStopDuration:    time.Hour,
+				clock:                   clocktesting.NewFakeClock(tt.now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var requeueAfter time.Duration
+			if res != nil {
+				requeueAfter = res.RequeueAfter
+			}
+			if requeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tt.wantRequeueAfter, requeueAfter)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_ProtectedJob(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	timedOut := start.Add(DefaultRegistrationGracePeriod + DefaultUnregistrationTimeout)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		protectedJob     string
+		now              time.Time
+		wantRequeueAfter time.Duration
+		wantReason       gracefulStopReason
+		wantEvent        bool
+	}{
+		{
+			name:             "protected",
+			protectedJob:     "true",
+			now:              timedOut,
+			wantRequeueAfter: DefaultUnregistrationRetryDelay,
+			wantReason:       gracefulStopReasonProtectedJob,
+			wantEvent:        true,
+		},
+		{
+			name:             "protected long after the timeout",
+			protectedJob:     "true",
+			now:              timedOut.Add(24 * time.Hour),
+			wantRequeueAfter: DefaultUnregistrationRetryDelay,
+			wantReason:       gracefulStopReasonProtectedJob,
+			wantEvent:        true,
+		},
+		{
+			name:             "protected within the timeout",
+			protectedJob:     "true",
+			now:              timedOut.Add(-time.Minute),
+			wantRequeueAfter: DefaultUnregistrationRetryDelay,
+			wantReason:       gracefulStopReasonInProgress,
+		},
+		{
+			name:         "not protected",
+			protectedJob: "false",
+			now:          timedOut,
+			wantReason:   gracefulStopReasonTimedOut,
+		},
+		{
+			name:       "no annotation",
+			now:        timedOut,
+			wantReason: gracefulStopReasonTimedOut,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The unregistration starts on the pod creation, and the runner never shows up on GitHub.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(start),
+					Annotations: map[string]string{
+						AnnotationKeyUnregistrationStartTimestamp: start.Add(DefaultRegistrationGracePeriod).Format(time.RFC3339),
+					},
+				},
+			}
+			if tt.protectedJob != "" {
+				pod.Annotations[AnnotationKeyProtectedJob] = tt.protectedJob
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			recorder := record.NewFakeRecorder(10)
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				recorder:                recorder,
+				clock:                   clocktesting.NewFakeClock(tt.now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var requeueAfter time.Duration
+			if res != nil {
+				requeueAfter = res.RequeueAfter
+			}
+			if requeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tt.wantRequeueAfter, requeueAfter)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			var gotEvent bool
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, "RunnerProtectedJobBlockingStop") {
+					gotEvent = true
+				}
+			}
+			if gotEvent != tt.wantEvent {
+				t.Errorf("unexpected RunnerProtectedJobBlockingStop event: want %v, got %v", tt.wantEvent, gotEvent)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_TimeoutWarning(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The runner never shows up on GitHub, so the unregistration stays in progress until the timeout.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(start.Add(-DefaultRegistrationGracePeriod)),
+			Annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: start.Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+	recorder := record.NewFakeRecorder(10)
+	clock := clocktesting.NewFakeClock(start)
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   10 * time.Minute,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		timeoutWarningThreshold: 0.8,
+		recorder:                recorder,
+		clock:                   clock,
+	}
+
+	for _, tc := range []struct {
+		elapsed     time.Duration
+		wantWarning bool
+	}{
+		{elapsed: 5 * time.Minute, wantWarning: false},
+		{elapsed: 8*time.Minute + 30*time.Second, wantWarning: true},
+		// The warning isn't repeated on later ticks.
+		{elapsed: 9 * time.Minute, wantWarning: false},
+	} {
+		clock.SetTime(start.Add(tc.elapsed))
+
+		var current corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &current); err != nil {
+			t.Fatal(err)
+		}
+
+		_, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", &current)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.elapsed, err)
+		}
+		if reason != gracefulStopReasonInProgress {
+			t.Fatalf("%s: unexpected reason: want %s, got %s", tc.elapsed, gracefulStopReasonInProgress, reason)
+		}
+
+		var warned bool
+		for len(recorder.Events) > 0 {
+			if e := <-recorder.Events; strings.Contains(e, "RunnerUnregistrationTimeoutApproaching") {
+				warned = true
+			}
+		}
+		if warned != tc.wantWarning {
+			t.Errorf("%s: unexpected warning: want %v, got %v", tc.elapsed, tc.wantWarning, warned)
+		}
+	}
+
+	var got corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &got); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getAnnotation(&got, AnnotationKeyUnregistrationWarningTimestamp); v != start.Add(8*time.Minute+30*time.Second).Format(time.RFC3339) {
+		t.Errorf("unexpected warning timestamp annotation: %q", v)
+	}
+}
+
+func TestEnsureRunnerUnregistration_ConcurrencyLimit(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removed++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+			Annotations: map[string]string{
+				AnnotationKeyRunnerID:                     "1",
+				AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	limiter := newUnregistrationLimiter(1)
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+		unregistrationLimiter:   limiter,
+	}
+
+	// Another runner pod is being unregistered.
+	if !limiter.tryAcquire() {
+		t.Fatal("expected the limiter to have a token")
+	}
+
+	res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res == nil || res.RequeueAfter != retryDelayOnUnregistrationLimit || reason != gracefulStopReasonThrottled {
+		t.Fatalf("expected the unregistration to be throttled, got result %+v and reason %s", res, reason)
+	}
+	if removed != 0 {
+		t.Fatalf("expected no runner to be removed, but RemoveRunner was called %d times", removed)
+	}
+
+	limiter.release()
+
+	res, _, err = ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != nil {
+		t.Errorf("expected the unregistration to complete, got %+v", res)
+	}
+	if removed != 1 {
+		t.Errorf("expected RemoveRunner to be called once, got %d", removed)
+	}
+	if !limiter.tryAcquire() {
+		t.Error("expected the token to be released after the unregistration")
+	}
+}
+
+func Test_logThrottle(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	pod1 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "uid1"}}
+	pod2 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "uid2"}}
+
+	throttle := newLogThrottle(5 * time.Minute)
+
+	steps := []struct {
+		pod  *corev1.Pod
+		at   time.Duration
+		want bool
+	}{
+		{pod: pod1, at: 0, want: true},
+		{pod: pod1, at: 10 * time.Second, want: false},
+		{pod: pod2, at: 10 * time.Second, want: true},
+		{pod: pod1, at: 4 * time.Minute, want: false},
+		{pod: pod1, at: 5 * time.Minute, want: true},
+		{pod: pod2, at: 5 * time.Minute, want: false},
+		{pod: pod2, at: 6 * time.Minute, want: true},
+	}
+
+	for i, s := range steps {
+		if got := throttle.allow(s.pod, now.Add(s.at)); got != s.want {
+			t.Errorf("step %d: unexpected result for %s at %s: want %v, got %v", i, s.pod.UID, s.at, s.want, got)
+		}
+	}
+
+	var nilThrottle *logThrottle
+	for i := 0; i < 2; i++ {
+		if !nilThrottle.allow(pod1, now) {
+			t.Error("expected nil throttle to always allow")
+		}
+	}
+}
+
+func TestEnsureRunnerUnregistration_Paused(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removed++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test1",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+			Annotations: map[string]string{
+				AnnotationKeyRunnerID:                     "1",
+				AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+				AnnotationKeyPauseUnregistration:          "",
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	cfg := gracefulStopConfig{
+		unregistrationTimeout:   DefaultUnregistrationTimeout,
+		retryDelay:              DefaultUnregistrationRetryDelay,
+		registrationGracePeriod: DefaultRegistrationGracePeriod,
+	}
+
+	res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res == nil || res.RequeueAfter != retryDelayOnPausedUnregistration || reason != gracefulStopReasonPaused {
+		t.Fatalf("expected the unregistration to be paused, got result %+v and reason %s", res, reason)
+	}
+	if removed != 0 {
+		t.Fatalf("expected no runner to be removed, but RemoveRunner was called %d times", removed)
+	}
+
+	// Removing the annotation resumes the unregistration.
+	delete(pod.Annotations, AnnotationKeyPauseUnregistration)
+
+	res, _, err = ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != nil {
+		t.Errorf("expected the unregistration to complete, got %+v", res)
+	}
+	if removed != 1 {
+		t.Errorf("expected RemoveRunner to be called once, got %d", removed)
+	}
+}
+
+func TestEnsureRunnerUnregistration_QuietHours(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removed++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	quietHours, err := ParseQuietHours("22:00-06:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inQuietHours := time.Date(2022, 3, 1, 23, 0, 0, 0, time.UTC)
+
+	newPod := func(ephemeral bool) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test1",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(inQuietHours.Add(-time.Hour)),
+				Annotations: map[string]string{
+					AnnotationKeyRunnerID:                     "1",
+					AnnotationKeyUnregistrationStartTimestamp: inQuietHours.Format(time.RFC3339),
+				},
+			},
+		}
+		if ephemeral {
+			setAnnotation(&pod.ObjectMeta, AnnotationKeyEphemeral, "true")
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		ephemeral  bool
+		wantReason gracefulStopReason
+		wantDelay  time.Duration
+		wantRemove bool
+	}{
+		{
+			name:       "persistent runner in quiet hours",
+			now:        inQuietHours,
+			wantReason: gracefulStopReasonQuietHours,
+			wantDelay:  7 * time.Hour,
+		},
+		{
+			name:       "ephemeral runner in quiet hours",
+			now:        inQuietHours,
+			ephemeral:  true,
+			wantReason: gracefulStopReasonCompleted,
+			wantRemove: true,
+		},
+		{
+			name:       "persistent runner after quiet hours",
+			now:        inQuietHours.Add(7 * time.Hour),
+			wantReason: gracefulStopReasonCompleted,
+			wantRemove: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed = 0
+
+			pod := newPod(tt.ephemeral)
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				quietHours:              quietHours,
+				clock:                   clocktesting.NewFakeClock(tt.now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reason != tt.wantReason {
+				t.Errorf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			if tt.wantDelay > 0 && (res == nil || res.RequeueAfter != tt.wantDelay) {
+				t.Errorf("expected the unregistration to be requeued after %s, got %+v", tt.wantDelay, res)
+			}
+
+			if got := removed > 0; got != tt.wantRemove {
+				t.Errorf("unexpected RemoveRunner call: want %v, got %d calls", tt.wantRemove, removed)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_CrashLoopBackOff(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 0, "runners": []}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := time.Now()
+
+	newCrashLoopingPod := func(age time.Duration, exitCode int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test1",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Annotations: map[string]string{
+					AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: containerName,
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+						},
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		wantReason gracefulStopReason
+	}{
+		{
+			name:       "crash-looping long enough",
+			pod:        newCrashLoopingPod(time.Minute, 1),
+			wantReason: gracefulStopReasonRegistrationFailed,
+		},
+		{
+			name:       "crash-looping just after creation",
+			pod:        newCrashLoopingPod(10*time.Second, 1),
+			wantReason: gracefulStopReasonRegistrationGracePeriod,
+		},
+		{
+			name:       "exited with zero",
+			pod:        newCrashLoopingPod(time.Minute, 0),
+			wantReason: gracefulStopReasonRegistrationGracePeriod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(tt.pod).Build()
+			recorder := record.NewFakeRecorder(10)
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				recorder:                recorder,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "test1", tt.pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reason != tt.wantReason {
+				t.Fatalf("unexpected reason: want %s, got %s", tt.wantReason, reason)
+			}
+
+			if tt.wantReason != gracefulStopReasonRegistrationFailed {
+				return
+			}
+
+			if res != nil {
+				t.Errorf("expected the runner pod to be safe for deletion, got %+v", res)
+			}
+
+			select {
+			case e := <-recorder.Events:
+				if !strings.Contains(e, "RunnerRegistrationFailed") {
+					t.Errorf("unexpected event: %s", e)
+				}
+			default:
+				t.Error("expected a warning event about the failed registration")
+			}
+		})
+	}
+}
+
+func TestGetRunnersByName(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 6, "runners": [`+
+			`{"id": 1, "name": "example-runner-abc", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 2, "name": "Example-Runner-ABC", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 3, "name": "Example-Runner-DEF", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 4, "name": "example-runner-ghi.", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 5, "name": "example-runner-mno", "os": "linux", "status": "online", "busy": false, "labels": [{"name": "self-hosted"}, {"name": "team-a"}]},`+
+			`{"id": 6, "name": "example-runner-mno", "os": "linux", "status": "online", "busy": false, "labels": [{"name": "self-hosted"}, {"name": "team-b"}, {"name": "gpu"}]}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	prefixRemap := runnerNameRemap{{RunnerNameRemapRule: v1alpha1.RunnerNameRemapRule{Prefix: "old-", Replacement: "example-"}}}
+	regexRemap := runnerNameRemap{{
+		RunnerNameRemapRule: v1alpha1.RunnerNameRemapRule{Regex: `^legacy-(.*)-runner-(.*)$`, Replacement: "${1}-runner-${2}"},
+		regex:               regexp.MustCompile(`^legacy-(.*)-runner-(.*)$`),
+	}}
+
+	tests := []struct {
+		name      string
+		runner    string
+		labels    []string
+		nameRemap runnerNameRemap
+		want      []int64
+	}{
+		{name: "exact match wins over case-insensitive match", runner: "example-runner-abc", want: []int64{1}},
+		{name: "case-insensitive match", runner: "example-runner-def", want: []int64{3}},
+		{name: "near-miss with a trailing character", runner: "example-runner-ghi", want: nil},
+		{name: "not found", runner: "example-runner-jkl", want: nil},
+		{name: "name collision without labels", runner: "example-runner-mno", want: []int64{5, 6}},
+		{name: "name collision disambiguated by labels", runner: "example-runner-mno", labels: []string{"Team-B"}, want: []int64{6}},
+		{name: "name collision without the labels", runner: "example-runner-mno", labels: []string{"team-c"}, want: nil},
+		{name: "labels not registered", runner: "example-runner-abc", labels: []string{"team-a"}, want: nil},
+		{name: "remapped by prefix", runner: "old-runner-def", nameRemap: prefixRemap, want: []int64{3}},
+		{name: "remapped by regex", runner: "legacy-example-runner-abc", nameRemap: regexRemap, want: []int64{1}},
+		{name: "remapped name with the labels", runner: "old-runner-mno", labels: []string{"team-b"}, nameRemap: prefixRemap, want: []int64{6}},
+		{name: "remapped name not found", runner: "old-runner-jkl", nameRemap: prefixRemap, want: nil},
+		{name: "no remap rule matches", runner: "new-runner-abc", nameRemap: prefixRemap, want: nil},
+		{name: "match without remap wins", runner: "example-runner-abc", nameRemap: regexRemap, want: []int64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runners, err := getRunnersByName(context.Background(), log, newGithubClient(server), "", "", "test/valid", tt.runner, 0, tt.labels, tt.nameRemap)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []int64
+			for _, r := range runners {
+				got = append(got, r.GetID())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected runners: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsNearMissRunnerName(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "example-runner", b: "example-runner.", want: true},
+		{a: "example-runner ", b: "Example-Runner", want: true},
+		{a: "example-runner-1", b: "example-runner-12", want: false},
+		{a: "example-runner", b: "another-runner", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isNearMissRunnerName(tt.a, tt.b); got != tt.want {
+			t.Errorf("isNearMissRunnerName(%q, %q): want %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestIsRunnerSafeToDelete(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var removed int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 3, "runners": [`+
+			`{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": true},`+
+			`{"id": 2, "name": "test2", "os": "linux", "status": "offline", "busy": false},`+
+			`{"id": 3, "name": "test3", "os": "linux", "status": "online", "busy": false}]}`)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete {
+			removed++
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": true}`)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/4", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	scope := runnerScope{repository: "test/valid"}
+
+	tests := []struct {
+		name     string
+		runner   string
+		id       *int64
+		wantSafe bool
+	}{
+		{name: "busy by name", runner: "test1", wantSafe: false},
+		{name: "busy by name in a different case", runner: "TEST1", wantSafe: false},
+		{name: "busy by ID", id: gogithub.Int64(1), wantSafe: false},
+		{name: "offline", runner: "test2", wantSafe: true},
+		{name: "idle", runner: "test3", wantSafe: true},
+		{name: "not found by name", runner: "test4", wantSafe: true},
+		{name: "not found by ID", id: gogithub.Int64(4), wantSafe: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			safe, reason, err := isRunnerSafeToDelete(context.Background(), log, newGithubClient(server), scope, tt.runner, tt.id)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if safe != tt.wantSafe {
+				t.Errorf("unexpected result: want %v, got %v (%s)", tt.wantSafe, safe, reason)
+			}
+			if reason == "" {
+				t.Error("expected a reason")
+			}
+		})
+	}
+
+	if removed != 0 {
+		t.Errorf("expected RemoveRunner not to be called, but called %d times", removed)
+	}
+}
+
+func TestEnsureRunnerPodRegistered_RunnerStatus(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 1, "runners": [`+
+			`{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": true, "labels": [{"id": 1, "name": "self-hosted", "type": "read-only"}, {"id": 2, "name": "custom", "type": "custom"}]}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			UID:       "runner-uid",
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			UID:       "pod-uid",
+		},
+	}
+	if err := ctrl.SetControllerReference(runner, pod, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(runner, pod).Build()
+
+	updated, res, err := ensureRunnerPodRegistered(context.Background(), registrationCheckConfig{interval: DefaultRegistrationRecheckInterval}, log, newGithubClient(server), c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != nil {
+		t.Fatalf("unexpected requeue: %+v", res)
+	}
+	if id, _ := getAnnotation(updated, AnnotationKeyRunnerID); id != "1" {
+		t.Errorf("unexpected runner ID annotation: %q", id)
+	}
+
+	var got v1alpha1.Runner
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(runner), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"self-hosted", "custom"}; fmt.Sprint(got.Status.RegisteredLabels) != fmt.Sprint(want) {
+		t.Errorf("unexpected registered labels: want %v, got %v", want, got.Status.RegisteredLabels)
+	}
+	if got.Status.GitHubStatus != "online" {
+		t.Errorf("unexpected GitHub status: %q", got.Status.GitHubStatus)
+	}
+	if !got.Status.Busy {
+		t.Errorf("expected the runner to be busy")
+	}
+	if got.Status.RunnerID != 1 {
+		t.Errorf("unexpected runner ID: %d", got.Status.RunnerID)
+	}
+}
+
+func TestUnregistrationState_RecreatedPod(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected request to GitHub: %s", req.URL)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	start := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	complete := metav1.NewTime(start.Add(time.Minute))
+
+	tcs := []struct {
+		name         string
+		complete     *metav1.Time
+		wantRestored bool
+	}{
+		{
+			name:         "in progress",
+			wantRestored: true,
+		},
+		{
+			// Like a node drain that completed the unregistration of the previous runner pod.
+			// Restoring it would let the recreated runner pod be deleted without unregistering its new runner.
+			name:     "completed",
+			complete: &complete,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					UID:       "runner-uid",
+				},
+				Status: v1alpha1.RunnerStatus{
+					RunnerID:                   1,
+					UnregistrationStartTime:    &start,
+					UnregistrationCompleteTime: tc.complete,
+				},
+			}
+
+			// The recreated pod has none of the annotations the previous pod had.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					UID:       "recreated-pod-uid",
+				},
+			}
+			if err := ctrl.SetControllerReference(runner, pod, sc); err != nil {
+				t.Fatal(err)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(runner, pod).Build()
+
+			updated, err := restoreUnregistrationState(context.Background(), c, log, pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for k, want := range map[string]string{
+				AnnotationKeyRunnerID:                       "1",
+				AnnotationKeyUnregistrationRequestTimestamp: start.Format(time.RFC3339),
+				AnnotationKeyUnregistrationStartTimestamp:   start.Format(time.RFC3339),
+			} {
+				got, ok := getAnnotation(updated, k)
+				if ok != tc.wantRestored {
+					t.Errorf("unexpected presence of %s annotation: want %v, got %v", k, tc.wantRestored, ok)
+				}
+				if ok && got != want {
+					t.Errorf("unexpected %s annotation: want %q, got %q", k, want, got)
+				}
+			}
+
+			if v, ok := getAnnotation(updated, AnnotationKeyUnregistrationCompleteTimestamp); ok {
+				t.Errorf("unexpected completion restored onto the recreated pod: %s", v)
+			}
+		})
+	}
+}
+
+func TestResetRunnerUnregistrationStatus(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	complete := metav1.NewTime(start.Add(time.Minute))
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			UID:       "runner-uid",
+		},
+		Status: v1alpha1.RunnerStatus{
+			RunnerID:                   1,
+			UnregistrationStartTime:    &start,
+			UnregistrationCompleteTime: &complete,
+			UnregistrationStatus:       &v1alpha1.RunnerUnregistrationStatus{Phase: v1alpha1.RunnerUnregistrationPhaseCompleted},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(runner).Build()
+
+	if err := resetRunnerUnregistrationStatus(context.Background(), c, log, runner); err != nil {
+		t.Fatal(err)
+	}
+
+	var updated v1alpha1.Runner
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(runner), &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := updated.Status; s.RunnerID != 0 || s.UnregistrationStartTime != nil || s.UnregistrationCompleteTime != nil || s.UnregistrationStatus != nil {
+		t.Errorf("unexpected unregistration state left in the runner status: %+v", s)
+	}
+
+	// The pod of the fresh runner has nothing to restore.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+	}
+	if err := ctrl.SetControllerReference(&updated, pod, sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := restoreUnregistrationState(context.Background(), c, log, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Annotations) != 0 {
+		t.Errorf("unexpected annotations restored onto the fresh pod: %v", restored.Annotations)
+	}
+}
+
+func TestUpdateRunnerUnregistrationStatus(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			UID:       "runner-uid",
+		},
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: start.Format(time.RFC3339),
+			},
+		},
+	}
+	if err := ctrl.SetControllerReference(runner, pod, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(runner, pod).Build()
+
+	getStatus := func() v1alpha1.RunnerStatus {
+		t.Helper()
+
+		var got v1alpha1.Runner
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(runner), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got.Status
+	}
+
+	if err := updateRunnerUnregistrationStatus(context.Background(), c, log, pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status := getStatus()
+	if status.UnregistrationStartTime == nil || !status.UnregistrationStartTime.Time.Equal(start) {
+		t.Errorf("unexpected unregistration start time: %v", status.UnregistrationStartTime)
+	}
+	if status.UnregistrationCompleteTime != nil {
+		t.Errorf("unexpected unregistration complete time: %v", status.UnregistrationCompleteTime)
+	}
+	if status.UnregistrationStatus == nil || status.UnregistrationStatus.Phase != v1alpha1.RunnerUnregistrationPhaseInProgress {
+		t.Errorf("unexpected unregistration status: %+v", status.UnregistrationStatus)
+	}
+
+	// The graceful stop got cancelled
+	delete(pod.Annotations, AnnotationKeyUnregistrationStartTimestamp)
+
+	if err := updateRunnerUnregistrationStatus(context.Background(), c, log, pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status = getStatus()
+	if status.UnregistrationStartTime != nil {
+		t.Errorf("unexpected unregistration start time: %v", status.UnregistrationStartTime)
+	}
+	if status.UnregistrationStatus == nil || status.UnregistrationStatus.Phase != v1alpha1.RunnerUnregistrationPhaseNotStarted {
+		t.Errorf("unexpected unregistration status: %+v", status.UnregistrationStatus)
+	}
+}
+
+func TestRunnerUnregistrationStatus(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	complete := start.Add(time.Minute)
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		wantPhase    v1alpha1.RunnerUnregistrationPhase
+		wantAttempts int
+		wantError    string
+	}{
+		{
+			name:      "not started",
+			wantPhase: v1alpha1.RunnerUnregistrationPhaseNotStarted,
+		},
+		{
+			name: "in progress",
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: start.Format(time.RFC3339),
+				AnnotationKeyUnregistrationAttempts:       "2",
+				AnnotationKeyLastUnregistrationError:      start.Format(time.RFC3339) + " boom",
+			},
+			wantPhase:    v1alpha1.RunnerUnregistrationPhaseInProgress,
+			wantAttempts: 2,
+			wantError:    start.Format(time.RFC3339) + " boom",
+		},
+		{
+			name: "completed",
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp:    start.Format(time.RFC3339),
+				AnnotationKeyUnregistrationCompleteTimestamp: complete.Format(time.RFC3339),
+				AnnotationKeyUnregistrationBranch:            string(unregistrationBranchUnregistered),
+			},
+			wantPhase: v1alpha1.RunnerUnregistrationPhaseCompleted,
+		},
+		{
+			name: "timed out",
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp:    start.Format(time.RFC3339),
+				AnnotationKeyUnregistrationCompleteTimestamp: complete.Format(time.RFC3339),
+				AnnotationKeyUnregistrationBranch:            string(unregistrationBranchTimedOut),
+				AnnotationKeyUnregistrationAttempts:          "not-a-number",
+			},
+			wantPhase: v1alpha1.RunnerUnregistrationPhaseTimedOut,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test1",
+					Namespace:   "default",
+					Annotations: tt.annotations,
+				},
+			}
+
+			got := runnerUnregistrationStatus(log, pod)
+
+			if got.Phase != tt.wantPhase {
+				t.Errorf("unexpected phase: want %s, got %s", tt.wantPhase, got.Phase)
+			}
+			if got.Attempts != tt.wantAttempts {
+				t.Errorf("unexpected attempts: want %d, got %d", tt.wantAttempts, got.Attempts)
+			}
+			if got.LastError != tt.wantError {
+				t.Errorf("unexpected last error: want %q, got %q", tt.wantError, got.LastError)
+			}
+			if _, ok := tt.annotations[AnnotationKeyUnregistrationStartTimestamp]; ok != (got.StartedAt != nil) {
+				t.Errorf("unexpected started at: %v", got.StartedAt)
+			}
+			if _, ok := tt.annotations[AnnotationKeyUnregistrationCompleteTimestamp]; ok != (got.CompletedAt != nil) {
+				t.Errorf("unexpected completed at: %v", got.CompletedAt)
+			}
+		})
+	}
+}
+
+func TestTickRunnerGracefulStop_TerminationReason(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		runners     []*gogithub.Runner
+		annotations map[string]string
+		status      corev1.PodStatus
+		want        string
+	}{
+		{
+			name:    "unregistered",
+			runners: []*gogithub.Runner{fake.NewRunner(1, "test1", false)},
+			annotations: map[string]string{
+				AnnotationKeyRunnerID: "1",
+			},
+			want: v1alpha1.RunnerTerminationReasonUnregisteredAndDeleted,
+		},
+		{
+			name: "timed out",
+			annotations: map[string]string{
+				AnnotationKeyUnregistrationStartTimestamp: now.Add(-DefaultUnregistrationTimeout).Format(time.RFC3339),
+			},
+			want: v1alpha1.RunnerTerminationReasonTimedOutAndForceDeleted,
+		},
+		{
+			name: "crashed",
+			status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: containerName,
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 1},
+					},
+				}},
+			},
+			want: v1alpha1.RunnerTerminationReasonCrashedAndDeleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					UID:       "runner-uid",
+				},
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					Annotations:       tt.annotations,
+				},
+				Status: tt.status,
+			}
+			if err := ctrl.SetControllerReference(runner, pod, sc); err != nil {
+				t.Fatal(err)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(runner, pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			updated, res, err := tickRunnerGracefulStop(context.Background(), cfg, log, fake.NewRunnerClient(tt.runners...), c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if updated == nil || res != nil {
+				t.Fatalf("expected the runner pod to be safe for deletion, got %+v", res)
+			}
+
+			var got v1alpha1.Runner
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(runner), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Status.TerminationReason != tt.want {
+				t.Errorf("unexpected termination reason: want %s, got %s", tt.want, got.Status.TerminationReason)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerPodRegistered_NotFound(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	cfg := registrationCheckConfig{interval: 15 * time.Second, maxWait: 10 * time.Minute, clock: clocktesting.NewFakeClock(now)}
+
+	tcs := []struct {
+		name        string
+		checkStart  string
+		wantRequeue bool
+	}{
+		{
+			name:        "first check",
+			wantRequeue: true,
+		},
+		{
+			name:        "within max wait",
+			checkStart:  now.Add(-5 * time.Minute).Format(time.RFC3339),
+			wantRequeue: true,
+		},
+		{
+			name:        "max wait exceeded",
+			checkStart:  now.Add(-11 * time.Minute).Format(time.RFC3339),
+			wantRequeue: false,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "missing",
+					Namespace:   "default",
+					Annotations: map[string]string{},
+				},
+			}
+			if tc.checkStart != "" {
+				pod.Annotations[AnnotationKeyRegistrationCheckStartTimestamp] = tc.checkStart
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			updated, res, err := ensureRunnerPodRegistered(context.Background(), cfg, log, newGithubClient(server), c, "", "", "test/valid", "missing", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &got); err != nil {
+				t.Fatal(err)
+			}
+			wantCheckStart := tc.checkStart
+			if wantCheckStart == "" {
+				wantCheckStart = now.Format(time.RFC3339)
+			}
+			if v, _ := getAnnotation(&got, AnnotationKeyRegistrationCheckStartTimestamp); v != wantCheckStart {
+				t.Errorf("unexpected registration check start timestamp: want %q, got %q", wantCheckStart, v)
+			}
+
+			if tc.wantRequeue {
+				if updated != nil {
+					t.Errorf("unexpected pod returned while waiting for the registration")
+				}
+				if res == nil || res.RequeueAfter != cfg.interval {
+					t.Errorf("unexpected result: want requeue after %s, got %+v", cfg.interval, res)
+				}
+				return
+			}
+
+			if updated == nil || res != nil {
+				t.Errorf("expected to stop waiting for the registration, got pod=%v, res=%+v", updated, res)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerPodRegistered_StopsPollingAfterMaxWait(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := clocktesting.NewFakeClock(now)
+
+	cfg := registrationCheckConfig{interval: 15 * time.Second, maxWait: 10 * time.Minute, clock: clock}
+
+	ghClient := fake.NewRunnerClient()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "missing",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AnnotationKeyRegistrationCheckStartTimestamp: now.Add(-11 * time.Minute).Format(time.RFC3339),
+			},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+	updated, res, err := ensureRunnerPodRegistered(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "missing", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated == nil || res != nil {
+		t.Fatalf("expected to stop waiting for the registration, got pod=%v, res=%+v", updated, res)
+	}
+	if v, _ := getAnnotation(updated, AnnotationKeyRegistrationCheckAbandonedTimestamp); v != now.Format(time.RFC3339) {
+		t.Errorf("unexpected registration check abandoned timestamp: want %q, got %q", now.Format(time.RFC3339), v)
+	}
+
+	calls := len(ghClient.Calls(""))
+	if calls == 0 {
+		t.Fatalf("expected GitHub to be checked once before giving up")
+	}
+
+	// Subsequent reconciliations never poll GitHub for the runner again.
+	for i := 0; i < 3; i++ {
+		clock.Step(cfg.interval)
+
+		updated, res, err = ensureRunnerPodRegistered(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "missing", updated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated == nil || res != nil {
+			t.Fatalf("unexpected result: pod=%v, res=%+v", updated, res)
+		}
+	}
+
+	if got := ghClient.Calls(""); len(got) != calls {
+		t.Errorf("unexpected GitHub API calls after giving up: %v", got[calls:])
+	}
+}
+
+func TestUnregisterRunners(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var (
+		mu                  sync.Mutex
+		inFlight, maxFlight int
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners/", func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxFlight {
+			maxFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		switch req.URL.Path {
+		case "/repos/test/valid/actions/runners/4":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case "/repos/test/valid/actions/runners/5":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Runner \"test5\" is still running a job"}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var runners []*gogithub.Runner
+	for i := int64(1); i <= 5; i++ {
+		runners = append(runners, &gogithub.Runner{ID: gogithub.Int64(i), Name: gogithub.String(fmt.Sprintf("test%d", i))})
+	}
+
+	removed, err := unregisterRunners(context.Background(), log, false, newGithubClient(server), "", "", "test/valid", runners, 2)
+	if err == nil || !strings.Contains(err.Error(), `"test5"`) {
+		t.Errorf("expected the error of the busy runner, got %v", err)
+	}
+	if want := []int64{1, 2, 3, 4}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("unexpected removed runners: want %v, got %v", want, removed)
+	}
+	if maxFlight > 2 {
+		t.Errorf("expected at most 2 RemoveRunner calls in flight, got %d", maxFlight)
+	}
+}
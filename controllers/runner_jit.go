@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EnvVarJITConfig is the environment variable of the runner container that contains the encoded JIT configuration
+// the entrypoint passes to the runner via `--jitconfig`.
+const EnvVarJITConfig = "RUNNER_JIT_CONFIG"
+
+// jitRequested returns true when the runner pod asks for the JIT configuration via AnnotationKeyJIT.
+func jitRequested(pod *corev1.Pod) bool {
+	return pod.Annotations[AnnotationKeyJIT] == "true"
+}
+
+// podIsJIT returns true if the runner pod has been configured with a JIT configuration,
+// which is told by the ID of the runner GitHub registered for the configuration.
+func podIsJIT(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+
+	_, ok := getAnnotation(pod, AnnotationKeyJITRunnerID)
+
+	return ok
+}
+
+// generateJITConfig registers the runner for the runner pod via the generate-jitconfig API,
+// with the runner group, the labels, and the work directory the runner container would otherwise pass to config.sh.
+func generateJITConfig(ctx context.Context, log logr.Logger, ghClient *github.Client, enterprise, org, repo string, pod *corev1.Pod, runnerContainer *corev1.Container) (*github.JITRunnerConfig, error) {
+	if pod.Name == "" {
+		return nil, fmt.Errorf("runner pod has no name yet. JIT configuration requires the runner name on pod creation")
+	}
+
+	groupID := runnerGroupID(ctx, log, ghClient, enterprise, org, repo, pod)
+
+	customLabels, _ := getEnv(runnerContainer, "RUNNER_LABELS")
+	workDir, _ := getEnv(runnerContainer, "RUNNER_WORKDIR")
+
+	return ghClient.GenerateJITConfig(ctx, enterprise, org, repo, pod.Name, groupID, jitRunnerLabels(customLabels), workDir)
+}
+
+// jitRunnerLabels returns the labels of a JIT runner, which are the default labels config.sh would add, followed by the custom labels.
+// Unlike config.sh, ARC can't tell the architecture of the runner image, so the architecture label like X64 is omitted.
+// Add it to the custom labels when your workflows rely on it.
+func jitRunnerLabels(customLabels string) []string {
+	return append([]string{"self-hosted", "Linux"}, parseRunnerLabels(customLabels)...)
+}
+
+// mutatePodForJIT injects the JIT configuration and the runner name into the runner container,
+// and records the ID of the runner GitHub registered for the configuration.
+//
+// The runner ID is known before the runner pod is even created, so ensureRunnerPodRegistered doesn't need to poll GitHub for the registration.
+func mutatePodForJIT(pod *corev1.Pod, config *github.JITRunnerConfig) *corev1.Pod {
+	updated := pod.DeepCopy()
+
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == runnerContainerName(pod) {
+			updated.Spec.Containers[i].Env = append(updated.Spec.Containers[i].Env,
+				corev1.EnvVar{
+					Name:  "RUNNER_NAME",
+					Value: pod.ObjectMeta.Name,
+				},
+				corev1.EnvVar{
+					Name:  EnvVarJITConfig,
+					Value: config.EncodedJITConfig,
+				},
+			)
+		}
+	}
+
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+
+	updated.Annotations[AnnotationKeyJITRunnerID] = fmt.Sprintf("%d", config.Runner.GetID())
+	updated.Annotations[AnnotationKeyEphemeral] = "true"
+
+	// The JIT configuration can configure the runner only once, so a restarted runner container could never run again.
+	updated.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	return updated
+}
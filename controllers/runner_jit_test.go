@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestJITRunnerLabels(t *testing.T) {
+	if got, want := jitRunnerLabels(""), []string{"self-hosted", "Linux"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected labels: want %v, got %v", want, got)
+	}
+
+	if got, want := jitRunnerLabels("gpu, X64,"), []string{"self-hosted", "Linux", "gpu", "X64"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected labels: want %v, got %v", want, got)
+	}
+}
+
+func TestMutatePodForJIT(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test1",
+			Annotations: map[string]string{AnnotationKeyJIT: "true"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyOnFailure,
+			Containers: []corev1.Container{
+				{Name: containerName},
+				{Name: "docker"},
+			},
+		},
+	}
+
+	updated := mutatePodForJIT(pod, &github.JITRunnerConfig{
+		Runner:           fake.NewRunner(23, "test1", false),
+		EncodedJITConfig: "abc",
+	})
+
+	if got, want := updated.Spec.Containers[0].Env, []corev1.EnvVar{
+		{Name: "RUNNER_NAME", Value: "test1"},
+		{Name: EnvVarJITConfig, Value: "abc"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected env of the runner container: want %v, got %v", want, got)
+	}
+
+	if len(updated.Spec.Containers[1].Env) != 0 {
+		t.Errorf("unexpected env of the docker container: %v", updated.Spec.Containers[1].Env)
+	}
+
+	if updated.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("unexpected restart policy: %s", updated.Spec.RestartPolicy)
+	}
+
+	if !podIsJIT(updated) || !podIsEphemeral(updated) {
+		t.Errorf("expected the pod to be a JIT and ephemeral runner pod")
+	}
+
+	if podIsJIT(pod) {
+		t.Errorf("expected the original pod not to be mutated")
+	}
+}
+
+func TestEnsureRunnerPodRegistered_JIT(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+			UID:       "uid1",
+			Annotations: map[string]string{
+				AnnotationKeyJITRunnerID: "23",
+			},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+	ghClient := fake.NewRunnerClient()
+
+	cfg := registrationCheckConfig{interval: 15 * time.Second, maxWait: 10 * time.Minute}
+
+	updated, res, err := ensureRunnerPodRegistered(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res != nil {
+		t.Errorf("unexpected requeue: %+v", res)
+	}
+
+	if id, _ := getAnnotation(updated, AnnotationKeyRunnerID); id != "23" {
+		t.Errorf("unexpected runner ID annotation: %q", id)
+	}
+
+	if uid, _ := getAnnotation(updated, AnnotationKeyRunnerIDPodUID); uid != "uid1" {
+		t.Errorf("unexpected runner ID pod UID annotation: %q", uid)
+	}
+
+	if calls := ghClient.Calls(""); len(calls) != 0 {
+		t.Errorf("expected no GitHub API calls, got %v", calls)
+	}
+}
+
+func TestEnsureRunnerUnregistration_JIT(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		runners     []*gogithub.Runner
+		wantRemoved bool
+	}{
+		{
+			name:        "idle runner",
+			runners:     []*gogithub.Runner{fake.NewRunner(23, "test1", false)},
+			wantRemoved: true,
+		},
+		{
+			// GitHub has removed the runner after the job, which must not be mistaken for a runner that isn't registered yet.
+			name: "runner removed by GitHub after the job",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghClient := fake.NewRunnerClient(tt.runners...)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					// Within the registration grace period, which a JIT runner doesn't need.
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+					Annotations: map[string]string{
+						AnnotationKeyJITRunnerID:                  "23",
+						AnnotationKeyUnregistrationStartTimestamp: now.Format(time.RFC3339),
+					},
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			cfg := gracefulStopConfig{
+				unregistrationTimeout:   DefaultUnregistrationTimeout,
+				retryDelay:              DefaultUnregistrationRetryDelay,
+				registrationGracePeriod: DefaultRegistrationGracePeriod,
+				clock:                   clocktesting.NewFakeClock(now),
+			}
+
+			res, reason, err := ensureRunnerUnregistration(context.Background(), cfg, log, ghClient, c, "", "", "test/valid", "test1", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res != nil || reason != gracefulStopReasonCompleted {
+				t.Errorf("expected the graceful stop to complete, got %+v and %s", res, reason)
+			}
+
+			calls := ghClient.Calls("RemoveRunner")
+			if len(calls) != 1 || calls[0].RunnerID != 23 {
+				t.Errorf("expected the runner to be removed by the JIT runner ID, got %v", calls)
+			}
+
+			if removed := len(ghClient.Runners) == 0 && len(tt.runners) > 0; removed != tt.wantRemoved {
+				t.Errorf("unexpected removal: want %v, got %v", tt.wantRemoved, removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// runnerNameRemapRule is a v1alpha1.RunnerNameRemapRule with its regex compiled.
+type runnerNameRemapRule struct {
+	v1alpha1.RunnerNameRemapRule
+
+	regex *regexp.Regexp
+}
+
+// runnerNameRemap is the list of rules to rename the runner pod name into the runner name to look for on GitHub.
+// See v1alpha1.RunnerConfig.NameRemap for more details.
+type runnerNameRemap []runnerNameRemapRule
+
+// podRunnerNameRemap returns the name remap rules recorded in the AnnotationKeyRunnerNameRemap annotation of the runner pod.
+// Invalid rules are logged and ignored, so that a broken annotation never blocks the unregistration of a runner that needs no remap.
+func podRunnerNameRemap(log logr.Logger, pod *corev1.Pod) runnerNameRemap {
+	if pod == nil {
+		return nil
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyRunnerNameRemap)
+	if !ok {
+		return nil
+	}
+
+	var rules []v1alpha1.RunnerNameRemapRule
+
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		log.Info("Ignoring the unparsable runner name remap rules", "annotation", AnnotationKeyRunnerNameRemap, "error", err.Error())
+		return nil
+	}
+
+	var remap runnerNameRemap
+
+	for i, rule := range rules {
+		r := runnerNameRemapRule{RunnerNameRemapRule: rule}
+
+		switch {
+		case rule.Prefix != "" && rule.Regex != "", rule.Prefix == "" && rule.Regex == "":
+			log.Info("Ignoring the runner name remap rule as it needs either prefix or regex", "index", i)
+			continue
+		case rule.Regex != "":
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				log.Info("Ignoring the runner name remap rule of the invalid regex", "index", i, "regex", rule.Regex, "error", err.Error())
+				continue
+			}
+
+			r.regex = re
+		}
+
+		remap = append(remap, r)
+	}
+
+	return remap
+}
+
+// apply returns the name remapped by the first rule that matches the name, along with the rule.
+// It returns false when no rule matches the name.
+func (m runnerNameRemap) apply(name string) (string, v1alpha1.RunnerNameRemapRule, bool) {
+	for _, r := range m {
+		if r.regex != nil {
+			if r.regex.MatchString(name) {
+				return r.regex.ReplaceAllString(name, r.Replacement), r.RunnerNameRemapRule, true
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(name, r.Prefix) {
+			return r.Replacement + strings.TrimPrefix(name, r.Prefix), r.RunnerNameRemapRule, true
+		}
+	}
+
+	return "", v1alpha1.RunnerNameRemapRule{}, false
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestPodRunnerNameRemap(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	pod, err := newRunnerPod("test1", corev1.Pod{}, v1alpha1.RunnerConfig{
+		Repository: "test/valid",
+		NameRemap: []v1alpha1.RunnerNameRemapRule{
+			{Regex: `^example-(runner-.*)$`, Replacement: "migrated-$1"},
+			{Prefix: "example-", Replacement: "new-"},
+		},
+	}, "runner", nil, "docker", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remap := podRunnerNameRemap(log, &pod)
+
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "example-runner-abc", want: "migrated-runner-abc", wantOK: true},
+		{name: "example-abc", want: "new-abc", wantOK: true},
+		{name: "other-runner-abc", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, _, ok := remap.apply(tt.name)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("unexpected remap of %s: want %q (%v), got %q (%v)", tt.name, tt.want, tt.wantOK, got, ok)
+		}
+	}
+}
+
+func TestPodRunnerNameRemap_InvalidRules(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	tests := []struct {
+		name       string
+		annotation string
+		wantRules  int
+	}{
+		{name: "unparsable", annotation: `not json`, wantRules: 0},
+		{name: "invalid regex", annotation: `[{"regex": "(", "replacement": "x"}, {"prefix": "a-", "replacement": "b-"}]`, wantRules: 1},
+		{name: "both prefix and regex", annotation: `[{"prefix": "a-", "regex": "^a-", "replacement": "b-"}]`, wantRules: 0},
+		{name: "neither prefix nor regex", annotation: `[{"replacement": "b-"}]`, wantRules: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						AnnotationKeyRunnerNameRemap: tt.annotation,
+					},
+				},
+			}
+
+			if got := podRunnerNameRemap(log, pod); len(got) != tt.wantRules {
+				t.Errorf("unexpected number of rules: want %d, got %d", tt.wantRules, len(got))
+			}
+		})
+	}
+}
@@ -26,31 +26,145 @@ import (
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
 )
 
+// runnerPodDeletionTimeout is the duration after the deletion timestamp of a runner pod after which the runner pod is forcefully deleted,
+// not counting the preStop grace period.
+const runnerPodDeletionTimeout = 1 * time.Minute
+
 // RunnerPodReconciler reconciles a Runner object
 type RunnerPodReconciler struct {
 	client.Client
-	Log                         logr.Logger
-	Recorder                    record.EventRecorder
-	Scheme                      *runtime.Scheme
-	GitHubClient                *github.Client
-	Name                        string
+
+	// APIReader reads directly from the API server, bypassing the cache the client reads from.
+	// It's used to fetch the merge bases of runner pod patches, so that a stale pod in the cache doesn't result in a conflicting patch.
+	// Nil means the merge bases are read from the cache, too.
+	APIReader client.Reader
+
+	Log                       logr.Logger
+	Recorder                  record.EventRecorder
+	Scheme                    *runtime.Scheme
+	GitHubClient              *github.Client
+	Name                      string
+	RegistrationRecheckJitter time.Duration
+
+	// RegistrationRecheckInterval is the delay until rechecking the registration of a runner that isn't seen on GitHub yet.
 	RegistrationRecheckInterval time.Duration
-	RegistrationRecheckJitter   time.Duration
+
+	// MaxRegistrationWait is the duration since the first registration check after which the reconciler stops waiting for the runner to be seen on GitHub.
+	MaxRegistrationWait time.Duration
 
 	UnregistrationTimeout    time.Duration
 	UnregistrationRetryDelay time.Duration
+
+	// RegistrationGracePeriod is the fixed registration grace period.
+	// Zero makes the reconciler derive the grace period from the observed registration latencies of recent runners.
+	RegistrationGracePeriod time.Duration
+
+	GitHubAPITimeout time.Duration
+
+	// RetryableGitHubStatusCodes is the HTTP status codes of failed RemoveRunner API calls that are retried with backoff.
+	// Empty means DefaultRetryableGitHubStatusCodes.
+	RetryableGitHubStatusCodes []int
+
+	// MaxUnregistrationAttempts is the number of failed unregistration attempts after which the runner pod is deleted without unregistration.
+	MaxUnregistrationAttempts int
+
+	// UnregistrationTimeoutWarningThreshold is the fraction of the unregistration timeout after which a one-time warning event is emitted
+	// for a runner that is still being unregistered. Defaults to DefaultUnregistrationTimeoutWarningThreshold. Set to 1 or more to disable the warning.
+	UnregistrationTimeoutWarningThreshold float64
+
+	// DrainReadinessGateConditionType is the condition type of the readiness gate that is set to False on the start of the graceful stop
+	// of a runner pod that declares the readiness gate in spec.readinessGates. Empty disables it.
+	DrainReadinessGateConditionType string
+
+	// BlockStopConditionType is the type of the pod condition a supervisor in the runner pod sets to True while it's unsafe to stop the runner pod,
+	// like while it's uploading artifacts. A runner pod whose unregistration has timed out isn't deleted while the condition is True,
+	// up to MaxBlockStopDuration past the unregistration timeout. Empty disables it.
+	BlockStopConditionType string
+
+	// MaxBlockStopDuration is the hard cap of how long the block-stop condition can delay the deletion past the unregistration timeout.
+	// Defaults to DefaultMaxBlockStopDuration.
+	MaxBlockStopDuration time.Duration
+
+	// UnregistrationDryRun makes the reconciler log runners it would unregister without actually unregistering them from GitHub.
+	UnregistrationDryRun bool
+
+	// VerifyRunnerID makes the reconciler confirm that the runner ID recorded for a runner pod still belongs to the runner
+	// of the expected name before unregistering it by the ID, at the cost of an extra GitHub API call per unregistration.
+	VerifyRunnerID bool
+
+	// OnlyUnregisterOfflineRunners makes the reconciler keep an online and idle non-ephemeral runner registered,
+	// and unregister it only after it went offline or its runner container stopped.
+	OnlyUnregisterOfflineRunners bool
+
+	// OfflineRunnerGracePeriod is the duration a runner needs to be seen offline on GitHub while being unregistered,
+	// after which its runner pod is deleted even if GitHub still reports the runner busy. Zero disables it.
+	OfflineRunnerGracePeriod time.Duration
+
+	// RequeueJitter is the fraction of the randomized jitter added to requeue delays of the runner pod registration and unregistration.
+	RequeueJitter float64
+
+	// MaxConcurrentUnregistrations is the maximum number of runner unregistrations in flight at once.
+	// Zero or a negative value means unlimited.
+	MaxConcurrentUnregistrations int
+
+	// DeletionStrategy is the teardown step run once the runner pod is safe to delete after the unregistration.
+	// Nil means the runner pod is deleted along with its owner, as DeletionStrategyDelete does.
+	DeletionStrategy DeletionStrategy
+
+	// UnregistrationQuietHours is the recurring time windows during which the unregistration of non-ephemeral runners is deferred.
+	// Nil means unregistrations are never deferred.
+	UnregistrationQuietHours *QuietHours
+
+	// PreStopGracePeriod is the additional time given to the preStop hook of the runner container, if any,
+	// before a runner pod stuck in termination is forcefully deleted.
+	// It can be overridden per runner pod with the pre-stop-grace-period annotation.
+	PreStopGracePeriod time.Duration
+
+	// UnregistrationProgressLogInterval is the minimum interval between two logs of the in-progress unregistration of a runner pod.
+	// Zero or a negative value means the progress is logged on every retry.
+	UnregistrationProgressLogInterval time.Duration
+
+	// GracefulStopSyncPeriod is the delay until a runner pod in graceful stop is reconciled again when nothing else requeues it,
+	// like a runner pod whose deletion is pending or whose teardown has completed.
+	// It never shortens a requeue delay the graceful stop asked for.
+	// Zero or a negative value disables the periodic resync.
+	GracefulStopSyncPeriod time.Duration
+
+	// ShutdownDrainGracePeriod is the time given to the final pass of the graceful stops in progress when the controller is shutting down.
+	// The manager's graceful shutdown timeout needs to be longer than this for the final pass to complete.
+	// Zero or a negative value disables the final pass, leaving the graceful stops to the next leader.
+	ShutdownDrainGracePeriod time.Duration
+
+	// DeletionVerificationTimeout is the time a runner pod is given to be deleted once its runner has been unregistered and torn down.
+	// A runner pod still around after this is reported as stuck, and its registration state is reset so that it's tracked afresh.
+	// The runner isn't re-registered by ARC. It's tracked again once it registers itself again, like on the restart of the runner container.
+	// Zero or a negative value disables the verification.
+	DeletionVerificationTimeout time.Duration
+
+	// Clock is used to tell the current time in the registration check and the graceful stop, so that tests can control it.
+	// It can be nil, in which case the real clock is used.
+	Clock clock.Clock
+
+	unregistrationLimiter *unregistrationLimiter
+	progressLogThrottle   *logThrottle
+	registrationLatency   *registrationLatencyEstimator
 }
 
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+// +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;patch
 
 func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("runnerpod", req.NamespacedName)
@@ -79,6 +193,12 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	ghClient, err := githubClientFor(r.GitHubClient, &runnerPod)
+	if err != nil {
+		log.Error(err, "Failed to create the GitHub client for the runner pod")
+		return ctrl.Result{}, err
+	}
+
 	if runnerPod.ObjectMeta.DeletionTimestamp.IsZero() {
 		finalizers, added := addFinalizer(runnerPod.ObjectMeta.Finalizers, runnerPodFinalizerName)
 
@@ -104,9 +224,10 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			// In a standard scenario, the upstream controller, like runnerset-controller, ensures this runner to be gracefully stopped before the deletion timestamp is set.
 			// But for the case that the user manually deleted it for whatever reason,
 			// we have to ensure it to gracefully stop now.
-			updatedPod, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+			updatedPod, res, reason, err := tickRunnerGracefulStopWithReason(ctx, r.gracefulStopConfig(), log, ghClient, newPodClient(r.Client, r.APIReader), enterprise, org, repo, runnerPod.Name, &runnerPod)
+			metrics.IncRunnerGracefulStopTicks(enterprise, org, repo, string(reason))
 			if res != nil {
-				return *res, err
+				return r.resyncGracefulStop(*res, err)
 			}
 
 			patchedPod := updatedPod.DeepCopy()
@@ -120,10 +241,18 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 			log.V(2).Info("Removed finalizer")
 
+			if d, ok := podLingeringDuration(&runnerPod); ok {
+				metrics.ObserveRunnerPodLingeringDuration(enterprise, org, repo, d)
+			}
+
 			return ctrl.Result{}, nil
 		}
 
-		deletionTimeout := 1 * time.Minute
+		// The preStop hook of the runner container, like one flushing caches, keeps running after the deletion timestamp
+		// as long as the runner pod's terminationGracePeriodSeconds allows,
+		// so we don't forcefully delete the runner pod with a zero grace period until the preStop grace period passes, too.
+		preStopGracePeriod := podPreStopGracePeriod(log, &runnerPod, r.PreStopGracePeriod)
+		deletionTimeout := runnerPodDeletionTimeout + preStopGracePeriod
 		currentTime := time.Now()
 		deletionDidTimeout := currentTime.Sub(runnerPod.DeletionTimestamp.Add(deletionTimeout)) > 0
 
@@ -135,6 +264,7 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 				"podDeletionTimestamp", runnerPod.DeletionTimestamp,
 				"currentTime", currentTime,
 				"configuredDeletionTimeout", deletionTimeout,
+				"preStopGracePeriod", preStopGracePeriod,
 			)
 
 			var force int64 = 0
@@ -155,10 +285,28 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			return ctrl.Result{RequeueAfter: 3 * time.Second}, nil
 		}
 
-		return ctrl.Result{}, nil
+		// Nothing might happen to the runner pod until the deletion timeout, like when the node became unreachable,
+		// so we resync to forcefully delete it once the deletion times out.
+		return r.resyncGracefulStop(ctrl.Result{}, nil)
 	}
 
-	po, res, err := ensureRunnerPodRegistered(ctx, log, r.GitHubClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+	if runnerPodOrContainerIsStopped(&runnerPod) {
+		updated, err := annotatePodOnce(ctx, newPodClient(r.Client, r.APIReader), log, &runnerPod, AnnotationKeyStoppedTimestamp, r.gracefulStopConfig().now().Format(time.RFC3339))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		runnerPod = *updated
+	}
+
+	po, res, err := forceRunnerReregistration(ctx, r.gracefulStopConfig(), log, ghClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+	if res != nil {
+		return *res, err
+	}
+
+	runnerPod = *po
+
+	po, res, err = ensureRunnerPodRegistered(ctx, r.registrationCheckConfig(), log, ghClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
 	if res != nil {
 		return *res, err
 	}
@@ -172,24 +320,112 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		//
 		// In a standard scenario, ARC starts the unregistration process before marking the pod for deletion at all,
 		// so that it isn't subject to terminationGracePeriod and can safely take hours to finish it's work.
-		_, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+		_, res, reason, err := tickRunnerGracefulStopWithReason(ctx, r.gracefulStopConfig(), log, ghClient, newPodClient(r.Client, r.APIReader), enterprise, org, repo, runnerPod.Name, &runnerPod)
+		metrics.IncRunnerGracefulStopTicks(enterprise, org, repo, string(reason))
 		if res != nil {
-			return *res, err
+			return r.resyncGracefulStop(*res, err)
 		}
 
 		// At this point we are sure that the runner has successfully unregistered, hence is safe to be deleted.
-		// But we don't delete the pod here. Instead, let the upstream controller/parent object to delete this pod as
+		// By default, we don't delete the pod here. Instead, let the upstream controller/parent object to delete this pod as
 		// a part of a cascade deletion.
 		// This is to avoid a parent object, like statefulset, to recreate the deleted pod.
 		// If the pod was recreated, it will start a registration process and that may race with the statefulset deleting the pod.
+		// See DeletionStrategy for the alternatives.
 		log.V(2).Info("Unregistration seems complete")
 
-		return ctrl.Result{}, nil
+		res, err = r.deletionStrategy().TearDown(ctx, r.Client, log, &runnerPod)
+		if res != nil {
+			return r.resyncGracefulStop(*res, err)
+		}
+
+		// The upstream controller is expected to delete the runner pod, but we keep checking on it in case it doesn't,
+		// which costs no GitHub API call as the unregistration has already completed.
+		res, err = verifyRunnerPodDeleted(ctx, r.gracefulStopConfig(), log, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+		if res != nil {
+			return r.resyncGracefulStop(*res, err)
+		}
+
+		return r.resyncGracefulStop(ctrl.Result{}, nil)
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// resyncGracefulStop makes the runner pod in graceful stop reconciled again after GracefulStopSyncPeriod when the result doesn't requeue it,
+// so that the graceful stop is re-evaluated, and its timeouts eventually fire, even when no Kubernetes event triggers another reconcilation.
+// A result with an error is returned as is, as controller-runtime requeues it with backoff anyway.
+func (r *RunnerPodReconciler) resyncGracefulStop(res ctrl.Result, err error) (ctrl.Result, error) {
+	if err != nil || res.Requeue || res.RequeueAfter > 0 || r.GracefulStopSyncPeriod <= 0 {
+		return res, err
+	}
+
+	return *withRequeueJitter(&ctrl.Result{RequeueAfter: r.GracefulStopSyncPeriod}, r.RequeueJitter), nil
+}
+
+func (r *RunnerPodReconciler) gracefulStopConfig() gracefulStopConfig {
+	return gracefulStopConfig{
+		unregistrationTimeout:     r.unregistrationTimeout(),
+		retryDelay:                r.unregistrationRetryDelay(),
+		registrationGracePeriod:   r.registrationGracePeriod(),
+		apiTimeout:                r.gitHubAPITimeout(),
+		retryableStatusCodes:      r.RetryableGitHubStatusCodes,
+		maxUnregistrationAttempts: r.maxUnregistrationAttempts(),
+		timeoutWarningThreshold:   r.unregistrationTimeoutWarningThreshold(),
+		drainReadinessGate:        corev1.PodConditionType(r.DrainReadinessGateConditionType),
+		blockStopCondition:        corev1.PodConditionType(r.BlockStopConditionType),
+		maxBlockStopDuration:      r.maxBlockStopDuration(),
+		dryRun:                    r.UnregistrationDryRun,
+		onlyUnregisterOffline:     r.OnlyUnregisterOfflineRunners,
+		offlineGracePeriod:        r.OfflineRunnerGracePeriod,
+		verifyRunnerID:            r.VerifyRunnerID,
+		requeueJitter:             r.RequeueJitter,
+		recorder:                  r.Recorder,
+		unregistrationLimiter:     r.unregistrationLimiter,
+		progressLogThrottle:       r.progressLogThrottle,
+		quietHours:                r.UnregistrationQuietHours,
+		clock:                     r.Clock,
+
+		deletionVerificationTimeout: r.DeletionVerificationTimeout,
+	}
+}
+
+func (r *RunnerPodReconciler) deletionStrategy() DeletionStrategy {
+	if r.DeletionStrategy == nil {
+		return deleteStrategy{}
+	}
+
+	return r.DeletionStrategy
+}
+
+func (r *RunnerPodReconciler) registrationCheckConfig() registrationCheckConfig {
+	return registrationCheckConfig{
+		interval:            r.registrationRecheckInterval(),
+		maxWait:             r.maxRegistrationWait(),
+		requeueJitter:       r.RequeueJitter,
+		registrationLatency: r.registrationLatency,
+		clock:               r.Clock,
+	}
+}
+
+func (r *RunnerPodReconciler) registrationRecheckInterval() time.Duration {
+	interval := DefaultRegistrationRecheckInterval
+
+	if r.RegistrationRecheckInterval > 0 {
+		interval = r.RegistrationRecheckInterval
+	}
+	return interval
+}
+
+func (r *RunnerPodReconciler) maxRegistrationWait() time.Duration {
+	maxWait := DefaultMaxRegistrationWait
+
+	if r.MaxRegistrationWait > 0 {
+		maxWait = r.MaxRegistrationWait
+	}
+	return maxWait
+}
+
 func (r *RunnerPodReconciler) unregistrationTimeout() time.Duration {
 	unregistrationTimeout := DefaultUnregistrationTimeout
 
@@ -208,6 +444,54 @@ func (r *RunnerPodReconciler) unregistrationRetryDelay() time.Duration {
 	return retryDelay
 }
 
+func (r *RunnerPodReconciler) registrationGracePeriod() time.Duration {
+	if r.RegistrationGracePeriod > 0 {
+		return r.RegistrationGracePeriod
+	}
+
+	if gracePeriod, ok := r.registrationLatency.gracePeriod(); ok {
+		return gracePeriod
+	}
+
+	return DefaultRegistrationGracePeriod
+}
+
+func (r *RunnerPodReconciler) gitHubAPITimeout() time.Duration {
+	timeout := DefaultGitHubAPITimeout
+
+	if r.GitHubAPITimeout > 0 {
+		timeout = r.GitHubAPITimeout
+	}
+	return timeout
+}
+
+func (r *RunnerPodReconciler) maxUnregistrationAttempts() int {
+	attempts := DefaultMaxUnregistrationAttempts
+
+	if r.MaxUnregistrationAttempts > 0 {
+		attempts = r.MaxUnregistrationAttempts
+	}
+	return attempts
+}
+
+func (r *RunnerPodReconciler) unregistrationTimeoutWarningThreshold() float64 {
+	threshold := DefaultUnregistrationTimeoutWarningThreshold
+
+	if r.UnregistrationTimeoutWarningThreshold > 0 {
+		threshold = r.UnregistrationTimeoutWarningThreshold
+	}
+	return threshold
+}
+
+func (r *RunnerPodReconciler) maxBlockStopDuration() time.Duration {
+	d := DefaultMaxBlockStopDuration
+
+	if r.MaxBlockStopDuration > 0 {
+		d = r.MaxBlockStopDuration
+	}
+	return d
+}
+
 func (r *RunnerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	name := "runnerpod-controller"
 	if r.Name != "" {
@@ -216,6 +500,22 @@ func (r *RunnerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	r.Recorder = mgr.GetEventRecorderFor(name)
 
+	if r.MaxConcurrentUnregistrations > 0 {
+		r.unregistrationLimiter = newUnregistrationLimiter(r.MaxConcurrentUnregistrations)
+	}
+
+	if r.UnregistrationProgressLogInterval > 0 {
+		r.progressLogThrottle = newLogThrottle(r.UnregistrationProgressLogInterval)
+	}
+
+	r.registrationLatency = newRegistrationLatencyEstimator(registrationLatencyWindowSize)
+
+	if r.ShutdownDrainGracePeriod > 0 {
+		if err := mgr.Add(&runnerPodShutdownDrainer{reconciler: r, gracePeriod: r.ShutdownDrainGracePeriod}); err != nil {
+			return err
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Pod{}).
 		Named(name).
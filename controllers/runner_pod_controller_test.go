@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// deleteRecordingClient records the grace periods of the deletions made via the client.
+type deleteRecordingClient struct {
+	client.Client
+
+	gracePeriods []*int64
+}
+
+func (c *deleteRecordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	var o client.DeleteOptions
+	o.ApplyOptions(opts)
+
+	c.gracePeriods = append(c.gracePeriods, o.GracePeriodSeconds)
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestRunnerPodReconciler_PreStopGracePeriod(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	preStop := &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "flush-caches"}},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		lifecycle          *corev1.Lifecycle
+		annotations        map[string]string
+		preStopGracePeriod time.Duration
+		deletedAgo         time.Duration
+		wantForceDeleted   bool
+	}{
+		{
+			name:             "no preStop hook",
+			deletedAgo:       2 * time.Minute,
+			wantForceDeleted: true,
+		},
+		{
+			name:               "preStop hook within the grace period",
+			lifecycle:          preStop,
+			preStopGracePeriod: 5 * time.Minute,
+			deletedAgo:         2 * time.Minute,
+		},
+		{
+			name:               "preStop hook after the grace period",
+			lifecycle:          preStop,
+			preStopGracePeriod: 5 * time.Minute,
+			deletedAgo:         7 * time.Minute,
+			wantForceDeleted:   true,
+		},
+		{
+			name:               "preStop hook within the grace period overridden via annotation",
+			lifecycle:          preStop,
+			annotations:        map[string]string{AnnotationKeyPreStopGracePeriod: "10m"},
+			preStopGracePeriod: 5 * time.Minute,
+			deletedAgo:         7 * time.Minute,
+		},
+		{
+			name:             "preStop hook without the grace period",
+			lifecycle:        preStop,
+			deletedAgo:       2 * time.Minute,
+			wantForceDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deletionTimestamp := metav1.NewTime(time.Now().Add(-tt.deletedAgo))
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					Labels:            map[string]string{LabelKeyRunnerSetName: "example"},
+					Annotations:       tt.annotations,
+					DeletionTimestamp: &deletionTimestamp,
+					// The runner pod controller's finalizer has already been removed, and the pod is stuck in termination.
+					Finalizers: []string{"example.com/other"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:      containerName,
+						Lifecycle: tt.lifecycle,
+					}},
+				},
+			}
+
+			c := &deleteRecordingClient{
+				Client: clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build(),
+			}
+
+			r := &RunnerPodReconciler{
+				Client:             c,
+				Log:                log,
+				Recorder:           record.NewFakeRecorder(10),
+				PreStopGracePeriod: tt.preStopGracePeriod,
+			}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if forceDeleted := len(c.gracePeriods) > 0; forceDeleted != tt.wantForceDeleted {
+				t.Fatalf("unexpected forced deletion: want %v, got %v", tt.wantForceDeleted, forceDeleted)
+			}
+
+			for _, p := range c.gracePeriods {
+				if p == nil || *p != 0 {
+					t.Errorf("expected the forced deletion to have a zero grace period, got %v", p)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerPodReconciler_GracefulStopSyncPeriod(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	tests := []struct {
+		name             string
+		syncPeriod       time.Duration
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:             "resync",
+			syncPeriod:       time.Minute,
+			wantRequeueAfter: time.Minute,
+		},
+		{
+			name: "disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deletionTimestamp := metav1.NewTime(time.Now().Add(-10 * time.Second))
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test1",
+					Namespace:         "default",
+					Labels:            map[string]string{LabelKeyRunnerSetName: "example"},
+					DeletionTimestamp: &deletionTimestamp,
+					// The pod is pending deletion but not timed out yet, which no Kubernetes event might follow.
+					Finalizers: []string{"example.com/other"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: containerName}},
+				},
+			}
+
+			r := &RunnerPodReconciler{
+				Client:                 clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build(),
+				Log:                    log,
+				Recorder:               record.NewFakeRecorder(10),
+				GracefulStopSyncPeriod: tt.syncPeriod,
+			}
+
+			res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.RequeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected requeue delay: want %s, got %s", tt.wantRequeueAfter, res.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestRunnerPodReconciler_resyncGracefulStop(t *testing.T) {
+	r := &RunnerPodReconciler{GracefulStopSyncPeriod: time.Minute}
+
+	// A shorter requeue delay asked for by the graceful stop, like the unregistration retry delay, must be kept as is
+	// so that the resync doesn't add GitHub API calls.
+	if res, _ := r.resyncGracefulStop(ctrl.Result{RequeueAfter: 10 * time.Second}, nil); res.RequeueAfter != 10*time.Second {
+		t.Errorf("unexpected requeue delay: want 10s, got %s", res.RequeueAfter)
+	}
+
+	if res, err := r.resyncGracefulStop(ctrl.Result{}, context.DeadlineExceeded); err == nil || res.RequeueAfter != 0 {
+		t.Errorf("expected the error to be returned as is, got %v and %v", res, err)
+	}
+}
+
+func TestRunnerPodReconciler_RegistrationRecheckInterval(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		interval         time.Duration
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:             "default",
+			wantRequeueAfter: DefaultRegistrationRecheckInterval,
+		},
+		{
+			name:             "configured",
+			interval:         30 * time.Second,
+			wantRequeueAfter: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "missing",
+					Namespace: "default",
+				},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(pod).Build()
+
+			r := &RunnerPodReconciler{RegistrationRecheckInterval: tt.interval}
+
+			_, res, err := ensureRunnerPodRegistered(context.Background(), r.registrationCheckConfig(), log, newGithubClient(server), c, "", "", "test/valid", "missing", pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res == nil || res.RequeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected result: want requeue after %s, got %+v", tt.wantRequeueAfter, res)
+			}
+		})
+	}
+}
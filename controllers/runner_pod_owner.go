@@ -13,6 +13,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -174,7 +175,7 @@ func getPodsForOwner(ctx context.Context, c client.Client, log logr.Logger, o cl
 		if runnerPodOrContainerIsStopped(&pod) {
 			completed++
 		} else if pod.Status.Phase == corev1.PodRunning {
-			if podRunnerID(&pod) == "" && podConditionTransitionTimeAfter(&pod, corev1.PodReady, registrationTimeout) {
+			if podRunnerID(&pod) == "" && podConditionTransitionTimeAfter(clock.RealClock{}, &pod, corev1.PodReady, registrationTimeout) {
 				log.Info(
 					"Runner failed to register itself to GitHub in timely manner. "+
 						"Recreating the pod to see if it resolves the issue. "+
@@ -236,6 +237,10 @@ type state struct {
 
 type result struct {
 	currentObjects []*podsForOwner
+
+	// requeueAfter is non-zero when the scale down of some runners is deferred until they live for the minimum runner lifetime.
+	// currentObjects is nil in that case.
+	requeueAfter time.Duration
 }
 
 // Why `create` must be a function rather than a client.Object? That's becase we use it to create one or more objects on scale up.
@@ -249,8 +254,15 @@ type result struct {
 // The second call fails due to the first call mutated the client.Object to have .Revision.
 // Passing a factory function of client.Object and creating a brand-new client.Object per a client.Create call resolves this issue,
 // allowing us to create two or more replicas in one reconcilation loop without being rejected by K8s.
-func syncRunnerPodsOwners(ctx context.Context, c client.Client, log logr.Logger, effectiveTime *metav1.Time, newDesiredReplicas int, create func() client.Object, ephemeral bool, owners []client.Object) (*result, error) {
-	state, err := collectPodsForOwners(ctx, c, log, owners)
+//
+// When waitForEviction is true, an owner whose runners have been unregistered isn't deleted until its runner pods are evicted
+// by the runner pod controller, so that the eviction, which respects PodDisruptionBudgets, isn't bypassed by the cascade deletion of the runner pods.
+// See collectPodsForOwners for details.
+//
+// Runner pods younger than minRunnerLifetime aren't selected for scale down, so that an oscillating autoscaler doesn't
+// repeatedly spin up and down expensive runners. See selectOwnersForScaleDown for details.
+func syncRunnerPodsOwners(ctx context.Context, c client.Client, log logr.Logger, effectiveTime *metav1.Time, newDesiredReplicas int, create func() client.Object, ephemeral, waitForEviction bool, minRunnerLifetime time.Duration, owners []client.Object) (*result, error) {
+	state, err := collectPodsForOwners(ctx, c, log, waitForEviction, owners)
 	if err != nil || state == nil {
 		return nil, err
 	}
@@ -386,22 +398,10 @@ func syncRunnerPodsOwners(ctx context.Context, c client.Client, log logr.Logger,
 		// This runnerreplicaset controller doesn't count marked runners into the `running` value, hence you're unlikely to
 		// fall into this branch when you're using ephemeral runners with webhook-based-autoscaler.
 
-		var retained int
-
-		var delete []*podsForOwner
-		for i := len(currentObjects) - 1; i >= 0; i-- {
-			ss := currentObjects[i]
-
-			if ss.running == 0 || retained >= newDesiredReplicas {
-				// In case the desired replicas is satisfied until i-1, or this owner has no running pods,
-				// this owner can be considered safe for deletion.
-				// Note that we already waited on this owner to create pods by waiting for
-				// `.Status.Replicas`(=total number of pods managed by owner, regardless of the runner is Running or Completed) to match the desired replicas in a previous step.
-				// So `.running == 0` means "the owner has created the desired number of pods before, and all of them are completed now".
-				delete = append(delete, ss)
-			} else if retained < newDesiredReplicas {
-				retained += ss.running
-			}
+		delete, retained, deferredFor := selectOwnersForScaleDown(currentObjects, newDesiredReplicas, minRunnerLifetime, time.Now())
+
+		if deferredFor > 0 {
+			log.V(1).Info("Deferred scale down of runner(s) younger than the minimum runner lifetime", "minRunnerLifetime", minRunnerLifetime, "requeueAfter", deferredFor)
 		}
 
 		if retained == newDesiredReplicas {
@@ -434,6 +434,11 @@ func syncRunnerPodsOwners(ctx context.Context, c client.Client, log logr.Logger,
 					log.V(2).Info("BUG: Redundant object was already annotated")
 				}
 			}
+
+			if deferredFor > 0 {
+				return &result{requeueAfter: deferredFor}, nil
+			}
+
 			return nil, err
 		} else if retained > newDesiredReplicas {
 			log.V(2).Info("Waiting sync before scale down", "retained", retained, "newDesiredReplicas", newDesiredReplicas)
@@ -467,7 +472,83 @@ func syncRunnerPodsOwners(ctx context.Context, c client.Client, log logr.Logger,
 	}, nil
 }
 
-func collectPodsForOwners(ctx context.Context, c client.Client, log logr.Logger, owners []client.Object) (*state, error) {
+// selectOwnersForScaleDown returns the owners that should start the unregistration process on scale down, along with
+// the number of running runners retained after the scale down.
+//
+// Owners with no running pods are always selected. Among the others, the newest runner pods are retained until the desired replicas is satisfied,
+// so that the oldest runner pods are gracefully stopped first to maximize the benefit of recycling pods.
+// The selection is deterministic, with ties in pod creation timestamps broken by owner names.
+// The returned owners are ordered from the oldest to the newest.
+//
+// An owner with running pods younger than minRunnerLifetime is neither selected nor counted as retained, so that it's selected
+// on a later call once it's old enough. The third return value is the duration until the oldest of such owners gets old enough,
+// or zero when there's none.
+func selectOwnersForScaleDown(currentObjects []*podsForOwner, newDesiredReplicas int, minRunnerLifetime time.Duration, now time.Time) ([]*podsForOwner, int, time.Duration) {
+	candidates := make([]*podsForOwner, len(currentObjects))
+	copy(candidates, currentObjects)
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ti, tj := oldestPodCreationTimestamp(candidates[i]), oldestPodCreationTimestamp(candidates[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+
+		return candidates[i].owner.GetName() < candidates[j].owner.GetName()
+	})
+
+	var (
+		retained    int
+		selected    []*podsForOwner
+		deferredFor time.Duration
+	)
+
+	for i := len(candidates) - 1; i >= 0; i-- {
+		ss := candidates[i]
+
+		if ss.running > 0 && retained >= newDesiredReplicas {
+			// Ephemeral runners that have completed their jobs have no running pods, so they are never deferred.
+			if d := minRunnerLifetime - now.Sub(oldestPodCreationTimestamp(ss)); d > 0 {
+				if deferredFor == 0 || d < deferredFor {
+					deferredFor = d
+				}
+
+				continue
+			}
+		}
+
+		if ss.running == 0 || retained >= newDesiredReplicas {
+			// In case the desired replicas is satisfied by newer owners, or this owner has no running pods,
+			// this owner can be considered safe for deletion.
+			// Note that we already waited on this owner to create pods by waiting for
+			// `.Status.Replicas`(=total number of pods managed by owner, regardless of the runner is Running or Completed) to match the desired replicas in a previous step.
+			// So `.running == 0` means "the owner has created the desired number of pods before, and all of them are completed now".
+			selected = append([]*podsForOwner{ss}, selected...)
+		} else {
+			retained += ss.running
+		}
+	}
+
+	return selected, retained, deferredFor
+}
+
+// oldestPodCreationTimestamp returns the creation timestamp of the oldest pod of the owner.
+// It falls back to the creation timestamp of the owner when the owner has no pods.
+func oldestPodCreationTimestamp(ss *podsForOwner) time.Time {
+	if len(ss.pods) == 0 {
+		return ss.owner.GetCreationTimestamp().Time
+	}
+
+	oldest := ss.pods[0].CreationTimestamp.Time
+	for _, po := range ss.pods[1:] {
+		if po.CreationTimestamp.Time.Before(oldest) {
+			oldest = po.CreationTimestamp.Time
+		}
+	}
+
+	return oldest
+}
+
+func collectPodsForOwners(ctx context.Context, c client.Client, log logr.Logger, waitForEviction bool, owners []client.Object) (*state, error) {
 	podsForOwnerPerTemplateHash := map[string][]*podsForOwner{}
 
 	// lastSyncTime becomes non-nil only when there are one or more owner(s) hence there are same number of runner pods.
@@ -514,12 +595,14 @@ func collectPodsForOwners(ctx context.Context, c client.Client, log logr.Logger,
 
 		// Statefulset termination process 2/4: Set unregistrationCompleteTimestamp only if all the pods managed by the statefulset
 		// have either unregistered or being deleted.
+		// When waitForEviction is true, an unregistered pod isn't counted until the runner pod controller evicts it,
+		// as the eviction can be blocked by a PodDisruptionBudget.
 		if _, ok := getAnnotation(res.owner, AnnotationKeyUnregistrationRequestTimestamp); ok {
 			var deletionSafe int
 			for _, po := range res.pods {
-				if _, ok := getAnnotation(&po, AnnotationKeyUnregistrationCompleteTimestamp); ok {
+				if !po.DeletionTimestamp.IsZero() {
 					deletionSafe++
-				} else if !po.DeletionTimestamp.IsZero() {
+				} else if _, ok := getAnnotation(&po, AnnotationKeyUnregistrationCompleteTimestamp); ok && !waitForEviction {
 					deletionSafe++
 				}
 			}
@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestSelectOwnersForScaleDown(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	newOwner := func(name string, podAge time.Duration, running int) *podsForOwner {
+		runner := &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				// The owner creation timestamps are in the reverse order of the pod ages,
+				// so that the test fails if the selection relied on them.
+				CreationTimestamp: metav1.NewTime(now.Add(podAge)),
+			},
+		}
+
+		return &podsForOwner{
+			running: running,
+			owner:   &ownerRunner{Object: runner, Runner: runner},
+			object:  runner,
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              name,
+						CreationTimestamp: metav1.NewTime(now.Add(-podAge)),
+					},
+				},
+			},
+		}
+	}
+
+	names := func(owners []*podsForOwner) []string {
+		var ns []string
+		for _, o := range owners {
+			ns = append(ns, o.owner.GetName())
+		}
+		return ns
+	}
+
+	tests := []struct {
+		name            string
+		owners          []*podsForOwner
+		desired         int
+		minLifetime     time.Duration
+		wantSelected    []string
+		wantRetained    int
+		wantDeferredFor time.Duration
+	}{
+		{
+			name: "oldest first",
+			owners: []*podsForOwner{
+				newOwner("middle", 2*time.Hour, 1),
+				newOwner("newest", time.Hour, 1),
+				newOwner("oldest", 3*time.Hour, 1),
+				newOwner("ancient", 4*time.Hour, 1),
+			},
+			desired:      2,
+			wantSelected: []string{"ancient", "oldest"},
+			wantRetained: 2,
+		},
+		{
+			name: "completed owners are always selected",
+			owners: []*podsForOwner{
+				newOwner("completed", time.Minute, 0),
+				newOwner("newest", time.Hour, 1),
+				newOwner("oldest", 3*time.Hour, 1),
+			},
+			desired:      1,
+			wantSelected: []string{"oldest", "completed"},
+			wantRetained: 1,
+		},
+		{
+			name: "ties are broken by name",
+			owners: []*podsForOwner{
+				newOwner("b", time.Hour, 1),
+				newOwner("c", time.Hour, 1),
+				newOwner("a", time.Hour, 1),
+			},
+			desired:      1,
+			wantSelected: []string{"a", "b"},
+			wantRetained: 1,
+		},
+		{
+			name: "runners younger than the minimum lifetime are deferred",
+			owners: []*podsForOwner{
+				newOwner("young", 10*time.Minute, 1),
+				newOwner("younger", 5*time.Minute, 1),
+				newOwner("youngest", time.Minute, 1),
+				newOwner("oldest", 3*time.Hour, 1),
+			},
+			desired:         1,
+			minLifetime:     30 * time.Minute,
+			wantSelected:    []string{"oldest"},
+			wantRetained:    1,
+			wantDeferredFor: 20 * time.Minute,
+		},
+		{
+			name: "completed owners are selected regardless of the minimum lifetime",
+			owners: []*podsForOwner{
+				newOwner("completed", time.Minute, 0),
+				newOwner("newest", time.Hour, 1),
+			},
+			desired:      1,
+			minLifetime:  30 * time.Minute,
+			wantSelected: []string{"completed"},
+			wantRetained: 1,
+		},
+		{
+			name: "no scale down",
+			owners: []*podsForOwner{
+				newOwner("newest", time.Hour, 1),
+				newOwner("oldest", 3*time.Hour, 1),
+			},
+			desired:      2,
+			wantRetained: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, retained, deferredFor := selectOwnersForScaleDown(tt.owners, tt.desired, tt.minLifetime, now)
+			if got := names(selected); !reflect.DeepEqual(got, tt.wantSelected) {
+				t.Errorf("unexpected selected owners: want %v, got %v", tt.wantSelected, got)
+			}
+			if retained != tt.wantRetained {
+				t.Errorf("unexpected retained: want %d, got %d", tt.wantRetained, retained)
+			}
+			if deferredFor != tt.wantDeferredFor {
+				t.Errorf("unexpected deferral: want %s, got %s", tt.wantDeferredFor, deferredFor)
+			}
+		})
+	}
+}
+
+// TestSyncRunnerPodsOwners_StatefulSetScaleDown runs the whole graceful stop flow of a RunnerSet scale-down,
+// from the runnerset controller marking the redundant statefulset, through the runner pod controller unregistering the runner,
+// to the statefulset being deleted.
+func TestSyncRunnerPodsOwners_StatefulSetScaleDown(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	ctx := context.Background()
+	now := time.Now()
+
+	var removed []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		removed = append(removed, req.Method)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	podLabels := map[string]string{LabelKeyRunnerSetName: "example"}
+
+	newStatefulSet := func(name string, age time.Duration) *appsv1.StatefulSet {
+		replicas := int32(1)
+
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				Labels:            map[string]string{LabelKeyRunnerTemplateHash: "hash"},
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				},
+			},
+			Status: appsv1.StatefulSetStatus{
+				Replicas: replicas,
+			},
+		}
+	}
+
+	newStatefulSetPod := func(name, runnerID string, ss *appsv1.StatefulSet) *corev1.Pod {
+		controller := true
+
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            podLabels,
+				Annotations:       map[string]string{AnnotationKeyRunnerID: runnerID},
+				CreationTimestamp: ss.CreationTimestamp,
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "StatefulSet", Name: ss.Name, UID: ss.UID, Controller: &controller},
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: containerName, Env: []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}}},
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+			},
+		}
+	}
+
+	oldSS, newSS := newStatefulSet("old", 2*time.Hour), newStatefulSet("new", time.Hour)
+	oldPod, newPod := newStatefulSetPod("test1", "1", oldSS), newStatefulSetPod("test2", "2", newSS)
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(oldSS, newSS, oldPod, newPod).Build()
+
+	sync := func() {
+		t.Helper()
+
+		var list appsv1.StatefulSetList
+		if err := c.List(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+
+		var owners []client.Object
+		for i := range list.Items {
+			owners = append(owners, &list.Items[i])
+		}
+
+		create := func() client.Object { return newStatefulSet("created", 0) }
+
+		if _, err := syncRunnerPodsOwners(ctx, c, log, nil, 1, create, false, false, 0, owners); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scaling down from 2 to 1 marks the oldest statefulset and its pod for unregistration.
+	sync()
+
+	var pod corev1.Pod
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldPod), &pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getAnnotation(&pod, AnnotationKeyUnregistrationRequestTimestamp); !ok {
+		t.Fatalf("expected the pod of the oldest statefulset to be marked for unregistration")
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(newPod), &pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getAnnotation(&pod, AnnotationKeyUnregistrationRequestTimestamp); ok {
+		t.Fatalf("expected the pod of the newest statefulset to be retained")
+	}
+
+	// The runner pod controller unregisters the runner without deleting the pod, so that the statefulset doesn't recreate it.
+	podReconciler := &RunnerPodReconciler{
+		Client:       c,
+		Log:          log,
+		GitHubClient: newGithubClient(server),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := podReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oldPod)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{http.MethodDelete}; !reflect.DeepEqual(removed, want) {
+		t.Fatalf("unexpected RemoveRunner calls: want %v, got %v", want, removed)
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldPod), &pod); err != nil {
+		t.Fatalf("expected the pod to be retained until the statefulset is deleted: %v", err)
+	}
+	if _, ok := getAnnotation(&pod, AnnotationKeyUnregistrationCompleteTimestamp); !ok {
+		t.Fatalf("expected the pod to be marked as unregistered")
+	}
+
+	if got, want := runnerSetForUnregisteredPod(&pod), "default/example"; len(got) != 1 || got[0].String() != want {
+		t.Fatalf("expected the unregistered pod to trigger the reconcilation of the runnerset %s, got %v", want, got)
+	}
+
+	// The runnerset controller then marks the statefulset as unregistered, and deletes it on the next reconcilation.
+	sync()
+
+	var ss appsv1.StatefulSet
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldSS), &ss); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getAnnotation(&ss, AnnotationKeyUnregistrationCompleteTimestamp); !ok {
+		t.Fatalf("expected the statefulset to be marked as unregistered")
+	}
+
+	sync()
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldSS), &ss); !kerrors.IsNotFound(err) {
+		t.Fatalf("expected the statefulset to be deleted, got %v", err)
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(newSS), &ss); err != nil {
+		t.Fatalf("expected the newest statefulset to be retained: %v", err)
+	}
+}
+
+func TestSyncRunnerPodsOwners_WaitForEviction(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	ctx := context.Background()
+	now := time.Now()
+
+	podLabels := map[string]string{LabelKeyRunnerSetName: "example"}
+
+	newStatefulSet := func(name string, age time.Duration, annotations map[string]string) *appsv1.StatefulSet {
+		replicas := int32(1)
+
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				Labels:            map[string]string{LabelKeyRunnerTemplateHash: "hash"},
+				Annotations:       annotations,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				},
+			},
+			Status: appsv1.StatefulSetStatus{
+				Replicas: replicas,
+			},
+		}
+	}
+
+	newStatefulSetPod := func(name string, ss *appsv1.StatefulSet, annotations map[string]string) *corev1.Pod {
+		controller := true
+
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            podLabels,
+				Annotations:       annotations,
+				Finalizers:        []string{"test"},
+				CreationTimestamp: ss.CreationTimestamp,
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "StatefulSet", Name: ss.Name, UID: ss.UID, Controller: &controller},
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+			},
+		}
+	}
+
+	requested := now.Format(time.RFC3339)
+
+	// The oldest statefulset has been scaled down and its runner has been unregistered, but its pod is yet to be evicted.
+	oldSS := newStatefulSet("old", 2*time.Hour, map[string]string{AnnotationKeyUnregistrationRequestTimestamp: requested})
+	oldPod := newStatefulSetPod("test1", oldSS, map[string]string{
+		AnnotationKeyUnregistrationRequestTimestamp:  requested,
+		AnnotationKeyUnregistrationCompleteTimestamp: requested,
+	})
+	newSS := newStatefulSet("new", time.Hour, nil)
+	newPod := newStatefulSetPod("test2", newSS, nil)
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(oldSS, newSS, oldPod, newPod).Build()
+
+	sync := func() {
+		t.Helper()
+
+		var list appsv1.StatefulSetList
+		if err := c.List(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+
+		var owners []client.Object
+		for i := range list.Items {
+			owners = append(owners, &list.Items[i])
+		}
+
+		create := func() client.Object { return newStatefulSet("created", 0, nil) }
+
+		if _, err := syncRunnerPodsOwners(ctx, c, log, nil, 1, create, false, true, 0, owners); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync()
+
+	var ss appsv1.StatefulSet
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldSS), &ss); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getAnnotation(&ss, AnnotationKeyUnregistrationCompleteTimestamp); ok {
+		t.Fatalf("expected the statefulset not to be marked as unregistered until its pod is evicted")
+	}
+
+	// The eviction sets the deletion timestamp of the pod, which is kept by the finalizer.
+	if err := c.Delete(ctx, oldPod); err != nil {
+		t.Fatal(err)
+	}
+
+	sync()
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(oldSS), &ss); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getAnnotation(&ss, AnnotationKeyUnregistrationCompleteTimestamp); !ok {
+		t.Fatalf("expected the statefulset to be marked as unregistered once its pod is evicted")
+	}
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+)
+
+// runnerPodShutdownDrainer makes a final pass of the graceful stops in progress when the controller is shutting down,
+// so that a controller restart in the middle of a scale-down leaves fewer runners to be unregistered by the next leader,
+// or orphaned when the runner pods are deleted meanwhile.
+//
+// It's run as a leader election runnable, which the manager stops before the caches and the leader election,
+// so the final pass can still read runner pods from the cache and runs only on the leader.
+type runnerPodShutdownDrainer struct {
+	reconciler *RunnerPodReconciler
+
+	// gracePeriod bounds the whole final pass.
+	gracePeriod time.Duration
+}
+
+// Start blocks until the manager starts shutting down, and then makes the final pass within the grace period.
+func (d *runnerPodShutdownDrainer) Start(ctx context.Context) error {
+	<-ctx.Done()
+
+	// ctx is already done, so the final pass needs its own context.
+	drainCtx, cancel := context.WithTimeout(context.Background(), d.gracePeriod)
+	defer cancel()
+
+	d.drain(drainCtx)
+
+	return nil
+}
+
+// NeedLeaderElection returns true so that only the leader, which was running the graceful stops, makes the final pass.
+func (d *runnerPodShutdownDrainer) NeedLeaderElection() bool {
+	return true
+}
+
+func (d *runnerPodShutdownDrainer) drain(ctx context.Context) {
+	r := d.reconciler
+	log := r.Log.WithName("shutdowndrain")
+
+	var pods corev1.PodList
+
+	if err := r.List(ctx, &pods, client.HasLabels{LabelKeyRunnerSetName}); err != nil {
+		log.Error(err, "Failed to list runner pods for the final pass of graceful stops")
+		return
+	}
+
+	var draining []*corev1.Pod
+
+	for i := range pods.Items {
+		if podIsDraining(&pods.Items[i]) {
+			draining = append(draining, &pods.Items[i])
+		}
+	}
+
+	if len(draining) == 0 {
+		return
+	}
+
+	log.Info("Making a final pass of graceful stops in progress before shutting down", "runnerPods", len(draining), "gracePeriod", d.gracePeriod)
+
+	var completed int
+
+	for _, pod := range draining {
+		if ctx.Err() != nil {
+			log.Info("Shutdown grace period has passed. Leaving the remaining graceful stops to the next leader", "completed", completed, "remaining", len(draining)-completed)
+			return
+		}
+
+		if d.tick(ctx, log, pod) {
+			completed++
+		}
+	}
+
+	log.Info("Completed the final pass of graceful stops", "completed", completed, "runnerPods", len(draining))
+}
+
+// tick runs one tick of the graceful stop of the runner pod, and returns true when the graceful stop has completed.
+// The runner pod is left for the next leader to delete or tear down, as the owner deletion is up to the upstream controllers.
+func (d *runnerPodShutdownDrainer) tick(ctx context.Context, log logr.Logger, pod *corev1.Pod) bool {
+	r := d.reconciler
+	log = log.WithValues("runnerpod", client.ObjectKeyFromObject(pod))
+
+	scope := runnerPodScope(pod)
+
+	ghClient, err := githubClientFor(r.GitHubClient, pod)
+	if err != nil {
+		log.Error(err, "Failed to create the GitHub client for the runner pod")
+		return false
+	}
+
+	_, res, reason, err := tickRunnerGracefulStopWithReason(ctx, r.gracefulStopConfig(), log, ghClient, newPodClient(r.Client, r.APIReader), scope.enterprise, scope.organization, scope.repository, pod.Name, pod)
+	metrics.IncRunnerGracefulStopTicks(scope.enterprise, scope.organization, scope.repository, string(reason))
+
+	if err != nil {
+		log.Error(err, "Failed the final pass of the graceful stop")
+	}
+
+	return res == nil
+}
+
+// podIsDraining returns true when the graceful stop of the runner pod has started but not completed yet.
+func podIsDraining(pod *corev1.Pod) bool {
+	if _, completed := getAnnotation(pod, AnnotationKeyUnregistrationCompleteTimestamp); completed {
+		return false
+	}
+
+	_, started := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp)
+
+	return started
+}
+
+// runnerPodScope returns the enterprise, the organization, or the repository the runner of the runner pod is registered to.
+func runnerPodScope(pod *corev1.Pod) runnerScope {
+	var scope runnerScope
+
+	if len(pod.Spec.Containers) == 0 {
+		return scope
+	}
+
+	for _, e := range pod.Spec.Containers[0].Env {
+		switch e.Name {
+		case EnvVarEnterprise:
+			scope.enterprise = e.Value
+		case EnvVarOrg:
+			scope.organization = e.Value
+		case EnvVarRepo:
+			scope.repository = e.Value
+		}
+	}
+
+	return scope
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestRunnerPodShutdownDrainer(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	var (
+		mu      sync.Mutex
+		removed []string
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 2, "runners": [`+
+			`{"id": 1, "name": "draining", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 2, "name": "running", "os": "linux", "status": "online", "busy": false}]}`)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/", func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		removed = append(removed, req.URL.Path)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newPod := func(name, id string, annotations map[string]string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{LabelKeyRunnerSetName: "example"},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+				Annotations:       map[string]string{AnnotationKeyRunnerID: id},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name: containerName,
+					Env:  []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}},
+				}},
+			},
+		}
+
+		for k, v := range annotations {
+			pod.Annotations[k] = v
+		}
+
+		return pod
+	}
+
+	draining := newPod("draining", "1", map[string]string{
+		AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+	})
+	running := newPod("running", "2", nil)
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(draining, running).Build()
+
+	d := &runnerPodShutdownDrainer{
+		reconciler: &RunnerPodReconciler{
+			Client:       c,
+			Log:          log,
+			Recorder:     record.NewFakeRecorder(10),
+			GitHubClient: newGithubClient(server),
+		},
+		gracePeriod: 10 * time.Second,
+	}
+
+	// The manager cancels the context on shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := d.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"/repos/test/valid/actions/runners/1"}; fmt.Sprint(removed) != fmt.Sprint(want) {
+		t.Errorf("unexpected runners removed: want %v, got %v", want, removed)
+	}
+
+	for _, tc := range []struct {
+		pod           *corev1.Pod
+		wantCompleted bool
+	}{
+		{pod: draining, wantCompleted: true},
+		{pod: running, wantCompleted: false},
+	} {
+		var got corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(tc.pod), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, completed := getAnnotation(&got, AnnotationKeyUnregistrationCompleteTimestamp); completed != tc.wantCompleted {
+			t.Errorf("unexpected unregistration completion of %s: want %v, got %v", tc.pod.Name, tc.wantCompleted, completed)
+		}
+	}
+}
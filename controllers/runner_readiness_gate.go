@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// drainReadinessGateReason is the reason of the readiness gate condition ARC sets to False on the graceful stop of the runner pod.
+const drainReadinessGateReason = "RunnerDraining"
+
+// podHasReadinessGate returns true when the runner pod declares the readiness gate of the condition type in spec.readinessGates.
+func podHasReadinessGate(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, g := range pod.Spec.ReadinessGates {
+		if g.ConditionType == conditionType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setDrainReadinessGate sets the readiness gate condition of the runner pod to False, so that the runner pod becomes unready
+// and external systems watching its readiness, like load balancers, can react to the graceful stop before the runner is unregistered.
+//
+// It does nothing when the condition type is empty, the runner pod doesn't declare the readiness gate, or the condition is already False.
+// The condition is patched with a strategic merge patch so that the conditions kubelet maintains are kept intact.
+func setDrainReadinessGate(ctx context.Context, cfg gracefulStopConfig, c client.Client, log logr.Logger, pod *corev1.Pod) (*corev1.Pod, error) {
+	conditionType := cfg.drainReadinessGate
+
+	if conditionType == "" || !podHasReadinessGate(pod, conditionType) {
+		return pod, nil
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == conditionType && cond.Status == corev1.ConditionFalse {
+			return pod, nil
+		}
+	}
+
+	updated := pod.DeepCopy()
+
+	cond := corev1.PodCondition{
+		Type:               conditionType,
+		Status:             corev1.ConditionFalse,
+		Reason:             drainReadinessGateReason,
+		Message:            "The runner is being unregistered by actions-runner-controller",
+		LastTransitionTime: metav1.NewTime(cfg.now()),
+	}
+
+	var found bool
+
+	for i := range updated.Status.Conditions {
+		if updated.Status.Conditions[i].Type == conditionType {
+			updated.Status.Conditions[i] = cond
+			found = true
+		}
+	}
+
+	if !found {
+		updated.Status.Conditions = append(updated.Status.Conditions, cond)
+	}
+
+	if err := c.Status().Patch(ctx, updated, client.StrategicMergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod status to set the %s readiness gate condition to False", conditionType))
+		return nil, err
+	}
+
+	log.V(1).Info("Set the readiness gate condition to False for the graceful stop", "conditionType", conditionType)
+
+	return updated, nil
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestSetDrainReadinessGate(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	const gate = corev1.PodConditionType("example.com/runner-available")
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	newPod := func(name string, readinessGates ...corev1.PodConditionType) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+					{Type: gate, Status: corev1.ConditionTrue},
+				},
+			},
+		}
+
+		for _, g := range readinessGates {
+			pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: g})
+		}
+
+		return pod
+	}
+
+	tests := []struct {
+		name          string
+		pod           *corev1.Pod
+		conditionType corev1.PodConditionType
+		wantStatus    corev1.ConditionStatus
+	}{
+		{
+			name:          "readiness gate declared",
+			pod:           newPod("declared", gate),
+			conditionType: gate,
+			wantStatus:    corev1.ConditionFalse,
+		},
+		{
+			name:          "readiness gate not declared",
+			pod:           newPod("undeclared"),
+			conditionType: gate,
+			wantStatus:    corev1.ConditionTrue,
+		},
+		{
+			name:       "disabled",
+			pod:        newPod("disabled", gate),
+			wantStatus: corev1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(tt.pod).Build()
+
+			cfg := gracefulStopConfig{
+				drainReadinessGate: tt.conditionType,
+				clock:              clocktesting.NewFakeClock(now),
+			}
+
+			if _, err := setDrainReadinessGate(context.Background(), cfg, c, log, tt.pod); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(tt.pod), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			statuses := map[corev1.PodConditionType]corev1.ConditionStatus{}
+			for _, cond := range got.Status.Conditions {
+				statuses[cond.Type] = cond.Status
+			}
+
+			if statuses[gate] != tt.wantStatus {
+				t.Errorf("unexpected status of the readiness gate condition: want %s, got %s", tt.wantStatus, statuses[gate])
+			}
+
+			// Other conditions must be kept intact.
+			if statuses[corev1.PodReady] != corev1.ConditionTrue {
+				t.Errorf("unexpected status of the Ready condition: %s", statuses[corev1.PodReady])
+			}
+		})
+	}
+}
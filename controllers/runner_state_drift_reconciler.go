@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultRunnerStateDriftCheckInterval is the default interval between two runs of the runner state drift check.
+const DefaultRunnerStateDriftCheckInterval = 10 * time.Minute
+
+// runnerStateDrift is the kind of the inconsistency between the runner ID recorded in the runner pod annotation and the runner on GitHub.
+type runnerStateDrift string
+
+const (
+	// runnerStateDriftIDChanged means that GitHub has a runner of the name, but with an ID other than the recorded one.
+	runnerStateDriftIDChanged runnerStateDrift = "id_changed"
+
+	// runnerStateDriftRunnerMissing means that GitHub has no runner of the name although the runner ID is recorded.
+	runnerStateDriftRunnerMissing runnerStateDrift = "runner_missing"
+
+	// runnerStateDriftInvalidID means that the recorded runner ID isn't a number.
+	runnerStateDriftInvalidID runnerStateDrift = "invalid_id"
+)
+
+// RunnerStateDriftReconciler periodically compares the runner ID recorded in the annotation of each runner pod
+// with the runner getRunner finds on GitHub, and reports the inconsistencies via events on the runner pod,
+// logs, and the arc_runner_state_drift_total metric.
+//
+// It's a diagnostic that never changes the runner pods or GitHub. A drift usually indicates a problem on GitHub Enterprise Server,
+// like a restore from a backup that reassigned runner IDs, or a bug that made two runner pods collide on the same runner name.
+//
+// Runner pods that haven't registered their runners yet, whose runners are being unregistered, or that have stopped are skipped,
+// as their runners are expected to be missing on GitHub.
+type RunnerStateDriftReconciler struct {
+	client.Client
+	Log          logr.Logger
+	Recorder     record.EventRecorder
+	GitHubClient *github.Client
+
+	// Interval is the interval between two runs of the runner state drift check.
+	Interval time.Duration
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Start runs the runner state drift check until the context is done.
+func (r *RunnerStateDriftReconciler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		if err := r.check(ctx); err != nil {
+			r.Log.Error(err, "Failed to check runner state drift")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns true so that only the leader calls GitHub API for the check.
+func (r *RunnerStateDriftReconciler) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *RunnerStateDriftReconciler) check(ctx context.Context) error {
+	var pods corev1.PodList
+
+	if err := r.List(ctx, &pods, client.HasLabels{LabelKeyRunnerSetName}); err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		id, ok := getAnnotation(pod, AnnotationKeyRunnerID)
+		if !ok || len(pod.Spec.Containers) == 0 || !pod.DeletionTimestamp.IsZero() || runnerPodOrContainerIsStopped(pod) {
+			continue
+		}
+
+		if _, unregistering := getAnnotation(pod, AnnotationKeyUnregistrationStartTimestamp); unregistering {
+			continue
+		}
+
+		scope := runnerPodScope(pod)
+		log := withRunnerScope(r.Log, scope.enterprise, scope.organization, scope.repository, pod.Name, pod)
+
+		ghClient, err := githubClientFor(r.GitHubClient, pod)
+		if err != nil {
+			log.Error(err, "Failed to create the GitHub client for the runner state drift check")
+			continue
+		}
+
+		drift, message, err := runnerStateDriftOf(ctx, log, ghClient, scope, pod, id)
+		if err != nil {
+			log.Error(err, "Failed to get the runner for the runner state drift check")
+			continue
+		}
+
+		if drift == "" {
+			continue
+		}
+
+		log.Info("Found a runner state drift", "drift", drift, "detail", message)
+
+		metrics.IncRunnerStateDrift(scope.enterprise, scope.organization, scope.repository, string(drift))
+
+		if r.Recorder != nil {
+			r.Recorder.Event(pod, corev1.EventTypeWarning, "RunnerStateDrift", message)
+		}
+	}
+
+	return nil
+}
+
+// runnerStateDriftOf returns the kind of the drift between the recorded runner ID and the runner on GitHub, along with a message
+// describing it, or an empty drift when they're consistent.
+func runnerStateDriftOf(ctx context.Context, log logr.Logger, ghClient *github.Client, scope runnerScope, pod *corev1.Pod, id string) (runnerStateDrift, string, error) {
+	recordedID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return runnerStateDriftInvalidID, fmt.Sprintf("Recorded runner ID %q is not a number", id), nil
+	}
+
+	groupID := runnerGroupID(ctx, log, ghClient, scope.enterprise, scope.organization, scope.repository, pod)
+
+	runner, err := getRunner(ctx, log, ghClient, scope.enterprise, scope.organization, scope.repository, pod.Name, groupID, podRunnerLabels(pod), podRunnerNameRemap(log, pod))
+	if err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case runner == nil:
+		return runnerStateDriftRunnerMissing, fmt.Sprintf("Runner %q of the recorded ID %d is missing on GitHub", pod.Name, recordedID), nil
+	case runner.GetID() != recordedID:
+		return runnerStateDriftIDChanged, fmt.Sprintf("Runner %q has ID %d on GitHub, but ID %d is recorded", pod.Name, runner.GetID(), recordedID), nil
+	}
+
+	return "", "", nil
+}
+
+func (r *RunnerStateDriftReconciler) interval() time.Duration {
+	interval := DefaultRunnerStateDriftCheckInterval
+
+	if r.Interval > 0 {
+		interval = r.Interval
+	}
+	return interval
+}
+
+func (r *RunnerStateDriftReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("runnerstatedrift-controller")
+
+	return mgr.Add(r)
+}
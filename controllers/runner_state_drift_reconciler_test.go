@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerStateDriftReconciler_check(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"total_count": 3, "runners": [`+
+			`{"id": 1, "name": "consistent", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 2, "name": "id-changed", "os": "linux", "status": "online", "busy": false},`+
+			`{"id": 4, "name": "invalid-id", "os": "linux", "status": "online", "busy": false}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newPod := func(name string, annotations map[string]string) client.Object {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Labels:      map[string]string{LabelKeyRunnerSetName: "runnerset"},
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: containerName,
+						Env: []corev1.EnvVar{
+							{Name: EnvVarRepo, Value: "test/valid"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+
+	r := &RunnerStateDriftReconciler{
+		Client: clientfake.NewClientBuilder().WithScheme(sc).WithObjects(
+			newPod("consistent", map[string]string{AnnotationKeyRunnerID: "1"}),
+			newPod("id-changed", map[string]string{AnnotationKeyRunnerID: "5"}),
+			newPod("missing", map[string]string{AnnotationKeyRunnerID: "3"}),
+			newPod("invalid-id", map[string]string{AnnotationKeyRunnerID: "four"}),
+			newPod("not-registered-yet", nil),
+			newPod("unregistering", map[string]string{
+				AnnotationKeyRunnerID:                     "6",
+				AnnotationKeyUnregistrationStartTimestamp: time.Now().Format(time.RFC3339),
+			}),
+		).Build(),
+		Log:          logr.Discard(),
+		Recorder:     recorder,
+		GitHubClient: newGithubClient(server),
+	}
+
+	if err := r.check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	sort.Strings(events)
+
+	want := []string{
+		`Warning RunnerStateDrift Recorded runner ID "four" is not a number`,
+		`Warning RunnerStateDrift Runner "id-changed" has ID 2 on GitHub, but ID 5 is recorded`,
+		`Warning RunnerStateDrift Runner "missing" of the recorded ID 3 is missing on GitHub`,
+	}
+
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected events:\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(events, "\n"))
+	}
+}
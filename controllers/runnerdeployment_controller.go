@@ -79,6 +79,15 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	metrics.SetRunnerDeployment(rd)
 
+	if drained, err := r.drainRunners(ctx, log, &rd); err != nil {
+		log.Error(err, "Failed to drain runners")
+
+		return ctrl.Result{}, err
+	} else if drained {
+		// Removing the drain request annotations triggers another reconcilation.
+		return ctrl.Result{}, nil
+	}
+
 	var myRunnerReplicaSetList v1alpha1.RunnerReplicaSetList
 	if err := r.List(ctx, &myRunnerReplicaSetList, client.InNamespace(req.Namespace), client.MatchingFields{runnerSetOwnerKey: req.Name}); err != nil {
 		return ctrl.Result{}, err
@@ -188,6 +197,18 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, err
 	}
 
+	if !reflect.DeepEqual(newestSet.Spec.MinRunnerLifetimeSeconds, desiredRS.Spec.MinRunnerLifetimeSeconds) {
+		newestSet.Spec.MinRunnerLifetimeSeconds = desiredRS.Spec.MinRunnerLifetimeSeconds
+
+		if err := r.Client.Update(ctx, newestSet); err != nil {
+			log.Error(err, "Failed to update runnerreplicaset resource")
+
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
 	// Do we have old runner replica sets that should eventually deleted?
 	if len(oldSets) > 0 {
 		var readyReplicas int
@@ -422,6 +443,8 @@ func newRunnerReplicaSet(rd *v1alpha1.RunnerDeployment, commonRunnerLabels []str
 			Selector:      newRSSelector,
 			Template:      newRSTemplate,
 			EffectiveTime: rd.Spec.EffectiveTime,
+
+			MinRunnerLifetimeSeconds: rd.Spec.MinRunnerLifetimeSeconds,
 		},
 	}
 
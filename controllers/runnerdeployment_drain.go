@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
+
+// drainRunners starts the graceful stop of the runners of the RunnerDeployment that match the drain request annotations,
+// AnnotationKeyDrainRunnerLabels and AnnotationKeyDrainPodSelector, and removes the annotations afterwards.
+// It returns true when there was a drain request.
+//
+// The graceful stop is started by annotating runner pods with the unregistration request timestamp,
+// so that the runner pod controller unregisters the runners the same way as it does for a scale-down.
+func (r *RunnerDeploymentReconciler) drainRunners(ctx context.Context, log logr.Logger, rd *v1alpha1.RunnerDeployment) (bool, error) {
+	runnerLabelsValue, hasRunnerLabels := getAnnotation(rd, AnnotationKeyDrainRunnerLabels)
+	podSelectorValue, hasPodSelector := getAnnotation(rd, AnnotationKeyDrainPodSelector)
+
+	if !hasRunnerLabels && !hasPodSelector {
+		return false, nil
+	}
+
+	log = log.WithValues("runnerLabels", runnerLabelsValue, "podSelector", podSelectorValue)
+
+	podSelector := labels.Everything()
+
+	if hasPodSelector {
+		s, err := labels.Parse(podSelectorValue)
+		if err != nil {
+			log.Error(err, "Ignoring the drain request as the pod selector is unparsable")
+
+			r.Recorder.Event(rd, corev1.EventTypeWarning, "RunnerDrainFailed", fmt.Sprintf("Ignored the drain request as the pod selector %q is unparsable: %v", podSelectorValue, err))
+
+			return true, r.removeDrainRequest(ctx, rd)
+		}
+
+		podSelector = s
+	}
+
+	var runnerLabels []string
+
+	for _, l := range strings.Split(runnerLabelsValue, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			runnerLabels = append(runnerLabels, l)
+		}
+	}
+
+	var runners v1alpha1.RunnerList
+
+	if err := r.List(ctx, &runners, client.InNamespace(rd.Namespace), client.MatchingLabels{LabelKeyRunnerDeploymentName: rd.Name}); err != nil {
+		return false, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+
+	var drained []string
+
+	for i := range runners.Items {
+		runner := &runners.Items[i]
+
+		if !runner.DeletionTimestamp.IsZero() || !runnerHasLabels(runner, runnerLabels) {
+			continue
+		}
+
+		var pod corev1.Pod
+
+		if err := r.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}, &pod); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+
+			return false, err
+		}
+
+		if !pod.DeletionTimestamp.IsZero() || !podSelector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		if _, err := annotatePodOnce(ctx, r.Client, log, &pod, AnnotationKeyUnregistrationRequestTimestamp, now); err != nil {
+			return false, err
+		}
+
+		drained = append(drained, pod.Name)
+	}
+
+	log.Info("Started the graceful stop of runners to drain", "runners", drained)
+
+	r.Recorder.Event(rd, corev1.EventTypeNormal, "RunnersDraining", fmt.Sprintf("Started the graceful stop of %d runner(s) to drain", len(drained)))
+
+	return true, r.removeDrainRequest(ctx, rd)
+}
+
+func (r *RunnerDeploymentReconciler) removeDrainRequest(ctx context.Context, rd *v1alpha1.RunnerDeployment) error {
+	updated := rd.DeepCopy()
+	delete(updated.Annotations, AnnotationKeyDrainRunnerLabels)
+	delete(updated.Annotations, AnnotationKeyDrainPodSelector)
+
+	return r.Patch(ctx, updated, client.MergeFrom(rd))
+}
+
+// runnerHasLabels returns true when the runner has all the labels, compared case-insensitively as GitHub does.
+// The labels the runner has registered with on GitHub are used, or the ones in the spec when the runner isn't registered yet.
+func runnerHasLabels(runner *v1alpha1.Runner, runnerLabels []string) bool {
+	have := runner.Status.RegisteredLabels
+	if len(have) == 0 {
+		have = runner.Spec.Labels
+	}
+
+	for _, want := range runnerLabels {
+		var found bool
+
+		for _, l := range have {
+			if strings.EqualFold(l, want) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
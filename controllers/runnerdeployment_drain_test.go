@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestRunnerDeploymentReconciler_drainRunners(t *testing.T) {
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
+	rd := &v1alpha1.RunnerDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AnnotationKeyDrainRunnerLabels: "GPU",
+				AnnotationKeyDrainPodSelector:  "node-pool=old",
+			},
+		},
+	}
+
+	newRunner := func(name string, specLabels, registeredLabels []string) *v1alpha1.Runner {
+		return &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{LabelKeyRunnerDeploymentName: rd.Name},
+			},
+			Spec: v1alpha1.RunnerSpec{
+				RunnerConfig: v1alpha1.RunnerConfig{
+					Labels: specLabels,
+				},
+			},
+			Status: v1alpha1.RunnerStatus{
+				RegisteredLabels: registeredLabels,
+			},
+		}
+	}
+
+	newRunnerPod := func(name, nodePool string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"node-pool": nodePool},
+			},
+		}
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sc).WithObjects(
+		rd,
+		// Matches by the registered labels
+		newRunner("registered", nil, []string{"self-hosted", "gpu"}), newRunnerPod("registered", "old"),
+		// Matches by the spec labels as it isn't registered yet
+		newRunner("unregistered", []string{"gpu"}, nil), newRunnerPod("unregistered", "old"),
+		// The registered labels take precedence over the spec labels
+		newRunner("nogpu", []string{"gpu"}, []string{"self-hosted"}), newRunnerPod("nogpu", "old"),
+		// The pod doesn't match the pod selector
+		newRunner("newpool", nil, []string{"gpu"}), newRunnerPod("newpool", "new"),
+	).Build()
+
+	r := &RunnerDeploymentReconciler{
+		Client:   c,
+		Log:      log,
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	drained, err := r.drainRunners(context.Background(), log, rd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !drained {
+		t.Fatal("expected the drain request to be handled")
+	}
+
+	for name, want := range map[string]bool{"registered": true, "unregistered": true, "nogpu": false, "newpool": false} {
+		var pod corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, &pod); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, got := getAnnotation(&pod, AnnotationKeyUnregistrationRequestTimestamp); got != want {
+			t.Errorf("unexpected unregistration request of pod %s: want %v, got %v", name, want, got)
+		}
+	}
+
+	var got v1alpha1.RunnerDeployment
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(rd), &got); err != nil {
+		t.Fatal(err)
+	}
+	if metav1.HasAnnotation(got.ObjectMeta, AnnotationKeyDrainRunnerLabels) || metav1.HasAnnotation(got.ObjectMeta, AnnotationKeyDrainPodSelector) {
+		t.Errorf("expected the drain request annotations to be removed: %v", got.Annotations)
+	}
+
+	drained, err = r.drainRunners(context.Background(), log, &got)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drained {
+		t.Error("expected nothing to be drained without the drain request")
+	}
+}
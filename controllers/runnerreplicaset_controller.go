@@ -43,6 +43,10 @@ type RunnerReplicaSetReconciler struct {
 	Scheme       *runtime.Scheme
 	GitHubClient *github.Client
 	Name         string
+
+	// WaitForRunnerPodEviction makes the controller wait for the runner pods of redundant runners to be evicted
+	// before deleting the runners. Set it when the runner pod controller uses DeletionStrategyEvict.
+	WaitForRunnerPodEviction bool
 }
 
 const (
@@ -79,6 +83,7 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		template := rs.Spec.DeepCopy()
 		template.Replicas = nil
 		template.EffectiveTime = nil
+		template.MinRunnerLifetimeSeconds = nil
 		templateHash := ComputeHash(template)
 
 		log.Info("Using auto-generated template hash", "value", templateHash)
@@ -113,6 +118,11 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	effectiveTime := rs.Spec.EffectiveTime
 	ephemeral := rs.Spec.Template.Spec.Ephemeral == nil || *rs.Spec.Template.Spec.Ephemeral
 
+	var minRunnerLifetime time.Duration
+	if rs.Spec.MinRunnerLifetimeSeconds != nil {
+		minRunnerLifetime = time.Duration(*rs.Spec.MinRunnerLifetimeSeconds) * time.Second
+	}
+
 	desired, err := r.newRunner(rs)
 	if err != nil {
 		log.Error(err, "Could not create runner")
@@ -126,11 +136,15 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		live = append(live, &r)
 	}
 
-	res, err := syncRunnerPodsOwners(ctx, r.Client, log, effectiveTime, replicas, func() client.Object { return desired.DeepCopy() }, ephemeral, live)
+	res, err := syncRunnerPodsOwners(ctx, r.Client, log, effectiveTime, replicas, func() client.Object { return desired.DeepCopy() }, ephemeral, r.WaitForRunnerPodEviction, minRunnerLifetime, live)
 	if err != nil || res == nil {
 		return ctrl.Result{}, err
 	}
 
+	if res.requeueAfter > 0 {
+		return ctrl.Result{RequeueAfter: res.requeueAfter}, nil
+	}
+
 	var (
 		status v1alpha1.RunnerReplicaSetStatus
 
@@ -24,9 +24,13 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -51,6 +55,10 @@ type RunnerSetReconciler struct {
 	RunnerImagePullSecrets []string
 	DockerImage            string
 	DockerRegistryMirror   string
+
+	// WaitForRunnerPodEviction makes the controller wait for the runner pods of redundant statefulsets to be evicted
+	// before deleting the statefulsets. Set it when the runner pod controller uses DeletionStrategyEvict.
+	WaitForRunnerPodEviction bool
 }
 
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnersets,verbs=get;list;watch;create;update;patch;delete
@@ -129,7 +137,7 @@ func (r *RunnerSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		owners = append(owners, &ss)
 	}
 
-	res, err := syncRunnerPodsOwners(ctx, r.Client, log, effectiveTime, newDesiredReplicas, func() client.Object { return create.DeepCopy() }, ephemeral, owners)
+	res, err := syncRunnerPodsOwners(ctx, r.Client, log, effectiveTime, newDesiredReplicas, func() client.Object { return create.DeepCopy() }, ephemeral, r.WaitForRunnerPodEviction, 0, owners)
 	if err != nil || res == nil {
 		return ctrl.Result{}, err
 	}
@@ -263,6 +271,30 @@ func (r *RunnerSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.RunnerSet{}).
 		Owns(&appsv1.StatefulSet{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(runnerSetForUnregisteredPod)).
 		Named(name).
 		Complete(r)
 }
+
+// runnerSetForUnregisteredPod maps a runner pod managed by a RunnerSet to the RunnerSet once the runner pod controller
+// has unregistered the runner on scale down.
+//
+// Unlike a runner pod managed by a Runner, a runner pod managed by a statefulset has the restartPolicy of Always,
+// so its runner container can restart and register itself again after the unregistration.
+// Reconciling the RunnerSet immediately lets it delete the statefulset without waiting for the next resync.
+func runnerSetForUnregisteredPod(obj client.Object) []reconcile.Request {
+	if owner := metav1.GetControllerOf(obj); owner == nil || owner.Kind != "StatefulSet" {
+		return nil
+	}
+
+	if _, ok := getAnnotation(obj, AnnotationKeyUnregistrationCompleteTimestamp); !ok {
+		return nil
+	}
+
+	name, ok := obj.GetLabels()[LabelKeyRunnerSetName]
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
@@ -1,5 +1,11 @@
 package controllers
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 func filterLabels(labels map[string]string, filter string) map[string]string {
 	filtered := map[string]string{}
 
@@ -11,3 +17,32 @@ func filterLabels(labels map[string]string, filter string) map[string]string {
 
 	return filtered
 }
+
+// ParseStatusCodes parses the comma-separated list of HTTP status codes, like "429,500,502".
+func ParseStatusCodes(s string) ([]int, error) {
+	var codes []int
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q: %w", v, err)
+		}
+
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %d: must be between 100 and 599", code)
+		}
+
+		codes = append(codes, code)
+	}
+
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no status code is specified in %q", s)
+	}
+
+	return codes, nil
+}
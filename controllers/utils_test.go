@@ -32,3 +32,28 @@ func Test_filterLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{in: "429,500,502,503,504", want: []int{429, 500, 502, 503, 504}},
+		{in: " 408, 429 ,", want: []int{408, 429}},
+		{in: "", wantErr: true},
+		{in: "5xx", wantErr: true},
+		{in: "600", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseStatusCodes(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: want error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStatusCodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
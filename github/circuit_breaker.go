@@ -0,0 +1,213 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// DefaultCircuitBreakerFailureThreshold is the default number of consecutive failed GitHub API requests
+	// after which the circuit breaker opens.
+	DefaultCircuitBreakerFailureThreshold = 10
+
+	// DefaultCircuitBreakerWindow is the default window the consecutive failures need to happen within to open the circuit breaker.
+	DefaultCircuitBreakerWindow = time.Minute
+
+	// DefaultCircuitBreakerCooldown is the default duration the circuit breaker stays open before probing GitHub API again.
+	DefaultCircuitBreakerCooldown = 2 * time.Minute
+)
+
+// ErrCircuitOpen is the error GitHub API calls fail with, without reaching GitHub, while the circuit breaker is open.
+// Use errors.Is to see if an error returned by the client is due to the circuit breaker,
+// and RetryAfter to tell when the circuit breaker is going to let a request through again.
+var ErrCircuitOpen = errors.New("GitHub API circuit breaker is open")
+
+// CircuitOpenError is the error returned while the circuit breaker is open. It matches ErrCircuitOpen.
+type CircuitOpenError struct {
+	// Until is the time the circuit breaker lets a probe request through.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrCircuitOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops the client from calling GitHub API while GitHub seems to be down,
+// so that every reconciliation doesn't keep making API calls that are going to fail.
+//
+// The circuit breaker opens after failureThreshold consecutive requests failed within the window,
+// where a failure is a network error, a timeout, or a 5xx response.
+// While open, requests fail with CircuitOpenError without reaching GitHub.
+// After the cooldown, a single probe request is let through, and the circuit breaker closes if it succeeds,
+// or stays open for another cooldown otherwise.
+type circuitBreaker struct {
+	failureThreshold int
+	window           time.Duration
+	cooldown         time.Duration
+
+	log *logr.Logger
+	now func() time.Time
+
+	mu           sync.Mutex
+	state        circuitState
+	failures     int
+	firstFailure time.Time
+	openUntil    time.Time
+}
+
+func (c *Config) circuitBreaker() *circuitBreaker {
+	threshold := c.CircuitBreakerFailureThreshold
+	if threshold == 0 {
+		threshold = DefaultCircuitBreakerFailureThreshold
+	} else if threshold < 0 {
+		return nil
+	}
+
+	window := c.CircuitBreakerWindow
+	if window <= 0 {
+		window = DefaultCircuitBreakerWindow
+	}
+
+	cooldown := c.CircuitBreakerCooldown
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+
+	return &circuitBreaker{
+		failureThreshold: threshold,
+		window:           window,
+		cooldown:         cooldown,
+		log:              c.Log,
+		now:              time.Now,
+	}
+}
+
+// allow returns a CircuitOpenError when the request must not be sent.
+// Once the cooldown has passed, it lets the first request through as the probe and makes the circuit breaker half-open.
+func (b *circuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if now := b.now(); now.Before(b.openUntil) {
+			return &CircuitOpenError{Until: b.openUntil}
+		}
+
+		b.setState(host, circuitHalfOpen)
+	case circuitHalfOpen:
+		// Another request is probing GitHub API
+		return &CircuitOpenError{Until: b.now().Add(b.cooldown)}
+	}
+
+	return nil
+}
+
+// record records the result of a request let through by allow.
+// A request that neither succeeded nor failed, like one canceled by the caller, just ends the probe if it was the probe.
+func (b *circuitBreaker) record(host string, succeeded, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	switch {
+	case succeeded:
+		b.failures = 0
+
+		if b.state != circuitClosed {
+			b.setState(host, circuitClosed)
+
+			if b.log != nil {
+				b.log.Info("GitHub API is reachable again. Closed the circuit breaker", "host", host)
+			}
+		}
+	case failed:
+		if b.state == circuitHalfOpen {
+			b.open(host, now)
+			return
+		}
+
+		if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+			b.failures = 0
+			b.firstFailure = now
+		}
+		b.failures++
+
+		if b.failures >= b.failureThreshold {
+			b.open(host, now)
+		}
+	default:
+		// The cooldown has already passed, so the next request probes GitHub API instead.
+		if b.state == circuitHalfOpen {
+			b.setState(host, circuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) open(host string, now time.Time) {
+	b.openUntil = now.Add(b.cooldown)
+	b.failures = 0
+	b.setState(host, circuitOpen)
+
+	if b.log != nil {
+		b.log.Info("GitHub API seems to be down. Opened the circuit breaker", "host", host, "failureThreshold", b.failureThreshold, "until", b.openUntil)
+	}
+}
+
+func (b *circuitBreaker) setState(host string, state circuitState) {
+	b.state = state
+
+	metrics.SetCircuitBreakerState(host, int(state))
+}
+
+// circuitBreakerTransport sends requests through the circuit breaker.
+type circuitBreakerTransport struct {
+	Transport http.RoundTripper
+	Breaker   *circuitBreaker
+}
+
+func (t circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	if err := t.Breaker.allow(host); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Transport.RoundTrip(req)
+
+	var succeeded, failed bool
+
+	switch {
+	case err != nil:
+		// A request canceled by the caller, like when the controller is shutting down, says nothing about GitHub.
+		failed = !errors.Is(req.Context().Err(), context.Canceled)
+	case resp.StatusCode >= 500:
+		failed = true
+	default:
+		succeeded = true
+	}
+
+	t.Breaker.record(host, succeeded, failed)
+
+	return resp, err
+}
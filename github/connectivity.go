@@ -0,0 +1,126 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"github.com/go-logr/logr"
+	"github.com/google/go-github/v39/github"
+)
+
+const (
+	// DefaultConnectivityCheckInterval is the default interval between two GitHub API connectivity checks.
+	DefaultConnectivityCheckInterval = time.Minute
+
+	// DefaultConnectivityCheckFailureThreshold is the default number of consecutive failed connectivity checks
+	// after which the GitHub API is considered unreachable.
+	DefaultConnectivityCheckFailureThreshold = 3
+)
+
+// ConnectivityChecker periodically makes a lightweight authenticated GitHub API call to see if the controller
+// can still talk to GitHub, like when the credential has expired or been revoked.
+//
+// It's a controller-runtime Runnable, and its Check method can be registered as a healthz checker so that
+// the health probe fails after FailureThreshold consecutive failures.
+type ConnectivityChecker struct {
+	Client *Client
+	Log    logr.Logger
+
+	// Interval is the interval between two connectivity checks.
+	Interval time.Duration
+
+	// FailureThreshold is the number of consecutive failed checks after which Check reports unhealthy.
+	FailureThreshold int
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	lastErr             error
+}
+
+// Start runs the connectivity check until the context is done.
+func (c *ConnectivityChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false so that every replica, including non-leaders, reports its own connectivity.
+func (c *ConnectivityChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// Check returns an error when the last FailureThreshold or more connectivity checks failed in a row.
+// Its signature matches healthz.Checker.
+func (c *ConnectivityChecker) Check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.consecutiveFailures >= c.failureThreshold() {
+		return fmt.Errorf("%d consecutive GitHub API connectivity checks failed: %v", c.consecutiveFailures, c.lastErr)
+	}
+
+	return nil
+}
+
+func (c *ConnectivityChecker) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.interval())
+	defer cancel()
+
+	// The rate limit API is authenticated but doesn't count against the rate limit.
+	_, _, err := c.Client.RateLimits(metrics.WithOperation(ctx, "GetRateLimits"))
+
+	// GitHub Enterprise Server responds with 404 when rate limiting is disabled,
+	// which still means that we reached GitHub API with a valid credential.
+	if errRes := (&github.ErrorResponse{}); errors.As(err, &errRes) && errRes.Response.StatusCode == http.StatusNotFound {
+		err = nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.consecutiveFailures++
+		c.lastErr = err
+
+		c.Log.Error(err, "GitHub API connectivity check failed", "consecutiveFailures", c.consecutiveFailures)
+
+		return
+	}
+
+	c.consecutiveFailures = 0
+	c.lastErr = nil
+
+	metrics.SetLastConnectivityCheckSuccess(time.Now())
+}
+
+func (c *ConnectivityChecker) interval() time.Duration {
+	interval := DefaultConnectivityCheckInterval
+
+	if c.Interval > 0 {
+		interval = c.Interval
+	}
+	return interval
+}
+
+func (c *ConnectivityChecker) failureThreshold() int {
+	threshold := DefaultConnectivityCheckFailureThreshold
+
+	if c.FailureThreshold > 0 {
+		threshold = c.FailureThreshold
+	}
+	return threshold
+}
@@ -0,0 +1,68 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestConnectivityChecker(t *testing.T) {
+	status := http.StatusUnauthorized
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4999, "reset": 1372700873}}}`)
+		} else {
+			fmt.Fprint(w, `{"message": "error"}`)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient()
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	checker := &ConnectivityChecker{
+		Client:           client,
+		Log:              logr.Discard(),
+		FailureThreshold: 2,
+	}
+
+	ctx := context.Background()
+
+	checker.check(ctx)
+	if err := checker.Check(nil); err != nil {
+		t.Errorf("expected healthy below the failure threshold, got %v", err)
+	}
+
+	checker.check(ctx)
+	if err := checker.Check(nil); err == nil {
+		t.Errorf("expected unhealthy after reaching the failure threshold")
+	}
+
+	status = http.StatusOK
+	checker.check(ctx)
+	if err := checker.Check(nil); err != nil {
+		t.Errorf("expected healthy after a successful check, got %v", err)
+	}
+
+	// GitHub Enterprise Server responds with 404 when rate limiting is disabled.
+	status = http.StatusNotFound
+	for i := 0; i < 3; i++ {
+		checker.check(ctx)
+	}
+	if err := checker.Check(nil); err != nil {
+		t.Errorf("expected 404 to be treated as success, got %v", err)
+	}
+}
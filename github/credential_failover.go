@@ -0,0 +1,298 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"github.com/actions-runner-controller/actions-runner-controller/hash"
+	"github.com/go-logr/logr"
+)
+
+// credentialFailureCooldown is how long a credential GitHub rejected is skipped when failing over,
+// as long as there's another credential that hasn't been rejected as recently.
+const credentialFailureCooldown = 5 * time.Minute
+
+// Credential is a GitHub credential the client authenticates with.
+// Like Config, a GitHub App installation is used unless basic auth or a personal access token is given.
+type Credential struct {
+	AppID             int64  `split_words:"true"`
+	AppInstallationID int64  `split_words:"true"`
+	AppPrivateKey     string `split_words:"true"`
+	Token             string
+	BasicauthUsername string `split_words:"true"`
+	BasicauthPassword string `split_words:"true"`
+}
+
+// IsZero returns true when no credential is set.
+func (c Credential) IsZero() bool {
+	return c == Credential{}
+}
+
+// id returns a non-secret identifier of the credential,
+// like "installation/12345" for a GitHub App installation, or a hash of the token for a personal access token.
+func (c Credential) id() string {
+	if len(c.BasicauthUsername) > 0 && len(c.BasicauthPassword) > 0 {
+		return "basicauth/" + c.BasicauthUsername
+	} else if len(c.Token) > 0 {
+		return "token/" + hash.FNVHashStringObjects(c.Token)
+	}
+
+	return fmt.Sprintf("installation/%d", c.AppInstallationID)
+}
+
+// credentialHealth is the health record of a credential.
+type credentialHealth struct {
+	// consecutiveFailures is the number of times in a row GitHub rejected the credential.
+	consecutiveFailures int
+	lastFailure         time.Time
+	lastError           string
+	lastSuccess         time.Time
+}
+
+// failoverTransport authenticates requests with one of the ordered credentials, starting from the first one.
+// When GitHub rejects the active credential, i.e. responds with 401, or 403 telling the credential is bad or suspended,
+// the transport switches to the next credential and retries the request with it,
+// preferring credentials that haven't been rejected in the last credentialFailureCooldown.
+//
+// The active credential is kept until it's rejected, so that requests don't flap between credentials.
+type failoverTransport struct {
+	credentials []string
+	transports  []http.RoundTripper
+
+	log *logr.Logger
+	now func() time.Time
+
+	mu     sync.Mutex
+	active int
+	health []credentialHealth
+}
+
+// failoverTransport returns the transport that fails over across the primary and the fallback credentials.
+// Each credential's transport is instrumented with per-credential metrics.
+func (c *Config) failoverTransport() (*failoverTransport, error) {
+	t := &failoverTransport{
+		log: c.Log,
+		now: time.Now,
+	}
+
+	for i, cred := range c.credentials() {
+		tr, err := c.authTransport(cred)
+		if err != nil {
+			return nil, fmt.Errorf("credential %d: %w", i, err)
+		}
+
+		t.credentials = append(t.credentials, cred.id())
+		t.transports = append(t.transports, metrics.Transport{Transport: tr, Credential: cred.id()})
+	}
+
+	t.health = make([]credentialHealth, len(t.transports))
+
+	metrics.SetActiveCredential(t.credentials[0], t.credentials)
+
+	return t, nil
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req
+
+	for attempt := 1; ; attempt++ {
+		t.mu.Lock()
+		i := t.active
+		t.mu.Unlock()
+
+		resp, err := t.transports[i].RoundTrip(r)
+
+		reason := authFailure(resp, err)
+		if reason == "" {
+			if err == nil {
+				t.recordSuccess(i)
+			}
+			return resp, err
+		}
+
+		t.recordFailure(i, reason)
+
+		if attempt >= len(t.transports) {
+			return resp, err
+		}
+
+		// A request whose body has already been consumed can't be retried.
+		// It's sent with the next credential next time.
+		retry, cloneErr := cloneRequest(req)
+		if cloneErr != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		r = retry
+	}
+}
+
+func (t *failoverTransport) recordSuccess(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.health[i].consecutiveFailures = 0
+	t.health[i].lastSuccess = t.now()
+}
+
+// recordFailure records that GitHub rejected the i-th credential,
+// and switches to the next credential if the i-th one is still active.
+func (t *failoverTransport) recordFailure(i int, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+
+	h := &t.health[i]
+	h.consecutiveFailures++
+	h.lastFailure = now
+	h.lastError = reason
+
+	// Another request has already switched the credential
+	if i != t.active {
+		return
+	}
+
+	next := -1
+
+	for n := 1; n < len(t.transports); n++ {
+		j := (i + n) % len(t.transports)
+
+		if t.health[j].lastFailure.IsZero() || now.Sub(t.health[j].lastFailure) >= credentialFailureCooldown {
+			next = j
+			break
+		}
+
+		// Every other credential has been rejected recently, too. Try the one rejected the longest ago.
+		if next < 0 || t.health[j].lastFailure.Before(t.health[next].lastFailure) {
+			next = j
+		}
+	}
+
+	if next < 0 {
+		return
+	}
+
+	t.active = next
+
+	metrics.SetActiveCredential(t.credentials[next], t.credentials)
+
+	if t.log != nil {
+		t.log.Info(
+			"GitHub rejected the credential. Failing over to the next credential",
+			"credential", t.credentials[i],
+			"consecutiveFailures", h.consecutiveFailures,
+			"reason", reason,
+			"nextCredential", t.credentials[next],
+			"nextCredentialLastFailure", t.health[next].lastFailure,
+		)
+	}
+}
+
+// authFailure returns the reason GitHub rejected the credential the request was made with,
+// or an empty string when the credential wasn't rejected.
+func authFailure(resp *http.Response, err error) string {
+	if err != nil {
+		// ghinstallation doesn't return a typed error when GitHub refuses to issue an installation token,
+		// like when the private key of the GitHub App has been revoked.
+		if strings.Contains(err.Error(), "could not refresh installation id") && strings.Contains(err.Error(), "non 2xx response status") {
+			return err.Error()
+		}
+		return ""
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return resp.Status
+	case http.StatusForbidden:
+		// GitHub also responds with 403 when the credential is fine but lacks access to the resource,
+		// like "Resource not accessible by integration" for a repository the GitHub App isn't installed on.
+		// Another credential is tried only when GitHub tells that the credential itself is unusable.
+		if isRateLimitResponse(resp) || !isBadCredentialResponse(resp) {
+			return ""
+		}
+		return resp.Status
+	}
+
+	return ""
+}
+
+// badCredentialMessages are the lowercased messages GitHub responds with on 403 when the credential itself is unusable.
+var badCredentialMessages = []string{
+	"bad credentials",
+	"suspended",
+}
+
+// isRateLimitResponse returns true when the 403 response is due to the primary or the secondary rate limit.
+// The response body is read to find the rate limit message and then restored for the caller.
+func isRateLimitResponse(resp *http.Response) bool {
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+
+	return strings.Contains(responseMessage(resp), "rate limit")
+}
+
+// isBadCredentialResponse returns true when the 403 response tells that the credential is bad or suspended.
+// The response body is read to find the message and then restored for the caller.
+func isBadCredentialResponse(resp *http.Response) bool {
+	message := responseMessage(resp)
+
+	for _, m := range badCredentialMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseMessage returns the lowercased body of the response, which is restored for the caller.
+func responseMessage(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(string(body))
+}
+
+// cloneRequest returns a copy of the request to be sent again, with its body rewound.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body can't be rewound")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+
+	return r, nil
+}
@@ -0,0 +1,272 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// RunnerClient is an in-memory fake of the subset of the GitHub client the runner graceful stop process uses,
+// so that reconcilation logics can be unit tested without a real GitHub or a fake GitHub API server.
+//
+// By default, runners are listed, got, and removed from Runners, like GitHub would do.
+// Responses queued with e.g. QueueRemoveRunner take precedence, one per call in the queued order,
+// so that a test can make the first RemoveRunner call fail with 422 and the next one succeed.
+type RunnerClient struct {
+	// Runners is the runners registered to GitHub.
+	Runners []*github.Runner
+
+	// RunnerGroupIDs is the IDs of the runner groups by name, returned by GetRunnerGroupIDByName.
+	RunnerGroupIDs map[string]int64
+
+	// RateLimitRetryDelay is returned by RetryDelayOnRateLimit when the rate limit error doesn't tell when the rate limit resets.
+	// Zero means the default delay passed by the caller.
+	RateLimitRetryDelay time.Duration
+
+	mu sync.Mutex
+
+	listRunnersResponses  []listRunnersResponse
+	getRunnerResponses    []getRunnerResponse
+	removeRunnerResponses []error
+
+	calls []Call
+}
+
+// Call is a call made to RunnerClient.
+type Call struct {
+	Method     string
+	Enterprise string
+	Org        string
+	Repo       string
+
+	// RunnerID is the ID of the runner, for GetRunnerByID and RemoveRunner.
+	RunnerID int64
+
+	// GroupID is the ID of the runner group, for ListRunnersInGroup.
+	GroupID int64
+}
+
+type listRunnersResponse struct {
+	runners []*github.Runner
+	err     error
+}
+
+type getRunnerResponse struct {
+	runner *github.Runner
+	err    error
+}
+
+// NewRunnerClient returns a RunnerClient with the runners registered.
+func NewRunnerClient(runners ...*github.Runner) *RunnerClient {
+	return &RunnerClient{Runners: runners}
+}
+
+// NewRunner returns an online runner.
+func NewRunner(id int64, name string, busy bool) *github.Runner {
+	return &github.Runner{
+		ID:     github.Int64(id),
+		Name:   github.String(name),
+		OS:     github.String("linux"),
+		Status: github.String("online"),
+		Busy:   github.Bool(busy),
+	}
+}
+
+// QueueListRunners makes a future ListRunnersInGroup call return the runners or the error, instead of Runners.
+func (c *RunnerClient) QueueListRunners(runners []*github.Runner, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listRunnersResponses = append(c.listRunnersResponses, listRunnersResponse{runners: runners, err: err})
+}
+
+// QueueGetRunnerByID makes a future GetRunnerByID call return the runner or the error, instead of the one in Runners.
+func (c *RunnerClient) QueueGetRunnerByID(runner *github.Runner, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.getRunnerResponses = append(c.getRunnerResponses, getRunnerResponse{runner: runner, err: err})
+}
+
+// QueueRemoveRunner makes a future RemoveRunner call return the error without removing the runner from Runners.
+// A nil error makes the call succeed without removing the runner, which is useful to simulate GitHub's eventual consistency.
+func (c *RunnerClient) QueueRemoveRunner(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeRunnerResponses = append(c.removeRunnerResponses, err)
+}
+
+// Calls returns the calls made to the method, like "RemoveRunner", in the order they were made.
+// An empty method returns all the calls.
+func (c *RunnerClient) Calls(method string) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var calls []Call
+
+	for _, call := range c.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+func (c *RunnerClient) ListRunnersInGroup(ctx context.Context, enterprise, org, repo string, groupID int64) ([]*github.Runner, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: "ListRunnersInGroup", Enterprise: enterprise, Org: org, Repo: repo, GroupID: groupID})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(c.listRunnersResponses) > 0 {
+		res := c.listRunnersResponses[0]
+		c.listRunnersResponses = c.listRunnersResponses[1:]
+
+		return res.runners, res.err
+	}
+
+	return append([]*github.Runner{}, c.Runners...), nil
+}
+
+func (c *RunnerClient) GetRunnerByID(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Runner, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: "GetRunnerByID", Enterprise: enterprise, Org: org, Repo: repo, RunnerID: runnerID})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(c.getRunnerResponses) > 0 {
+		res := c.getRunnerResponses[0]
+		c.getRunnerResponses = c.getRunnerResponses[1:]
+
+		return res.runner, res.err
+	}
+
+	for _, r := range c.Runners {
+		if r.GetID() == runnerID {
+			return r, nil
+		}
+	}
+
+	// Like github.Client, a missing runner isn't an error
+	return nil, nil
+}
+
+func (c *RunnerClient) RemoveRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: "RemoveRunner", Enterprise: enterprise, Org: org, Repo: repo, RunnerID: runnerID})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(c.removeRunnerResponses) > 0 {
+		err := c.removeRunnerResponses[0]
+		c.removeRunnerResponses = c.removeRunnerResponses[1:]
+
+		return err
+	}
+
+	for i, r := range c.Runners {
+		if r.GetID() != runnerID {
+			continue
+		}
+
+		if r.GetBusy() {
+			return NewBusyRunnerError(r.GetName())
+		}
+
+		c.Runners = append(c.Runners[:i:i], c.Runners[i+1:]...)
+
+		return nil
+	}
+
+	return NewErrorResponse(http.MethodDelete, http.StatusNotFound, "Not Found")
+}
+
+func (c *RunnerClient) GetRunnerGroupIDByName(ctx context.Context, enterprise, org, name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: "GetRunnerGroupIDByName", Enterprise: enterprise, Org: org})
+
+	id, ok := c.RunnerGroupIDs[name]
+	if !ok {
+		return 0, fmt.Errorf("runner group %q not found", name)
+	}
+
+	return id, nil
+}
+
+// RetryDelayOnRateLimit returns the duration until the rate limit resets when err is a RateLimitError,
+// and RateLimitRetryDelay or defaultDelay otherwise.
+func (c *RunnerClient) RetryDelayOnRateLimit(err error, now time.Time, defaultDelay time.Duration) time.Duration {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if d := rateLimitErr.Rate.Reset.Time.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	if c.RateLimitRetryDelay > 0 {
+		return c.RateLimitRetryDelay
+	}
+
+	return defaultDelay
+}
+
+// NewErrorResponse returns the error go-github returns when GitHub API responds with the status.
+func NewErrorResponse(method string, status int, message string) error {
+	return &github.ErrorResponse{
+		Response: newResponse(method, status),
+		Message:  message,
+	}
+}
+
+// NewBusyRunnerError returns the error GitHub API responds with when removing a runner that's running a job.
+func NewBusyRunnerError(name string) error {
+	return NewErrorResponse(http.MethodDelete, http.StatusUnprocessableEntity, fmt.Sprintf("Bad request - Runner %q is still running a job", name))
+}
+
+// NewRateLimitError returns the error go-github returns when the primary rate limit is exceeded until reset.
+func NewRateLimitError(reset time.Time) error {
+	return &github.RateLimitError{
+		Rate: github.Rate{
+			Limit:     5000,
+			Remaining: 0,
+			Reset:     github.Timestamp{Time: reset},
+		},
+		Response: newResponse(http.MethodGet, http.StatusForbidden),
+		Message:  "API rate limit exceeded",
+	}
+}
+
+func newResponse(method string, status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{},
+		// go-github's errors include the request method and URL in their messages
+		Request: &http.Request{
+			Method: method,
+			URL:    &url.URL{Scheme: "https", Host: "api.github.com", Path: "/"},
+		},
+	}
+}
@@ -2,23 +2,30 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"github.com/actions-runner-controller/actions-runner-controller/hash"
 	"github.com/actions-runner-controller/actions-runner-controller/logging"
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/go-logr/logr"
 	"github.com/google/go-github/v39/github"
 	"github.com/gregjones/httpcache"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 )
 
+// DefaultRequestTimeout is the default timeout of each GitHub API request.
+const DefaultRequestTimeout = 30 * time.Second
+
 // Config contains configuration for Github client
 type Config struct {
 	EnterpriseURL     string `split_words:"true"`
@@ -32,6 +39,64 @@ type Config struct {
 	BasicauthPassword string `split_words:"true"`
 	RunnerGitHubURL   string `split_words:"true"`
 
+	// ListRunnersCacheTTL is the duration ListRunners results are cached in-memory per enterprise/organization/repository.
+	// Zero or a negative value disables the cache.
+	ListRunnersCacheTTL time.Duration `split_words:"true"`
+
+	// ListRunnersRevalidate makes ListRunners revalidate the HTTP-cached response with a conditional request on every API call,
+	// instead of trusting the cached response for the max-age of the Cache-Control header GitHub returns, which is usually 60 seconds.
+	// This reduces the chance of acting on a stale busy status of a runner. A conditional request answered with 304 Not Modified
+	// doesn't count against the rate limit.
+	// Note that this doesn't affect the in-memory cache configured by ListRunnersCacheTTL.
+	ListRunnersRevalidate bool `split_words:"true"`
+
+	// RequestTimeout is the timeout of each GitHub API request, so that e.g. a hung connection doesn't stall
+	// the caller for as long as the caller's context allows.
+	// Zero defaults to DefaultRequestTimeout, and a negative value disables the timeout.
+	RequestTimeout time.Duration `split_words:"true"`
+
+	// Transport is the base transport GitHub API requests are sent with, like one instrumented for distributed tracing.
+	// The authentication, caching, logging, and rate limit metrics transports are layered on top of it.
+	// Defaults to http.DefaultTransport.
+	Transport http.RoundTripper `ignored:"true"`
+
+	// ProxyURL is the URL of the proxy GitHub API requests are sent through, like "http://proxy.example.com:3128"
+	// or "socks5://proxy.example.com:1080". The scheme must be one of http, https, and socks5.
+	// When set, it takes precedence over the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables,
+	// so that e.g. clients for github.com and GitHub Enterprise Server can egress through different proxies.
+	// It's applied to the Transport, which then needs to be either nil or an *http.Transport.
+	// Empty means the proxy is configured via the environment variables.
+	ProxyURL string `split_words:"true"`
+
+	// ProxyUsername and ProxyPassword are the credentials to authenticate with the proxy at ProxyURL.
+	// They take precedence over the ones in ProxyURL, if any.
+	ProxyUsername string `split_words:"true"`
+	ProxyPassword string `split_words:"true"`
+
+	// RateLimitRetryDelay is the delay before retrying a GitHub API call that failed due to the rate limit,
+	// used only when GitHub doesn't tell when the rate limit resets.
+	// This allows e.g. a GitHub Enterprise Server with a larger rate limit budget to be retried sooner than github.com.
+	// Zero means that the caller's default is used.
+	RateLimitRetryDelay time.Duration `split_words:"true"`
+
+	// CircuitBreakerFailureThreshold is the number of consecutive GitHub API requests failed with a network error,
+	// a timeout, or a 5xx response within CircuitBreakerWindow, after which the client stops calling GitHub API
+	// for CircuitBreakerCooldown and fails calls with ErrCircuitOpen instead.
+	// Zero defaults to DefaultCircuitBreakerFailureThreshold, and a negative value disables the circuit breaker.
+	CircuitBreakerFailureThreshold int `split_words:"true"`
+
+	// CircuitBreakerWindow is the window the consecutive failures need to happen within to open the circuit breaker.
+	// Zero defaults to DefaultCircuitBreakerWindow.
+	CircuitBreakerWindow time.Duration `split_words:"true"`
+
+	// CircuitBreakerCooldown is the duration the circuit breaker stays open before letting a probe request through.
+	// Zero defaults to DefaultCircuitBreakerCooldown.
+	CircuitBreakerCooldown time.Duration `split_words:"true"`
+
+	// FallbackCredentials are the credentials the client fails over to, in order, when GitHub rejects the current one,
+	// like when the private key of the GitHub App is revoked. See failoverTransport for details.
+	FallbackCredentials []Credential `ignored:"true"`
+
 	Log *logr.Logger
 }
 
@@ -42,55 +107,235 @@ type Client struct {
 	mu        sync.Mutex
 	// GithubBaseURL to Github without API suffix.
 	GithubBaseURL string
+
+	runnersCache    map[string]*runnersCacheEntry
+	runnersCacheTTL time.Duration
+	runnersCacheMu  sync.Mutex
+
+	// listRunnersGroup deduplicates concurrent ListRunners API calls for the same enterprise/organization/repository.
+	listRunnersGroup singleflight.Group
+
+	// runnersBusy is the busy status of each runner seen in the last ListRunners API call, keyed by the enterprise/organization/repository.
+	runnersBusy   map[string]map[int64]bool
+	runnersBusyMu sync.Mutex
+
+	// runnerGroupIDs is the ID of each runner group resolved by GetRunnerGroupIDByName, keyed by the enterprise/organization and the group name.
+	runnerGroupIDs   map[string]int64
+	runnerGroupIDsMu sync.Mutex
+
+	listRunnersRevalidate bool
+
+	requestTimeout time.Duration
+
+	rateLimitRetryDelay time.Duration
+
+	// config is the config the client was created from, used to derive clients for other GitHub Enterprise Server instances.
+	config Config
+}
+
+type runnersCacheEntry struct {
+	runners   []*github.Runner
+	expiresAt time.Time
 }
 
 type BasicAuthTransport struct {
 	Username string
 	Password string
+
+	// Transport is the transport the authenticated requests are sent with. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 func (p BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.SetBasicAuth(p.Username, p.Password)
-	return http.DefaultTransport.RoundTrip(req)
+
+	transport := p.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return transport.RoundTrip(req)
 }
 
-// NewClient creates a Github Client
-func (c *Config) NewClient() (*Client, error) {
-	var transport http.RoundTripper
-	if len(c.BasicauthUsername) > 0 && len(c.BasicauthPassword) > 0 {
-		transport = BasicAuthTransport{Username: c.BasicauthUsername, Password: c.BasicauthPassword}
-	} else if len(c.Token) > 0 {
-		transport = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.Token})).Transport
+func (c *Config) baseTransport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return c.Transport
+}
+
+// proxyTransport returns a copy of the base transport that sends requests through the proxy at ProxyURL.
+func (c *Config) proxyTransport() (http.RoundTripper, error) {
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: scheme must be one of http, https, and socks5", c.ProxyURL)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: missing host", c.ProxyURL)
+	}
+
+	if len(c.ProxyUsername) > 0 {
+		proxyURL.User = url.UserPassword(c.ProxyUsername, c.ProxyPassword)
+	}
+
+	base, ok := c.baseTransport().(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("proxy url can't be applied to the custom transport of type %T: it must be an *http.Transport", c.baseTransport())
+	}
+
+	tr := base.Clone()
+	tr.Proxy = http.ProxyURL(proxyURL)
+
+	return tr, nil
+}
+
+// credential returns a non-secret identifier of the primary credential the client authenticates with.
+func (c *Config) credential() string {
+	return c.primaryCredential().id()
+}
+
+// primaryCredential returns the credential configured directly in the config.
+func (c *Config) primaryCredential() Credential {
+	return Credential{
+		AppID:             c.AppID,
+		AppInstallationID: c.AppInstallationID,
+		AppPrivateKey:     c.AppPrivateKey,
+		Token:             c.Token,
+		BasicauthUsername: c.BasicauthUsername,
+		BasicauthPassword: c.BasicauthPassword,
+	}
+}
+
+// credentials returns the primary credential followed by the fallback credentials, in the order they're tried.
+func (c *Config) credentials() []Credential {
+	return append([]Credential{c.primaryCredential()}, c.FallbackCredentials...)
+}
+
+// authTransport returns the transport that authenticates requests with the credential.
+func (c *Config) authTransport(cred Credential) (http.RoundTripper, error) {
+	if len(cred.BasicauthUsername) > 0 && len(cred.BasicauthPassword) > 0 {
+		return BasicAuthTransport{Username: cred.BasicauthUsername, Password: cred.BasicauthPassword, Transport: c.Transport}, nil
+	} else if len(cred.Token) > 0 {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: c.baseTransport()})
+		return oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cred.Token})).Transport, nil
+	}
+
+	return c.installationTransport(cred)
+}
+
+// installationTransports caches GitHub App installation transports, keyed by the app ID, the installation ID,
+// the private key, and the API base URL.
+// Each transport caches its installation token and refreshes it only when it's about to expire,
+// so sharing the transport across clients keeps every client from minting its own installation token.
+var (
+	installationTransports   = map[string]*ghinstallation.Transport{}
+	installationTransportsMu sync.Mutex
+)
+
+// installationTransport returns the GitHub App installation transport for the credential, reusing the cached one if any.
+func (c *Config) installationTransport(cred Credential) (*ghinstallation.Transport, error) {
+	var baseURL string
+
+	if len(c.EnterpriseURL) > 0 {
+		githubAPIURL, err := getEnterpriseApiUrl(c.EnterpriseURL)
+		if err != nil {
+			return nil, fmt.Errorf("enterprise url incorrect: %v", err)
+		}
+		baseURL = githubAPIURL
+	} else if len(c.URL) > 0 {
+		// Otherwise the installation token is minted via api.github.com, bypassing e.g. a path-rewriting proxy in front of GitHub API.
+		// Trim the trailing slash, as ghinstallation adds one before the token endpoint.
+		baseURL = strings.TrimSuffix(c.URL, "/")
+	}
+
+	key := fmt.Sprintf("%d/%d/%s/%s", cred.AppID, cred.AppInstallationID, hash.FNVHashStringObjects(cred.AppPrivateKey), baseURL)
+
+	// A transport built on a custom base transport isn't cached, as we can't tell if two base transports are the same.
+	cacheable := c.Transport == nil
+
+	installationTransportsMu.Lock()
+	defer installationTransportsMu.Unlock()
+
+	if tr, ok := installationTransports[key]; ok && cacheable {
+		return tr, nil
+	}
+
+	var tr *ghinstallation.Transport
+
+	if _, err := os.Stat(cred.AppPrivateKey); err == nil {
+		tr, err = ghinstallation.NewKeyFromFile(c.baseTransport(), cred.AppID, cred.AppInstallationID, cred.AppPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("authentication failed: using private key at %s: %v", cred.AppPrivateKey, err)
+		}
 	} else {
-		var tr *ghinstallation.Transport
+		tr, err = ghinstallation.New(c.baseTransport(), cred.AppID, cred.AppInstallationID, []byte(cred.AppPrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("authentication failed: using private key of size %d (%s...): %v", len(cred.AppPrivateKey), strings.Split(cred.AppPrivateKey, "\n")[0], err)
+		}
+	}
 
-		if _, err := os.Stat(c.AppPrivateKey); err == nil {
-			tr, err = ghinstallation.NewKeyFromFile(http.DefaultTransport, c.AppID, c.AppInstallationID, c.AppPrivateKey)
-			if err != nil {
-				return nil, fmt.Errorf("authentication failed: using private key at %s: %v", c.AppPrivateKey, err)
-			}
-		} else {
-			tr, err = ghinstallation.New(http.DefaultTransport, c.AppID, c.AppInstallationID, []byte(c.AppPrivateKey))
-			if err != nil {
-				return nil, fmt.Errorf("authentication failed: using private key of size %d (%s...): %v", len(c.AppPrivateKey), strings.Split(c.AppPrivateKey, "\n")[0], err)
-			}
+	if baseURL != "" {
+		tr.BaseURL = baseURL
+	}
+
+	if cacheable {
+		installationTransports[key] = tr
+	}
+
+	return tr, nil
+}
+
+// NewClient creates a Github Client
+func (c *Config) NewClient() (*Client, error) {
+	if len(c.ProxyURL) > 0 {
+		tr, err := c.proxyTransport()
+		if err != nil {
+			return nil, err
 		}
 
-		if len(c.EnterpriseURL) > 0 {
-			githubAPIURL, err := getEnterpriseApiUrl(c.EnterpriseURL)
-			if err != nil {
-				return nil, fmt.Errorf("enterprise url incorrect: %v", err)
-			}
-			tr.BaseURL = githubAPIURL
+		// The proxy is baked into the transport, which clients derived by WithEnterpriseURL inherit as well.
+		conf := *c
+		conf.Transport = tr
+		conf.ProxyURL = ""
+		conf.ProxyUsername = ""
+		conf.ProxyPassword = ""
+
+		return conf.NewClient()
+	}
+
+	var transport http.RoundTripper
+	if len(c.FallbackCredentials) == 0 {
+		tr, err := c.authTransport(c.primaryCredential())
+		if err != nil {
+			return nil, err
+		}
+		transport = metrics.Transport{Transport: tr, Credential: c.credential()}
+	} else {
+		tr, err := c.failoverTransport()
+		if err != nil {
+			return nil, err
 		}
 		transport = tr
 	}
 
+	// The circuit breaker is underneath the cache, so that fresh cached responses are still served while it's open.
+	if b := c.circuitBreaker(); b != nil {
+		transport = circuitBreakerTransport{Transport: transport, Breaker: b}
+	}
+
 	cached := httpcache.NewTransport(httpcache.NewMemoryCache())
 	cached.Transport = transport
-	loggingTransport := logging.Transport{Transport: cached, Log: c.Log}
-	metricsTransport := metrics.Transport{Transport: loggingTransport}
-	httpClient := &http.Client{Transport: metricsTransport}
+	revalidatingTransport := revalidatingTransport{Transport: cached}
+	loggingTransport := logging.Transport{Transport: revalidatingTransport, Log: c.Log}
+	httpClient := &http.Client{Transport: loggingTransport}
 
 	var client *github.Client
 	var githubBaseURL string
@@ -138,13 +383,199 @@ func (c *Config) NewClient() (*Client, error) {
 	client.UserAgent = "actions-runner-controller"
 
 	return &Client{
-		Client:        client,
-		regTokens:     map[string]*github.RegistrationToken{},
-		mu:            sync.Mutex{},
-		GithubBaseURL: githubBaseURL,
+		Client:          client,
+		regTokens:       map[string]*github.RegistrationToken{},
+		mu:              sync.Mutex{},
+		GithubBaseURL:   githubBaseURL,
+		runnersCache:    map[string]*runnersCacheEntry{},
+		runnersCacheTTL: c.ListRunnersCacheTTL,
+		runnersBusy:     map[string]map[int64]bool{},
+		runnerGroupIDs:  map[string]int64{},
+		requestTimeout:  c.requestTimeout(),
+		config:          *c,
+
+		listRunnersRevalidate: c.ListRunnersRevalidate,
+		rateLimitRetryDelay:   c.RateLimitRetryDelay,
 	}, nil
 }
 
+type revalidateContextKey struct{}
+
+// withRevalidation returns a context that makes revalidatingTransport revalidate the HTTP-cached response of the request.
+func withRevalidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, revalidateContextKey{}, true)
+}
+
+// revalidatingTransport makes the HTTP cache underneath revalidate the cached response with a conditional request,
+// for requests made with a context returned by withRevalidation.
+type revalidatingTransport struct {
+	Transport http.RoundTripper
+}
+
+func (t revalidatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if revalidate, _ := req.Context().Value(revalidateContextKey{}).(bool); revalidate {
+		req = req.Clone(req.Context())
+		// Unlike no-cache, max-age=0 makes httpcache send a conditional request with the ETag of the cached response.
+		req.Header.Set("Cache-Control", "max-age=0")
+	}
+
+	return t.Transport.RoundTrip(req)
+}
+
+func (c *Config) requestTimeout() time.Duration {
+	if c.RequestTimeout == 0 {
+		return DefaultRequestTimeout
+	}
+
+	return c.RequestTimeout
+}
+
+// withRequestTimeout returns a context for a single GitHub API request, derived from ctx.
+// The context is canceled either after the request timeout or when ctx is done, whichever comes first.
+func (c *Client) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.requestTimeout)
+}
+
+// RetryDelayOnRateLimit returns how long to wait before retrying the GitHub API call that failed with err due to the rate limit.
+// It prefers the delay GitHub asked for along with the error, see RetryAfter,
+// and falls back to the client's RateLimitRetryDelay, or defaultDelay when the client has none.
+func (c *Client) RetryDelayOnRateLimit(err error, now time.Time, defaultDelay time.Duration) time.Duration {
+	if d, ok := RetryAfter(err, now); ok {
+		return d
+	}
+
+	if c != nil && c.rateLimitRetryDelay > 0 {
+		return c.rateLimitRetryDelay
+	}
+
+	return defaultDelay
+}
+
+// IsRateLimitError returns true when err is due to either the primary or the secondary rate limit of GitHub API.
+func IsRateLimitError(err error) bool {
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseRateLimitErr) {
+		return true
+	}
+
+	// go-github recognizes a secondary rate limit error only by its former documentation URL ending with #abuse-rate-limits.
+	var errRes *github.ErrorResponse
+
+	return errors.As(err, &errRes) && errRes.Response != nil && errRes.Response.StatusCode == http.StatusForbidden &&
+		strings.HasSuffix(errRes.DocumentationURL, "#secondary-rate-limits")
+}
+
+// RetryAfter returns how long GitHub asked to wait before retrying the API call that failed with err.
+// That's the Retry-After header of a secondary rate limit error or any other error response, like a 429 from a proxy,
+// or the X-RateLimit-Reset header of a primary rate limit error.
+// For an error due to the open circuit breaker, it's the remaining cooldown.
+// The second return value is false when the error response has none of them, or the reset time has already passed.
+func RetryAfter(err error, now time.Time) (time.Duration, bool) {
+	var circuitOpenErr *CircuitOpenError
+	if errors.As(err, &circuitOpenErr) {
+		if circuitOpenErr.Until.After(now) {
+			return circuitOpenErr.Until.Sub(now), true
+		}
+
+		return 0, false
+	}
+
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if reset := rateLimitErr.Rate.Reset.Time; reset.After(now) {
+			return reset.Sub(now), true
+		}
+
+		return 0, false
+	}
+
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseRateLimitErr) {
+		if d := abuseRateLimitErr.RetryAfter; d != nil && *d > 0 {
+			return *d, true
+		}
+
+		return 0, false
+	}
+
+	var errRes *github.ErrorResponse
+	if errors.As(err, &errRes) && errRes.Response != nil {
+		return parseRetryAfter(errRes.Response.Header.Get("Retry-After"), now)
+	}
+
+	return 0, false
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// enterpriseClients caches clients derived by WithEnterpriseURL, keyed by the GitHub Enterprise Server URL and the credential.
+var (
+	enterpriseClients   = map[string]*Client{}
+	enterpriseClientsMu sync.Mutex
+)
+
+// WithEnterpriseURL returns the client for the GitHub Enterprise Server at the URL, authenticating with the same credential as c.
+// The API base URL and the upload URL are derived from the enterprise URL as GITHUB_ENTERPRISE_URL does.
+// It returns c itself when the URL is empty or the same as the one c is for.
+//
+// Derived clients are cached by the URL and the credential, so that calling this on every reconcilation
+// doesn't rebuild the client and lose its registration token and ListRunners caches.
+func (c *Client) WithEnterpriseURL(enterpriseURL string) (*Client, error) {
+	if enterpriseURL == "" || enterpriseURL == c.config.EnterpriseURL {
+		return c, nil
+	}
+
+	conf := c.config
+	conf.EnterpriseURL = enterpriseURL
+	conf.URL = ""
+	conf.UploadURL = ""
+	conf.RunnerGitHubURL = ""
+
+	// Note that FNVHashStringObjects hashes only the last object, so we hash all the credentials as one slice.
+	key := enterpriseURL + "/" + hash.FNVHashStringObjects(conf.credentials())
+
+	enterpriseClientsMu.Lock()
+	defer enterpriseClientsMu.Unlock()
+
+	if client, ok := enterpriseClients[key]; ok {
+		return client, nil
+	}
+
+	client, err := conf.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	enterpriseClients[key] = client
+
+	return client, nil
+}
+
 // GetRegistrationToken returns a registration token tied with the name of repository and runner.
 func (c *Client) GetRegistrationToken(ctx context.Context, enterprise, org, repo, name string) (*github.RegistrationToken, error) {
 	c.mu.Lock()
@@ -184,6 +615,52 @@ func (c *Client) GetRegistrationToken(ctx context.Context, enterprise, org, repo
 	return rt, nil
 }
 
+// JITRunnerConfig is the just-in-time configuration of a runner, returned by GenerateJITConfig.
+type JITRunnerConfig struct {
+	// Runner is the runner GitHub has registered for the configuration.
+	Runner *github.Runner `json:"runner"`
+
+	// EncodedJITConfig is the configuration to be passed to the runner via `run.sh --jitconfig`.
+	EncodedJITConfig string `json:"encoded_jit_config"`
+}
+
+// GenerateJITConfig registers a runner with the name and returns its just-in-time configuration.
+// Unlike a registration token, the configuration can configure only the runner, which GitHub removes after it ran a job,
+// so the runner never holds a long-lived credential.
+//
+// runnerGroupID is ignored for repository runners, as runner groups are available only to enterprises and organizations.
+func (c *Client) GenerateJITConfig(ctx context.Context, enterprise, org, repo, name string, runnerGroupID int64, labels []string, workFolder string) (*JITRunnerConfig, error) {
+	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The API requires a runner group even for repository runners, where 1 is the default one.
+	if runnerGroupID == 0 || len(repo) > 0 {
+		runnerGroupID = 1
+	}
+
+	config, res, err := c.generateJITConfig(ctx, enterprise, owner, repo, &jitConfigRequest{
+		Name:          name,
+		RunnerGroupID: runnerGroupID,
+		Labels:        labels,
+		WorkFolder:    workFolder,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate jit config: %w", err)
+	}
+
+	if res.StatusCode != 201 {
+		return nil, fmt.Errorf("unexpected status: %d", res.StatusCode)
+	}
+
+	c.invalidateRunnersCache(enterprise, owner, repo)
+
+	return config, nil
+}
+
 // RemoveRunner removes a runner with specified runner ID from repository.
 func (c *Client) RemoveRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) error {
 	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
@@ -202,10 +679,38 @@ func (c *Client) RemoveRunner(ctx context.Context, enterprise, org, repo string,
 		return fmt.Errorf("unexpected status: %d", res.StatusCode)
 	}
 
+	c.invalidateRunnersCache(enterprise, owner, repo)
+
 	return nil
 }
 
+// GetRunnerByID returns the runner with the specified runner ID.
+// Unlike ListRunners, this calls the get-single-runner API so that you don't need to list all the runners to get one.
+// It returns nil without an error when the runner is not found.
+func (c *Client) GetRunnerByID(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Runner, error) {
+	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	runner, res, err := c.getRunner(ctx, enterprise, owner, repo, runnerID)
+
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get runner: %w", err)
+	}
+
+	return runner, nil
+}
+
 // ListRunners returns a list of runners of specified owner/repository name.
+//
+// The result is cached for Config.ListRunnersCacheTTL per enterprise/organization/repository,
+// so that e.g. getting many runners in the same scope results in only one API call.
 func (c *Client) ListRunners(ctx context.Context, enterprise, org, repo string) ([]*github.Runner, error) {
 	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
 
@@ -213,14 +718,111 @@ func (c *Client) ListRunners(ctx context.Context, enterprise, org, repo string)
 		return nil, err
 	}
 
+	if runners, ok := c.getCachedRunners(enterprise, owner, repo); ok {
+		metrics.IncListRunnersCacheHits()
+		return runners, nil
+	}
+
+	// Concurrent calls for the same scope share one in-flight API call, as many reconciles can ask for the same runners
+	// at once, like during a scale event, before the cache is populated.
+	// Note that the context of the call that started the in-flight API call is used for it.
+	v, err, _ := c.listRunnersGroup.Do(getRegistrationKey(owner, repo, enterprise), func() (interface{}, error) {
+		return c.listAllRunners(ctx, enterprise, owner, repo)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]*github.Runner), nil
+}
+
+// listAllRunners lists all the runners of the scope page by page, and caches them.
+func (c *Client) listAllRunners(ctx context.Context, enterprise, owner, repo string) ([]*github.Runner, error) {
 	var runners []*github.Runner
 
+	if c.listRunnersRevalidate {
+		ctx = withRevalidation(ctx)
+	}
+
 	opts := github.ListOptions{PerPage: 100}
 	for {
 		list, res, err := c.listRunners(ctx, enterprise, owner, repo, &opts)
 
 		if err != nil {
-			return runners, fmt.Errorf("failed to list runners: %w", err)
+			// We don't return the runners fetched so far, because callers like the runner unregistration
+			// can misbehave on an incomplete list, e.g. by missing a busy runner.
+			return nil, fmt.Errorf("failed to list runners: %w", err)
+		}
+
+		runners = append(runners, list.Runners...)
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	c.setCachedRunners(enterprise, owner, repo, runners)
+	c.observeRunnersBusy(enterprise, owner, repo, runners)
+
+	return runners, nil
+}
+
+// observeRunnersBusy records the busy status of the runners, and counts runners whose busy status flipped
+// since the last ListRunners API call for the same enterprise/organization/repository.
+// This quantifies how often a busy-status decision made on a cached response could have been wrong.
+// It returns the number of flipped runners.
+func (c *Client) observeRunnersBusy(enterprise, org, repo string, runners []*github.Runner) int {
+	key := getRegistrationKey(org, repo, enterprise)
+
+	busy := make(map[int64]bool, len(runners))
+	for _, r := range runners {
+		busy[r.GetID()] = r.GetBusy()
+	}
+
+	c.runnersBusyMu.Lock()
+	prev := c.runnersBusy[key]
+	c.runnersBusy[key] = busy
+	c.runnersBusyMu.Unlock()
+
+	var flips int
+	for id, b := range busy {
+		if p, ok := prev[id]; ok && p != b {
+			flips++
+		}
+	}
+
+	metrics.AddRunnerBusyStatusFlips(flips)
+
+	return flips
+}
+
+// ListRunnersInGroup returns a list of runners that belong to the runner group of the specified ID.
+//
+// Runner groups are available only to enterprise and organization runners.
+// For repository runners, or when groupID is zero, this is equivalent to ListRunners.
+//
+// Note that there's no group-scoped variant of RemoveRunner, because removing a runner from a runner group via the API
+// only moves the runner back to the default group without unregistering it.
+// A runner found by this function can be unregistered by calling RemoveRunner with the same enterprise or organization.
+func (c *Client) ListRunnersInGroup(ctx context.Context, enterprise, org, repo string, groupID int64) ([]*github.Runner, error) {
+	if groupID == 0 || len(repo) > 0 {
+		return c.ListRunners(ctx, enterprise, org, repo)
+	}
+
+	enterprise, owner, _, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var runners []*github.Runner
+
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		list, res, err := c.listRunnerGroupRunners(ctx, enterprise, owner, groupID, &opts)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list runners in runner group %d: %w", groupID, err)
 		}
 
 		runners = append(runners, list.Runners...)
@@ -233,6 +835,85 @@ func (c *Client) ListRunners(ctx context.Context, enterprise, org, repo string)
 	return runners, nil
 }
 
+// GetRunnerGroupIDByName returns the ID of the enterprise or organization runner group with the name.
+// Runner group IDs never change, so the result is cached for the lifetime of the client.
+func (c *Client) GetRunnerGroupIDByName(ctx context.Context, enterprise, org, name string) (int64, error) {
+	enterprise, owner, _, err := getEnterpriseOrganizationAndRepo(enterprise, org, "")
+
+	if err != nil {
+		return 0, err
+	}
+
+	key := getRegistrationKey(owner, "", enterprise) + "/" + name
+
+	c.runnerGroupIDsMu.Lock()
+	defer c.runnerGroupIDsMu.Unlock()
+
+	if id, ok := c.runnerGroupIDs[key]; ok {
+		return id, nil
+	}
+
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		list, res, err := c.listRunnerGroups(ctx, enterprise, owner, &opts)
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to list runner groups: %w", err)
+		}
+
+		for _, g := range list.RunnerGroups {
+			if g.GetName() == name {
+				c.runnerGroupIDs[key] = g.GetID()
+				return g.GetID(), nil
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	return 0, fmt.Errorf("runner group %q not found", name)
+}
+
+func (c *Client) getCachedRunners(enterprise, org, repo string) ([]*github.Runner, bool) {
+	if c.runnersCacheTTL <= 0 {
+		return nil, false
+	}
+
+	c.runnersCacheMu.Lock()
+	defer c.runnersCacheMu.Unlock()
+
+	e, ok := c.runnersCache[getRegistrationKey(org, repo, enterprise)]
+	if !ok || e.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+
+	return e.runners, true
+}
+
+func (c *Client) setCachedRunners(enterprise, org, repo string, runners []*github.Runner) {
+	if c.runnersCacheTTL <= 0 {
+		return
+	}
+
+	c.runnersCacheMu.Lock()
+	defer c.runnersCacheMu.Unlock()
+
+	c.runnersCache[getRegistrationKey(org, repo, enterprise)] = &runnersCacheEntry{
+		runners:   runners,
+		expiresAt: time.Now().Add(c.runnersCacheTTL),
+	}
+}
+
+func (c *Client) invalidateRunnersCache(enterprise, org, repo string) {
+	c.runnersCacheMu.Lock()
+	defer c.runnersCacheMu.Unlock()
+
+	delete(c.runnersCache, getRegistrationKey(org, repo, enterprise))
+}
+
 // ListOrganizationRunnerGroups returns all the runner groups defined in the organization and
 // inherited to the organization from an enterprise.
 func (c *Client) ListOrganizationRunnerGroups(ctx context.Context, org string) ([]*github.RunnerGroup, error) {
@@ -240,7 +921,9 @@ func (c *Client) ListOrganizationRunnerGroups(ctx context.Context, org string) (
 
 	opts := github.ListOptions{PerPage: 100}
 	for {
-		list, res, err := c.Client.Actions.ListOrganizationRunnerGroups(ctx, org, &opts)
+		reqCtx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListOrganizationRunnerGroups"))
+		list, res, err := c.Client.Actions.ListOrganizationRunnerGroups(reqCtx, org, &opts)
+		cancel()
 		if err != nil {
 			return runnerGroups, fmt.Errorf("failed to list organization runner groups: %w", err)
 		}
@@ -260,7 +943,9 @@ func (c *Client) ListRunnerGroupRepositoryAccesses(ctx context.Context, org stri
 
 	opts := github.ListOptions{PerPage: 100}
 	for {
-		list, res, err := c.Client.Actions.ListRepositoryAccessRunnerGroup(ctx, org, runnerGroupId, &opts)
+		reqCtx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListRunnerGroupRepositoryAccesses"))
+		list, res, err := c.Client.Actions.ListRepositoryAccessRunnerGroup(reqCtx, org, runnerGroupId, &opts)
+		cancel()
 		if err != nil {
 			return nil, fmt.Errorf("failed to list repository access for runner group: %w", err)
 		}
@@ -292,6 +977,9 @@ func (c *Client) cleanup() {
 // so the calling functions don't need to switch and their code is a bit cleaner
 
 func (c *Client) createRegistrationToken(ctx context.Context, enterprise, org, repo string) (*github.RegistrationToken, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "CreateRegistrationToken"))
+	defer cancel()
+
 	if len(repo) > 0 {
 		return c.Client.Actions.CreateRegistrationToken(ctx, org, repo)
 	}
@@ -301,7 +989,43 @@ func (c *Client) createRegistrationToken(ctx context.Context, enterprise, org, r
 	return c.Client.Enterprise.CreateRegistrationToken(ctx, enterprise)
 }
 
+type jitConfigRequest struct {
+	Name          string   `json:"name"`
+	RunnerGroupID int64    `json:"runner_group_id"`
+	Labels        []string `json:"labels"`
+	WorkFolder    string   `json:"work_folder,omitempty"`
+}
+
+func (c *Client) generateJITConfig(ctx context.Context, enterprise, org, repo string, body *jitConfigRequest) (*JITRunnerConfig, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "GenerateJITConfig"))
+	defer cancel()
+
+	// go-github doesn't provide the generate-jitconfig API yet.
+	path := fmt.Sprintf("enterprises/%v/actions/runners/generate-jitconfig", enterprise)
+	if len(repo) > 0 {
+		path = fmt.Sprintf("repos/%v/%v/actions/runners/generate-jitconfig", org, repo)
+	} else if len(org) > 0 {
+		path = fmt.Sprintf("orgs/%v/actions/runners/generate-jitconfig", org)
+	}
+
+	req, err := c.Client.NewRequest("POST", path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := new(JITRunnerConfig)
+	res, err := c.Client.Do(ctx, req, config)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return config, res, nil
+}
+
 func (c *Client) removeRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "RemoveRunner"))
+	defer cancel()
+
 	if len(repo) > 0 {
 		return c.Client.Actions.RemoveRunner(ctx, org, repo, runnerID)
 	}
@@ -311,7 +1035,36 @@ func (c *Client) removeRunner(ctx context.Context, enterprise, org, repo string,
 	return c.Client.Enterprise.RemoveRunner(ctx, enterprise, runnerID)
 }
 
+func (c *Client) getRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Runner, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "GetRunner"))
+	defer cancel()
+
+	if len(repo) > 0 {
+		return c.Client.Actions.GetRunner(ctx, org, repo, runnerID)
+	}
+	if len(org) > 0 {
+		return c.Client.Actions.GetOrganizationRunner(ctx, org, runnerID)
+	}
+
+	// go-github doesn't provide the enterprise variant of the get-single-runner API yet.
+	req, err := c.Client.NewRequest("GET", fmt.Sprintf("enterprises/%v/actions/runners/%v", enterprise, runnerID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runner := new(github.Runner)
+	res, err := c.Client.Do(ctx, req, runner)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return runner, res, nil
+}
+
 func (c *Client) listRunners(ctx context.Context, enterprise, org, repo string, opts *github.ListOptions) (*github.Runners, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListRunners"))
+	defer cancel()
+
 	if len(repo) > 0 {
 		return c.Client.Actions.ListRunners(ctx, org, repo, opts)
 	}
@@ -321,6 +1074,56 @@ func (c *Client) listRunners(ctx context.Context, enterprise, org, repo string,
 	return c.Client.Enterprise.ListRunners(ctx, enterprise, opts)
 }
 
+func (c *Client) listRunnerGroupRunners(ctx context.Context, enterprise, org string, groupID int64, opts *github.ListOptions) (*github.Runners, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListRunnerGroupRunners"))
+	defer cancel()
+
+	if len(org) > 0 {
+		return c.Client.Actions.ListRunnerGroupRunners(ctx, org, groupID, opts)
+	}
+
+	// go-github doesn't provide the enterprise variant of the list-runners-in-group API yet.
+	u := fmt.Sprintf("enterprises/%v/actions/runner-groups/%v/runners?per_page=%d&page=%d", enterprise, groupID, opts.PerPage, opts.Page)
+
+	req, err := c.Client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runners := new(github.Runners)
+	res, err := c.Client.Do(ctx, req, runners)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return runners, res, nil
+}
+
+func (c *Client) listRunnerGroups(ctx context.Context, enterprise, org string, opts *github.ListOptions) (*github.RunnerGroups, *github.Response, error) {
+	ctx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListRunnerGroups"))
+	defer cancel()
+
+	if len(org) > 0 {
+		return c.Client.Actions.ListOrganizationRunnerGroups(ctx, org, opts)
+	}
+
+	// go-github doesn't provide the enterprise variant of the list-runner-groups API yet.
+	u := fmt.Sprintf("enterprises/%v/actions/runner-groups?per_page=%d&page=%d", enterprise, opts.PerPage, opts.Page)
+
+	req, err := c.Client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups := new(github.RunnerGroups)
+	res, err := c.Client.Do(ctx, req, groups)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return groups, res, nil
+}
+
 func (c *Client) ListRepositoryWorkflowRuns(ctx context.Context, user string, repoName string) ([]*github.WorkflowRun, error) {
 	queued, err := c.listRepositoryWorkflowRuns(ctx, user, repoName, "queued")
 	if err != nil {
@@ -351,7 +1154,9 @@ func (c *Client) listRepositoryWorkflowRuns(ctx context.Context, user string, re
 	}
 
 	for {
-		list, res, err := c.Client.Actions.ListRepositoryWorkflowRuns(ctx, user, repoName, &opts)
+		reqCtx, cancel := c.withRequestTimeout(metrics.WithOperation(ctx, "ListRepositoryWorkflowRuns"))
+		list, res, err := c.Client.Actions.ListRepositoryWorkflowRuns(reqCtx, user, repoName, &opts)
+		cancel()
 
 		if err != nil {
 			return workflowRuns, fmt.Errorf("failed to list workflow runs: %v", err)
@@ -367,7 +1172,11 @@ func (c *Client) listRepositoryWorkflowRuns(ctx context.Context, user string, re
 	return workflowRuns, nil
 }
 
-// Validates enterprise, organization and repo arguments. Both are optional, but at least one should be specified
+// getEnterpriseOrganizationAndRepo validates enterprise, organization and repo arguments and returns the scope of the runners to call GitHub API for.
+// All are optional, but at least one should be specified.
+// The narrowest non-empty one of the repository, the organization, and the enterprise wins, and the others are returned empty,
+// so that callers can branch on whichever is non-empty in the same order.
+// The repository is split into the owner, returned as the organization, and the repository name.
 func getEnterpriseOrganizationAndRepo(enterprise, org, repo string) (string, string, string, error) {
 	if len(repo) > 0 {
 		owner, repository, err := splitOwnerAndRepo(repo)
@@ -2,8 +2,21 @@ package github
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -102,6 +115,387 @@ func TestListRunners(t *testing.T) {
 	}
 }
 
+func TestListRunnersCache(t *testing.T) {
+	var listCalls int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		listCalls++
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	mux.HandleFunc("/repos/test/valid/actions/runners/1", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := Config{
+		Token:               "token",
+		ListRunnersCacheTTL: time.Minute,
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.ListRunners(ctx, "", "", "test/valid"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if listCalls != 1 {
+		t.Errorf("unexpected number of ListRunners API calls: want 1, got %d", listCalls)
+	}
+
+	if err := client.RemoveRunner(ctx, "", "", "test/valid", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := client.ListRunners(ctx, "", "", "test/valid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listCalls != 2 {
+		t.Errorf("RemoveRunner did not invalidate the cache: want 2 ListRunners API calls, got %d", listCalls)
+	}
+}
+
+func TestListRunnersDeduplication(t *testing.T) {
+	var listCalls int32
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/valid/actions/runners", func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&listCalls, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The in-memory cache is disabled so that only the deduplication can save API calls.
+	client, err := (&Config{Token: "token"}).NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			runners, err := client.ListRunners(context.Background(), "", "", "test/valid")
+			if err == nil && len(runners) == 0 {
+				err = errors.New("no runners returned")
+			}
+			errs <- err
+		}()
+	}
+
+	// Give the other goroutines time to join the in-flight call before it completes.
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&listCalls); got != 1 {
+		t.Errorf("unexpected number of ListRunners API calls: want 1, got %d", got)
+	}
+}
+
+func TestListRunnersPagination(t *testing.T) {
+	const pages = 3
+
+	newServer := func(failingPage int) *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			page := 1
+			if p := req.URL.Query().Get("page"); p != "" {
+				fmt.Sscanf(p, "%d", &page)
+			}
+
+			if page == failingPage {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if page < pages {
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, srv.URL, req.URL.Path, page+1))
+			}
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"total_count": %d, "runners": [{"id": %d, "name": "test%d", "os": "linux", "status": "online", "busy": false}]}`, pages, page, page)
+		}))
+		return srv
+	}
+
+	newClient := func(srv *httptest.Server) *Client {
+		c := Config{
+			Token: "token",
+		}
+		client, err := c.NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		baseURL, err := url.Parse(srv.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Client.BaseURL = baseURL
+		return client
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		srv := newServer(0)
+		defer srv.Close()
+
+		runners, err := newClient(srv).ListRunners(context.Background(), "", "", "test/valid")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runners) != pages {
+			t.Fatalf("unexpected number of runners: want %d, got %d", pages, len(runners))
+		}
+		for i, r := range runners {
+			if want := fmt.Sprintf("test%d", i+1); r.GetName() != want {
+				t.Errorf("[%d] unexpected runner name: want %s, got %s", i, want, r.GetName())
+			}
+		}
+	})
+
+	t.Run("failure mid-iteration", func(t *testing.T) {
+		srv := newServer(2)
+		defer srv.Close()
+
+		runners, err := newClient(srv).ListRunners(context.Background(), "", "", "test/valid")
+		if err == nil {
+			t.Fatalf("expected an error, got none")
+		}
+		if runners != nil {
+			t.Errorf("expected no runners on error, got %v", runners)
+		}
+	})
+}
+
+func TestListRunnersRevalidate(t *testing.T) {
+	for _, revalidate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("revalidate=%v", revalidate), func(t *testing.T) {
+			var calls, notModified int
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+
+				if req.Header.Get("If-None-Match") == `"v1"` {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("Cache-Control", "private, max-age=60, s-maxage=60")
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, fake.RunnersListBody)
+			}))
+			defer srv.Close()
+
+			c := Config{
+				Token:                 "token",
+				URL:                   srv.URL,
+				ListRunnersRevalidate: revalidate,
+			}
+			client, err := c.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				runners, err := client.ListRunners(context.Background(), "", "", "test/valid")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(runners) == 0 {
+					t.Fatal("expected runners, got none")
+				}
+			}
+
+			wantCalls, wantNotModified := 1, 0
+			if revalidate {
+				wantCalls, wantNotModified = 2, 1
+			}
+
+			if calls != wantCalls || notModified != wantNotModified {
+				t.Errorf("unexpected API calls: want %d calls including %d conditional ones, got %d calls including %d conditional ones", wantCalls, wantNotModified, calls, notModified)
+			}
+		})
+	}
+}
+
+func TestObserveRunnersBusy(t *testing.T) {
+	client := newTestClient()
+
+	runner := func(id int64, busy bool) *github.Runner {
+		return &github.Runner{ID: github.Int64(id), Busy: github.Bool(busy)}
+	}
+
+	if flips := client.observeRunnersBusy("", "test", "", []*github.Runner{runner(1, false), runner(2, true)}); flips != 0 {
+		t.Errorf("unexpected flips on the first observation: %d", flips)
+	}
+
+	if flips := client.observeRunnersBusy("", "test", "", []*github.Runner{runner(1, true), runner(2, true), runner(3, true)}); flips != 1 {
+		t.Errorf("unexpected flips: want 1, got %d", flips)
+	}
+
+	// Another scope doesn't share the observations
+	if flips := client.observeRunnersBusy("", "another", "", []*github.Runner{runner(1, false)}); flips != 0 {
+		t.Errorf("unexpected flips in another scope: %d", flips)
+	}
+}
+
+func TestListRunnersInGroup(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, path := range []string{
+		"/orgs/test/actions/runner-groups/2/runners",
+		"/enterprises/test/actions/runner-groups/2/runners",
+	} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"total_count": 1, "runners": [{"id": 3, "name": "test3", "os": "linux", "status": "online", "busy": false}]}`)
+		})
+	}
+	mux.Handle("/repos/test/valid/actions/runners", fake.DefaultListRunnersHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := Config{
+		Token: "token",
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	tests := []struct {
+		enterprise string
+		org        string
+		repo       string
+		groupID    int64
+		length     int
+		err        bool
+	}{
+		{enterprise: "", org: "test", repo: "", groupID: 2, length: 1, err: false},
+		{enterprise: "test", org: "", repo: "", groupID: 2, length: 1, err: false},
+		{enterprise: "", org: "test", repo: "", groupID: 3, length: 0, err: true},
+		// Runner groups aren't available to repository runners so the group ID is ignored
+		{enterprise: "", org: "", repo: "test/valid", groupID: 2, length: 2, err: false},
+	}
+
+	for i, tt := range tests {
+		runners, err := client.ListRunnersInGroup(context.Background(), tt.enterprise, tt.org, tt.repo, tt.groupID)
+		if tt.err != (err != nil) {
+			t.Errorf("[%d] unexpected error: %v", i, err)
+		}
+		if tt.length != len(runners) {
+			t.Errorf("[%d] unexpected runners list: %v", i, runners)
+		}
+	}
+}
+
+func TestGetRunnerGroupIDByName(t *testing.T) {
+	var requests int
+
+	mux := http.NewServeMux()
+	for _, path := range []string{
+		"/orgs/test/actions/runner-groups",
+		"/enterprises/test/actions/runner-groups",
+	} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"total_count": 2, "runner_groups": [{"id": 1, "name": "Default"}, {"id": 2, "name": "team-a"}]}`)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := Config{
+		Token: "token",
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	tests := []struct {
+		enterprise string
+		org        string
+		name       string
+		id         int64
+		err        bool
+	}{
+		{enterprise: "", org: "test", name: "team-a", id: 2, err: false},
+		{enterprise: "test", org: "", name: "team-a", id: 2, err: false},
+		{enterprise: "", org: "test", name: "team-b", id: 0, err: true},
+		// Resolved IDs are cached
+		{enterprise: "", org: "test", name: "team-a", id: 2, err: false},
+	}
+
+	for i, tt := range tests {
+		id, err := client.GetRunnerGroupIDByName(context.Background(), tt.enterprise, tt.org, tt.name)
+		if tt.err != (err != nil) {
+			t.Errorf("[%d] unexpected error: %v", i, err)
+		}
+		if tt.id != id {
+			t.Errorf("[%d] unexpected runner group ID: want %d, got %d", i, tt.id, id)
+		}
+	}
+
+	if requests != 3 {
+		t.Errorf("unexpected number of requests: want 3, got %d", requests)
+	}
+}
+
 func TestRemoveRunner(t *testing.T) {
 	tests := []struct {
 		enterprise string
@@ -129,6 +523,576 @@ func TestRemoveRunner(t *testing.T) {
 	}
 }
 
+// TestRunnerScope verifies which GitHub API endpoints the runner APIs call for each combination of the enterprise, organization, and repository.
+// The narrowest non-empty scope wins, so e.g. an organization runner can be managed with the enterprise specified as well.
+func TestRunnerScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		enterprise string
+		org        string
+		repo       string
+		wantPath   string
+		wantErr    bool
+	}{
+		{name: "enterprise", enterprise: "myent", wantPath: "/enterprises/myent/actions/runners"},
+		{name: "organization", org: "myorg", wantPath: "/orgs/myorg/actions/runners"},
+		{name: "repository", repo: "myorg/myrepo", wantPath: "/repos/myorg/myrepo/actions/runners"},
+		{name: "enterprise and organization", enterprise: "myent", org: "myorg", wantPath: "/orgs/myorg/actions/runners"},
+		{name: "organization and repository", org: "myorg", repo: "myorg/myrepo", wantPath: "/repos/myorg/myrepo/actions/runners"},
+		{name: "all", enterprise: "myent", org: "myorg", repo: "myorg/myrepo", wantPath: "/repos/myorg/myrepo/actions/runners"},
+		{name: "none", wantErr: true},
+		{name: "invalid repository", repo: "myrepo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests []string
+			)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				mu.Unlock()
+
+				switch {
+				case req.Method == http.MethodDelete:
+					w.WriteHeader(http.StatusNoContent)
+				case req.URL.Path == tt.wantPath:
+					fmt.Fprint(w, `{"total_count":1,"runners":[{"id":1,"name":"test1"}]}`)
+				default:
+					fmt.Fprint(w, `{"id":1,"name":"test1"}`)
+				}
+			}))
+			defer srv.Close()
+
+			client := newTestClient()
+			baseURL, err := url.Parse(srv.URL + "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Client.BaseURL = baseURL
+
+			ctx := context.Background()
+
+			runners, listErr := client.ListRunners(ctx, tt.enterprise, tt.org, tt.repo)
+			runner, getErr := client.GetRunnerByID(ctx, tt.enterprise, tt.org, tt.repo, 1)
+			removeErr := client.RemoveRunner(ctx, tt.enterprise, tt.org, tt.repo, 1)
+
+			if tt.wantErr {
+				if listErr == nil || getErr == nil || removeErr == nil {
+					t.Errorf("expected errors, got %v, %v, %v", listErr, getErr, removeErr)
+				}
+				if len(requests) != 0 {
+					t.Errorf("expected no requests, got %v", requests)
+				}
+				return
+			}
+
+			for _, err := range []error{listErr, getErr, removeErr} {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if len(runners) != 1 || runner.GetID() != 1 {
+				t.Errorf("unexpected runners: %v, %v", runners, runner)
+			}
+
+			want := []string{
+				"GET " + tt.wantPath,
+				"GET " + tt.wantPath + "/1",
+				"DELETE " + tt.wantPath + "/1",
+			}
+			if fmt.Sprint(requests) != fmt.Sprint(want) {
+				t.Errorf("unexpected requests: want %v, got %v", want, requests)
+			}
+		})
+	}
+}
+
+// TestPathPrefixedBaseURL verifies the final URLs of the runner API requests when GitHub API is served under a path prefix,
+// like behind a path-rewriting proxy.
+func TestPathPrefixedBaseURL(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		mu.Unlock()
+
+		if req.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, `{"total_count":1,"runners":[{"id":1,"name":"test1"}]}`)
+	}))
+	defer srv.Close()
+
+	configs := []struct {
+		name string
+		conf Config
+	}{
+		{name: "url", conf: Config{URL: srv.URL + "/github/api/v3"}},
+		{name: "url with trailing slash", conf: Config{URL: srv.URL + "/github/api/v3/"}},
+		{name: "enterprise url", conf: Config{EnterpriseURL: srv.URL + "/github"}},
+		{name: "enterprise url with api path", conf: Config{EnterpriseURL: srv.URL + "/github/api/v3"}},
+	}
+
+	scopes := []struct {
+		name       string
+		enterprise string
+		org        string
+		repo       string
+		wantPath   string
+	}{
+		{name: "enterprise", enterprise: "myent", wantPath: "/github/api/v3/enterprises/myent/actions/runners"},
+		{name: "organization", org: "myorg", wantPath: "/github/api/v3/orgs/myorg/actions/runners"},
+		{name: "repository", repo: "myorg/myrepo", wantPath: "/github/api/v3/repos/myorg/myrepo/actions/runners"},
+	}
+
+	for _, cc := range configs {
+		for _, sc := range scopes {
+			t.Run(cc.name+"/"+sc.name, func(t *testing.T) {
+				mu.Lock()
+				requests = nil
+				mu.Unlock()
+
+				c := cc.conf
+				c.Token = "token"
+
+				client, err := c.NewClient()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ctx := context.Background()
+
+				if _, err := client.ListRunners(ctx, sc.enterprise, sc.org, sc.repo); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := client.RemoveRunner(ctx, sc.enterprise, sc.org, sc.repo, 1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				want := []string{
+					"GET " + sc.wantPath,
+					"DELETE " + sc.wantPath + "/1",
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if fmt.Sprint(requests) != fmt.Sprint(want) {
+					t.Errorf("unexpected requests: want %v, got %v", want, requests)
+				}
+			})
+		}
+	}
+}
+
+func TestGenerateJITConfig(t *testing.T) {
+	var bodies []map[string]interface{}
+
+	mux := http.NewServeMux()
+	for _, path := range []string{
+		"/repos/test/valid/actions/runners/generate-jitconfig",
+		"/orgs/test/actions/runners/generate-jitconfig",
+		"/enterprises/test/actions/runners/generate-jitconfig",
+	} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost {
+				t.Errorf("unexpected method: %s", req.Method)
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				t.Errorf("unexpected request body: %v", err)
+			}
+			bodies = append(bodies, body)
+
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"runner": {"id": 23, "name": %q, "os": "unknown", "status": "offline", "busy": false}, "encoded_jit_config": "abc"}`, body["name"])
+		})
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := Config{
+		Token: "token",
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	tests := []struct {
+		enterprise string
+		org        string
+		repo       string
+		groupID    int64
+		wantGroup  float64
+		err        bool
+	}{
+		{enterprise: "", org: "", repo: "test/valid", groupID: 2, wantGroup: 1, err: false},
+		{enterprise: "", org: "test", repo: "", groupID: 2, wantGroup: 2, err: false},
+		{enterprise: "test", org: "", repo: "", groupID: 0, wantGroup: 1, err: false},
+		{enterprise: "", org: "", repo: "test/invalid", err: true},
+	}
+
+	for i, tt := range tests {
+		bodies = nil
+
+		config, err := client.GenerateJITConfig(context.Background(), tt.enterprise, tt.org, tt.repo, "test1", tt.groupID, []string{"self-hosted", "linux"}, "/runner/_work")
+		if tt.err != (err != nil) {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+		if tt.err {
+			continue
+		}
+
+		if config.Runner.GetID() != 23 || config.Runner.GetName() != "test1" {
+			t.Errorf("[%d] unexpected runner: %v", i, config.Runner)
+		}
+		if config.EncodedJITConfig != "abc" {
+			t.Errorf("[%d] unexpected encoded jit config: %q", i, config.EncodedJITConfig)
+		}
+		if len(bodies) != 1 {
+			t.Fatalf("[%d] unexpected number of requests: %d", i, len(bodies))
+		}
+		if got := bodies[0]["runner_group_id"]; got != tt.wantGroup {
+			t.Errorf("[%d] unexpected runner group ID: want %v, got %v", i, tt.wantGroup, got)
+		}
+		if got := bodies[0]["work_folder"]; got != "/runner/_work" {
+			t.Errorf("[%d] unexpected work folder: %v", i, got)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	c := Config{
+		Token:          "token",
+		URL:            slow.URL,
+		RequestTimeout: 100 * time.Millisecond,
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.GetRunnerByID(context.Background(), "", "", "test/valid", 1)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unexpected error: want %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GetRunnerByID didn't time out")
+	}
+}
+
+func TestRetryDelayOnRateLimit(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rateLimitErr := func(reset time.Time) error {
+		return fmt.Errorf("removing runner: %w", &github.RateLimitError{
+			Rate: github.Rate{Reset: github.Timestamp{Time: reset}},
+		})
+	}
+
+	errorResponse := func(retryAfter string) error {
+		return &github.ErrorResponse{
+			Response: &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{retryAfter}},
+			},
+		}
+	}
+
+	twoMinutes := 2 * time.Minute
+
+	tcs := []struct {
+		name                string
+		rateLimitRetryDelay time.Duration
+		err                 error
+		want                time.Duration
+	}{
+		{
+			name: "reset time",
+			err:  rateLimitErr(now.Add(90 * time.Second)),
+			want: 90 * time.Second,
+		},
+		{
+			name:                "reset time preferred over the configured delay",
+			rateLimitRetryDelay: 10 * time.Second,
+			err:                 rateLimitErr(now.Add(90 * time.Second)),
+			want:                90 * time.Second,
+		},
+		{
+			name: "reset time in the past",
+			err:  rateLimitErr(now.Add(-time.Second)),
+			want: 30 * time.Second,
+		},
+		{
+			name:                "configured delay",
+			rateLimitRetryDelay: 10 * time.Second,
+			err:                 rateLimitErr(time.Time{}),
+			want:                10 * time.Second,
+		},
+		{
+			name: "default delay",
+			err:  rateLimitErr(time.Time{}),
+			want: 30 * time.Second,
+		},
+		{
+			name: "secondary rate limit with retry-after",
+			err:  &github.AbuseRateLimitError{RetryAfter: &twoMinutes},
+			want: 2 * time.Minute,
+		},
+		{
+			name:                "secondary rate limit without retry-after",
+			rateLimitRetryDelay: 10 * time.Second,
+			err:                 &github.AbuseRateLimitError{},
+			want:                10 * time.Second,
+		},
+		{
+			name: "retry-after in seconds",
+			err:  errorResponse("45"),
+			want: 45 * time.Second,
+		},
+		{
+			name: "retry-after in http date",
+			err:  errorResponse(now.Add(time.Minute).Format(http.TimeFormat)),
+			want: time.Minute,
+		},
+		{
+			name: "unparsable retry-after",
+			err:  errorResponse("foo"),
+			want: 30 * time.Second,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Config{
+				Token:               "token",
+				RateLimitRetryDelay: tc.rateLimitRetryDelay,
+			}
+			client, err := c.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := client.RetryDelayOnRateLimit(tc.err, now, 30*time.Second); got != tc.want {
+				t.Errorf("unexpected retry delay: want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIsRateLimitError(t *testing.T) {
+	forbidden := func(documentationURL string) error {
+		return fmt.Errorf("removing runner: %w", &github.ErrorResponse{
+			Response:         &http.Response{StatusCode: http.StatusForbidden},
+			DocumentationURL: documentationURL,
+		})
+	}
+
+	tcs := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "primary rate limit",
+			err:  &github.RateLimitError{},
+			want: true,
+		},
+		{
+			name: "abuse rate limit",
+			err:  &github.AbuseRateLimitError{},
+			want: true,
+		},
+		{
+			name: "secondary rate limit",
+			err:  forbidden("https://docs.github.com/rest/overview/resources-in-the-rest-api#secondary-rate-limits"),
+			want: true,
+		},
+		{
+			name: "forbidden",
+			err:  forbidden(""),
+			want: false,
+		},
+		{
+			name: "other error",
+			err:  errors.New("error"),
+			want: false,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRateLimitError(tc.err); got != tc.want {
+				t.Errorf("unexpected result: want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type recordingTransport struct {
+	authorizations []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.authorizations = append(t.authorizations, req.Header.Get("Authorization"))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomTransport(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+	}{
+		{name: "token", conf: Config{Token: "token"}},
+		{name: "basicauth", conf: Config{BasicauthUsername: "user", BasicauthPassword: "pass"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &recordingTransport{}
+
+			c := tt.conf
+			c.URL = server.URL
+			c.Transport = tr
+
+			client, err := c.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := client.RemoveRunner(context.Background(), "", "", "test/valid", 1); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(tr.authorizations) != 1 {
+				t.Fatalf("unexpected number of requests sent via the custom transport: %d", len(tr.authorizations))
+			}
+			if tr.authorizations[0] == "" {
+				t.Errorf("expected the request to be authenticated before being sent via the custom transport")
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		proxiedURLs         []string
+		proxyAuthorizations []string
+	)
+
+	reverseProxy := httputil.NewSingleHostReverseProxy(target)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxiedURLs = append(proxiedURLs, req.URL.String())
+		proxyAuthorizations = append(proxyAuthorizations, req.Header.Get("Proxy-Authorization"))
+		reverseProxy.ServeHTTP(w, req)
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name                   string
+		conf                   Config
+		wantProxyAuthorization string
+		wantErr                bool
+	}{
+		{
+			name: "no auth",
+			conf: Config{ProxyURL: proxy.URL},
+		},
+		{
+			name:                   "auth",
+			conf:                   Config{ProxyURL: proxy.URL, ProxyUsername: "user", ProxyPassword: "pass"},
+			wantProxyAuthorization: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:                   "auth in url",
+			conf:                   Config{ProxyURL: strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)},
+			wantProxyAuthorization: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:    "unsupported scheme",
+			conf:    Config{ProxyURL: "ftp://proxy.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "custom transport",
+			conf:    Config{ProxyURL: proxy.URL, Transport: &recordingTransport{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxiedURLs, proxyAuthorizations = nil, nil
+
+			c := tt.conf
+			c.Token = "token"
+			c.URL = server.URL
+
+			client, err := c.NewClient()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := client.RemoveRunner(context.Background(), "", "", "test/valid", 1); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want := []string{server.URL + "/repos/test/valid/actions/runners/1"}; !reflect.DeepEqual(proxiedURLs, want) {
+				t.Fatalf("unexpected requests sent via the proxy: want %v, got %v", want, proxiedURLs)
+			}
+			if proxyAuthorizations[0] != tt.wantProxyAuthorization {
+				t.Errorf("unexpected Proxy-Authorization header: want %q, got %q", tt.wantProxyAuthorization, proxyAuthorizations[0])
+			}
+		})
+	}
+}
+
 func TestCleanup(t *testing.T) {
 	token := "token"
 
@@ -159,3 +1123,336 @@ func TestUserAgent(t *testing.T) {
 		t.Errorf("UserAgent should be set to actions-runner-controller")
 	}
 }
+
+func TestInstallationTokenCaching(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var tokenRequests int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/app/installations/1/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/api/v3/repos/test/", func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("Authorization"); got != "token installation-token" {
+			t.Errorf("unexpected Authorization header: %q", got)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	appServer := httptest.NewServer(mux)
+	defer appServer.Close()
+
+	c := Config{
+		AppID:             1,
+		AppInstallationID: 1,
+		AppPrivateKey:     string(privateKey),
+		EnterpriseURL:     appServer.URL,
+	}
+
+	// The second client is expected to reuse the installation token minted for the first client.
+	for i, repo := range []string{"test/valid", "test/another"} {
+		client, err := c.NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.ListRunners(context.Background(), "", "", repo); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("unexpected number of installation token requests: want 1, got %d", tokenRequests)
+	}
+}
+
+func TestInstallationTokenWithPathPrefixedURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var tokenRequests int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/github/api/v3/app/installations/1/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/github/api/v3/repos/test/", func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("Authorization"); got != "token installation-token" {
+			t.Errorf("unexpected Authorization header: %q", got)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	})
+	appServer := httptest.NewServer(mux)
+	defer appServer.Close()
+
+	// The installation token needs to be minted via the same API endpoint as the other API calls, rather than api.github.com.
+	c := Config{
+		AppID:             1,
+		AppInstallationID: 1,
+		AppPrivateKey:     string(privateKey),
+		URL:               appServer.URL + "/github/api/v3/",
+	}
+
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.ListRunners(context.Background(), "", "", "test/valid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("unexpected number of installation token requests: want 1, got %d", tokenRequests)
+	}
+}
+
+func TestWithEnterpriseURL(t *testing.T) {
+	client := newTestClient()
+
+	if c, err := client.WithEnterpriseURL(""); err != nil || c != client {
+		t.Fatalf("expected the client itself for an empty enterprise URL, got %p (err=%v)", c, err)
+	}
+
+	ghes, err := client.WithEnterpriseURL("https://ghes.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ghes.BaseURL.String(), "https://ghes.example.com/api/v3/"; got != want {
+		t.Errorf("unexpected base URL: want %s, got %s", want, got)
+	}
+	if got, want := ghes.UploadURL.String(), "https://ghes.example.com/api/uploads/"; got != want {
+		t.Errorf("unexpected upload URL: want %s, got %s", want, got)
+	}
+	if got, want := ghes.GithubBaseURL, "https://ghes.example.com/"; got != want {
+		t.Errorf("unexpected GitHub base URL: want %s, got %s", want, got)
+	}
+
+	cached, err := client.WithEnterpriseURL("https://ghes.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != ghes {
+		t.Errorf("expected the client for the same enterprise URL and credential to be reused")
+	}
+
+	other, err := (&Client{config: Config{Token: "other"}}).WithEnterpriseURL("https://ghes.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == ghes {
+		t.Errorf("expected a different client for a different credential")
+	}
+}
+
+func TestCredentialFailover(t *testing.T) {
+	var rateLimited bool
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		requests = append(requests, auth)
+
+		switch {
+		case rateLimited:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Minute).Unix()))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+		case auth == "Bearer revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "Bad credentials"}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	c := Config{
+		Token:               "revoked",
+		FallbackCredentials: []Credential{{Token: "valid"}},
+		URL:                 server.URL,
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := client.RemoveRunner(ctx, "", "", "test/valid", 1); err != nil {
+		t.Fatalf("expected the request to succeed with the fallback credential: %v", err)
+	}
+	if err := client.RemoveRunner(ctx, "", "", "test/valid", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"Bearer revoked", "Bearer valid", "Bearer valid"}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("unexpected credentials used: want %v, got %v", want, requests)
+	}
+
+	// The rate limit isn't a reason to fail over.
+	requests = nil
+	rateLimited = true
+
+	if err := client.RemoveRunner(ctx, "", "", "test/valid", 3); !IsRateLimitError(err) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+
+	if want := []string{"Bearer valid"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("unexpected credentials used: want %v, got %v", want, requests)
+	}
+}
+
+func TestCredentialFailover_Forbidden(t *testing.T) {
+	var suspended bool
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		requests = append(requests, auth)
+
+		switch {
+		case auth == "Bearer primary" && suspended:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "This installation has been suspended"}`)
+		case req.URL.Path == "/repos/test/other/actions/runners/1":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	c := Config{
+		Token:               "primary",
+		FallbackCredentials: []Credential{{Token: "fallback"}},
+		URL:                 server.URL,
+	}
+
+	tr, err := c.failoverTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := &http.Client{Transport: tr}
+
+	get := func(path string, want int) {
+		t.Helper()
+
+		resp, err := httpClient.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Fatalf("unexpected status code: want %d, got %d", want, resp.StatusCode)
+		}
+	}
+
+	// The credential lacking access to a repository is still fine for other repositories.
+	get("/repos/test/other/actions/runners/1", http.StatusForbidden)
+
+	if want := []string{"Bearer primary"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("unexpected credentials used: want %v, got %v", want, requests)
+	}
+	if tr.active != 0 {
+		t.Errorf("unexpected active credential: want 0, got %d", tr.active)
+	}
+
+	requests = nil
+	suspended = true
+
+	get("/repos/test/valid/actions/runners/1", http.StatusNoContent)
+
+	if want := []string{"Bearer primary", "Bearer fallback"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("unexpected credentials used: want %v, got %v", want, requests)
+	}
+	if tr.active != 1 {
+		t.Errorf("unexpected active credential: want 1, got %d", tr.active)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int
+	status := http.StatusServiceUnavailable
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+
+	b := (&Config{CircuitBreakerFailureThreshold: 2, CircuitBreakerCooldown: time.Minute}).circuitBreaker()
+	b.now = func() time.Time { return now }
+
+	httpClient := &http.Client{Transport: circuitBreakerTransport{Transport: http.DefaultTransport, Breaker: b}}
+
+	get := func() error {
+		resp, err := httpClient.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+	}
+
+	err := get()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit breaker to be open, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("unexpected number of requests made while the circuit breaker is open: want 2, got %d", requests)
+	}
+	if d, ok := RetryAfter(err, now); !ok || d != time.Minute {
+		t.Errorf("unexpected retry delay: want %s, got %s (ok=%v)", time.Minute, d, ok)
+	}
+
+	// The failed probe keeps the circuit breaker open for another cooldown.
+	now = now.Add(time.Minute)
+
+	if err := get(); err != nil {
+		t.Fatalf("unexpected error on the probe: %v", err)
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit breaker to be open after the failed probe, got %v", err)
+	}
+
+	// The successful probe closes the circuit breaker.
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("[%d] unexpected error after the successful probe: %v", i, err)
+		}
+	}
+	if requests != 6 {
+		t.Errorf("unexpected number of requests: want 6, got %d", requests)
+	}
+}
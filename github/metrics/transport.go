@@ -5,15 +5,30 @@
 package metrics
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 func init() {
-	metrics.Registry.MustRegister(metricRateLimit, metricRateLimitRemaining)
+	metrics.Registry.MustRegister(
+		metricRateLimit,
+		metricRateLimitRemaining,
+		metricRateLimitRemainingByCredential,
+		metricRateLimitResetByCredential,
+		metricListRunnersCacheHits,
+		metricRunnerBusyStatusFlips,
+		metricLastConnectivityCheckSuccess,
+		metricActiveCredential,
+		metricCircuitBreakerState,
+		metricAPIRequestDuration,
+	)
 }
 
 var (
@@ -30,34 +45,184 @@ var (
 			Help: "The number of requests remaining in the current rate limit window",
 		},
 	)
+	metricRateLimitRemainingByCredential = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_rate_limit_remaining_by_credential",
+			Help: "The number of requests remaining in the current rate limit window, per GitHub credential",
+		},
+		[]string{"credential"},
+	)
+	metricRateLimitResetByCredential = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_rate_limit_reset_timestamp_seconds",
+			Help: "The time at which the current rate limit window resets in UTC epoch seconds, per GitHub credential",
+		},
+		[]string{"credential"},
+	)
+	metricListRunnersCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "github_list_runners_cache_hits_total",
+			Help: "The number of ListRunners calls served from the in-memory cache without calling GitHub API",
+		},
+	)
+	metricRunnerBusyStatusFlips = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "github_runner_busy_status_flips_total",
+			Help: "The number of times the busy status of a runner differed between two consecutive ListRunners API calls",
+		},
+	)
+	metricLastConnectivityCheckSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_api_last_successful_connectivity_check_timestamp_seconds",
+			Help: "The time of the last successful GitHub API connectivity check in UTC epoch seconds",
+		},
+	)
+	metricActiveCredential = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_credential_active",
+			Help: "Whether the GitHub credential is the one GitHub API requests are currently authenticated with (1) or not (0)",
+		},
+		[]string{"credential"},
+	)
+	metricCircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_circuit_breaker_state",
+			Help: "The state of the GitHub API circuit breaker, 0 for closed, 1 for open, and 2 for half-open",
+		},
+		[]string{"host"},
+	)
+	metricAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_api_request_duration_seconds",
+			Help:    "The duration of GitHub API requests in seconds, per operation and status class like 2xx, or error when no response was received",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation", "status_class"},
+	)
 )
 
+// IncListRunnersCacheHits increments the number of ListRunners calls served from the cache.
+func IncListRunnersCacheHits() {
+	metricListRunnersCacheHits.Inc()
+}
+
+// AddRunnerBusyStatusFlips adds the number of runners whose busy status flipped between two consecutive ListRunners API calls.
+func AddRunnerBusyStatusFlips(n int) {
+	metricRunnerBusyStatusFlips.Add(float64(n))
+}
+
+// SetLastConnectivityCheckSuccess records the time of the last successful GitHub API connectivity check.
+func SetLastConnectivityCheckSuccess(t time.Time) {
+	metricLastConnectivityCheckSuccess.Set(float64(t.Unix()))
+}
+
+// SetActiveCredential marks the credential as the active one among all the credentials.
+func SetActiveCredential(active string, all []string) {
+	for _, c := range all {
+		v := 0.0
+		if c == active {
+			v = 1
+		}
+		metricActiveCredential.WithLabelValues(c).Set(v)
+	}
+}
+
+// SetCircuitBreakerState records the state of the GitHub API circuit breaker for the host.
+func SetCircuitBreakerState(host string, state int) {
+	metricCircuitBreakerState.WithLabelValues(host).Set(float64(state))
+}
+
+type operationContextKey struct{}
+
+// WithOperation returns a context that makes Transport observe the duration of the GitHub API requests made with it
+// as the operation, like ListRunners or RemoveRunner.
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationContextKey{}, operation)
+}
+
+func operationFrom(ctx context.Context) string {
+	if op, ok := ctx.Value(operationContextKey{}).(string); ok {
+		return op
+	}
+
+	return "unknown"
+}
+
+func statusClass(resp *http.Response, err error) string {
+	if resp == nil {
+		return "error"
+	}
+
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
+
 const (
 	// https://docs.github.com/en/rest/overview/resources-in-the-rest-api#rate-limiting
 	headerRateLimit          = "X-RateLimit-Limit"
 	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
 )
 
 // Transport wraps a transport with metrics monitoring
 type Transport struct {
 	Transport http.RoundTripper
+
+	// Credential identifies the GitHub credential used by the transport, like a GitHub App installation or a token.
+	// It's used as the label value of per-credential metrics, so it must not contain the secret itself.
+	Credential string
 }
 
 func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
 	resp, err := t.Transport.RoundTrip(req)
+	metricAPIRequestDuration.WithLabelValues(operationFrom(req.Context()), statusClass(resp, err)).Observe(time.Since(start).Seconds())
 	if resp != nil {
-		parseResponse(resp)
+		parseResponse(resp, t.Credential)
 	}
 	return resp, err
 }
 
-func parseResponse(resp *http.Response) {
-	rateLimit, err := strconv.Atoi(resp.Header.Get(headerRateLimit))
-	if err == nil {
+// RateLimit is the GitHub API rate limit as seen in the headers of a response.
+type RateLimit struct {
+	// Limit is the maximum number of requests permitted per hour.
+	Limit int
+	// Remaining is the number of requests remaining in the current rate limit window.
+	Remaining int
+	// Reset is the time the current rate limit window resets. It's zero when unknown.
+	Reset time.Time
+}
+
+// lastRateLimit holds the RateLimit of the last response that had the rate limit headers.
+var lastRateLimit atomic.Value
+
+// LastRateLimit returns the GitHub API rate limit as of the last response that had the rate limit headers,
+// so that callers can slow down when the remaining budget is low.
+// It returns false until such a response is seen.
+func LastRateLimit() (RateLimit, bool) {
+	v, ok := lastRateLimit.Load().(RateLimit)
+	return v, ok
+}
+
+func parseResponse(resp *http.Response, credential string) {
+	rateLimit, limitErr := strconv.Atoi(resp.Header.Get(headerRateLimit))
+	if limitErr == nil {
 		metricRateLimit.Set(float64(rateLimit))
 	}
-	rateLimitRemaining, err := strconv.Atoi(resp.Header.Get(headerRateLimitRemaining))
-	if err == nil {
+	rateLimitRemaining, remainingErr := strconv.Atoi(resp.Header.Get(headerRateLimitRemaining))
+	if remainingErr == nil {
 		metricRateLimitRemaining.Set(float64(rateLimitRemaining))
+		metricRateLimitRemainingByCredential.WithLabelValues(credential).Set(float64(rateLimitRemaining))
+	}
+	rateLimitReset, resetErr := strconv.ParseInt(resp.Header.Get(headerRateLimitReset), 10, 64)
+	if resetErr == nil {
+		metricRateLimitResetByCredential.WithLabelValues(credential).Set(float64(rateLimitReset))
+	}
+
+	if limitErr == nil && remainingErr == nil {
+		rl := RateLimit{Limit: rateLimit, Remaining: rateLimitRemaining}
+		if resetErr == nil {
+			rl.Reset = time.Unix(rateLimitReset, 0)
+		}
+		lastRateLimit.Store(rl)
 	}
 }
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransport_APIRequestDuration(t *testing.T) {
+	metricAPIRequestDuration.Reset()
+
+	status := http.StatusNoContent
+
+	tr := Transport{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if status == 0 {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{StatusCode: status, Header: http.Header{}, Request: req}, nil
+		}),
+	}
+
+	do := func(ctx context.Context) {
+		req := httptest.NewRequest("DELETE", "https://api.github.com/repos/test/valid/actions/runners/1", nil).WithContext(ctx)
+		tr.RoundTrip(req)
+	}
+
+	do(WithOperation(context.Background(), "RemoveRunner"))
+	do(WithOperation(context.Background(), "RemoveRunner"))
+
+	status = http.StatusUnprocessableEntity
+	do(WithOperation(context.Background(), "RemoveRunner"))
+
+	status = 0
+	do(context.Background())
+
+	if got := testutil.CollectAndCount(metricAPIRequestDuration); got != 3 {
+		t.Fatalf("unexpected number of series: want 3, got %d", got)
+	}
+
+	for _, labels := range [][]string{
+		{"RemoveRunner", "2xx"},
+		{"RemoveRunner", "4xx"},
+		{"unknown", "error"},
+	} {
+		// DeleteLabelValues tells if the series has been observed.
+		if !metricAPIRequestDuration.DeleteLabelValues(labels...) {
+			t.Errorf("missing observation of %v", labels)
+		}
+	}
+}
+
+func TestTransport_LastRateLimit(t *testing.T) {
+	header := http.Header{}
+
+	tr := Transport{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Request: req}, nil
+		}),
+	}
+
+	do := func() {
+		tr.RoundTrip(httptest.NewRequest("GET", "https://api.github.com/repos/test/valid/actions/runners", nil))
+	}
+
+	header.Set("X-RateLimit-Limit", "5000")
+	header.Set("X-RateLimit-Remaining", "4321")
+	header.Set("X-RateLimit-Reset", "1646092800")
+	do()
+
+	want := RateLimit{Limit: 5000, Remaining: 4321, Reset: time.Unix(1646092800, 0)}
+	if got, ok := LastRateLimit(); !ok || got != want {
+		t.Errorf("unexpected rate limit: want %+v, got %+v (%v)", want, got, ok)
+	}
+
+	// A response without the rate limit headers, like one served from the HTTP cache, doesn't reset the last rate limit.
+	header = http.Header{}
+	do()
+
+	if got, ok := LastRateLimit(); !ok || got != want {
+		t.Errorf("unexpected rate limit: want %+v, got %+v (%v)", want, got, ok)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/actions-runner-controller/actions-runner-controller/logging"
 	"github.com/kelseyhightower/envconfig"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -38,6 +39,15 @@ import (
 const (
 	defaultRunnerImage = "summerwind/actions-runner:latest"
 	defaultDockerImage = "docker:dind"
+
+	// defaultListRunnersCacheTTL corresponds to the max-age of the Cache-Control header GitHub returns for ListRunners API responses.
+	defaultListRunnersCacheTTL = 60 * time.Second
+
+	// defaultGracefulShutdownTimeout is the graceful shutdown timeout controller-runtime defaults to.
+	defaultGracefulShutdownTimeout = 30 * time.Second
+
+	// gracefulShutdownTimeoutMargin is the time the manager is given on top of --shutdown-drain-grace-period to stop everything else.
+	gracefulShutdownTimeoutMargin = 10 * time.Second
 )
 
 var (
@@ -69,6 +79,7 @@ func main() {
 		ghClient *github.Client
 
 		metricsAddr          string
+		healthProbeAddr      string
 		enableLeaderElection bool
 		leaderElectionId     string
 		syncPeriod           time.Duration
@@ -84,6 +95,49 @@ func main() {
 		logLevel             string
 
 		commonRunnerLabels commaSeparatedStringSlice
+
+		registrationGracePeriod     time.Duration
+		registrationRecheckInterval time.Duration
+		maxRegistrationWait         time.Duration
+		requeueJitter               float64
+		gitHubAPITimeout            time.Duration
+		retryableGitHubStatusCodes  string
+		unregistrationDryRun        bool
+
+		onlyUnregisterOfflineRunners bool
+		offlineRunnerGracePeriod     time.Duration
+		verifyRunnerID               bool
+
+		unregistrationProgressLogInterval time.Duration
+		gracefulStopSyncPeriod            time.Duration
+		shutdownDrainGracePeriod          time.Duration
+		deletionVerificationTimeout       time.Duration
+
+		preStopGracePeriod time.Duration
+
+		maxUnregistrationAttempts    int
+		unregistrationWarnThreshold  float64
+		drainReadinessGate           string
+		blockStopCondition           string
+		maxBlockStopDuration         time.Duration
+		maxConcurrentUnregistrations int
+
+		annotationKeyPrefix         string
+		migrateLegacyAnnotationKeys bool
+
+		collectOrphanedRunners bool
+		orphanedRunnerAge      time.Duration
+
+		checkRunnerStateDrift         bool
+		runnerStateDriftCheckInterval time.Duration
+
+		deletionStrategy string
+
+		unregistrationQuietHours         string
+		unregistrationQuietHoursTimeZone string
+
+		gitHubConnectivityCheckInterval         time.Duration
+		gitHubConnectivityCheckFailureThreshold int
 	)
 
 	var c github.Config
@@ -93,7 +147,19 @@ func main() {
 		os.Exit(1)
 	}
 
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	if c.ListRunnersCacheTTL == 0 {
+		c.ListRunnersCacheTTL = defaultListRunnersCacheTTL
+	}
+
+	var fallback github.Credential
+	err = envconfig.Process("github_fallback", &fallback)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: processing environment variables: %v\n", err)
+		os.Exit(1)
+	}
+
+	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to. The /draining-runners endpoint on the same address lists the runner pods in graceful stop as JSON.")
+	flag.StringVar(&healthProbeAddr, "health-probe-addr", ":8081", "The address the health probe endpoint binds to. The /healthz endpoint reports unhealthy when the controller can't reach GitHub API.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&leaderElectionId, "leader-election-id", "actions-runner-controller", "Controller id for leader election.")
@@ -109,11 +175,54 @@ func main() {
 	flag.StringVar(&c.UploadURL, "github-upload-url", c.UploadURL, "GitHub Upload URL to be used for GitHub API calls")
 	flag.StringVar(&c.BasicauthUsername, "github-basicauth-username", c.BasicauthUsername, "Username for GitHub basic auth to use instead of PAT or GitHub APP in case it's running behind a proxy API")
 	flag.StringVar(&c.BasicauthPassword, "github-basicauth-password", c.BasicauthPassword, "Password for GitHub basic auth to use instead of PAT or GitHub APP in case it's running behind a proxy API")
+	flag.IntVar(&c.CircuitBreakerFailureThreshold, "github-circuit-breaker-failure-threshold", c.CircuitBreakerFailureThreshold, fmt.Sprintf("The number of consecutive GitHub API requests failed with a network error, a timeout, or a 5xx response within --github-circuit-breaker-window, after which the controller stops calling GitHub API for --github-circuit-breaker-cooldown, so that a GitHub outage doesn't make every reconciliation keep calling GitHub API. Defaults to %d. Set to a negative value to disable the circuit breaker", github.DefaultCircuitBreakerFailureThreshold))
+	flag.DurationVar(&c.CircuitBreakerWindow, "github-circuit-breaker-window", c.CircuitBreakerWindow, fmt.Sprintf("The window the consecutive failed GitHub API requests need to happen within to open the circuit breaker. Defaults to %s", github.DefaultCircuitBreakerWindow))
+	flag.DurationVar(&c.CircuitBreakerCooldown, "github-circuit-breaker-cooldown", c.CircuitBreakerCooldown, fmt.Sprintf("The duration the circuit breaker stays open before letting a GitHub API request through to see if GitHub is back. Defaults to %s", github.DefaultCircuitBreakerCooldown))
+	flag.StringVar(&fallback.Token, "github-fallback-token", fallback.Token, "The personal access token of GitHub the controller fails over to when GitHub rejects the primary credential, like when the private key of the GitHub App is revoked.")
+	flag.Int64Var(&fallback.AppID, "github-fallback-app-id", fallback.AppID, "The application ID of GitHub App the controller fails over to when GitHub rejects the primary credential.")
+	flag.Int64Var(&fallback.AppInstallationID, "github-fallback-app-installation-id", fallback.AppInstallationID, "The installation ID of GitHub App the controller fails over to when GitHub rejects the primary credential.")
+	flag.StringVar(&fallback.AppPrivateKey, "github-fallback-app-private-key", fallback.AppPrivateKey, "The path of a private key file of GitHub App the controller fails over to when GitHub rejects the primary credential. This can be another key of the same GitHub App, so that revoking one key doesn't stall the controller")
 	flag.StringVar(&c.RunnerGitHubURL, "runner-github-url", c.RunnerGitHubURL, "GitHub URL to be used by runners during registration")
+	flag.DurationVar(&c.ListRunnersCacheTTL, "github-list-runners-cache-ttl", c.ListRunnersCacheTTL, "The duration the controller caches ListRunners API responses per enterprise, organization, or repository, so that many runners in the same scope don't result in redundant API calls. Set to a negative value to disable the cache")
+	flag.BoolVar(&c.ListRunnersRevalidate, "github-list-runners-revalidate", c.ListRunnersRevalidate, "Revalidate cached ListRunners API responses with conditional requests on every API call, instead of trusting them for the max-age GitHub specifies, usually 60s. This reduces the chance of acting on a stale busy status of a runner. Conditional requests answered with 304 Not Modified don't count against the rate limit")
+	flag.DurationVar(&c.RequestTimeout, "github-request-timeout", github.DefaultRequestTimeout, "The timeout of each GitHub API request, so that a hung connection doesn't stall a reconciliation. Set to a negative value to disable the timeout")
+	flag.DurationVar(&c.RateLimitRetryDelay, "github-rate-limit-retry-delay", c.RateLimitRetryDelay, "The delay before retrying a GitHub API call that failed due to the rate limit, used only when GitHub doesn't tell when the rate limit resets. Defaults to 30s")
 	flag.DurationVar(&gitHubAPICacheDuration, "github-api-cache-duration", 0, "DEPRECATED: The duration until the GitHub API cache expires. Setting this to e.g. 10m results in the controller tries its best not to make the same API call within 10m to reduce the chance of being rate-limited. Defaults to mostly the same value as sync-period. If you're tweaking this in order to make autoscaling more responsive, you'll probably want to tweak sync-period, too")
 	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Minute, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled. When you use autoscaling, set to a lower value like 10 minute, because this corresponds to the minimum time to react on demand change.")
 	flag.Var(&commonRunnerLabels, "common-runner-labels", "Runner labels in the K1=V1,K2=V2,... format that are inherited all the runners created by the controller. See https://github.com/actions-runner-controller/actions-runner-controller/issues/321 for more information")
 	flag.StringVar(&namespace, "watch-namespace", "", "The namespace to watch for custom resources. Set to empty for letting it watch for all namespaces.")
+	flag.DurationVar(&registrationGracePeriod, "registration-grace-period", 0, fmt.Sprintf("The duration since a runner pod creation within which the controller waits for the runner to be registered before unregistering and deleting the runner pod. This prevents the controller from deleting a runner pod that GitHub is about to schedule a workflow job onto. Defaults to the 95th percentile of how long recent runners took to register plus a margin, or %s until enough runners have registered. Set this to use a fixed grace period instead", controllers.DefaultRegistrationGracePeriod))
+	flag.DurationVar(&registrationRecheckInterval, "registration-recheck-interval", controllers.DefaultRegistrationRecheckInterval, "The delay until the controller rechecks the registration of a runner that isn't seen on GitHub yet.")
+	flag.DurationVar(&maxRegistrationWait, "max-registration-wait", controllers.DefaultMaxRegistrationWait, "The duration since the first registration check of a runner pod after which the controller considers the runner is genuinely absent on GitHub and stops waiting for it to be registered.")
+	flag.StringVar(&retryableGitHubStatusCodes, "retryable-github-status-codes", "429,500,502,503,504", "The comma-separated HTTP status codes of failed runner unregistrations that the controller retries with backoff, as they are usually transient. Useful when e.g. a proxy in front of GitHub Enterprise Server responds with 408.")
+	flag.DurationVar(&gitHubAPITimeout, "github-api-timeout", controllers.DefaultGitHubAPITimeout, "The timeout of each GitHub API call made while checking runner registrations and unregistering runners.")
+	flag.IntVar(&maxUnregistrationAttempts, "max-unregistration-attempts", controllers.DefaultMaxUnregistrationAttempts, "The number of failed runner unregistration attempts, excluding ones failed due to GitHub API rate limits or the runner being busy, after which the controller gives up unregistering the runner and deletes the runner pod anyway.")
+	flag.Float64Var(&unregistrationWarnThreshold, "unregistration-timeout-warning-threshold", controllers.DefaultUnregistrationTimeoutWarningThreshold, "The fraction of the unregistration timeout after which the controller emits a one-time warning event for a runner that is still being unregistered, so that operators can intervene before the runner pod is deleted. Set to 1 or more to disable the warning.")
+	flag.StringVar(&drainReadinessGate, "drain-readiness-gate", "", "The condition type of the readiness gate the controller sets to False on the start of the graceful stop of a runner pod, before unregistering the runner, so that external systems like load balancers can react to the drain. Only runner pods that declare the readiness gate in spec.readinessGates are affected. Empty disables it.")
+	flag.StringVar(&blockStopCondition, "block-stop-condition", "", "The type of the pod condition a supervisor in the runner pod sets to True while it's unsafe to stop the runner pod, like while it's uploading artifacts. A runner pod whose unregistration has timed out isn't deleted while the condition is True, up to --max-block-stop-duration past the unregistration timeout. Empty disables it.")
+	flag.DurationVar(&maxBlockStopDuration, "max-block-stop-duration", controllers.DefaultMaxBlockStopDuration, "The hard cap of how long the condition specified by --block-stop-condition can delay the deletion of a runner pod past its unregistration timeout")
+	flag.IntVar(&maxConcurrentUnregistrations, "max-concurrent-unregistrations", 0, "The maximum number of runner unregistrations, that is GitHub's RemoveRunner API calls, in flight at once controller-wide. Runner pods that exceed the limit are requeued shortly. Set to 0 for no limit. This also bounds the number of concurrent RemoveRunner calls made while unregistering all the runners of a deleted RunnerDeployment in bulk, which defaults to 10")
+	flag.BoolVar(&verifyRunnerID, "verify-runner-id", false, "When true, the controller gets the runner by the runner ID recorded for a runner pod and confirms it has the expected name before unregistering it, so that a runner ID reassigned to another runner, like after a GHES restore, doesn't make the controller remove the wrong runner. This costs an extra GitHub API call per unregistration")
+	flag.BoolVar(&onlyUnregisterOfflineRunners, "only-unregister-offline-runners", false, "When true, the controller unregisters a non-ephemeral runner only after GitHub reports it offline or its runner container has stopped, keeping an online and idle runner as it might pick up a job. The runner pod isn't deleted until then. Ephemeral runners are unaffected")
+	flag.DurationVar(&offlineRunnerGracePeriod, "offline-runner-grace-period", 0, "The duration a runner needs to be seen offline on GitHub while being unregistered, after which the controller deletes its runner pod even if GitHub still reports the runner busy, like when the node running the runner pod was killed in the middle of a job. Zero disables it, in which case such a runner pod is deleted only on the unregistration timeout")
+	flag.DurationVar(&unregistrationProgressLogInterval, "unregistration-progress-log-interval", controllers.DefaultUnregistrationProgressLogInterval, "The minimum interval between two logs of the in-progress unregistration of each runner pod. The unregistration is still retried at the usual retry delay. Set to 0 to log on every retry")
+	flag.DurationVar(&gracefulStopSyncPeriod, "graceful-stop-sync-period", controllers.DefaultGracefulStopSyncPeriod, "The delay until the controller reconciles a runner pod in graceful stop again when nothing else requeues it, so that the graceful stop and its timeouts are re-evaluated even when no Kubernetes event fires for the runner pod. It never shortens the retry delays of the unregistration, so it doesn't add GitHub API calls to an unregistration in progress. Set to 0 to disable")
+	flag.DurationVar(&shutdownDrainGracePeriod, "shutdown-drain-grace-period", 0, "The time the controller spends on a final pass of the runner unregistrations in progress when it's shutting down, like on SIGTERM, so that a controller restart during a scale-down leaves fewer runners behind. The terminationGracePeriodSeconds of the controller pod needs to be longer than this. Set to 0 to disable")
+	flag.DurationVar(&deletionVerificationTimeout, "deletion-verification-timeout", 0, "The time a runner pod is given to be deleted once its runner has been unregistered. A runner pod still around after this, like when its deletion is blocked by a finalizer or missing RBAC permissions, is reported via a log and a metric, and its registration state is reset so that it's tracked afresh once the runner registers itself again. ARC doesn't re-register the runner by itself. Set to 0 to disable")
+	flag.DurationVar(&preStopGracePeriod, "pre-stop-grace-period", 0, "The additional time given to the preStop hook of the runner container, if any, before a runner pod stuck in termination is forcefully deleted with a zero grace period. Can be overridden per runner pod with the actions-runner-controller/pre-stop-grace-period annotation, like via the pod template of a RunnerDeployment")
+	flag.BoolVar(&unregistrationDryRun, "unregistration-dry-run", false, "When true, the controller logs runners it would unregister without actually calling GitHub's RemoveRunner API. Runner pods are still deleted. Useful for validating scale-down behaviors in a staging environment")
+	flag.Float64Var(&requeueJitter, "requeue-jitter", 0.2, "The fraction of the randomized jitter added to requeue delays of runner pod registration and unregistration, so that many runners reconciled at once don't spike GitHub API usage at the same instant. For example, 0.2 results in delays of ±20%. Set to 0 to disable the jitter")
+	flag.StringVar(&annotationKeyPrefix, "annotation-key-prefix", controllers.DefaultAnnotationKeyPrefix, "The prefix of the annotation keys the controller uses to record the state of runner pods. Must end with a slash. Set a different value to each controller when you run multiple controllers, like a canary one alongside the stable one, so that their annotations don't collide")
+	flag.BoolVar(&migrateLegacyAnnotationKeys, "migrate-legacy-annotation-keys", false, "When true, the controller copies the annotations with the default prefix to the prefix of --annotation-key-prefix, once per runner pod, so that runner pods annotated before the prefix change keep working. Enable it only when no controller with the default prefix manages the same runner pods. Has no effect with the default prefix")
+	flag.BoolVar(&collectOrphanedRunners, "collect-orphaned-runners", false, "When true, the controller periodically removes offline runners that are registered to GitHub but have no runner pod. This mutates GitHub state and removes any such runner in enterprises, organizations, and repositories that have runner pods, including ones not managed by the controller")
+	flag.DurationVar(&gitHubConnectivityCheckInterval, "github-connectivity-check-interval", github.DefaultConnectivityCheckInterval, "The interval between two GitHub API connectivity checks that back the /healthz endpoint.")
+	flag.IntVar(&gitHubConnectivityCheckFailureThreshold, "github-connectivity-check-failure-threshold", github.DefaultConnectivityCheckFailureThreshold, "The number of consecutive failed GitHub API connectivity checks after which the /healthz endpoint reports unhealthy.")
+	flag.DurationVar(&orphanedRunnerAge, "orphaned-runner-age", controllers.DefaultOrphanedRunnerAge, "The duration a runner needs to be seen offline without a runner pod before the controller removes it. Used only when --collect-orphaned-runners is true")
+	flag.BoolVar(&checkRunnerStateDrift, "check-runner-state-drift", false, "When true, the controller periodically compares the runner ID recorded in each runner pod with the runner on GitHub, and reports inconsistencies via events, logs, and the arc_runner_state_drift_total metric without changing anything. Useful to diagnose GitHub Enterprise Server problems or runner name collisions")
+	flag.DurationVar(&runnerStateDriftCheckInterval, "runner-state-drift-check-interval", controllers.DefaultRunnerStateDriftCheckInterval, "The interval between two runner state drift checks. Used only when --check-runner-state-drift is true")
+	flag.StringVar(&deletionStrategy, "deletion-strategy", controllers.DeletionStrategyDelete, fmt.Sprintf("How a runner pod is torn down once its runner is unregistered. %q leaves the runner pod to be deleted along with its owner. %q evicts the runner pod, respecting PodDisruptionBudgets. %q cordons the node of the runner pod before the runner pod is deleted along with its owner", controllers.DeletionStrategyDelete, controllers.DeletionStrategyEvict, controllers.DeletionStrategyCordon))
+	flag.StringVar(&unregistrationQuietHours, "unregistration-quiet-hours", "", `The semicolon-separated list of recurring time windows in the "[DAYS ]HH:MM-HH:MM" format, like "Mon-Fri 22:00-06:00;Sat,Sun 00:00-00:00", during which the unregistration of non-ephemeral runners is deferred until the window ends. Ephemeral runners are unaffected. Defaults to no quiet hours`)
+	flag.StringVar(&unregistrationQuietHoursTimeZone, "unregistration-quiet-hours-time-zone", "UTC", "The IANA time zone name, like America/New_York, the times of --unregistration-quiet-hours are interpreted in")
 	flag.StringVar(&logLevel, "log-level", logging.LogLevelDebug, `The verbosity of the logging. Valid values are "debug", "info", "warn", "error". Defaults to "debug".`)
 	flag.Parse()
 
@@ -121,6 +230,25 @@ func main() {
 
 	c.Log = &logger
 
+	if !fallback.IsZero() {
+		c.FallbackCredentials = append(c.FallbackCredentials, fallback)
+	}
+
+	if err := controllers.ValidateAnnotationKeyPrefix(annotationKeyPrefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --annotation-key-prefix: %v\n", err)
+		os.Exit(1)
+	}
+	controllers.SetAnnotationKeyPrefix(annotationKeyPrefix)
+	if migrateLegacyAnnotationKeys {
+		controllers.EnableLegacyAnnotationKeyMigration()
+	}
+
+	retryableStatusCodes, err := controllers.ParseStatusCodes(retryableGitHubStatusCodes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --retryable-github-status-codes: %v\n", err)
+		os.Exit(1)
+	}
+
 	ghClient, err = c.NewClient()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error: Client creation failed.", err)
@@ -129,14 +257,23 @@ func main() {
 
 	ctrl.SetLogger(logger)
 
+	// The manager waits for the final pass of unregistrations on shutdown only within the graceful shutdown timeout.
+	gracefulShutdownTimeout := defaultGracefulShutdownTimeout
+	if d := shutdownDrainGracePeriod + gracefulShutdownTimeoutMargin; d > gracefulShutdownTimeout {
+		gracefulShutdownTimeout = d
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   leaderElectionId,
-		Port:               9443,
-		SyncPeriod:         &syncPeriod,
-		Namespace:          namespace,
+		Scheme:                 scheme,
+		MetricsBindAddress:     metricsAddr,
+		HealthProbeBindAddress: healthProbeAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       leaderElectionId,
+		Port:                   9443,
+		SyncPeriod:             &syncPeriod,
+		Namespace:              namespace,
+
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		log.Error(err, "unable to start manager")
@@ -145,6 +282,7 @@ func main() {
 
 	runnerReconciler := &controllers.RunnerReconciler{
 		Client:               mgr.GetClient(),
+		APIReader:            mgr.GetAPIReader(),
 		Log:                  log.WithName("runner"),
 		Scheme:               mgr.GetScheme(),
 		GitHubClient:         ghClient,
@@ -153,6 +291,9 @@ func main() {
 		// Defaults for self-hosted runner containers
 		RunnerImage:            runnerImage,
 		RunnerImagePullSecrets: runnerImagePullSecrets,
+
+		UnregistrationDryRun:          unregistrationDryRun,
+		BulkUnregistrationConcurrency: maxConcurrentUnregistrations,
 	}
 
 	if err = runnerReconciler.SetupWithManager(mgr); err != nil {
@@ -165,6 +306,8 @@ func main() {
 		Log:          log.WithName("runnerreplicaset"),
 		Scheme:       mgr.GetScheme(),
 		GitHubClient: ghClient,
+
+		WaitForRunnerPodEviction: deletionStrategy == controllers.DeletionStrategyEvict,
 	}
 
 	if err = runnerReplicaSetReconciler.SetupWithManager(mgr); err != nil {
@@ -195,6 +338,8 @@ func main() {
 		// Defaults for self-hosted runner containers
 		RunnerImage:            runnerImage,
 		RunnerImagePullSecrets: runnerImagePullSecrets,
+
+		WaitForRunnerPodEviction: deletionStrategy == controllers.DeletionStrategyEvict,
 	}
 
 	if err = runnerSetReconciler.SetupWithManager(mgr); err != nil {
@@ -227,11 +372,64 @@ func main() {
 		CacheDuration: gitHubAPICacheDuration,
 	}
 
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "unable to create kubernetes clientset")
+		os.Exit(1)
+	}
+
+	quietHoursLocation, err := time.LoadLocation(unregistrationQuietHoursTimeZone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --unregistration-quiet-hours-time-zone: %v\n", err)
+		os.Exit(1)
+	}
+
+	quietHours, err := controllers.ParseQuietHours(unregistrationQuietHours, quietHoursLocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --unregistration-quiet-hours: %v\n", err)
+		os.Exit(1)
+	}
+
+	podDeletionStrategy, err := controllers.NewDeletionStrategy(deletionStrategy, clientset)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --deletion-strategy: %v\n", err)
+		os.Exit(1)
+	}
+
 	runnerPodReconciler := &controllers.RunnerPodReconciler{
-		Client:       mgr.GetClient(),
-		Log:          log.WithName("runnerpod"),
-		Scheme:       mgr.GetScheme(),
-		GitHubClient: ghClient,
+		Client:                  mgr.GetClient(),
+		APIReader:               mgr.GetAPIReader(),
+		Log:                     log.WithName("runnerpod"),
+		Scheme:                  mgr.GetScheme(),
+		GitHubClient:            ghClient,
+		RegistrationGracePeriod: registrationGracePeriod,
+
+		RegistrationRecheckInterval: registrationRecheckInterval,
+		MaxRegistrationWait:         maxRegistrationWait,
+		RequeueJitter:               requeueJitter,
+		GitHubAPITimeout:            gitHubAPITimeout,
+		RetryableGitHubStatusCodes:  retryableStatusCodes,
+		UnregistrationDryRun:        unregistrationDryRun,
+
+		OnlyUnregisterOfflineRunners: onlyUnregisterOfflineRunners,
+		OfflineRunnerGracePeriod:     offlineRunnerGracePeriod,
+		VerifyRunnerID:               verifyRunnerID,
+
+		UnregistrationProgressLogInterval: unregistrationProgressLogInterval,
+		PreStopGracePeriod:                preStopGracePeriod,
+		GracefulStopSyncPeriod:            gracefulStopSyncPeriod,
+		ShutdownDrainGracePeriod:          shutdownDrainGracePeriod,
+		DeletionVerificationTimeout:       deletionVerificationTimeout,
+
+		MaxUnregistrationAttempts:    maxUnregistrationAttempts,
+		MaxConcurrentUnregistrations: maxConcurrentUnregistrations,
+		DeletionStrategy:             podDeletionStrategy,
+		UnregistrationQuietHours:     quietHours,
+
+		UnregistrationTimeoutWarningThreshold: unregistrationWarnThreshold,
+		DrainReadinessGateConditionType:       drainReadinessGate,
+		BlockStopConditionType:                blockStopCondition,
+		MaxBlockStopDuration:                  maxBlockStopDuration,
 	}
 
 	if err = runnerPodReconciler.SetupWithManager(mgr); err != nil {
@@ -239,6 +437,62 @@ func main() {
 		os.Exit(1)
 	}
 
+	if collectOrphanedRunners {
+		orphanedRunnerReconciler := &controllers.OrphanedRunnerReconciler{
+			Client:            mgr.GetClient(),
+			Log:               log.WithName("orphanedrunner"),
+			GitHubClient:      ghClient,
+			OrphanedRunnerAge: orphanedRunnerAge,
+			DryRun:            unregistrationDryRun,
+		}
+
+		if err = orphanedRunnerReconciler.SetupWithManager(mgr); err != nil {
+			log.Error(err, "unable to create controller", "controller", "OrphanedRunner")
+			os.Exit(1)
+		}
+	}
+
+	if checkRunnerStateDrift {
+		runnerStateDriftReconciler := &controllers.RunnerStateDriftReconciler{
+			Client:       mgr.GetClient(),
+			Log:          log.WithName("runnerstatedrift"),
+			GitHubClient: ghClient,
+			Interval:     runnerStateDriftCheckInterval,
+		}
+
+		if err = runnerStateDriftReconciler.SetupWithManager(mgr); err != nil {
+			log.Error(err, "unable to create controller", "controller", "RunnerStateDrift")
+			os.Exit(1)
+		}
+	}
+
+	gitHubConnectivityChecker := &github.ConnectivityChecker{
+		Client:           ghClient,
+		Log:              log.WithName("githubconnectivity"),
+		Interval:         gitHubConnectivityCheckInterval,
+		FailureThreshold: gitHubConnectivityCheckFailureThreshold,
+	}
+
+	if err = mgr.Add(gitHubConnectivityChecker); err != nil {
+		log.Error(err, "unable to set up GitHub API connectivity check")
+		os.Exit(1)
+	}
+
+	if err = mgr.AddHealthzCheck("github-api", gitHubConnectivityChecker.Check); err != nil {
+		log.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+
+	drainingRunnersHandler := &controllers.DrainingRunnersHandler{
+		Client: mgr.GetClient(),
+		Log:    log.WithName("drainingrunners"),
+	}
+
+	if err = mgr.AddMetricsExtraHandler(controllers.DrainingRunnersPath, drainingRunnersHandler); err != nil {
+		log.Error(err, "unable to set up the draining runners endpoint")
+		os.Exit(1)
+	}
+
 	if err = horizontalRunnerAutoscaler.SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "HorizontalRunnerAutoscaler")
 		os.Exit(1)
@@ -61,8 +61,8 @@ else
   exit 1
 fi
 
-if [ -z "${RUNNER_TOKEN}" ]; then
-  error "RUNNER_TOKEN must be set"
+if [ -z "${RUNNER_TOKEN}" ] && [ -z "${RUNNER_JIT_CONFIG}" ]; then
+  error "RUNNER_TOKEN or RUNNER_JIT_CONFIG must be set"
   exit 1
 fi
 
@@ -97,6 +97,18 @@ if [ "${DISABLE_RUNNER_UPDATE:-}" == "true" ]; then
 fi
 
 retries_left=10
+if [ "${RUNNER_EPHEMERAL}" == "false" ] && [ -f .runner ]; then
+  # The runner container has been restarted within a reused runner pod, whose runner is still registered.
+  # Note that the registration token can have expired by now, so we don't try to configure the runner again.
+  log "Runner is already configured. Reusing the existing registration."
+  retries_left=0
+fi
+if [ -n "${RUNNER_JIT_CONFIG}" ]; then
+  # The runner has already been registered by actions-runner-controller and the JIT config is passed to the runner on start,
+  # so config.sh is never run.
+  log "Runner has a JIT config. Skipping the configuration."
+  retries_left=0
+fi
 while [[ ${retries_left} -gt 0 ]]; do
   log "Configuring the runner."
   ./config.sh --unattended --replace \
@@ -117,13 +129,13 @@ while [[ ${retries_left} -gt 0 ]]; do
   sleep 1
 done
 
-if [ ! -f .runner ]; then
+if [ ! -f .runner ] && [ -z "${RUNNER_JIT_CONFIG}" ]; then
   # we couldn't configure and register the runner; no point continuing
   error "Configuration failed!"
   exit 2
 fi
 
-cat .runner
+[ -f .runner ] && cat .runner
 # Note: the `.runner` file's content should be something like the below:
 #
 # $ cat /runner/.runner
@@ -163,10 +175,13 @@ if [ -z "${UNITTEST:-}" ]; then
 fi
 
 args=()
-if [ "${RUNNER_FEATURE_FLAG_EPHEMERAL:-}" != "true" -a "${RUNNER_EPHEMERAL}" != "false" ]; then
+if [ -n "${RUNNER_JIT_CONFIG}" ]; then
+  args+=(--jitconfig "${RUNNER_JIT_CONFIG}")
+  echo "Passing --jitconfig to runsvc.sh to run the JIT runner."
+elif [ "${RUNNER_FEATURE_FLAG_EPHEMERAL:-}" != "true" -a "${RUNNER_EPHEMERAL}" != "false" ]; then
   args+=(--once)
   echo "Passing --once to runsvc.sh to enable the legacy ephemeral runner."
 fi
 
-unset RUNNER_NAME RUNNER_REPO RUNNER_TOKEN
+unset RUNNER_NAME RUNNER_REPO RUNNER_TOKEN RUNNER_JIT_CONFIG
 exec ./bin/runsvc.sh "${args[@]}"